@@ -21,14 +21,14 @@ export default function Gallery() {
   useEffect(() => {
     const fetchFeaturedWorks = async () => {
       try {
-        const response = await fetch("http://37.27.210.128:8080/api/photos/featured")
+        const response = await fetch("http://37.27.210.128:8080/api/photos/featured?pageSize=100")
 
         if (!response.ok) {
           throw new Error("Failed to fetch featured works")
         }
 
         const data = await response.json()
-        setFeaturedWorks(data.data || [])
+        setFeaturedWorks(data.data?.items || [])
       } catch (error) {
         console.error("Error fetching featured works:", error)
         // Fallback to default images if API fails
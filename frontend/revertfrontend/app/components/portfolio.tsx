@@ -28,9 +28,9 @@ export default function Portfolio() {
         const fetchPromises = categories
           .filter((cat) => cat !== "all")
           .map((category) =>
-            fetch(`http://37.27.210.128:8080/api/photos/${category}`)
+            fetch(`http://37.27.210.128:8080/api/photos/${category}?pageSize=100`)
               .then((res) => res.json())
-              .then((data) => data.data || []),
+              .then((data) => data.data?.items || []),
           )
 
         const results = await Promise.all(fetchPromises)
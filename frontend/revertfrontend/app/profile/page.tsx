@@ -89,7 +89,7 @@ export default function AdminDashboard() {
     if (!token) return
 
     try {
-      const response = await fetch(`http://37.27.210.128:8080/api/photos/${category}`, {
+      const response = await fetch(`http://37.27.210.128:8080/api/photos/${category}?pageSize=100`, {
         headers: {
           Authorization: `Bearer ${token}`,
         },
@@ -100,7 +100,7 @@ export default function AdminDashboard() {
       }
 
       const data = await response.json()
-      setPhotos(data.data || [])
+      setPhotos(data.data?.items || [])
     } catch (error) {
       console.error("Error fetching photos:", error)
     }
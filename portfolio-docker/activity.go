@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// ActivityEntry is one action from a user's audit log
+type ActivityEntry struct {
+	ID         int64  `json:"id"`
+	Action     string `json:"action"`
+	TargetType string `json:"targetType"`
+	TargetID   string `json:"targetId"`
+	// Photo's current title, or its title at the time for a deleted photo
+	PhotoTitle string `json:"photoTitle,omitempty"`
+	Details    string `json:"details,omitempty"`
+	CreatedAt  string `json:"createdAt,omitempty"`
+}
+
+// Record an action on a photo in the audit log. The photo's title is kept
+// as the details, so the entry still reads well once the photo is gone. The
+// action has already happened by now, so a failure is logged rather than
+// returned.
+func auditPhotoAction(ctx context.Context, actorID int64, action, photoID, title string) {
+	err := execWithRetry(ctx, func() error {
+		return queries.CreateAuditLogEntry(ctx, db.CreateAuditLogEntryParams{
+			ActorID:    actorID,
+			Action:     action,
+			TargetType: "photo",
+			TargetID:   photoID,
+			Details:    title,
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to write audit log entry", "action", action, "photo_id", photoID, "error", err)
+	}
+}
+
+// List the authenticated user's own recent actions, newest first
+func activityHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+	ctx := requestContext(r)
+
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	total, err := queries.CountAuditLogByActor(ctx, userID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	rows, err := queries.ListAuditLogByActor(ctx, db.ListAuditLogByActorParams{
+		ActorID: userID,
+		Limit:   int64(pageSize),
+		Offset:  pageOffset(page, pageSize),
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	entries := []ActivityEntry{}
+	for _, row := range rows {
+		entry := ActivityEntry{
+			ID:         row.ID,
+			Action:     row.Action,
+			TargetType: row.TargetType,
+			TargetID:   row.TargetID,
+			Details:    row.Details,
+		}
+		if row.TargetType == "photo" {
+			entry.PhotoTitle, entry.Details = row.Details, ""
+			if row.PhotoTitle.Valid {
+				entry.PhotoTitle = row.PhotoTitle.String
+			}
+		}
+		if row.CreatedAt.Valid {
+			entry.CreatedAt = formatTimestamp(row.CreatedAt.Time)
+		}
+		entries = append(entries, entry)
+	}
+
+	setPaginationHeaders(w, r, page, pageSize, total)
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    newPaginatedResponse(entries, page, pageSize, total),
+	})
+}
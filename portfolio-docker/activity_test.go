@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+type activityPage struct {
+	Items   []ActivityEntry `json:"items"`
+	Total   int64           `json:"total"`
+	HasMore bool            `json:"hasMore"`
+}
+
+func TestActivityFeed(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	kept := uploadTestPhoto(t, user.token, "photography")
+	deleted := uploadTestPhoto(t, user.token, "photography")
+	uploadTestPhoto(t, other.token, "photography")
+	title := "Renamed"
+	rec := doJSON(t, "PATCH", "/api/photos/"+kept.ID, user.token, PhotoUpdate{Title: &title})
+	expectStatus(t, rec, http.StatusOK)
+	rec = doJSON(t, "DELETE", "/api/photos/"+deleted.ID, user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = doJSON(t, "GET", "/api/profile/activity", user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var page activityPage
+	decodeResponse(t, rec, &page)
+
+	// Newest first, with the photo's current title, or its last one once
+	// deleted
+	want := []ActivityEntry{
+		{Action: "delete", TargetID: deleted.ID, PhotoTitle: "Test photo"},
+		{Action: "update", TargetID: kept.ID, PhotoTitle: "Renamed"},
+		{Action: "upload", TargetID: deleted.ID, PhotoTitle: "Test photo"},
+		{Action: "upload", TargetID: kept.ID, PhotoTitle: "Renamed"},
+	}
+	if page.Total != int64(len(want)) || len(page.Items) != len(want) {
+		t.Fatalf("got %d of %d entries, want only the user's %d", len(page.Items), page.Total, len(want))
+	}
+	for i, entry := range page.Items {
+		if entry.Action != want[i].Action || entry.TargetID != want[i].TargetID || entry.PhotoTitle != want[i].PhotoTitle {
+			t.Errorf("entry %d = %s %s %q, want %s %s %q", i, entry.Action, entry.TargetID, entry.PhotoTitle, want[i].Action, want[i].TargetID, want[i].PhotoTitle)
+		}
+		if entry.TargetType != "photo" || entry.CreatedAt == "" {
+			t.Errorf("entry %d = %+v, want a dated photo entry", i, entry)
+		}
+	}
+
+	rec = doJSON(t, "GET", "/api/profile/activity?pageSize=3", user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	decodeResponse(t, rec, &page)
+	if len(page.Items) != 3 || !page.HasMore {
+		t.Errorf("got %d entries, hasMore %v; want 3 with more", len(page.Items), page.HasMore)
+	}
+
+	expectStatus(t, doJSON(t, "GET", "/api/profile/activity", "", nil), http.StatusUnauthorized)
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// JWT signing settings. JWT_KEYS is a comma-separated list of kid:secret
+// pairs; tokens are signed with JWT_CURRENT_KID and accepted when signed by
+// any listed key, so a secret is rotated by adding the new key, switching
+// JWT_CURRENT_KID, and removing the old key once its tokens have expired.
+// Without JWT_KEYS, JWT_SECRET_KEY is used and tokens carry no kid.
+var (
+	jwtSigningAlg = getEnv("JWT_SIGNING_ALG", "HS256")
+	jwtKeys       = parseJWTKeys(getEnv("JWT_KEYS", ""))
+	jwtCurrentKID = getEnv("JWT_CURRENT_KID", "")
+	// Tolerance for clock skew when checking a token's exp and nbf
+	jwtLeeway = getEnvDuration("JWT_LEEWAY", time.Minute)
+)
+
+func parseJWTKeys(value string) map[string][]byte {
+	keys := map[string][]byte{}
+	if value == "" {
+		return keys
+	}
+	for _, pair := range strings.Split(value, ",") {
+		kid, secret, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || kid == "" || secret == "" {
+			log.Fatalf("Invalid value for JWT_KEYS: expected kid:secret pairs")
+		}
+		keys[kid] = []byte(secret)
+	}
+	return keys
+}
+
+// Check the JWT settings at startup so a bad rotation fails fast
+func validateJWTConfig() {
+	if _, ok := jwt.GetSigningMethod(jwtSigningAlg).(*jwt.SigningMethodHMAC); !ok {
+		log.Fatalf("Invalid value for JWT_SIGNING_ALG: %q (use HS256, HS384 or HS512)", jwtSigningAlg)
+	}
+	if len(jwtKeys) == 0 {
+		return
+	}
+	if jwtCurrentKID == "" {
+		log.Fatal("JWT_CURRENT_KID is required when JWT_KEYS is set")
+	}
+	if _, ok := jwtKeys[jwtCurrentKID]; !ok {
+		log.Fatalf("JWT_CURRENT_KID %q is not listed in JWT_KEYS", jwtCurrentKID)
+	}
+}
+
+// Claims are the claims of the tokens the server issues, used for both
+// signing and parsing
+type Claims struct {
+	UserID *int64 `json:"user_id"`
+	Email  string `json:"email,omitempty"`
+	// Role when the token was issued, for clients. Access checks read the
+	// current role instead, so a demotion applies to live tokens.
+	Role         string `json:"role,omitempty"`
+	TokenVersion int64  `json:"token_version"` // Absent in tokens predating versioning
+	// Admin who issued the token when it's for impersonation
+	Act *TokenActor `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// TokenActor identifies who is acting through an impersonation token, as in
+// RFC 8693's act claim
+type TokenActor struct {
+	Sub string `json:"sub"`
+}
+
+// Reject tokens without a user, after the parser has checked the registered
+// claims
+func (c *Claims) Validate() error {
+	if c.UserID == nil || *c.UserID <= 0 {
+		return errors.New("token has no valid user_id")
+	}
+	return nil
+}
+
+// Parse and validate a token: its signature, algorithm and registered
+// claims, with exp required and JWT_LEEWAY of tolerance for clock skew
+func parseJWT(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, jwtKeyFunc,
+		jwt.WithValidMethods([]string{jwtSigningAlg}),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(jwtLeeway),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Sign claims with the configured algorithm and current key
+func signJWT(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(jwtSigningAlg), claims)
+	if len(jwtKeys) == 0 {
+		return token.SignedString(jwtKey)
+	}
+	token.Header["kid"] = jwtCurrentKID
+	return token.SignedString(jwtKeys[jwtCurrentKID])
+}
+
+// Select the verification key for a token by its kid header. Tokens without
+// a kid predate key rotation and are checked against JWT_SECRET_KEY.
+func jwtKeyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		if len(jwtKey) == 0 {
+			return nil, fmt.Errorf("token has no kid")
+		}
+		return jwtKey, nil
+	}
+	key, ok := jwtKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// TokenInfo is the validated content of the caller's token, so clients never
+// need to decode it themselves
+type TokenInfo struct {
+	UserID    int64  `json:"userId"`
+	Email     string `json:"email"`
+	Role      string `json:"role"` // Current role, which may differ from the token's
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	ExpiresIn int64  `json:"expiresIn,omitempty"` // Seconds
+	// Admin who issued the token when it's for impersonation
+	ImpersonatedBy *int64 `json:"impersonatedBy,omitempty"`
+}
+
+// Describe the bearer token, which authMiddleware has already validated
+func tokenInfoHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+	claims := r.Context().Value("tokenClaims").(*Claims)
+
+	role, err := queries.GetUserRole(requestContext(r), userID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	info := TokenInfo{
+		UserID: userID,
+		Email:  claims.Email,
+		Role:   role,
+	}
+	if expiresAt, ok := r.Context().Value("tokenExpiresAt").(time.Time); ok {
+		info.ExpiresAt = formatTimestamp(expiresAt)
+		info.ExpiresIn = int64(time.Until(expiresAt).Seconds())
+	}
+	if claims.Act != nil {
+		if adminID, err := strconv.ParseInt(claims.Act.Sub, 10, 64); err == nil {
+			info.ImpersonatedBy = &adminID
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    info,
+	})
+}
+
+// Report whether the bearer token is still valid. authMiddleware has already
+// rejected invalid and expired tokens with 401 by the time this runs.
+func validateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+
+	data := map[string]interface{}{
+		"userId": userID,
+	}
+	if expiresAt, ok := r.Context().Value("tokenExpiresAt").(time.Time); ok {
+		data["expiresAt"] = formatTimestamp(expiresAt)
+		data["expiresIn"] = int64(time.Until(expiresAt).Seconds())
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    data,
+	})
+}
+
+// Lifetime of tokens issued to admins acting as another user
+const impersonationTTL = 15 * time.Minute
+
+// Issue a short-lived token for another user (admin only). The token's act
+// claim names the admin, and the impersonation is written to the audit log
+// before the token is handed out.
+func impersonateUserHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("userID").(int64)
+
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	ctx := requestContext(r)
+	user, err := queries.GetUser(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	expiresAt := time.Now().Add(impersonationTTL)
+	err = execWithRetry(ctx, func() error {
+		return queries.CreateAuditLogEntry(ctx, db.CreateAuditLogEntryParams{
+			ActorID:    adminID,
+			Action:     "impersonate",
+			TargetType: "user",
+			TargetID:   strconv.FormatInt(user.ID, 10),
+			Details:    "token expires " + formatTimestamp(expiresAt),
+		})
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	sessionID, err := createSession(ctx, r, user.ID, expiresAt, sql.NullInt64{Int64: adminID, Valid: true})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	tokenString, err := signJWT(&Claims{
+		UserID:       &user.ID,
+		Email:        user.Email,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+		Act:          &TokenActor{Sub: strconv.FormatInt(adminID, 10)},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	})
+	if err != nil {
+		respondWithInternalError(w, "Error generating token", err)
+		return
+	}
+
+	slog.Warn("Admin issued impersonation token", "admin_id", adminID, "user_id", user.ID)
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Token:   tokenString,
+		User: &UserResponse{
+			ID:    user.ID,
+			Name:  user.Name,
+			Email: user.Email,
+		},
+		Data: map[string]interface{}{
+			"expiresAt": formatTimestamp(expiresAt),
+		},
+	})
+}
+
+// PasswordRequest carries a password to confirm
+type PasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// Password confirmation attempts per user within the current window
+type passwordAttempts struct {
+	count       int64
+	windowStart time.Time
+}
+
+var (
+	passwordAttemptsMu sync.Mutex
+	passwordAttemptsBy = map[int64]*passwordAttempts{}
+)
+
+// Count a password confirmation attempt for the user, returning how long to
+// wait when the user is out of attempts. The attempt is counted before the
+// password is checked so concurrent guesses can't exceed the limit.
+func reservePasswordAttempt(userID int64) (time.Duration, bool) {
+	if verifyPasswordMaxAttempts == 0 {
+		return 0, true
+	}
+
+	passwordAttemptsMu.Lock()
+	defer passwordAttemptsMu.Unlock()
+
+	attempts, ok := passwordAttemptsBy[userID]
+	if !ok || time.Since(attempts.windowStart) >= verifyPasswordWindow {
+		attempts = &passwordAttempts{windowStart: time.Now()}
+		passwordAttemptsBy[userID] = attempts
+	}
+	if attempts.count >= verifyPasswordMaxAttempts {
+		return verifyPasswordWindow - time.Since(attempts.windowStart), false
+	}
+	attempts.count++
+	return 0, true
+}
+
+// Forget the user's failed attempts after a correct password
+func resetPasswordAttempts(userID int64) {
+	passwordAttemptsMu.Lock()
+	defer passwordAttemptsMu.Unlock()
+	delete(passwordAttemptsBy, userID)
+}
+
+// Confirm the authenticated user's password without issuing a new token, for
+// step-up confirmation before sensitive changes. Wrong passwords are limited
+// to VERIFY_PASSWORD_MAX_ATTEMPTS per VERIFY_PASSWORD_WINDOW.
+func verifyPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+
+	var req PasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.Password == "" {
+		respondWithValidationErrors(w, map[string]string{"password": "Password is required"})
+		return
+	}
+
+	if wait, ok := reservePasswordAttempt(userID); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		respondWithError(w, http.StatusTooManyRequests, "Too many attempts, please try again later")
+		return
+	}
+
+	user, err := queries.GetUser(requestContext(r), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondUnauthorized(w, r, "Invalid password")
+		return
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		slog.Warn("Password confirmation failed", "user_id", userID)
+		respondUnauthorized(w, r, "Invalid password")
+		return
+	}
+	resetPasswordAttempts(userID)
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Password confirmed",
+	})
+}
+
+// Log the authenticated user out everywhere by bumping their token version,
+// which every token they've been issued, this one included, carries. Their
+// sessions are revoked too so they no longer show as active.
+func logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+
+	version, err := withRetry(requestContext(r), func() (int64, error) {
+		return queries.IncrementUserTokenVersion(requestContext(r), userID)
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if err := queries.RevokeSessionsByUser(requestContext(r), userID); err != nil {
+		slog.Error("Failed to revoke sessions", "user_id", userID, "error", err)
+	}
+
+	slog.Info("User logged out of all sessions", "user_id", userID, "token_version", version)
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Logged out of all sessions",
+	})
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	user := newTestUser(t)
+	tests := []struct {
+		name     string
+		password string
+		status   int
+	}{
+		{"wrong password", "not the password", http.StatusUnauthorized},
+		{"correct password", user.password, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, "POST", "/api/profile/verify-password", user.token, PasswordRequest{Password: tt.password})
+			expectStatus(t, rec, tt.status)
+			if tt.status == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestVerifyPasswordRateLimit(t *testing.T) {
+	user := newTestUser(t)
+	old := verifyPasswordMaxAttempts
+	verifyPasswordMaxAttempts = 2
+	t.Cleanup(func() { verifyPasswordMaxAttempts = old })
+
+	rec := doJSON(t, "POST", "/api/profile/verify-password", user.token, PasswordRequest{})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	// A correct password clears the earlier failures
+	attempts := []struct {
+		password string
+		status   int
+	}{
+		{"not the password", http.StatusUnauthorized},
+		{user.password, http.StatusOK},
+		{"not the password", http.StatusUnauthorized},
+		{"not the password", http.StatusUnauthorized},
+		{user.password, http.StatusTooManyRequests},
+	}
+	for _, attempt := range attempts {
+		rec = doJSON(t, "POST", "/api/profile/verify-password", user.token, PasswordRequest{Password: attempt.password})
+		expectStatus(t, rec, attempt.status)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+
+	// Limited per user
+	other := newTestUser(t)
+	rec = doJSON(t, "POST", "/api/profile/verify-password", other.token, PasswordRequest{Password: other.password})
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestAdminRouteStatuses(t *testing.T) {
+	user := newTestUser(t)
+	admin := newTestAdmin(t)
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"invalid token", "not-a-token", http.StatusUnauthorized},
+		{"valid token, not an admin", user.token, http.StatusForbidden},
+		{"admin", admin.token, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, "GET", "/api/admin/consistency", tt.token, nil)
+			expectStatus(t, rec, tt.status)
+		})
+	}
+}
+
+func TestLoginValidationErrors(t *testing.T) {
+	user := newTestUser(t)
+	tests := []struct {
+		name       string
+		creds      Credentials
+		status     int
+		wantFields []string
+	}{
+		{"missing both", Credentials{}, http.StatusBadRequest, []string{"email", "password"}},
+		{"blank email", Credentials{Email: "  ", Password: user.password}, http.StatusBadRequest, []string{"email"}},
+		{"missing password", Credentials{Email: user.email}, http.StatusBadRequest, []string{"password"}},
+		{"unknown email", Credentials{Email: "nobody@example.com", Password: user.password}, http.StatusUnauthorized, nil},
+		{"wrong password", Credentials{Email: user.email, Password: "not the password"}, http.StatusUnauthorized, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, "POST", "/api/login", "", tt.creds)
+			expectStatus(t, rec, tt.status)
+			resp := decodeResponse(t, rec, nil)
+			if len(resp.Errors) != len(tt.wantFields) {
+				t.Errorf("errors = %v, want entries for %v", resp.Errors, tt.wantFields)
+			}
+			for _, field := range tt.wantFields {
+				if resp.Errors[field] == "" {
+					t.Errorf("no error for %s in %v", field, resp.Errors)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	user := newTestUser(t)
+	rec := doJSON(t, "GET", "/api/auth/validate", user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var data struct {
+		UserID    int64  `json:"userId"`
+		ExpiresAt string `json:"expiresAt"`
+		ExpiresIn int64  `json:"expiresIn"`
+	}
+	decodeResponse(t, rec, &data)
+	if data.UserID != user.id {
+		t.Errorf("userId = %d, want %d", data.UserID, user.id)
+	}
+	if data.ExpiresAt == "" || data.ExpiresIn <= 0 || data.ExpiresIn > int64(sessionTTL.Seconds()) {
+		t.Errorf("expires at %q, in %ds; want within the session TTL", data.ExpiresAt, data.ExpiresIn)
+	}
+
+	for _, token := range []string{"", "not-a-token", user.token + "x"} {
+		rec := doJSON(t, "GET", "/api/auth/validate", token, nil)
+		expectStatus(t, rec, http.StatusUnauthorized)
+	}
+}
+
+// The caller's token info from /api/auth/me
+func tokenInfo(t *testing.T, token string) TokenInfo {
+	t.Helper()
+	rec := doJSON(t, "GET", "/api/auth/me", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var info TokenInfo
+	decodeResponse(t, rec, &info)
+	return info
+}
+
+func TestTokenInfo(t *testing.T) {
+	user := newTestUser(t)
+	admin := newTestAdmin(t)
+
+	info := tokenInfo(t, user.token)
+	if info.UserID != user.id || info.Email != user.email || info.Role != "user" || info.ImpersonatedBy != nil {
+		t.Errorf("token info = %+v, want user %d, %s", info, user.id, user.email)
+	}
+	expiresAt, err := time.Parse(time.RFC3339, info.ExpiresAt)
+	if err != nil {
+		t.Fatalf("expiresAt %q: %v", info.ExpiresAt, err)
+	}
+	if info.ExpiresIn <= 0 || info.ExpiresIn > int64(sessionTTL.Seconds()) {
+		t.Errorf("expiresIn = %d, want within the %v session", info.ExpiresIn, sessionTTL)
+	}
+	if remaining := time.Until(expiresAt).Seconds(); math.Abs(remaining-float64(info.ExpiresIn)) > 2 {
+		t.Errorf("expiresIn = %d, but expiresAt is %.0fs away", info.ExpiresIn, remaining)
+	}
+
+	if info := tokenInfo(t, admin.token); info.Role != "admin" {
+		t.Errorf("admin's role = %q", info.Role)
+	}
+
+	// The role is read afresh rather than taken from the token
+	if _, err := dbConn.Exec(`UPDATE users SET role = 'admin' WHERE id = ?`, user.id); err != nil {
+		t.Fatal(err)
+	}
+	if info := tokenInfo(t, user.token); info.Role != "admin" {
+		t.Errorf("role after promotion = %q, want admin", info.Role)
+	}
+
+	expectStatus(t, doJSON(t, "GET", "/api/auth/me", "", nil), http.StatusUnauthorized)
+}
+
+func TestImpersonateUser(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	admin := newTestAdmin(t)
+	path := fmt.Sprintf("/api/admin/users/%d/token", user.id)
+
+	rec := doJSON(t, "POST", path, other.token, nil)
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = doJSON(t, "POST", "/api/admin/users/999999999/token", admin.token, nil)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = doJSON(t, "POST", path, admin.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	resp := decodeResponse(t, rec, nil)
+	if resp.User == nil || resp.User.ID != user.id || resp.Token == "" {
+		t.Fatalf("response = %+v, want a token for user %d", resp, user.id)
+	}
+
+	rec = doJSON(t, "GET", "/api/auth/me", resp.Token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var info TokenInfo
+	decodeResponse(t, rec, &info)
+	if info.UserID != user.id || info.ImpersonatedBy == nil || *info.ImpersonatedBy != admin.id {
+		t.Errorf("token info = %+v, want user %d impersonated by %d", info, user.id, admin.id)
+	}
+	if info.ExpiresIn <= 0 || info.ExpiresIn > int64(impersonationTTL.Seconds()) {
+		t.Errorf("expires in %ds, want within %v", info.ExpiresIn, impersonationTTL)
+	}
+
+	var entries int
+	err := dbConn.QueryRow(`SELECT COUNT(*) FROM audit_log WHERE actor_id = ? AND action = 'impersonate' AND target_id = ?`,
+		admin.id, fmt.Sprint(user.id)).Scan(&entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries != 1 {
+		t.Errorf("%d audit log entries, want 1", entries)
+	}
+}
+
+func TestRememberMeTTL(t *testing.T) {
+	user := newTestUser(t)
+	tests := []struct {
+		name       string
+		rememberMe bool
+		ttl        time.Duration
+	}{
+		{"session", false, sessionTTL},
+		{"remember me", true, rememberMeTTL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, "POST", "/api/login", "", Credentials{Email: user.email, Password: user.password, RememberMe: tt.rememberMe})
+			expectStatus(t, rec, http.StatusOK)
+			claims, err := parseJWT(decodeResponse(t, rec, nil).Token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Both claims are whole seconds, taken a moment apart
+			ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time)
+			if ttl < tt.ttl-time.Second || ttl > tt.ttl+time.Second {
+				t.Errorf("token lives %v, want %v", ttl, tt.ttl)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Minimum time between two backups
+var backupInterval = getEnvDuration("BACKUP_INTERVAL", 5*time.Minute)
+
+// Name of the backup file within backupDir. Each backup replaces the last.
+const backupFilename = "database.db"
+
+// Time of the last backup, for rate limiting
+var (
+	lastBackupMu sync.Mutex
+	lastBackup   time.Time
+)
+
+// BackupInfo describes the current backup file
+type BackupInfo struct {
+	SizeBytes int64  `json:"sizeBytes"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// Reserve a backup, returning how long to wait when the last one was too
+// recent
+func reserveBackup() (time.Duration, bool) {
+	lastBackupMu.Lock()
+	defer lastBackupMu.Unlock()
+
+	if wait := backupInterval - time.Since(lastBackup); wait > 0 {
+		return wait, false
+	}
+	lastBackup = time.Now()
+	return 0, true
+}
+
+// Write a consistent copy of the database to backupDir. VACUUM INTO reads
+// the database in one transaction, so writes made meanwhile are either
+// wholly in the copy or not at all, and it refuses to overwrite a file, so
+// the copy is made under a temporary name and renamed over the last backup.
+func backupDatabase(ctx context.Context) (os.FileInfo, error) {
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(backupDir, backupFilename)
+	tmpPath := path + ".tmp"
+	os.Remove(tmpPath)
+	if _, err := dbConn.ExecContext(ctx, "VACUUM INTO ?", tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+	return os.Stat(path)
+}
+
+// Back up the database (admin only). Limited to one backup every
+// BACKUP_INTERVAL.
+func createBackupHandler(w http.ResponseWriter, r *http.Request) {
+	if wait, ok := reserveBackup(); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		respondWithError(w, http.StatusTooManyRequests, "A backup was made recently, please try again later")
+		return
+	}
+
+	info, err := backupDatabase(requestContext(r))
+	if err != nil {
+		respondWithInternalError(w, "Failed to back up database", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, Response{
+		Success: true,
+		Message: "Database backed up successfully",
+		Data: BackupInfo{
+			SizeBytes: info.Size(),
+			CreatedAt: formatTimestamp(info.ModTime()),
+		},
+	})
+}
+
+// Download the latest backup (admin only)
+func downloadBackupHandler(w http.ResponseWriter, r *http.Request) {
+	path := filepath.Join(backupDir, backupFilename)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		respondWithError(w, http.StatusNotFound, "No backup has been made")
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, "Failed to read backup", err)
+		return
+	}
+
+	filename := "database-" + info.ModTime().UTC().Format("20060102-150405") + ".db"
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	http.ServeFile(w, r, path)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackup(t *testing.T) {
+	admin := newTestAdmin(t)
+	user := newTestUser(t)
+	oldDir := backupDir
+	backupDir = t.TempDir()
+	lastBackupMu.Lock()
+	lastBackup = time.Time{}
+	lastBackupMu.Unlock()
+	t.Cleanup(func() { backupDir = oldDir })
+
+	expectStatus(t, doJSON(t, "POST", "/api/admin/backup", user.token, nil), http.StatusForbidden)
+	expectStatus(t, doJSON(t, "GET", "/api/admin/backup/download", admin.token, nil), http.StatusNotFound)
+
+	rec := doJSON(t, "POST", "/api/admin/backup", admin.token, nil)
+	expectStatus(t, rec, http.StatusCreated)
+	var info BackupInfo
+	decodeResponse(t, rec, &info)
+	if info.SizeBytes == 0 {
+		t.Error("backup is empty")
+	}
+
+	// Rate limited
+	rec = doJSON(t, "POST", "/api/admin/backup", admin.token, nil)
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+
+	rec = doJSON(t, "GET", "/api/admin/backup/download", admin.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/vnd.sqlite3" {
+		t.Errorf("Content-Type = %q, want application/vnd.sqlite3", ct)
+	}
+	if int64(rec.Body.Len()) != info.SizeBytes {
+		t.Errorf("downloaded %d bytes, want %d", rec.Body.Len(), info.SizeBytes)
+	}
+
+	// The download is a sound database holding the data at backup time
+	path := filepath.Join(t.TempDir(), "downloaded.db")
+	if err := os.WriteFile(path, rec.Body.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	backup, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	var check string
+	if err := backup.QueryRow("PRAGMA integrity_check").Scan(&check); err != nil {
+		t.Fatal(err)
+	}
+	if check != "ok" {
+		t.Errorf("integrity check: %s", check)
+	}
+	var email string
+	if err := backup.QueryRow("SELECT email FROM users WHERE id = ?", user.id).Scan(&email); err != nil {
+		t.Fatalf("user missing from the backup: %v", err)
+	}
+	if email != user.email {
+		t.Errorf("backed up email = %q, want %q", email, user.email)
+	}
+}
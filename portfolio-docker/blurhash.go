@@ -0,0 +1,135 @@
+package main
+
+import (
+	"image"
+	"math"
+	"strings"
+)
+
+// Number of blurhash components along each axis. 4x3 suits the mostly
+// landscape portfolio images and encodes to a 28 character string.
+const (
+	blurhashComponentsX = 4
+	blurhashComponentsY = 3
+)
+
+// Longest edge, in pixels, of the grid the blurhash is computed from
+const blurhashSampleSize = 32
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Encode an image as a blurhash (https://blurha.sh). The image is sampled on
+// a small grid first, so the cost does not depend on the image size.
+// Transparent areas are flattened onto white.
+func encodeBlurhash(img image.Image) string {
+	bounds := img.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return ""
+	}
+
+	// Sample the image into a small grid of linear RGB values
+	width := min(bounds.Dx(), blurhashSampleSize)
+	height := min(bounds.Dy(), blurhashSampleSize)
+	pixels := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			px := bounds.Min.X + x*bounds.Dx()/width
+			py := bounds.Min.Y + y*bounds.Dy()/height
+			r, g, b, a := img.At(px, py).RGBA()
+			// Composite the premultiplied color onto a white background
+			white := 0xffff - a
+			pixels[y*width+x] = [3]float64{
+				srgbToLinear(float64(r+white) / 0xffff),
+				srgbToLinear(float64(g+white) / 0xffff),
+				srgbToLinear(float64(b+white) / 0xffff),
+			}
+		}
+	}
+
+	factors := make([][3]float64, 0, blurhashComponentsX*blurhashComponentsY)
+	for j := 0; j < blurhashComponentsY; j++ {
+		for i := 0; i < blurhashComponentsX; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					basis := math.Cos(math.Pi*float64(i*x)/float64(width)) *
+						math.Cos(math.Pi*float64(j*y)/float64(height))
+					for c := 0; c < 3; c++ {
+						factor[c] += basis * pixels[y*width+x][c]
+					}
+				}
+			}
+
+			scale := normalisation / float64(width*height)
+			for c := 0; c < 3; c++ {
+				factor[c] *= scale
+			}
+			factors = append(factors, factor)
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((blurhashComponentsX-1)+(blurhashComponentsY-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+
+	maximumValue := 1.0
+	if len(ac) > 0 {
+		actualMaximum := 0.0
+		for _, factor := range ac {
+			for c := 0; c < 3; c++ {
+				actualMaximum = math.Max(actualMaximum, math.Abs(factor[c]))
+			}
+		}
+		quantisedMaximum := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+		maximumValue = float64(quantisedMaximum+1) / 166
+		hash.WriteString(encodeBase83(quantisedMaximum, 1))
+	} else {
+		hash.WriteString(encodeBase83(0, 1))
+	}
+
+	hash.WriteString(encodeBase83(linearToSRGB(dc[0])<<16+linearToSRGB(dc[1])<<8+linearToSRGB(dc[2]), 4))
+
+	for _, factor := range ac {
+		var quant [3]int
+		for c := 0; c < 3; c++ {
+			quant[c] = int(math.Max(0, math.Min(18, math.Floor(signPow(factor[c]/maximumValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encodeBase83(quant[0]*19*19+quant[1]*19+quant[2], 2))
+	}
+
+	return hash.String()
+}
+
+func encodeBase83(value, length int) string {
+	result := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		result[i-1] = base83Chars[digit]
+	}
+	return string(result)
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = math.Max(0, math.Min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(v, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(v), exp), v)
+}
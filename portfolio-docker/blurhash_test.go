@@ -0,0 +1,56 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestEncodeBlurhash(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+
+	// 4x3 components encode as "L", and the average color follows the
+	// quantized maximum
+	solid := encodeBlurhash(twoToneImage(16, 16, 0, red, red))
+	if len(solid) != 28 || !strings.HasPrefix(solid, "L") || solid[2:6] != "TI:j" {
+		t.Errorf("solid red = %q, want L?TI:j followed by the AC components", solid)
+	}
+
+	twoTone := encodeBlurhash(twoToneImage(64, 48, 32, blue, red))
+	if len(twoTone) != 28 {
+		t.Errorf("len(%q) = %d, want 28", twoTone, len(twoTone))
+	}
+	if twoTone == solid {
+		t.Error("two-tone image hashed like a solid one")
+	}
+
+	if got := encodeBlurhash(image.NewRGBA(image.Rectangle{})); got != "" {
+		t.Errorf("empty image = %q, want \"\"", got)
+	}
+}
+
+func TestRegenerateBlurhash(t *testing.T) {
+	user := newTestUser(t)
+	admin := newTestAdmin(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+	if photo.Blurhash == "" {
+		t.Fatal("upload has no blurhash")
+	}
+	if _, err := dbConn.Exec(`UPDATE photos SET blurhash = '' WHERE id = ?`, photo.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := doJSON(t, "POST", "/api/admin/photos/blurhash", admin.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = doJSON(t, "GET", "/api/photos/photography/"+photo.ID, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var regenerated PhotoResponse
+	decodeResponse(t, rec, &regenerated)
+	if regenerated.Blurhash != photo.Blurhash {
+		t.Errorf("blurhash = %q, want %q as on upload", regenerated.Blurhash, photo.Blurhash)
+	}
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// Categories whose photos only admins may edit or delete, loaded at startup
+var protectedCategories = map[string]bool{}
+
+// Read PROTECTED_CATEGORIES and PROTECTED_CATEGORIES_FILE. The file lists
+// one category per line; blank lines and lines starting with # are skipped.
+// An unknown category is fatal, so a typo can't leave a category open.
+func loadProtectedCategories() {
+	names := protectedCategoriesList
+	if protectedCategoriesFile != "" {
+		data, err := os.ReadFile(protectedCategoriesFile)
+		if err != nil {
+			log.Fatalf("Failed to read PROTECTED_CATEGORIES_FILE: %v", err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				names = append(names, line)
+			}
+		}
+	}
+
+	for _, name := range names {
+		if !isValidCategory(name) {
+			log.Fatalf("Invalid protected category: %q", name)
+		}
+		protectedCategories[name] = true
+	}
+}
+
+// Content types the server can decode, and so store; TIFF is converted on
+// upload
+var supportedContentTypes = []string{"image/jpeg", "image/png", "image/gif", "image/tiff"}
+
+// Content types accepted by categories that narrow supportedContentTypes,
+// loaded at startup
+var categoryContentTypes = map[string][]string{}
+
+// Read CATEGORY_CONTENT_TYPES, exiting on an unknown category or a type the
+// server can't store
+func loadCategoryContentTypes() {
+	for _, entry := range strings.Split(categoryContentTypesConfig, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		category, list, _ := strings.Cut(entry, "=")
+		category = strings.TrimSpace(category)
+		if !isValidCategory(category) {
+			log.Fatalf("Invalid category in CATEGORY_CONTENT_TYPES: %q", category)
+		}
+		if _, ok := categoryContentTypes[category]; ok {
+			log.Fatalf("Duplicate category in CATEGORY_CONTENT_TYPES: %q", category)
+		}
+
+		types := []string{}
+		for _, contentType := range strings.Split(list, ",") {
+			contentType = strings.ToLower(strings.TrimSpace(contentType))
+			if !slices.Contains(supportedContentTypes, contentType) {
+				log.Fatalf("Unsupported content type in CATEGORY_CONTENT_TYPES: %q; supported types are %s", contentType, strings.Join(supportedContentTypes, ", "))
+			}
+			if !slices.Contains(types, contentType) {
+				types = append(types, contentType)
+			}
+		}
+		categoryContentTypes[category] = types
+	}
+}
+
+// Photo caps from CATEGORY_MAX_PHOTOS, loaded at startup
+var categoryMaxPhotos = map[string]int64{}
+
+// Read CATEGORY_MAX_PHOTOS, exiting on an unknown category or a cap that
+// isn't a positive number
+func loadCategoryMaxPhotos() {
+	for _, entry := range strings.Split(categoryMaxPhotosConfig, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		category, value, _ := strings.Cut(entry, "=")
+		category = strings.TrimSpace(category)
+		if !isValidCategory(category) {
+			log.Fatalf("Unknown category in CATEGORY_MAX_PHOTOS: %q", category)
+		}
+		limit, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil || limit < 1 {
+			log.Fatalf("Invalid cap in CATEGORY_MAX_PHOTOS for %s: %q", category, value)
+		}
+		categoryMaxPhotos[category] = limit
+	}
+}
+
+// Most photos a category may hold: the cap an admin set, or the one from
+// CATEGORY_MAX_PHOTOS. Zero means uncapped.
+func categoryPhotoLimit(ctx context.Context, q *db.Queries, category string) (int64, error) {
+	limit, err := q.GetCategoryLimit(ctx, category)
+	if errors.Is(err, sql.ErrNoRows) {
+		return categoryMaxPhotos[category], nil
+	}
+	return limit.MaxPhotos, err
+}
+
+// categoryFullError is a photo that would take a category over its cap
+type categoryFullError struct {
+	problem string
+}
+
+func (e *categoryFullError) Error() string {
+	return e.problem
+}
+
+// Check that a category has room for adding more photos, returning why not
+// or "". Admins may exceed the cap. q is the transaction that adds the
+// photos, when there is one, so the count can't change before they're in.
+func categoryCapacityProblem(ctx context.Context, q *db.Queries, userID int64, category string, adding int64) (string, error) {
+	limit, err := categoryPhotoLimit(ctx, q, category)
+	if err != nil || limit == 0 {
+		return "", err
+	}
+	count, err := q.CountPhotosInCategory(ctx, category)
+	if err != nil || count+adding <= limit {
+		return "", err
+	}
+	role, err := q.GetUserRole(ctx, userID)
+	if err != nil || role == "admin" {
+		return "", err
+	}
+	return fmt.Sprintf("The %s category is full; it holds at most %d photos", category, limit), nil
+}
+
+// Check that a category has room for adding more photos, writing the error
+// response when it doesn't
+func checkCategoryCapacity(w http.ResponseWriter, ctx context.Context, userID int64, category string, adding int64) bool {
+	problem, err := categoryCapacityProblem(ctx, queries, userID, category, adding)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return false
+	}
+	if problem != "" {
+		respondWithError(w, http.StatusConflict, problem)
+		return false
+	}
+	return true
+}
+
+// Move a photo to another category, checking the category's cap again in
+// the same transaction so concurrent moves and uploads can't overfill it.
+// The whole transaction is retried if the database is busy.
+func movePhotoWithinLimits(ctx context.Context, userID int64, params db.UpdatePhotoCategoryParams) (db.Photo, error) {
+	return withRetry(ctx, func() (db.Photo, error) {
+		tx, err := dbConn.BeginTx(ctx, nil)
+		if err != nil {
+			return db.Photo{}, err
+		}
+		defer tx.Rollback()
+
+		qtx := queries.WithTx(tx)
+		problem, err := categoryCapacityProblem(ctx, qtx, userID, params.Category, 1)
+		if err != nil {
+			return db.Photo{}, err
+		}
+		if problem != "" {
+			return db.Photo{}, &categoryFullError{problem: problem}
+		}
+
+		row, err := qtx.UpdatePhotoCategory(ctx, params)
+		if err != nil {
+			return db.Photo{}, err
+		}
+		return row, tx.Commit()
+	})
+}
+
+// Content types a category accepts
+func acceptedContentTypes(category string) []string {
+	if types, ok := categoryContentTypes[category]; ok {
+		return types
+	}
+	return supportedContentTypes
+}
+
+// Check that a category accepts images in a decoded format, such as "jpeg".
+// Returns why it doesn't, naming the types it does, or "".
+func checkCategoryFormat(category, format string) string {
+	types := acceptedContentTypes(category)
+	if slices.Contains(types, "image/"+format) {
+		return ""
+	}
+	return fmt.Sprintf("The %s category only accepts %s", category, strings.Join(types, ", "))
+}
+
+// Format of a stored image file, such as "jpeg", or "" when it can't be read
+func storedImageFormat(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	_, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return ""
+	}
+	return format
+}
+
+// Whether the user is an admin
+func userIsAdmin(ctx context.Context, userID int64) (bool, error) {
+	role, err := queries.GetUserRole(ctx, userID)
+	return role == "admin", err
+}
+
+// Check that the user may change photos in the category, which they can't
+// when it's protected and they aren't an admin. Writes the error response
+// when they can't.
+func checkCategoryAccess(w http.ResponseWriter, ctx context.Context, userID int64, category string) bool {
+	if !protectedCategories[category] {
+		return true
+	}
+
+	admin, err := userIsAdmin(ctx, userID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return false
+	}
+	if !admin {
+		respondForbidden(w, fmt.Sprintf("Only admins can change photos in the %s category", category))
+		return false
+	}
+	return true
+}
+
+// CategoryResponse describes a category for navigation, with its cover photo
+// if one has been chosen
+type CategoryResponse struct {
+	Name  string         `json:"name"`
+	Label string         `json:"label"` // Display name; the name unless an admin set one
+	Cover *PhotoResponse `json:"cover"`
+}
+
+// Longest category display name, in characters
+const maxCategoryLabelLength = 64
+
+// CategoryLimitRequest sets the most photos a category may hold. Zero
+// removes the cap; null restores the one from CATEGORY_MAX_PHOTOS.
+type CategoryLimitRequest struct {
+	MaxPhotos *int64 `json:"maxPhotos"`
+}
+
+// CategoryLabelRequest sets a category's display name. An empty label
+// restores the default, the category's name.
+type CategoryLabelRequest struct {
+	Label string `json:"label"`
+}
+
+// Make a photo its category's cover, or stop it being one. A category has at
+// most one cover, which a unique index enforces, so setting a new cover
+// clears the previous one first. q should belong to a transaction so the
+// category is never left without its old cover after a failed update.
+func setPhotoCover(ctx context.Context, q *db.Queries, photo db.Photo, cover bool) (db.Photo, error) {
+	if cover {
+		if err := q.ClearCategoryCover(ctx, photo.Category); err != nil {
+			return photo, err
+		}
+	}
+	return q.UpdatePhotoCover(ctx, db.UpdatePhotoCoverParams{
+		Cover: cover,
+		ID:    photo.ID,
+	})
+}
+
+// List the photo categories in their configured order, each with its cover
+func listCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	covers, err := queries.ListCategoryCovers(requestContext(r))
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	byCategory := make(map[string]db.Photo, len(covers))
+	for _, photo := range covers {
+		if photoVisible(r, photo) {
+			byCategory[photo.Category] = photo
+		}
+	}
+
+	labels, err := queries.ListCategoryLabels(requestContext(r))
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	labelByCategory := make(map[string]string, len(labels))
+	for _, label := range labels {
+		labelByCategory[label.Category] = label.Label
+	}
+
+	categories := make([]CategoryResponse, 0, len(photoCategories))
+	for _, name := range photoCategories {
+		category := CategoryResponse{Name: name, Label: name}
+		if label, ok := labelByCategory[name]; ok {
+			category.Label = label
+		}
+		if photo, ok := byCategory[name]; ok {
+			cover := photoResponseFromRow(r, photo)
+			category.Cover = &cover
+		}
+		categories = append(categories, category)
+	}
+
+	respondWithCacheableJSON(w, r, Response{
+		Success: true,
+		Data:    categories,
+	})
+}
+
+// Set or clear a category's display name (admin only). Only the label
+// changes; the category's directory and URLs stay as they are.
+func setCategoryLabelHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("userID").(int64)
+	category := mux.Vars(r)["category"]
+	if !isValidCategory(category) {
+		respondWithError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	var req CategoryLabelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	label := strings.TrimSpace(req.Label)
+	if utf8.RuneCountInString(label) > maxCategoryLabelLength {
+		respondWithValidationErrors(w, map[string]string{"label": fmt.Sprintf("Label must be at most %d characters", maxCategoryLabelLength)})
+		return
+	}
+	if strings.ContainsFunc(label, unicode.IsControl) {
+		respondWithValidationErrors(w, map[string]string{"label": "Label can't contain control characters"})
+		return
+	}
+
+	ctx := requestContext(r)
+	err := execWithRetry(ctx, func() error {
+		if label == "" {
+			return queries.DeleteCategoryLabel(ctx, category)
+		}
+		return queries.SetCategoryLabel(ctx, db.SetCategoryLabelParams{
+			Category: category,
+			Label:    label,
+		})
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	err = execWithRetry(ctx, func() error {
+		return queries.CreateAuditLogEntry(ctx, db.CreateAuditLogEntryParams{
+			ActorID:    adminID,
+			Action:     "relabel",
+			TargetType: "category",
+			TargetID:   category,
+			Details:    label,
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to write audit log entry", "action", "relabel", "category", category, "error", err)
+	}
+
+	if label == "" {
+		label = category
+	}
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Category label updated",
+		Data: map[string]string{
+			"name":  category,
+			"label": label,
+		},
+	})
+}
+
+// Set or clear the cap on a category's photos (admin only). Categories
+// already over a new cap keep their photos but take no more.
+func setCategoryLimitHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("userID").(int64)
+	category := mux.Vars(r)["category"]
+	if !isValidCategory(category) {
+		respondWithError(w, http.StatusNotFound, "Category not found")
+		return
+	}
+
+	var req CategoryLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if req.MaxPhotos != nil && *req.MaxPhotos < 0 {
+		respondWithValidationErrors(w, map[string]string{"maxPhotos": "maxPhotos must not be negative"})
+		return
+	}
+
+	ctx := requestContext(r)
+	details := "default"
+	err := execWithRetry(ctx, func() error {
+		if req.MaxPhotos == nil {
+			return queries.DeleteCategoryLimit(ctx, category)
+		}
+		details = "max photos " + strconv.FormatInt(*req.MaxPhotos, 10)
+		return queries.SetCategoryLimit(ctx, db.SetCategoryLimitParams{
+			Category:  category,
+			MaxPhotos: *req.MaxPhotos,
+		})
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	err = execWithRetry(ctx, func() error {
+		return queries.CreateAuditLogEntry(ctx, db.CreateAuditLogEntryParams{
+			ActorID:    adminID,
+			Action:     "limit",
+			TargetType: "category",
+			TargetID:   category,
+			Details:    details,
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to write audit log entry", "action", "limit", "category", category, "error", err)
+	}
+
+	limit, err := categoryPhotoLimit(ctx, queries, category)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Category limit updated",
+		Data: map[string]interface{}{
+			"name":      category,
+			"maxPhotos": limit, // Zero when uncapped
+		},
+	})
+}
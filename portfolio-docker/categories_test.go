@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// Category the cap tests fill, which other tests leave alone
+const cappedCategory = "notebook-sketches"
+
+// Cap a category at room more photos than it holds, through the admin
+// endpoint. The cap is removed when the test ends.
+func capCategory(t *testing.T, category string, room int64) {
+	t.Helper()
+	count, err := queries.CountPhotosInCategory(context.Background(), category)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := newTestAdmin(t)
+	limit := count + room
+	rec := doJSON(t, "PUT", "/api/admin/categories/"+category+"/max-photos", admin.token, CategoryLimitRequest{MaxPhotos: &limit})
+	expectStatus(t, rec, http.StatusOK)
+	t.Cleanup(func() {
+		rec := doJSON(t, "PUT", "/api/admin/categories/"+category+"/max-photos", admin.token, CategoryLimitRequest{})
+		expectStatus(t, rec, http.StatusOK)
+	})
+}
+
+func TestUploadToFullCategory(t *testing.T) {
+	user := newTestUser(t)
+	admin := newTestAdmin(t)
+	capCategory(t, cappedCategory, 1)
+
+	uploadTestPhoto(t, user.token, cappedCategory)
+
+	rec := uploadFile(t, user.token, cappedCategory, "second.png", testPNG(t, 8, 8, testColor))
+	expectStatus(t, rec, http.StatusConflict)
+
+	// Admins may exceed the cap
+	uploadTestPhoto(t, admin.token, cappedCategory)
+}
+
+func TestMovePhotoToFullCategory(t *testing.T) {
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+	capCategory(t, cappedCategory, 0)
+
+	rec := doJSON(t, "POST", "/api/photos/"+photo.ID+"/move", user.token, MoveRequest{Category: cappedCategory})
+	expectStatus(t, rec, http.StatusConflict)
+
+	if _, err := os.Stat(filepath.Join(photoDir, "photography", photo.Filename)); err != nil {
+		t.Errorf("photo file not left in place: %v", err)
+	}
+}
+
+func TestCreatePhotoWithinLimitsChecksCategoryCap(t *testing.T) {
+	user := newTestUser(t)
+	const room, attempts = 3, 40
+	capCategory(t, cappedCategory, room)
+
+	// Release every attempt at once so their checks overlap
+	ctx := context.Background()
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make([]error, attempts)
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			id := fmt.Sprintf("cap-race-%d-%d", user.id, i)
+			_, errs[i] = createPhotoWithinLimits(ctx, db.CreatePhotoParams{
+				ID:       id,
+				UserID:   user.id,
+				Filename: id + ".png",
+				Title:    "Race",
+				Category: cappedCategory,
+				Status:   defaultPhotoStatus,
+			})
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		var fullErr *categoryFullError
+		switch {
+		case err == nil:
+			created++
+		case errors.As(err, &fullErr):
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if created != room {
+		t.Errorf("created %d photos, want %d", created, room)
+	}
+}
+
+// The categories as listed publicly
+func listCategories(t *testing.T) []CategoryResponse {
+	t.Helper()
+	rec := doJSON(t, "GET", "/api/categories", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var categories []CategoryResponse
+	decodeResponse(t, rec, &categories)
+	return categories
+}
+
+// Cover photo of a category as listed, or "" when it has none
+func categoryCoverID(t *testing.T, category string) string {
+	t.Helper()
+	for _, c := range listCategories(t) {
+		if c.Name == category && c.Cover != nil {
+			return c.Cover.ID
+		}
+	}
+	return ""
+}
+
+func TestCategoryCover(t *testing.T) {
+	user := newTestUser(t)
+	a := uploadTestPhoto(t, user.token, "digital-sketches")
+	b := uploadTestPhoto(t, user.token, "digital-sketches")
+	yes, no := true, false
+
+	for _, photo := range []PhotoResponse{a, b} {
+		rec := doJSON(t, "PATCH", "/api/photos/"+photo.ID, user.token, PhotoUpdate{Cover: &yes})
+		expectStatus(t, rec, http.StatusOK)
+		var updated PhotoResponse
+		decodeResponse(t, rec, &updated)
+		if !updated.Cover {
+			t.Errorf("%s not marked as the cover", photo.ID)
+		}
+		if cover := categoryCoverID(t, "digital-sketches"); cover != photo.ID {
+			t.Errorf("cover = %q, want %s", cover, photo.ID)
+		}
+	}
+	var covers int
+	if err := dbConn.QueryRow(`SELECT COUNT(*) FROM photos WHERE category = ? AND cover`, "digital-sketches").Scan(&covers); err != nil {
+		t.Fatal(err)
+	}
+	if covers != 1 {
+		t.Errorf("category has %d covers, want 1", covers)
+	}
+
+	// The index rejects a second cover however it's written
+	if _, err := dbConn.Exec(`UPDATE photos SET cover = 1 WHERE id = ?`, a.ID); err == nil {
+		t.Error("database accepted a second cover")
+	}
+
+	rec := doJSON(t, "PATCH", "/api/photos/"+b.ID, user.token, PhotoUpdate{Cover: &no})
+	expectStatus(t, rec, http.StatusOK)
+	if cover := categoryCoverID(t, "digital-sketches"); cover != "" {
+		t.Errorf("cover = %q after clearing it", cover)
+	}
+}
+
+// Apply a CATEGORY_CONTENT_TYPES spec until the test ends
+func useCategoryContentTypes(t *testing.T, spec string) {
+	t.Helper()
+	oldTypes, oldConfig := categoryContentTypes, categoryContentTypesConfig
+	categoryContentTypes, categoryContentTypesConfig = map[string][]string{}, spec
+	loadCategoryContentTypes()
+	t.Cleanup(func() { categoryContentTypes, categoryContentTypesConfig = oldTypes, oldConfig })
+}
+
+func TestCategoryContentTypes(t *testing.T) {
+	user := newTestUser(t)
+	// Uploaded before photography is narrowed, to move in later
+	sketch := uploadTestPhoto(t, user.token, "digital-sketches")
+	useCategoryContentTypes(t, "photography = image/JPEG, image/jpeg")
+
+	if types := acceptedContentTypes("photography"); !slices.Equal(types, []string{"image/jpeg"}) {
+		t.Errorf("photography accepts %v, want just image/jpeg", types)
+	}
+	if types := acceptedContentTypes("digital-sketches"); !slices.Equal(types, supportedContentTypes) {
+		t.Errorf("digital-sketches accepts %v, want every supported type", types)
+	}
+
+	png := testPNG(t, 8, 8, testColor)
+	rec := uploadFile(t, user.token, "photography", "photo.png", png)
+	expectStatus(t, rec, http.StatusUnsupportedMediaType)
+	if resp := decodeResponse(t, rec, nil); !strings.Contains(resp.Message, "image/jpeg") {
+		t.Errorf("message = %q, want the accepted types named", resp.Message)
+	}
+	expectStatus(t, uploadFile(t, user.token, "digital-sketches", "photo.png", png), http.StatusCreated)
+
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, uploadFile(t, user.token, "photography", "photo.jpg", jpg.Bytes()), http.StatusCreated)
+
+	rec = doJSON(t, "POST", "/api/photos/"+sketch.ID+"/move", user.token, MoveRequest{Category: "photography"})
+	expectStatus(t, rec, http.StatusUnsupportedMediaType)
+}
+
+func TestCategoryLabels(t *testing.T) {
+	admin := newTestAdmin(t)
+	user := newTestUser(t)
+	path := "/api/admin/categories/digital-sketches/label"
+	label := func() string {
+		for _, c := range listCategories(t) {
+			if c.Name == "digital-sketches" {
+				return c.Label
+			}
+		}
+		t.Fatal("digital-sketches not listed")
+		return ""
+	}
+
+	if got := label(); got != "digital-sketches" {
+		t.Errorf("label = %q, want the name until one is set", got)
+	}
+
+	expectStatus(t, doJSON(t, "PUT", path, user.token, CategoryLabelRequest{Label: "Screens"}), http.StatusForbidden)
+	expectStatus(t, doJSON(t, "PUT", "/api/admin/categories/paintings/label", admin.token, CategoryLabelRequest{Label: "Oils"}), http.StatusNotFound)
+	expectStatus(t, doJSON(t, "PUT", path, admin.token, CategoryLabelRequest{Label: strings.Repeat("a", maxCategoryLabelLength+1)}), http.StatusBadRequest)
+	expectStatus(t, doJSON(t, "PUT", path, admin.token, CategoryLabelRequest{Label: "Ink\nPaper"}), http.StatusBadRequest)
+
+	rec := doJSON(t, "PUT", path, admin.token, CategoryLabelRequest{Label: "  Ink & Paper  "})
+	expectStatus(t, rec, http.StatusOK)
+	t.Cleanup(func() { doJSON(t, "PUT", path, admin.token, CategoryLabelRequest{}) })
+	if got := label(); got != "Ink & Paper" {
+		t.Errorf("label = %q, want Ink & Paper", got)
+	}
+
+	// Photos keep their category and URLs
+	photo := uploadTestPhoto(t, user.token, "digital-sketches")
+	expectStatus(t, doJSON(t, "GET", "/api/photos/digital-sketches/"+photo.ID, "", nil), http.StatusOK)
+
+	rec = doJSON(t, "PUT", path, admin.token, CategoryLabelRequest{Label: ""})
+	expectStatus(t, rec, http.StatusOK)
+	if got := label(); got != "digital-sketches" {
+		t.Errorf("label = %q after clearing it, want the name", got)
+	}
+}
+
+func TestInvalidCategoryListsValid(t *testing.T) {
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+
+	tests := []struct {
+		name string
+		rec  func() *httptest.ResponseRecorder
+	}{
+		{"upload", func() *httptest.ResponseRecorder {
+			return uploadFile(t, user.token, "paintings", "photo.png", testPNG(t, 8, 8, testColor))
+		}},
+		{"category listing", func() *httptest.ResponseRecorder {
+			return doJSON(t, "GET", "/api/photos/paintings", "", nil)
+		}},
+		{"own photos", func() *httptest.ResponseRecorder {
+			return doJSON(t, "GET", "/api/profile/photos?category=paintings", user.token, nil)
+		}},
+		{"random photo", func() *httptest.ResponseRecorder {
+			return doJSON(t, "GET", "/api/photos/random?category=paintings", "", nil)
+		}},
+		{"photo by slug", func() *httptest.ResponseRecorder {
+			return doJSON(t, "GET", "/api/photos/paintings/"+photo.ID, "", nil)
+		}},
+		{"move", func() *httptest.ResponseRecorder {
+			return doJSON(t, "POST", "/api/photos/"+photo.ID+"/move", user.token, MoveRequest{Category: "paintings"})
+		}},
+		{"upload by URL", func() *httptest.ResponseRecorder {
+			return doJSON(t, "POST", "/api/photos/upload-url", user.token, UploadURLRequest{URL: "https://example.com/a.png", Category: "paintings"})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := tt.rec()
+			expectStatus(t, rec, http.StatusBadRequest)
+			var data struct {
+				ValidCategories []string `json:"validCategories"`
+			}
+			resp := decodeResponse(t, rec, &data)
+			if resp.Message != "Invalid category" || !slices.Equal(data.ValidCategories, photoCategories) {
+				t.Errorf("message %q, valid categories %v; want %v", resp.Message, data.ValidCategories, photoCategories)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import "net/http"
+
+// ClientConfig holds the effective limits a frontend needs to configure its
+// forms. Only non-sensitive settings belong here.
+type ClientConfig struct {
+	MaxUploadBytes     int64    `json:"maxUploadBytes"` // Zero means unlimited
+	AllowedTypes       []string `json:"allowedTypes"`
+	Categories         []string `json:"categories"`
+	MaxImageDimension  int      `json:"maxImageDimension"` // Larger uploads are downscaled; zero means never
+	MaxResizeDimension int      `json:"maxResizeDimension"`
+	DefaultPageSize    int      `json:"defaultPageSize"`
+	MaxPageSize        int      `json:"maxPageSize"`
+	RegistrationMode   string   `json:"registrationMode"`
+	// Types accepted by the categories that narrow allowedTypes
+	CategoryTypes map[string][]string `json:"categoryTypes,omitempty"`
+	// Multipart field names uploads are read from, keyed file, title and
+	// category
+	UploadFields map[string]string `json:"uploadFields"`
+}
+
+// Report the server's upload and listing limits so clients don't hardcode
+// them
+func clientConfigHandler(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data: ClientConfig{
+			MaxUploadBytes:     maxUploadBytes,
+			AllowedTypes:       supportedContentTypes,
+			Categories:         photoCategories,
+			MaxImageDimension:  maxImageDimension,
+			MaxResizeDimension: maxResizeDimension,
+			DefaultPageSize:    defaultPageSize,
+			MaxPageSize:        maxPageSize,
+			RegistrationMode:   registrationMode,
+			CategoryTypes:      categoryContentTypes,
+			UploadFields: map[string]string{
+				"file":     uploadFileField,
+				"title":    uploadTitleField,
+				"category": uploadCategoryField,
+			},
+		},
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClientConfig(t *testing.T) {
+	old := maxUploadBytes
+	maxUploadBytes = 3 << 20
+	t.Cleanup(func() { maxUploadBytes = old })
+	setRegistrationMode(t, "invite")
+
+	rec := doJSON(t, "GET", "/api/config", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var config ClientConfig
+	decodeResponse(t, rec, &config)
+
+	want := ClientConfig{
+		MaxUploadBytes:     3 << 20,
+		AllowedTypes:       supportedContentTypes,
+		Categories:         photoCategories,
+		MaxImageDimension:  maxImageDimension,
+		MaxResizeDimension: maxResizeDimension,
+		DefaultPageSize:    defaultPageSize,
+		MaxPageSize:        maxPageSize,
+		RegistrationMode:   "invite",
+		CategoryTypes:      categoryContentTypes,
+		UploadFields: map[string]string{
+			"file":     uploadFileField,
+			"title":    uploadTitleField,
+			"category": uploadCategoryField,
+		},
+	}
+	if len(want.CategoryTypes) == 0 {
+		want.CategoryTypes = nil
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("config = %+v, want %+v", config, want)
+	}
+
+	body := strings.ToLower(rec.Body.String())
+	for _, secret := range []string{"secret", "key", "password", "dsn"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("config mentions %q: %s", secret, rec.Body)
+		}
+	}
+}
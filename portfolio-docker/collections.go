@@ -0,0 +1,399 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// CollectionRequest creates or renames a collection
+type CollectionRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// CollectionPhotoRequest names a photo to add to a collection
+type CollectionPhotoRequest struct {
+	PhotoID string `json:"photoId"`
+}
+
+// ReorderRequest lists every photo of a collection in its new order
+type ReorderRequest struct {
+	PhotoIDs []string `json:"photoIds"`
+}
+
+// CollectionResponse represents a collection in the response
+type CollectionResponse struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+// CollectionDetailResponse is a single collection with its photos in order.
+// An empty collection has "photos": [], not a missing field.
+type CollectionDetailResponse struct {
+	CollectionResponse
+	Photos []PhotoResponse `json:"photos"`
+}
+
+func collectionResponseFromRow(collection db.Collection) CollectionResponse {
+	response := CollectionResponse{
+		ID:          collection.ID,
+		Name:        collection.Name,
+		Description: collection.Description,
+	}
+	if collection.CreatedAt.Valid {
+		response.CreatedAt = formatTimestamp(collection.CreatedAt.Time)
+	}
+	return response
+}
+
+// Load the collection named in the URL, writing the error response if it
+// doesn't exist
+func loadCollection(w http.ResponseWriter, r *http.Request) (db.Collection, bool) {
+	collectionID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid collection ID")
+		return db.Collection{}, false
+	}
+
+	collection, err := queries.GetCollection(requestContext(r), collectionID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Collection not found")
+		return collection, false
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return collection, false
+	}
+	return collection, true
+}
+
+// Load the collection named in the URL, which the user must own
+func loadOwnedCollection(w http.ResponseWriter, r *http.Request) (db.Collection, bool) {
+	collection, ok := loadCollection(w, r)
+	if !ok {
+		return collection, false
+	}
+	if collection.UserID != r.Context().Value("userID").(int64) {
+		respondForbidden(w, "You can only edit your own collections")
+		return collection, false
+	}
+	return collection, true
+}
+
+// Decode and validate a create or rename request
+func decodeCollectionRequest(w http.ResponseWriter, r *http.Request) (CollectionRequest, bool) {
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return req, false
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		respondWithValidationErrors(w, map[string]string{"name": "Name is required"})
+		return req, false
+	}
+	return req, true
+}
+
+// List the authenticated user's collections, newest first
+func listCollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := queries.ListCollectionsByUser(requestContext(r), userID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	start, end := pageBounds(len(rows), page, pageSize)
+	collections := []CollectionResponse{}
+	for _, row := range rows[start:end] {
+		collections = append(collections, collectionResponseFromRow(row))
+	}
+
+	setPaginationHeaders(w, r, page, pageSize, int64(len(rows)))
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    newPaginatedResponse(collections, page, pageSize, int64(len(rows))),
+	})
+}
+
+func createCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+
+	req, ok := decodeCollectionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	collection, err := withRetry(requestContext(r), func() (db.Collection, error) {
+		return queries.CreateCollection(requestContext(r), db.CreateCollectionParams{
+			UserID:      userID,
+			Name:        req.Name,
+			Description: req.Description,
+		})
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, Response{
+		Success: true,
+		Message: "Collection created successfully",
+		Data:    collectionResponseFromRow(collection),
+	})
+}
+
+// Fetch a collection with its photos in order
+func getCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := loadCollection(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := queries.ListCollectionPhotos(requestContext(r), collection.ID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	response := CollectionDetailResponse{
+		CollectionResponse: collectionResponseFromRow(collection),
+		Photos:             []PhotoResponse{},
+	}
+	for _, row := range rows {
+		if photoVisible(r, row) {
+			response.Photos = append(response.Photos, photoResponseFromRow(r, row))
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    response,
+	})
+}
+
+// Rename a collection or change its description
+func updateCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := loadOwnedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	req, ok := decodeCollectionRequest(w, r)
+	if !ok {
+		return
+	}
+
+	collection, err := withRetry(requestContext(r), func() (db.Collection, error) {
+		return queries.UpdateCollection(requestContext(r), db.UpdateCollectionParams{
+			Name:        req.Name,
+			Description: req.Description,
+			ID:          collection.ID,
+		})
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Collection updated successfully",
+		Data:    collectionResponseFromRow(collection),
+	})
+}
+
+// Delete a collection. The photos in it are left untouched.
+func deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := loadOwnedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := queries.WithTx(tx)
+	if err := qtx.ClearCollectionPhotos(requestContext(r), collection.ID); err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if err := qtx.DeleteCollection(requestContext(r), collection.ID); err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Collection deleted successfully",
+	})
+}
+
+// Append a photo to the end of a collection. Any photo can be collected, not
+// only the user's own.
+func addCollectionPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := loadOwnedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var req CollectionPhotoRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	ctx := requestContext(r)
+	_, err := queries.GetPhoto(ctx, req.PhotoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Photo not found")
+		return
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	added, err := withRetry(ctx, func() (int64, error) {
+		return queries.AddCollectionPhoto(ctx, db.AddCollectionPhotoParams{
+			CollectionID: collection.ID,
+			PhotoID:      req.PhotoID,
+		})
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if added == 0 {
+		respondWithJSON(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Photo is already in the collection",
+		})
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, Response{
+		Success: true,
+		Message: "Photo added to collection",
+	})
+}
+
+func removeCollectionPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := loadOwnedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	removed, err := withRetry(requestContext(r), func() (int64, error) {
+		return queries.RemoveCollectionPhoto(requestContext(r), db.RemoveCollectionPhotoParams{
+			CollectionID: collection.ID,
+			PhotoID:      mux.Vars(r)["photoId"],
+		})
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if removed == 0 {
+		respondWithError(w, http.StatusNotFound, "Photo is not in the collection")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Photo removed from collection",
+	})
+}
+
+// Reorder a collection. The request must list exactly the photos already in
+// the collection.
+func reorderCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	collection, ok := loadOwnedCollection(w, r)
+	if !ok {
+		return
+	}
+
+	var req ReorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	ctx := requestContext(r)
+	current, err := queries.ListCollectionPhotoIDs(ctx, collection.ID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	members := make(map[string]bool, len(current))
+	for _, id := range current {
+		members[id] = true
+	}
+	for _, id := range req.PhotoIDs {
+		if !members[id] {
+			respondWithError(w, http.StatusBadRequest, "photoIds must list each photo in the collection exactly once")
+			return
+		}
+		delete(members, id)
+	}
+	if len(members) > 0 || len(req.PhotoIDs) != len(current) {
+		respondWithError(w, http.StatusBadRequest, "photoIds must list each photo in the collection exactly once")
+		return
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := queries.WithTx(tx)
+	for position, id := range req.PhotoIDs {
+		err := qtx.UpdateCollectionPhotoPosition(ctx, db.UpdateCollectionPhotoPositionParams{
+			Position:     int64(position),
+			CollectionID: collection.ID,
+			PhotoID:      id,
+		})
+		if err != nil {
+			respondWithDatabaseError(w, err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Collection reordered",
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// Create a collection, failing unless it's created
+func createCollection(t *testing.T, token, name string) CollectionResponse {
+	t.Helper()
+	rec := doJSON(t, "POST", "/api/collections", token, CollectionRequest{Name: name})
+	expectStatus(t, rec, http.StatusCreated)
+	var collection CollectionResponse
+	decodeResponse(t, rec, &collection)
+	return collection
+}
+
+// IDs of a collection's photos, in order
+func collectionPhotoIDs(t *testing.T, id int64) []string {
+	t.Helper()
+	rec := doJSON(t, "GET", fmt.Sprintf("/api/collections/%d", id), "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var detail CollectionDetailResponse
+	decodeResponse(t, rec, &detail)
+	ids := []string{}
+	for _, photo := range detail.Photos {
+		ids = append(ids, photo.ID)
+	}
+	return ids
+}
+
+func TestCollectionPhotos(t *testing.T) {
+	user := newTestUser(t)
+	a := uploadTestPhoto(t, user.token, "photography")
+	b := uploadTestPhoto(t, user.token, "photography")
+	c := uploadTestPhoto(t, user.token, "photography")
+	collection := createCollection(t, user.token, "  Favourites  ")
+	if collection.Name != "Favourites" {
+		t.Errorf("name = %q, want it trimmed", collection.Name)
+	}
+	path := fmt.Sprintf("/api/collections/%d/photos", collection.ID)
+
+	if ids := collectionPhotoIDs(t, collection.ID); len(ids) != 0 {
+		t.Errorf("new collection holds %v", ids)
+	}
+	for _, photo := range []PhotoResponse{a, b, c} {
+		rec := doJSON(t, "POST", path, user.token, CollectionPhotoRequest{PhotoID: photo.ID})
+		expectStatus(t, rec, http.StatusCreated)
+	}
+	rec := doJSON(t, "POST", path, user.token, CollectionPhotoRequest{PhotoID: a.ID})
+	expectStatus(t, rec, http.StatusOK)
+	rec = doJSON(t, "POST", path, user.token, CollectionPhotoRequest{PhotoID: "no-such-photo"})
+	expectStatus(t, rec, http.StatusNotFound)
+	if ids, want := collectionPhotoIDs(t, collection.ID), []string{a.ID, b.ID, c.ID}; !slices.Equal(ids, want) {
+		t.Errorf("photos = %v, want %v in the order added", ids, want)
+	}
+
+	rec = doJSON(t, "PUT", path+"/order", user.token, ReorderRequest{PhotoIDs: []string{c.ID, a.ID, b.ID}})
+	expectStatus(t, rec, http.StatusOK)
+	if ids, want := collectionPhotoIDs(t, collection.ID), []string{c.ID, a.ID, b.ID}; !slices.Equal(ids, want) {
+		t.Errorf("photos = %v, want %v after reordering", ids, want)
+	}
+	for _, order := range [][]string{{c.ID, a.ID}, {c.ID, a.ID, a.ID}, {c.ID, a.ID, b.ID, "no-such-photo"}} {
+		rec = doJSON(t, "PUT", path+"/order", user.token, ReorderRequest{PhotoIDs: order})
+		expectStatus(t, rec, http.StatusBadRequest)
+	}
+
+	rec = doJSON(t, "DELETE", path+"/"+a.ID, user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	rec = doJSON(t, "DELETE", path+"/"+a.ID, user.token, nil)
+	expectStatus(t, rec, http.StatusNotFound)
+	if ids, want := collectionPhotoIDs(t, collection.ID), []string{c.ID, b.ID}; !slices.Equal(ids, want) {
+		t.Errorf("photos = %v, want %v after removing one", ids, want)
+	}
+}
+
+func TestCollectionOwnership(t *testing.T) {
+	owner := newTestUser(t)
+	other := newTestUser(t)
+	photo := uploadTestPhoto(t, owner.token, "photography")
+	collection := createCollection(t, owner.token, "Mine")
+	path := fmt.Sprintf("/api/collections/%d", collection.ID)
+
+	rec := doJSON(t, "PATCH", path, other.token, CollectionRequest{Name: "Theirs"})
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = doJSON(t, "POST", path+"/photos", other.token, CollectionPhotoRequest{PhotoID: photo.ID})
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = doJSON(t, "DELETE", path, other.token, nil)
+	expectStatus(t, rec, http.StatusForbidden)
+
+	rec = doJSON(t, "PATCH", path, owner.token, CollectionRequest{Name: " "})
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = doJSON(t, "DELETE", path, owner.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	rec = doJSON(t, "GET", path, "", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+	rec = doJSON(t, "GET", "/api/collections/not-a-number", "", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestEmptyListsSerializeAsArrays(t *testing.T) {
+	user := newTestUser(t)
+
+	rec := doJSON(t, "GET", "/api/collections", user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var page map[string]json.RawMessage
+	decodeResponse(t, rec, &page)
+	if items := string(page["items"]); items != "[]" {
+		t.Errorf("collections of a new user = %q, want []", items)
+	}
+
+	collection := createCollection(t, user.token, "Empty")
+	rec = doJSON(t, "GET", fmt.Sprintf("/api/collections/%d", collection.ID), "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var detail map[string]json.RawMessage
+	decodeResponse(t, rec, &detail)
+	if photos := string(detail["photos"]); photos != "[]" {
+		t.Errorf("photos of an empty collection = %q, want []", photos)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default upload quotas applied to every user without a per-user override.
+// Zero means unlimited.
+var (
+	uploadQuotaBytes  = getEnvInt64("UPLOAD_QUOTA_BYTES", 0)
+	uploadQuotaPhotos = getEnvInt64("UPLOAD_QUOTA_PHOTOS", 0)
+)
+
+// Uploads whose longest edge exceeds this many pixels are downscaled before
+// storage. Zero disables downscaling. With KEEP_ORIGINALS the untouched
+// upload is archived next to the downscaled copy.
+var (
+	maxImageDimension = int(getEnvInt64("MAX_IMAGE_DIMENSION", 0))
+	keepOriginals     = getEnvBool("KEEP_ORIGINALS", false)
+)
+
+// Keep the sanitized name an upload was sent with, to offer it again as the
+// download filename. Files on disk are named after the photo ID either way.
+var preserveFilenames = getEnvBool("PRESERVE_FILENAMES", false)
+
+// Largest upload request body, file and form fields together. Zero means
+// unlimited.
+var maxUploadBytes = getEnvInt64("MAX_UPLOAD_BYTES", 10<<20)
+
+// Names of the multipart fields photo uploads are read from, for clients
+// whose form libraries can't use the defaults. The file field name also
+// applies to replacing a photo's file and to inspecting an image.
+var (
+	uploadFileField     = getEnv("UPLOAD_FILE_FIELD", "photo")
+	uploadTitleField    = getEnv("UPLOAD_TITLE_FIELD", "title")
+	uploadCategoryField = getEnv("UPLOAD_CATEGORY_FIELD", "category")
+)
+
+// Limits on ZIP imports: the archive's size, how many entries it may list,
+// and the total its images may extract to. Each image is also held to
+// MAX_UPLOAD_BYTES. Zero means unlimited.
+var (
+	importMaxArchiveBytes   = getEnvInt64("IMPORT_MAX_ARCHIVE_BYTES", 256<<20)
+	importMaxEntries        = getEnvInt64("IMPORT_MAX_ENTRIES", 500)
+	importMaxExtractedBytes = getEnvInt64("IMPORT_MAX_EXTRACTED_BYTES", 1<<30)
+)
+
+// Uploads by URL: time allowed for the whole fetch, and how many redirects
+// are followed. The image is held to MAX_UPLOAD_BYTES.
+var (
+	remoteFetchTimeout      = getEnvDuration("REMOTE_FETCH_TIMEOUT", 15*time.Second)
+	remoteFetchMaxRedirects = getEnvInt64("REMOTE_FETCH_MAX_REDIRECTS", 3)
+)
+
+// Number of image decode/encode operations run at once, and how many more
+// requests may wait for a slot before being turned away with 503
+var (
+	imageWorkers    = int(getEnvInt64("IMAGE_WORKERS", int64(runtime.NumCPU())))
+	imageQueueLimit = getEnvInt64("IMAGE_QUEUE_LIMIT", 16)
+)
+
+// Directory holding the category directories of uploaded photos. Relative
+// paths are resolved against the working directory.
+var photoDir = getEnv("PHOTO_DIR", "photos")
+
+// Directory database backups are written to. Relative paths are resolved
+// against the working directory.
+var backupDir = getEnv("BACKUP_DIR", "backups")
+
+// Certificate and key for serving HTTPS directly. Both unset (the default)
+// serves plain HTTP, for deployments where a proxy terminates TLS.
+var (
+	tlsCertFile = getEnv("TLS_CERT_FILE", "")
+	tlsKeyFile  = getEnv("TLS_KEY_FILE", "")
+)
+
+// Redirect plain HTTP requests to HTTPS. Behind a proxy that terminates TLS,
+// requests from the addresses or CIDR ranges in TRUSTED_PROXIES count as
+// HTTPS when their X-Forwarded-Proto says so; the header is ignored from
+// anywhere else.
+var (
+	forceHTTPS           = getEnvBool("FORCE_HTTPS", false)
+	trustedProxiesConfig = getEnvList("TRUSTED_PROXIES")
+)
+
+// Lifetime of login tokens, for a normal session and with "remember me"
+var (
+	sessionTTL    = getEnvDuration("SESSION_TTL", 2*time.Hour)
+	rememberMeTTL = getEnvDuration("REMEMBER_ME_TTL", 30*24*time.Hour)
+)
+
+// Sessions unused for this long stop being accepted before their token
+// expires, so the user has to log in again. Unset, only the token's expiry
+// ends a session.
+var sessionIdleTimeout = getEnvDuration("SESSION_IDLE_TIMEOUT", 0)
+
+// Wrong passwords a user may submit to the password confirmation endpoint
+// within the window before further attempts are refused. Two-factor codes
+// count towards the same limit. Zero means unlimited.
+var (
+	verifyPasswordMaxAttempts = getEnvInt64("VERIFY_PASSWORD_MAX_ATTEMPTS", 5)
+	verifyPasswordWindow      = getEnvDuration("VERIFY_PASSWORD_WINDOW", 15*time.Minute)
+)
+
+// Name authenticator apps show next to the account when two-factor login is
+// set up
+var totpIssuer = getEnv("TOTP_ISSUER", "Portfolio")
+
+// A client viewing the same photo again within viewDebounce isn't counted
+// again. Counts are written to the database every viewFlushInterval.
+var (
+	viewDebounce      = getEnvDuration("VIEW_DEBOUNCE", 30*time.Minute)
+	viewFlushInterval = getEnvDuration("VIEW_FLUSH_INTERVAL", 30*time.Second)
+)
+
+// Spooled uploads older than tempFileMaxAge, left behind when the server
+// stopped mid-upload, are removed every tempSweepInterval
+var (
+	tempSweepInterval = getEnvDuration("TEMP_SWEEP_INTERVAL", time.Hour)
+	tempFileMaxAge    = getEnvDuration("TEMP_FILE_MAX_AGE", time.Hour)
+)
+
+// Categories in which only admins may edit and delete photos, as a
+// comma-separated list and/or a file naming one per line
+var (
+	protectedCategoriesList = getEnvList("PROTECTED_CATEGORIES")
+	protectedCategoriesFile = getEnv("PROTECTED_CATEGORIES_FILE", "")
+)
+
+// Named widths of the extra thumbnails made for responsive layouts, such as
+// "sm=200,md=600,lg=1200". Photos made with other presets are regenerated at
+// startup.
+var thumbnailPresetsConfig = getEnv("THUMBNAIL_PRESETS", "")
+
+// Include the underlying error in responses for server-side failures, for
+// development. Off, clients get a generic message and the error is only
+// logged.
+var debugErrors = getEnvBool("DEBUG_ERRORS", false)
+
+// Content types each category accepts, narrowing the formats the server can
+// decode, such as "photography=image/jpeg,image/tiff;digital-sketches=image/png".
+// Categories not listed accept every supported type.
+var categoryContentTypesConfig = getEnv("CATEGORY_CONTENT_TYPES", "")
+
+// Most photos each category may hold, such as "featured=12;photography=200".
+// Admins can change a category's cap at runtime and aren't held to it.
+// Categories not listed are uncapped.
+var categoryMaxPhotosConfig = getEnv("CATEGORY_MAX_PHOTOS", "")
+
+// Color transparent images are laid over when saved as JPEG, which has no
+// alpha channel, as a #rrggbb hex string
+var jpegBackgroundConfig = getEnv("JPEG_BACKGROUND", "#ffffff")
+
+// Quality, from 1 to 100, of every JPEG the server writes: converted and
+// downscaled uploads, thumbnails, presets and resized copies. Lower values
+// give smaller files. Files already written keep the quality they were
+// written with.
+var jpegQuality = getEnvInt64("JPEG_QUALITY", 90)
+
+// Compression of the PNGs the server writes: "default", "fast", "best" or
+// "none". Only the time taken and file size differ; PNG is lossless.
+var pngCompression = getEnvChoice("PNG_COMPRESSION", "default", "default", "fast", "best", "none")
+
+// Length and alphabet of new photo IDs. The alphabet is "hex", "base62", or
+// the characters to draw from, which must be letters, digits, '-' or '_' so
+// IDs need no escaping in URLs. Existing photos keep the IDs they were given.
+// Mixed-case alphabets need a case-sensitive filesystem under PHOTO_DIR.
+var (
+	photoIDLength   = getEnvInt64("PHOTO_ID_LENGTH", 32)
+	photoIDAlphabet = getEnv("PHOTO_ID_ALPHABET", "hex")
+)
+
+// Who may register: "open" lets anyone sign up, "invite" requires an
+// admin-issued invite token, "closed" turns registration off
+var registrationMode = getEnvChoice("REGISTRATION_MODE", "open", "open", "invite", "closed")
+
+// Publication state of new photos when the upload doesn't choose one.
+// Drafts are only visible to their owner until published.
+var defaultPhotoStatus = getEnvChoice("DEFAULT_PHOTO_STATUS", "published", "published", "draft")
+
+// OpenTelemetry trace export, named as in the OpenTelemetry specification.
+// With no endpoint set tracing is off. Spans are sent as OTLP over HTTP in
+// its protobuf encoding, the only protocol supported.
+var (
+	otlpEndpoint       = getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	otlpTracesEndpoint = getEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	otlpHeaders        = getEnv("OTEL_EXPORTER_OTLP_HEADERS", "")
+	otlpProtocol       = getEnvChoice("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf", "http/protobuf")
+	otelServiceName    = getEnv("OTEL_SERVICE_NAME", "portfolio-backend")
+)
+
+// Read a string setting from the environment, falling back to def when unset
+func getEnv(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// Read a comma-separated list setting, skipping empty entries
+func getEnvList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Read a setting that must be one of choices, falling back to def when unset
+func getEnvChoice(key, def string, choices ...string) string {
+	value := getEnv(key, def)
+	for _, choice := range choices {
+		if value == choice {
+			return value
+		}
+	}
+	log.Fatalf("Invalid value for %s: %q", key, value)
+	return ""
+}
+
+// Read a boolean setting from the environment, falling back to def when unset
+func getEnvBool(key string, def bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("Invalid value for %s: %q", key, value)
+	}
+	return b
+}
+
+// Read an integer setting from the environment, falling back to def when unset
+func getEnvInt64(key string, def int64) int64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		log.Fatalf("Invalid value for %s: %q", key, value)
+	}
+	return n
+}
+
+// Read a duration setting such as "2h" or "720h" from the environment,
+// falling back to def when unset
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Fatalf("Invalid value for %s: %q", key, value)
+	}
+	return d
+}
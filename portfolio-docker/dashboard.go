@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// How long a user's dashboard totals are reused before being recomputed
+var dashboardCacheTTL = getEnvDuration("DASHBOARD_CACHE_TTL", 30*time.Second)
+
+// DashboardResponse summarizes a user's portfolio for the dashboard homepage
+type DashboardResponse struct {
+	TotalPhotos      int64            `json:"totalPhotos"`
+	PhotosByCategory map[string]int64 `json:"photosByCategory"` // Every category, including empty ones
+	UploadsThisMonth int64            `json:"uploadsThisMonth"` // Since the start of the month in UTC
+	StorageBytes     int64            `json:"storageBytes"`
+	// Most viewed photo as of the last view flush; null until a photo has
+	// been viewed
+	MostViewed  *PhotoResponse `json:"mostViewed"`
+	GeneratedAt string         `json:"generatedAt"`
+}
+
+// A computed dashboard and when it stops being served
+type cachedDashboard struct {
+	dashboard DashboardResponse
+	expires   time.Time
+}
+
+// Dashboards computed recently, by user ID
+var (
+	dashboardCacheMu sync.Mutex
+	dashboardCache   = map[int64]cachedDashboard{}
+)
+
+// Compute a user's dashboard totals with grouped queries
+func buildDashboard(ctx context.Context, r *http.Request, userID int64) (DashboardResponse, error) {
+	now := time.Now().UTC()
+	dashboard := DashboardResponse{
+		PhotosByCategory: make(map[string]int64, len(photoCategories)),
+		GeneratedAt:      formatTimestamp(now),
+	}
+	for _, category := range photoCategories {
+		dashboard.PhotosByCategory[category] = 0
+	}
+
+	counts, err := queries.CountPhotosByCategoryForUser(ctx, userID)
+	if err != nil {
+		return dashboard, err
+	}
+	for _, count := range counts {
+		dashboard.PhotosByCategory[count.Category] = count.PhotoCount
+		dashboard.TotalPhotos += count.PhotoCount
+	}
+
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	dashboard.UploadsThisMonth, err = queries.CountPhotosCreatedSince(ctx, db.CountPhotosCreatedSinceParams{
+		UserID: userID,
+		Since:  monthStart,
+	})
+	if err != nil {
+		return dashboard, err
+	}
+
+	usage, err := queries.GetPhotoUsageByUser(ctx, userID)
+	if err != nil {
+		return dashboard, err
+	}
+	dashboard.StorageBytes = usage.TotalBytes
+
+	photo, err := queries.GetMostViewedPhotoByUser(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return dashboard, err
+	}
+	if err == nil {
+		mostViewed := photoResponseFromRow(r, photo)
+		dashboard.MostViewed = &mostViewed
+	}
+	return dashboard, nil
+}
+
+// Return the signed-in user's portfolio totals in one call. Results are
+// cached for DASHBOARD_CACHE_TTL, so new uploads can take that long to show.
+func dashboardHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+
+	dashboardCacheMu.Lock()
+	cached, ok := dashboardCache[userID]
+	dashboardCacheMu.Unlock()
+
+	if !ok || time.Now().After(cached.expires) {
+		dashboard, err := buildDashboard(requestContext(r), r, userID)
+		if err != nil {
+			respondWithDatabaseError(w, err)
+			return
+		}
+		cached = cachedDashboard{dashboard: dashboard, expires: time.Now().Add(dashboardCacheTTL)}
+
+		dashboardCacheMu.Lock()
+		dashboardCache[userID] = cached
+		// Drop other users' expired entries so the cache doesn't grow with
+		// every user who ever opened the dashboard
+		for id, entry := range dashboardCache {
+			if time.Now().After(entry.expires) {
+				delete(dashboardCache, id)
+			}
+		}
+		dashboardCacheMu.Unlock()
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(time.Until(cached.expires).Seconds())))
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    cached.dashboard,
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+// Fetch the signed-in user's dashboard
+func getDashboard(t *testing.T, token string) DashboardResponse {
+	t.Helper()
+	rec := doJSON(t, "GET", "/api/profile/dashboard", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var dashboard DashboardResponse
+	decodeResponse(t, rec, &dashboard)
+	return dashboard
+}
+
+func TestDashboard(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	ctx := context.Background()
+
+	empty := getDashboard(t, user.token)
+	if empty.TotalPhotos != 0 || empty.StorageBytes != 0 || empty.MostViewed != nil {
+		t.Errorf("new user's dashboard = %+v, want it empty", empty)
+	}
+	if len(empty.PhotosByCategory) != len(photoCategories) {
+		t.Errorf("dashboard lists %d categories, want all %d", len(empty.PhotosByCategory), len(photoCategories))
+	}
+
+	photos := []PhotoResponse{
+		uploadTestPhoto(t, user.token, "photography"),
+		uploadTestPhoto(t, user.token, "photography"),
+		uploadTestPhoto(t, user.token, "digital-sketches"),
+	}
+	uploadTestPhoto(t, other.token, "photography")
+	var storage int64
+	for _, photo := range photos {
+		row, err := queries.GetPhoto(ctx, photo.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		storage += row.SizeBytes
+	}
+	viewed := photos[1]
+	viewFile(t, viewed.Category+"/"+viewed.Filename, "192.0.2.50:1234")
+	viewFile(t, viewed.Category+"/"+viewed.Filename, "192.0.2.51:1234")
+	viewFile(t, photos[2].Category+"/"+photos[2].Filename, "192.0.2.50:1234")
+	if err := flushViews(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Served from the cache until it expires
+	if cached := getDashboard(t, user.token); cached.TotalPhotos != 0 {
+		t.Errorf("cached dashboard has %d photos, want 0", cached.TotalPhotos)
+	}
+	dashboardCacheMu.Lock()
+	delete(dashboardCache, user.id)
+	dashboardCacheMu.Unlock()
+
+	dashboard := getDashboard(t, user.token)
+	if dashboard.TotalPhotos != 3 || dashboard.UploadsThisMonth != 3 || dashboard.StorageBytes != storage {
+		t.Errorf("got %d photos, %d this month and %d bytes; want 3, 3 and %d",
+			dashboard.TotalPhotos, dashboard.UploadsThisMonth, dashboard.StorageBytes, storage)
+	}
+	for category, want := range map[string]int64{"photography": 2, "digital-sketches": 1, cappedCategory: 0} {
+		if got := dashboard.PhotosByCategory[category]; got != want {
+			t.Errorf("%d photos in %s, want %d", got, category, want)
+		}
+	}
+	if dashboard.MostViewed == nil || dashboard.MostViewed.ID != viewed.ID {
+		t.Errorf("most viewed = %+v, want %s", dashboard.MostViewed, viewed.ID)
+	}
+
+	expectStatus(t, doJSON(t, "GET", "/api/profile/dashboard", "", nil), http.StatusUnauthorized)
+}
@@ -0,0 +1,23 @@
+-- name: CreateAuditLogEntry :exec
+INSERT INTO audit_log (
+    actor_id,
+    action,
+    target_type,
+    target_id,
+    details
+) 
+VALUES (
+    ?, ?, ?, ?, ?
+);
+
+-- name: CountAuditLogByActor :one
+SELECT COUNT(*) FROM audit_log
+WHERE actor_id = ?;
+
+-- name: ListAuditLogByActor :many
+SELECT audit_log.id, audit_log.action, audit_log.target_type, audit_log.target_id, audit_log.details, audit_log.created_at, photos.title AS photo_title
+FROM audit_log
+LEFT JOIN photos ON audit_log.target_type = 'photo' AND photos.id = audit_log.target_id
+WHERE audit_log.actor_id = ?
+ORDER BY audit_log.id DESC
+LIMIT ? OFFSET ?;
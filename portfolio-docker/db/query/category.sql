@@ -0,0 +1,36 @@
+-- name: ListCategoryLabels :many
+SELECT * FROM category_labels
+ORDER BY category;
+
+-- name: SetCategoryLabel :exec
+INSERT INTO category_labels (
+    category,
+    label
+) 
+VALUES (
+    ?, ?
+) 
+ON CONFLICT (category) DO UPDATE SET label = excluded.label, updated_at = CURRENT_TIMESTAMP;
+
+-- name: DeleteCategoryLabel :exec
+DELETE FROM category_labels
+WHERE category = ?;
+
+-- name: GetCategoryLimit :one
+SELECT * FROM category_limits
+WHERE category = ?
+LIMIT 1;
+
+-- name: SetCategoryLimit :exec
+INSERT INTO category_limits (
+    category,
+    max_photos
+) 
+VALUES (
+    ?, ?
+) 
+ON CONFLICT (category) DO UPDATE SET max_photos = excluded.max_photos, updated_at = CURRENT_TIMESTAMP;
+
+-- name: DeleteCategoryLimit :exec
+DELETE FROM category_limits
+WHERE category = ?;
@@ -0,0 +1,65 @@
+-- name: CreateCollection :one
+INSERT INTO collections (
+    user_id,
+    name,
+    description
+) 
+VALUES (
+    ?, ?, ?
+) 
+RETURNING *;
+
+-- name: GetCollection :one
+SELECT * FROM collections
+WHERE id = ? 
+LIMIT 1;
+
+-- name: ListCollectionsByUser :many
+SELECT * FROM collections
+WHERE user_id = ?
+ORDER BY created_at DESC, id DESC;
+
+-- name: UpdateCollection :one
+UPDATE collections
+SET name = ?, description = ?
+WHERE id = ?
+RETURNING *;
+
+-- name: DeleteCollection :exec
+DELETE FROM collections
+WHERE id = ?;
+
+-- name: AddCollectionPhoto :execrows
+INSERT INTO collection_photos (collection_id, photo_id, position)
+SELECT sqlc.arg(collection_id), sqlc.arg(photo_id), COALESCE(MAX(position) + 1, 0)
+FROM collection_photos
+WHERE collection_id = sqlc.arg(collection_id)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveCollectionPhoto :execrows
+DELETE FROM collection_photos
+WHERE collection_id = ? AND photo_id = ?;
+
+-- name: ClearCollectionPhotos :exec
+DELETE FROM collection_photos
+WHERE collection_id = ?;
+
+-- name: RemovePhotoFromCollections :exec
+DELETE FROM collection_photos
+WHERE photo_id = ?;
+
+-- name: ListCollectionPhotoIDs :many
+SELECT photo_id FROM collection_photos
+WHERE collection_id = ?
+ORDER BY position;
+
+-- name: ListCollectionPhotos :many
+SELECT photos.* FROM photos
+JOIN collection_photos ON collection_photos.photo_id = photos.id
+WHERE collection_photos.collection_id = ?
+ORDER BY collection_photos.position;
+
+-- name: UpdateCollectionPhotoPosition :exec
+UPDATE collection_photos
+SET position = ?
+WHERE collection_id = ? AND photo_id = ?;
@@ -0,0 +1,26 @@
+-- name: CreateInvite :one
+INSERT INTO invites (
+    token,
+    created_by,
+    expires_at
+) 
+VALUES (
+    ?, ?, ?
+) 
+RETURNING *;
+
+-- name: GetInvite :one
+SELECT * FROM invites
+WHERE token = ? 
+LIMIT 1;
+
+-- name: ListInvites :many
+SELECT * FROM invites
+ORDER BY created_at DESC;
+
+-- name: UseInvite :execrows
+UPDATE invites
+SET 
+    used_by = ?, 
+    used_at = CURRENT_TIMESTAMP
+WHERE token = ? AND used_by IS NULL;
@@ -0,0 +1,242 @@
+-- name: CreatePhoto :one
+INSERT INTO photos (
+    id,
+    user_id,
+    filename,
+    title,
+    category,
+    size_bytes,
+    captured_at,
+    alt_text,
+    caption,
+    colors,
+    blurhash,
+    thumbnail,
+    original,
+    slug,
+    original_filename,
+    presets,
+    width,
+    height,
+    status,
+    tags
+) 
+VALUES (
+    ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+) 
+RETURNING *;
+
+-- name: CountPhotosByUser :one
+SELECT COUNT(*) FROM photos
+WHERE user_id = sqlc.arg(user_id)
+  AND (CAST(sqlc.arg(category) AS TEXT) = '' OR category = sqlc.arg(category));
+
+-- name: DeletePhoto :exec
+DELETE FROM photos
+WHERE id = ?;
+
+-- name: GetPhoto :one
+SELECT * FROM photos
+WHERE id = ? 
+LIMIT 1;
+
+-- name: CheckPhotoIDExists :one
+SELECT 
+    EXISTS(
+        SELECT 1 FROM photos WHERE id = ?1
+        UNION ALL
+        SELECT 1 FROM photo_tombstones WHERE photo_id = ?1
+    );
+
+-- name: GetPhotoUsageByUser :one
+SELECT 
+    COUNT(*) AS photo_count,
+    CAST(COALESCE(SUM(size_bytes), 0) AS INTEGER) AS total_bytes
+FROM photos
+WHERE user_id = ?;
+
+-- name: ListPhotosByCategory :many
+SELECT * FROM photos
+WHERE category = ?;
+
+-- name: ListPhotosByUser :many
+SELECT * FROM photos
+WHERE user_id = sqlc.arg(user_id)
+  AND (CAST(sqlc.arg(category) AS TEXT) = '' OR category = sqlc.arg(category))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: ListPhotosMissingDerivatives :many
+SELECT * FROM photos
+WHERE thumbnail = '' OR blurhash = '' OR colors = '' OR presets != ?
+ORDER BY created_at, id;
+
+-- name: ListPhotosWithStalePresets :many
+SELECT * FROM photos
+WHERE presets != ?
+ORDER BY id;
+
+-- name: ListPhotosWithoutBlurhash :many
+SELECT * FROM photos
+WHERE blurhash = '';
+
+-- name: UpdatePhotoBlurhash :exec
+UPDATE photos
+SET blurhash = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: UpdatePhotoCategory :one
+UPDATE photos
+SET category = ?, cover = 0, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: UpdatePhotoDerivatives :one
+UPDATE photos
+SET 
+    colors = ?, 
+    blurhash = ?, 
+    thumbnail = ?, 
+    presets = ?, 
+    width = ?, 
+    height = ?, 
+    version = version + 1, 
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: UpdatePhotoMetadata :one
+UPDATE photos
+SET 
+    title = ?, 
+    alt_text = ?, 
+    caption = ?, 
+    slug = ?, 
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: ReplacePhotoFile :one
+UPDATE photos
+SET 
+    filename = ?, 
+    size_bytes = ?, 
+    captured_at = ?, 
+    colors = ?, 
+    blurhash = ?, 
+    thumbnail = ?, 
+    original = ?, 
+    original_filename = ?, 
+    presets = ?, 
+    width = ?, 
+    height = ?, 
+    version = version + 1, 
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: ListPhotos :many
+SELECT * FROM photos
+ORDER BY id;
+
+-- name: ListAllPhotosByUser :many
+SELECT * FROM photos
+WHERE user_id = ?
+ORDER BY created_at, id;
+
+-- name: CheckSlugExists :one
+SELECT 
+    EXISTS(SELECT 1 FROM photos WHERE category = ? AND slug = ? AND id != ?);
+
+-- name: GetPhotoByFilename :one
+SELECT * FROM photos
+WHERE category = ? AND filename = ?
+LIMIT 1;
+
+-- name: GetRandomPublishedPhoto :one
+SELECT * FROM photos
+WHERE status = 'published'
+  AND (CAST(sqlc.arg(category) AS TEXT) = '' OR category = sqlc.arg(category))
+ORDER BY RANDOM()
+LIMIT 1;
+
+-- name: GetPhotoBySlug :one
+SELECT * FROM photos
+WHERE category = ? AND slug = ?
+LIMIT 1;
+
+-- name: ListPhotosChangedSince :many
+SELECT * FROM photos
+WHERE datetime(COALESCE(updated_at, created_at)) >= datetime(sqlc.arg(since))
+ORDER BY COALESCE(updated_at, created_at), id;
+
+-- name: CreatePhotoTombstone :exec
+INSERT OR REPLACE INTO photo_tombstones (
+    photo_id,
+    category
+) 
+VALUES (
+    ?, ?
+);
+
+-- name: ListPhotoTombstonesSince :many
+SELECT * FROM photo_tombstones
+WHERE datetime(deleted_at) >= datetime(sqlc.arg(since))
+ORDER BY deleted_at, photo_id;
+
+-- name: UpdatePhotoTags :exec
+UPDATE photos
+SET tags = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?;
+
+-- name: ClearCategoryCover :exec
+UPDATE photos
+SET cover = 0, updated_at = CURRENT_TIMESTAMP
+WHERE category = ? AND cover;
+
+-- name: UpdatePhotoCover :one
+UPDATE photos
+SET cover = ?, updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: ListCategoryCovers :many
+SELECT * FROM photos
+WHERE cover;
+
+-- name: AddPhotoViews :exec
+UPDATE photos
+SET views = views + ?
+WHERE id = ?;
+
+-- name: UpdatePhotoPresets :exec
+UPDATE photos
+SET presets = ?, width = ?, height = ?
+WHERE id = ?;
+
+-- name: UpdatePhotoStatus :one
+UPDATE photos
+SET status = ?, was_published = was_published OR status = 'published', updated_at = CURRENT_TIMESTAMP
+WHERE id = ?
+RETURNING *;
+
+-- name: CountPhotosByCategoryForUser :many
+SELECT category, COUNT(*) AS photo_count FROM photos
+WHERE user_id = ?
+GROUP BY category
+ORDER BY category;
+
+-- name: CountPhotosCreatedSince :one
+SELECT COUNT(*) FROM photos
+WHERE user_id = sqlc.arg(user_id)
+  AND datetime(created_at) >= datetime(sqlc.arg(since));
+
+-- name: GetMostViewedPhotoByUser :one
+SELECT * FROM photos
+WHERE user_id = ? AND views > 0
+ORDER BY views DESC, id
+LIMIT 1;
+
+-- name: CountPhotosInCategory :one
+SELECT COUNT(*) FROM photos
+WHERE category = ?;
@@ -0,0 +1,41 @@
+-- name: CreateSession :exec
+INSERT INTO sessions (
+    id,
+    user_id,
+    expires_at,
+    ip,
+    user_agent,
+    impersonated_by
+) 
+VALUES (
+    ?, ?, ?, ?, ?, ?
+);
+
+-- name: GetSession :one
+SELECT * FROM sessions
+WHERE id = ? 
+LIMIT 1;
+
+-- name: ListActiveSessionsByUser :many
+SELECT * FROM sessions
+WHERE user_id = ? AND revoked_at IS NULL AND datetime(expires_at) > datetime('now')
+ORDER BY COALESCE(last_used_at, created_at) DESC, id;
+
+-- name: TouchSession :exec
+UPDATE sessions
+SET last_used_at = CURRENT_TIMESTAMP, ip = ?
+WHERE id = ?;
+
+-- name: RevokeSession :execrows
+UPDATE sessions
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE id = ? AND user_id = ? AND revoked_at IS NULL;
+
+-- name: RevokeSessionsByUser :exec
+UPDATE sessions
+SET revoked_at = CURRENT_TIMESTAMP
+WHERE user_id = ? AND revoked_at IS NULL;
+
+-- name: DeleteExpiredSessionsByUser :exec
+DELETE FROM sessions
+WHERE user_id = ? AND datetime(expires_at) <= datetime('now');
@@ -0,0 +1,44 @@
+-- name: GetTOTPSecret :one
+SELECT * FROM totp_secrets
+WHERE user_id = ? 
+LIMIT 1;
+
+-- name: UpsertPendingTOTPSecret :execrows
+INSERT INTO totp_secrets (
+    user_id,
+    secret
+) 
+VALUES (
+    ?, ?
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret = excluded.secret, last_used_step = 0, created_at = CURRENT_TIMESTAMP
+WHERE totp_secrets.enabled_at IS NULL;
+
+-- name: EnableTOTPSecret :execrows
+UPDATE totp_secrets
+SET enabled_at = CURRENT_TIMESTAMP, last_used_step = ?
+WHERE user_id = ? AND enabled_at IS NULL;
+
+-- name: UseTOTPStep :execrows
+UPDATE totp_secrets
+SET last_used_step = sqlc.arg(step)
+WHERE user_id = sqlc.arg(user_id) AND last_used_step < sqlc.arg(step);
+
+-- name: CreateTOTPBackupCode :exec
+INSERT INTO totp_backup_codes (
+    user_id,
+    code_hash
+) 
+VALUES (
+    ?, ?
+);
+
+-- name: DeleteTOTPBackupCodes :exec
+DELETE FROM totp_backup_codes
+WHERE user_id = ?;
+
+-- name: UseTOTPBackupCode :execrows
+UPDATE totp_backup_codes
+SET used_at = CURRENT_TIMESTAMP
+WHERE user_id = ? AND code_hash = ? AND used_at IS NULL;
@@ -10,12 +10,22 @@ VALUES (
 ) 
 RETURNING id, name, email, created_at;
 
+-- name: GetUserAuthState :one
+SELECT 
+    token_version, 
+    role 
+FROM users
+WHERE id = ? 
+LIMIT 1;
+
 -- name: GetUserByEmail :one
 SELECT 
     id, 
     name, 
     email, 
-    password 
+    password, 
+    token_version, 
+    role 
 FROM users
 WHERE email = ? 
 LIMIT 1;
@@ -32,3 +42,52 @@ LIMIT 1;
 -- name: CheckEmailExists :one
 SELECT 
     EXISTS(SELECT 1 FROM users WHERE email = ?);
+
+-- name: GetUserRole :one
+SELECT 
+    role 
+FROM users
+WHERE id = ? 
+LIMIT 1;
+
+-- name: GetUserQuota :one
+SELECT 
+    quota_bytes, 
+    quota_photos 
+FROM users
+WHERE id = ? 
+LIMIT 1;
+
+-- name: UpdateUserQuota :execrows
+UPDATE users
+SET 
+    quota_bytes = ?, 
+    quota_photos = ?
+WHERE id = ?;
+
+-- name: GetUser :one
+SELECT * FROM users
+WHERE id = ? 
+LIMIT 1;
+
+-- name: IncrementUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = ?
+RETURNING token_version;
+
+-- name: SearchUsers :many
+SELECT 
+    id, 
+    name, 
+    email, 
+    role, 
+    created_at 
+FROM users
+WHERE name LIKE sqlc.arg(pattern) ESCAPE '\' OR email LIKE sqlc.arg(pattern) ESCAPE '\'
+ORDER BY name COLLATE NOCASE, id
+LIMIT sqlc.arg(limit) OFFSET sqlc.arg(offset);
+
+-- name: CountUsersMatching :one
+SELECT COUNT(*) FROM users
+WHERE name LIKE sqlc.arg(pattern) ESCAPE '\' OR email LIKE sqlc.arg(pattern) ESCAPE '\';
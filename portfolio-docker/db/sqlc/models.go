@@ -6,12 +6,125 @@ package db
 
 import (
 	"database/sql"
+	"time"
 )
 
-type User struct {
+type AuditLog struct {
+	ID         int64        `json:"id"`
+	ActorID    int64        `json:"actor_id"`
+	Action     string       `json:"action"`
+	TargetType string       `json:"target_type"`
+	TargetID   string       `json:"target_id"`
+	Details    string       `json:"details"`
+	CreatedAt  sql.NullTime `json:"created_at"`
+}
+
+type CategoryLabel struct {
+	Category  string       `json:"category"`
+	Label     string       `json:"label"`
+	UpdatedAt sql.NullTime `json:"updated_at"`
+}
+
+type CategoryLimit struct {
+	Category  string       `json:"category"`
+	MaxPhotos int64        `json:"max_photos"`
+	UpdatedAt sql.NullTime `json:"updated_at"`
+}
+
+type Collection struct {
+	ID          int64        `json:"id"`
+	UserID      int64        `json:"user_id"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	CreatedAt   sql.NullTime `json:"created_at"`
+}
+
+type CollectionPhoto struct {
+	CollectionID int64  `json:"collection_id"`
+	PhotoID      string `json:"photo_id"`
+	Position     int64  `json:"position"`
+}
+
+type Invite struct {
+	Token     string        `json:"token"`
+	CreatedBy int64         `json:"created_by"`
+	CreatedAt sql.NullTime  `json:"created_at"`
+	ExpiresAt time.Time     `json:"expires_at"`
+	UsedBy    sql.NullInt64 `json:"used_by"`
+	UsedAt    sql.NullTime  `json:"used_at"`
+}
+
+type Photo struct {
+	ID               string       `json:"id"`
+	UserID           int64        `json:"user_id"`
+	Filename         string       `json:"filename"`
+	Title            string       `json:"title"`
+	Category         string       `json:"category"`
+	SizeBytes        int64        `json:"size_bytes"`
+	CreatedAt        sql.NullTime `json:"created_at"`
+	CapturedAt       sql.NullTime `json:"captured_at"`
+	AltText          string       `json:"alt_text"`
+	Caption          string       `json:"caption"`
+	Colors           string       `json:"colors"`
+	Blurhash         string       `json:"blurhash"`
+	Thumbnail        string       `json:"thumbnail"`
+	Original         string       `json:"original"`
+	Version          int64        `json:"version"`
+	Slug             string       `json:"slug"`
+	UpdatedAt        sql.NullTime `json:"updated_at"`
+	Tags             string       `json:"tags"`
+	Cover            bool         `json:"cover"`
+	OriginalFilename string       `json:"original_filename"`
+	Views            int64        `json:"views"`
+	Presets          string       `json:"presets"`
+	Width            int64        `json:"width"`
+	Height           int64        `json:"height"`
+	Status           string       `json:"status"`
+	WasPublished     bool         `json:"was_published"`
+}
+
+type PhotoTombstone struct {
+	PhotoID   string       `json:"photo_id"`
+	Category  string       `json:"category"`
+	DeletedAt sql.NullTime `json:"deleted_at"`
+}
+
+type Session struct {
+	ID             string        `json:"id"`
+	UserID         int64         `json:"user_id"`
+	CreatedAt      sql.NullTime  `json:"created_at"`
+	ExpiresAt      time.Time     `json:"expires_at"`
+	LastUsedAt     sql.NullTime  `json:"last_used_at"`
+	Ip             string        `json:"ip"`
+	UserAgent      string        `json:"user_agent"`
+	ImpersonatedBy sql.NullInt64 `json:"impersonated_by"`
+	RevokedAt      sql.NullTime  `json:"revoked_at"`
+}
+
+type TotpBackupCode struct {
 	ID        int64        `json:"id"`
-	Name      string       `json:"name"`
-	Email     string       `json:"email"`
-	Password  string       `json:"password"`
+	UserID    int64        `json:"user_id"`
+	CodeHash  string       `json:"code_hash"`
+	UsedAt    sql.NullTime `json:"used_at"`
 	CreatedAt sql.NullTime `json:"created_at"`
 }
+
+type TotpSecret struct {
+	UserID       int64        `json:"user_id"`
+	Secret       string       `json:"secret"`
+	EnabledAt    sql.NullTime `json:"enabled_at"`
+	LastUsedStep int64        `json:"last_used_step"`
+	CreatedAt    sql.NullTime `json:"created_at"`
+}
+
+type User struct {
+	ID           int64         `json:"id"`
+	Name         string        `json:"name"`
+	Email        string        `json:"email"`
+	Password     string        `json:"password"`
+	CreatedAt    sql.NullTime  `json:"created_at"`
+	Role         string        `json:"role"`
+	QuotaBytes   sql.NullInt64 `json:"quota_bytes"`
+	QuotaPhotos  sql.NullInt64 `json:"quota_photos"`
+	TokenVersion int64         `json:"token_version"`
+}
@@ -9,10 +9,93 @@ import (
 )
 
 type Querier interface {
+	AddCollectionPhoto(ctx context.Context, arg AddCollectionPhotoParams) (int64, error)
+	AddPhotoViews(ctx context.Context, arg AddPhotoViewsParams) error
 	CheckEmailExists(ctx context.Context, email string) (int64, error)
+	CheckPhotoIDExists(ctx context.Context, id string) (int64, error)
+	CheckSlugExists(ctx context.Context, arg CheckSlugExistsParams) (int64, error)
+	ClearCategoryCover(ctx context.Context, category string) error
+	ClearCollectionPhotos(ctx context.Context, collectionID int64) error
+	CountAuditLogByActor(ctx context.Context, actorID int64) (int64, error)
+	CountPhotosByCategoryForUser(ctx context.Context, userID int64) ([]CountPhotosByCategoryForUserRow, error)
+	CountPhotosByUser(ctx context.Context, arg CountPhotosByUserParams) (int64, error)
+	CountPhotosCreatedSince(ctx context.Context, arg CountPhotosCreatedSinceParams) (int64, error)
+	CountPhotosInCategory(ctx context.Context, category string) (int64, error)
+	CountUsersMatching(ctx context.Context, pattern string) (int64, error)
+	CreateAuditLogEntry(ctx context.Context, arg CreateAuditLogEntryParams) error
+	CreateCollection(ctx context.Context, arg CreateCollectionParams) (Collection, error)
+	CreateInvite(ctx context.Context, arg CreateInviteParams) (Invite, error)
+	CreatePhoto(ctx context.Context, arg CreatePhotoParams) (Photo, error)
+	CreatePhotoTombstone(ctx context.Context, arg CreatePhotoTombstoneParams) error
+	CreateSession(ctx context.Context, arg CreateSessionParams) error
+	CreateTOTPBackupCode(ctx context.Context, arg CreateTOTPBackupCodeParams) error
 	CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error)
+	DeleteCategoryLabel(ctx context.Context, category string) error
+	DeleteCategoryLimit(ctx context.Context, category string) error
+	DeleteCollection(ctx context.Context, id int64) error
+	DeleteExpiredSessionsByUser(ctx context.Context, userID int64) error
+	DeletePhoto(ctx context.Context, id string) error
+	DeleteTOTPBackupCodes(ctx context.Context, userID int64) error
+	EnableTOTPSecret(ctx context.Context, arg EnableTOTPSecretParams) (int64, error)
+	GetCategoryLimit(ctx context.Context, category string) (CategoryLimit, error)
+	GetCollection(ctx context.Context, id int64) (Collection, error)
+	GetInvite(ctx context.Context, token string) (Invite, error)
+	GetMostViewedPhotoByUser(ctx context.Context, userID int64) (Photo, error)
+	GetPhoto(ctx context.Context, id string) (Photo, error)
+	GetPhotoByFilename(ctx context.Context, arg GetPhotoByFilenameParams) (Photo, error)
+	GetPhotoBySlug(ctx context.Context, arg GetPhotoBySlugParams) (Photo, error)
+	GetPhotoUsageByUser(ctx context.Context, userID int64) (GetPhotoUsageByUserRow, error)
+	GetRandomPublishedPhoto(ctx context.Context, category string) (Photo, error)
+	GetSession(ctx context.Context, id string) (Session, error)
+	GetTOTPSecret(ctx context.Context, userID int64) (TotpSecret, error)
+	GetUser(ctx context.Context, id int64) (User, error)
+	GetUserAuthState(ctx context.Context, id int64) (GetUserAuthStateRow, error)
 	GetUserByEmail(ctx context.Context, email string) (GetUserByEmailRow, error)
 	GetUserByID(ctx context.Context, id int64) (GetUserByIDRow, error)
+	GetUserQuota(ctx context.Context, id int64) (GetUserQuotaRow, error)
+	GetUserRole(ctx context.Context, id int64) (string, error)
+	IncrementUserTokenVersion(ctx context.Context, id int64) (int64, error)
+	ListActiveSessionsByUser(ctx context.Context, userID int64) ([]Session, error)
+	ListAllPhotosByUser(ctx context.Context, userID int64) ([]Photo, error)
+	ListAuditLogByActor(ctx context.Context, arg ListAuditLogByActorParams) ([]ListAuditLogByActorRow, error)
+	ListCategoryCovers(ctx context.Context) ([]Photo, error)
+	ListCategoryLabels(ctx context.Context) ([]CategoryLabel, error)
+	ListCollectionPhotoIDs(ctx context.Context, collectionID int64) ([]string, error)
+	ListCollectionPhotos(ctx context.Context, collectionID int64) ([]Photo, error)
+	ListCollectionsByUser(ctx context.Context, userID int64) ([]Collection, error)
+	ListInvites(ctx context.Context) ([]Invite, error)
+	ListPhotoTombstonesSince(ctx context.Context, since interface{}) ([]PhotoTombstone, error)
+	ListPhotos(ctx context.Context) ([]Photo, error)
+	ListPhotosByCategory(ctx context.Context, category string) ([]Photo, error)
+	ListPhotosByUser(ctx context.Context, arg ListPhotosByUserParams) ([]Photo, error)
+	ListPhotosChangedSince(ctx context.Context, since interface{}) ([]Photo, error)
+	ListPhotosMissingDerivatives(ctx context.Context, presets string) ([]Photo, error)
+	ListPhotosWithStalePresets(ctx context.Context, presets string) ([]Photo, error)
+	ListPhotosWithoutBlurhash(ctx context.Context) ([]Photo, error)
+	RemoveCollectionPhoto(ctx context.Context, arg RemoveCollectionPhotoParams) (int64, error)
+	RemovePhotoFromCollections(ctx context.Context, photoID string) error
+	ReplacePhotoFile(ctx context.Context, arg ReplacePhotoFileParams) (Photo, error)
+	RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error)
+	RevokeSessionsByUser(ctx context.Context, userID int64) error
+	SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error)
+	SetCategoryLabel(ctx context.Context, arg SetCategoryLabelParams) error
+	SetCategoryLimit(ctx context.Context, arg SetCategoryLimitParams) error
+	TouchSession(ctx context.Context, arg TouchSessionParams) error
+	UpdateCollection(ctx context.Context, arg UpdateCollectionParams) (Collection, error)
+	UpdateCollectionPhotoPosition(ctx context.Context, arg UpdateCollectionPhotoPositionParams) error
+	UpdatePhotoBlurhash(ctx context.Context, arg UpdatePhotoBlurhashParams) error
+	UpdatePhotoCategory(ctx context.Context, arg UpdatePhotoCategoryParams) (Photo, error)
+	UpdatePhotoCover(ctx context.Context, arg UpdatePhotoCoverParams) (Photo, error)
+	UpdatePhotoDerivatives(ctx context.Context, arg UpdatePhotoDerivativesParams) (Photo, error)
+	UpdatePhotoMetadata(ctx context.Context, arg UpdatePhotoMetadataParams) (Photo, error)
+	UpdatePhotoPresets(ctx context.Context, arg UpdatePhotoPresetsParams) error
+	UpdatePhotoStatus(ctx context.Context, arg UpdatePhotoStatusParams) (Photo, error)
+	UpdatePhotoTags(ctx context.Context, arg UpdatePhotoTagsParams) error
+	UpdateUserQuota(ctx context.Context, arg UpdateUserQuotaParams) (int64, error)
+	UpsertPendingTOTPSecret(ctx context.Context, arg UpsertPendingTOTPSecretParams) (int64, error)
+	UseInvite(ctx context.Context, arg UseInviteParams) (int64, error)
+	UseTOTPBackupCode(ctx context.Context, arg UseTOTPBackupCodeParams) (int64, error)
+	UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error)
 }
 
 var _ Querier = (*Queries)(nil)
@@ -22,6 +22,18 @@ func (q *Queries) CheckEmailExists(ctx context.Context, email string) (int64, er
 	return column_1, err
 }
 
+const countUsersMatching = `-- name: CountUsersMatching :one
+SELECT COUNT(*) FROM users
+WHERE name LIKE ?1 ESCAPE '\' OR email LIKE ?1 ESCAPE '\'
+`
+
+func (q *Queries) CountUsersMatching(ctx context.Context, pattern string) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUsersMatching, pattern)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
     name,
@@ -59,22 +71,70 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateU
 	return i, err
 }
 
+const getUser = `-- name: GetUser :one
+SELECT id, name, email, password, created_at, role, quota_bytes, quota_photos, token_version FROM users
+WHERE id = ? 
+LIMIT 1
+`
+
+func (q *Queries) GetUser(ctx context.Context, id int64) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Email,
+		&i.Password,
+		&i.CreatedAt,
+		&i.Role,
+		&i.QuotaBytes,
+		&i.QuotaPhotos,
+		&i.TokenVersion,
+	)
+	return i, err
+}
+
+const getUserAuthState = `-- name: GetUserAuthState :one
+SELECT 
+    token_version, 
+    role 
+FROM users
+WHERE id = ? 
+LIMIT 1
+`
+
+type GetUserAuthStateRow struct {
+	TokenVersion int64  `json:"token_version"`
+	Role         string `json:"role"`
+}
+
+func (q *Queries) GetUserAuthState(ctx context.Context, id int64) (GetUserAuthStateRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserAuthState, id)
+	var i GetUserAuthStateRow
+	err := row.Scan(&i.TokenVersion, &i.Role)
+	return i, err
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
 SELECT 
     id, 
     name, 
     email, 
-    password 
+    password, 
+    token_version, 
+    role 
 FROM users
 WHERE email = ? 
 LIMIT 1
 `
 
 type GetUserByEmailRow struct {
-	ID       int64  `json:"id"`
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	Password     string `json:"password"`
+	TokenVersion int64  `json:"token_version"`
+	Role         string `json:"role"`
 }
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (GetUserByEmailRow, error) {
@@ -85,6 +145,8 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (GetUserByEm
 		&i.Name,
 		&i.Email,
 		&i.Password,
+		&i.TokenVersion,
+		&i.Role,
 	)
 	return i, err
 }
@@ -111,3 +173,131 @@ func (q *Queries) GetUserByID(ctx context.Context, id int64) (GetUserByIDRow, er
 	err := row.Scan(&i.ID, &i.Name, &i.Email)
 	return i, err
 }
+
+const getUserQuota = `-- name: GetUserQuota :one
+SELECT 
+    quota_bytes, 
+    quota_photos 
+FROM users
+WHERE id = ? 
+LIMIT 1
+`
+
+type GetUserQuotaRow struct {
+	QuotaBytes  sql.NullInt64 `json:"quota_bytes"`
+	QuotaPhotos sql.NullInt64 `json:"quota_photos"`
+}
+
+func (q *Queries) GetUserQuota(ctx context.Context, id int64) (GetUserQuotaRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserQuota, id)
+	var i GetUserQuotaRow
+	err := row.Scan(&i.QuotaBytes, &i.QuotaPhotos)
+	return i, err
+}
+
+const getUserRole = `-- name: GetUserRole :one
+SELECT 
+    role 
+FROM users
+WHERE id = ? 
+LIMIT 1
+`
+
+func (q *Queries) GetUserRole(ctx context.Context, id int64) (string, error) {
+	row := q.db.QueryRowContext(ctx, getUserRole, id)
+	var role string
+	err := row.Scan(&role)
+	return role, err
+}
+
+const incrementUserTokenVersion = `-- name: IncrementUserTokenVersion :one
+UPDATE users
+SET token_version = token_version + 1
+WHERE id = ?
+RETURNING token_version
+`
+
+func (q *Queries) IncrementUserTokenVersion(ctx context.Context, id int64) (int64, error) {
+	row := q.db.QueryRowContext(ctx, incrementUserTokenVersion, id)
+	var token_version int64
+	err := row.Scan(&token_version)
+	return token_version, err
+}
+
+const searchUsers = `-- name: SearchUsers :many
+SELECT 
+    id, 
+    name, 
+    email, 
+    role, 
+    created_at 
+FROM users
+WHERE name LIKE ?1 ESCAPE '\' OR email LIKE ?1 ESCAPE '\'
+ORDER BY name COLLATE NOCASE, id
+LIMIT ?2 OFFSET ?3
+`
+
+type SearchUsersParams struct {
+	Pattern string `json:"pattern"`
+	Limit   int64  `json:"limit"`
+	Offset  int64  `json:"offset"`
+}
+
+type SearchUsersRow struct {
+	ID        int64        `json:"id"`
+	Name      string       `json:"name"`
+	Email     string       `json:"email"`
+	Role      string       `json:"role"`
+	CreatedAt sql.NullTime `json:"created_at"`
+}
+
+func (q *Queries) SearchUsers(ctx context.Context, arg SearchUsersParams) ([]SearchUsersRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchUsers, arg.Pattern, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchUsersRow
+	for rows.Next() {
+		var i SearchUsersRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Email,
+			&i.Role,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateUserQuota = `-- name: UpdateUserQuota :execrows
+UPDATE users
+SET 
+    quota_bytes = ?, 
+    quota_photos = ?
+WHERE id = ?
+`
+
+type UpdateUserQuotaParams struct {
+	QuotaBytes  sql.NullInt64 `json:"quota_bytes"`
+	QuotaPhotos sql.NullInt64 `json:"quota_photos"`
+	ID          int64         `json:"id"`
+}
+
+func (q *Queries) UpdateUserQuota(ctx context.Context, arg UpdateUserQuotaParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, updateUserQuota, arg.QuotaBytes, arg.QuotaPhotos, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
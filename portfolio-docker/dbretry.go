@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Attempts made at a query that fails with a transient error, and the wait
+// between them, which doubles from dbRetryBaseDelay up to dbRetryMaxDelay
+const (
+	dbRetryAttempts  = 5
+	dbRetryBaseDelay = 20 * time.Millisecond
+	dbRetryMaxDelay  = 500 * time.Millisecond
+)
+
+// Whether err is SQLite reporting that another connection holds a lock the
+// query needs, which clears once that connection is done. The driver has
+// already waited out its busy timeout by the time it reports one.
+func isTransientDBError(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// Run a single-statement query, retrying transient errors with exponential
+// backoff. Statements in a transaction mustn't be retried this way: the
+// transaction keeps its locks while waiting, so it's the whole transaction
+// that would need retrying.
+func withRetry[T any](ctx context.Context, query func() (T, error)) (T, error) {
+	delay := dbRetryBaseDelay
+	for attempt := 1; ; attempt++ {
+		result, err := query()
+		if err == nil || attempt == dbRetryAttempts || !isTransientDBError(err) {
+			return result, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, dbRetryMaxDelay)
+	}
+}
+
+// withRetry for queries that only return an error
+func execWithRetry(ctx context.Context, exec func() error) error {
+	_, err := withRetry(ctx, func() (struct{}, error) {
+		return struct{}{}, exec()
+	})
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+var errBusy = sqlite3.Error{Code: sqlite3.ErrBusy}
+
+func TestIsTransientDBError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{errBusy, true},
+		{sqlite3.Error{Code: sqlite3.ErrLocked}, true},
+		{fmt.Errorf("saving: %w", errBusy), true},
+		{sqlite3.Error{Code: sqlite3.ErrConstraint}, false},
+		{errors.New("database is locked"), false},
+	}
+	for _, tt := range tests {
+		if got := isTransientDBError(tt.err); got != tt.want {
+			t.Errorf("isTransientDBError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	ctx := context.Background()
+
+	calls := 0
+	got, err := withRetry(ctx, func() (int, error) {
+		calls++
+		if calls < 3 {
+			return 0, errBusy
+		}
+		return 42, nil
+	})
+	if got != 42 || err != nil || calls != 3 {
+		t.Errorf("withRetry() = %d, %v after %d calls; want 42 after 3", got, err, calls)
+	}
+
+	calls = 0
+	err = execWithRetry(ctx, func() error {
+		calls++
+		return errBusy
+	})
+	if !isTransientDBError(err) || calls != dbRetryAttempts {
+		t.Errorf("execWithRetry() = %v after %d calls; want busy after %d", err, calls, dbRetryAttempts)
+	}
+
+	// Other errors aren't retried
+	calls = 0
+	constraint := sqlite3.Error{Code: sqlite3.ErrConstraint}
+	err = execWithRetry(ctx, func() error {
+		calls++
+		return constraint
+	})
+	if calls != 1 {
+		t.Errorf("non-transient error tried %d times, want once", calls)
+	}
+
+	// Nor is anything once the request is cancelled
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	calls = 0
+	execWithRetry(cancelled, func() error {
+		calls++
+		return errBusy
+	})
+	if calls != 1 {
+		t.Errorf("cancelled query tried %d times, want once", calls)
+	}
+}
+
+func TestRetriesExhaustedRespond503(t *testing.T) {
+	err := execWithRetry(context.Background(), func() error { return errBusy })
+	rec := httptest.NewRecorder()
+	respondWithDatabaseError(rec, err)
+	expectStatus(t, rec, http.StatusServiceUnavailable)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("503 without Retry-After")
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// Longest original filename kept, in bytes
+const maxOriginalFilenameLength = 255
+
+// Reduce a client-supplied filename to something safe to store and to send
+// back in a Content-Disposition header: the last path element only, without
+// control characters, quotes or characters Windows forbids, and not hidden.
+// Returns "" when nothing usable is left. The name is only ever metadata;
+// files on disk keep their generated names.
+func sanitizeFilename(name string) string {
+	// Browsers on Windows may send the full path, with either separator
+	name = name[strings.LastIndexAny(name, `/\`)+1:]
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == utf8.RuneError, unicode.IsControl(r), strings.ContainsRune(`"*:<>?|`, r):
+			return -1
+		case unicode.IsSpace(r):
+			return ' '
+		}
+		return r
+	}, name)
+	name = strings.Join(strings.Fields(name), " ")
+	name = strings.TrimLeft(name, ". ")
+	name = strings.TrimRight(name, ". ")
+
+	// Shorten long names from the end of the stem so the extension survives
+	if len(name) > maxOriginalFilenameLength {
+		ext := filepath.Ext(name)
+		if len(ext) > 16 {
+			ext = ""
+		}
+		stem := name[:maxOriginalFilenameLength-len(ext)]
+		for !utf8.ValidString(stem) {
+			stem = stem[:len(stem)-1]
+		}
+		name = strings.TrimRight(stem, ". ") + ext
+	}
+	return name
+}
+
+// Name a photo is downloaded as: its original filename when one was kept,
+// otherwise its slug or ID. The extension is always that of the stored
+// file, which differs from the uploaded one when the upload was converted.
+func downloadFilename(photoID, slug, originalFilename, storedFilename string) string {
+	ext := filepath.Ext(storedFilename)
+	name := originalFilename
+	if name == "" {
+		name = slug
+	}
+	if name == "" {
+		name = photoID
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ext
+}
+
+// Download a photo's file as an attachment
+func downloadPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	photo, err := queries.GetPhoto(requestContext(r), mux.Vars(r)["id"])
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !photoVisible(r, photo)) {
+		respondWithError(w, http.StatusNotFound, "Photo not found")
+		return
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	// FormatMediaType switches to the RFC 2231 encoding for names that
+	// aren't plain ASCII
+	filename := downloadFilename(photo.ID, photo.Slug, photo.OriginalFilename, photo.Filename)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	recordView(r, photo.ID)
+	http.ServeFile(w, r, filepath.Join(photoDir, photo.Category, photo.Filename))
+}
+
+// hidePrivateFiles wraps the static photo file server, answering 404 for
+// archived originals, which only their owner may download, and for hidden
+// files such as uploads in progress and the resize cache
+func hidePrivateFiles(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, elem := range strings.Split(path.Clean("/"+r.URL.Path), "/") {
+			if elem == originalsDir || strings.HasPrefix(elem, ".") {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Download the file a photo was uploaded as, for its owner. That's the
+// archived original when the upload was converted or downscaled with
+// KEEP_ORIGINALS set, and otherwise the stored file, which is only
+// different from the upload when an original wasn't kept.
+func downloadOriginalHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+
+	photo, err := queries.GetPhoto(requestContext(r), mux.Vars(r)["id"])
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Photo not found")
+		return
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if photo.UserID != userID {
+		respondForbidden(w, "You can only download originals of your own photos")
+		return
+	}
+
+	file := photo.Filename
+	if photo.Original != "" {
+		file = photo.Original
+	}
+
+	filename := downloadFilename(photo.ID, photo.Slug, photo.OriginalFilename, file)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	http.ServeFile(w, r, filepath.Join(photoDir, photo.Category, file))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDownloadFilename(t *testing.T) {
+	tests := []struct {
+		original, slug, stored string
+		want                   string
+	}{
+		{"My Holiday.png", "holiday", "abc.png", "My Holiday.png"},
+		{"scan.tiff", "", "abc.png", "scan.png"},
+		{"", "holiday", "abc.jpg", "holiday.jpg"},
+		{"", "", "abc.jpg", "abc.jpg"},
+	}
+	for _, tt := range tests {
+		if got := downloadFilename("abc", tt.slug, tt.original, tt.stored); got != tt.want {
+			t.Errorf("downloadFilename(%q, %q, %q) = %q, want %q", tt.slug, tt.original, tt.stored, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadOriginal(t *testing.T) {
+	owner := newTestUser(t)
+	other := newTestUser(t)
+	oldDimension, oldKeep, oldPreserve := maxImageDimension, keepOriginals, preserveFilenames
+	maxImageDimension, keepOriginals, preserveFilenames = 16, true, true
+	t.Cleanup(func() { maxImageDimension, keepOriginals, preserveFilenames = oldDimension, oldKeep, oldPreserve })
+
+	uploaded := testPNG(t, 32, 32, testColor)
+	rec := uploadFile(t, owner.token, "photography", "My Holiday.png", uploaded)
+	expectStatus(t, rec, http.StatusCreated)
+	var photo PhotoResponse
+	decodeResponse(t, rec, &photo)
+
+	// The public file was downscaled; the original is untouched
+	public := doRequest(t, "GET", "/photos/photography/"+photo.Filename, "", "", nil)
+	expectStatus(t, public, http.StatusOK)
+	if bytes.Equal(public.Body.Bytes(), uploaded) {
+		t.Fatal("public file wasn't processed, so can't be told from the original")
+	}
+
+	rec = doJSON(t, "GET", "/api/photos/"+photo.ID+"/original", owner.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if !bytes.Equal(rec.Body.Bytes(), uploaded) {
+		t.Errorf("downloaded %d bytes that differ from the %d uploaded", rec.Body.Len(), len(uploaded))
+	}
+	disposition, params, err := mime.ParseMediaType(rec.Header().Get("Content-Disposition"))
+	if err != nil || disposition != "attachment" || params["filename"] != "My Holiday.png" {
+		t.Errorf("Content-Disposition = %q, want an attachment named My Holiday.png", rec.Header().Get("Content-Disposition"))
+	}
+
+	// Nor is it served as a static file
+	row, err := queries.GetPhoto(context.Background(), photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Original == "" {
+		t.Fatal("no original was kept")
+	}
+	expectStatus(t, doRequest(t, "GET", "/photos/photography/"+row.Original, "", "", nil), http.StatusNotFound)
+	expectStatus(t, doRequest(t, "GET", "/photos/photography/"+originalsDir+"/", "", "", nil), http.StatusNotFound)
+
+	expectStatus(t, doJSON(t, "GET", "/api/photos/"+photo.ID+"/original", other.token, nil), http.StatusForbidden)
+	expectStatus(t, doJSON(t, "GET", "/api/photos/"+photo.ID+"/original", "", nil), http.StatusUnauthorized)
+	expectStatus(t, doJSON(t, "GET", "/api/photos/no-such-photo/original", owner.token, nil), http.StatusNotFound)
+}
+
+func TestStaticFilesHideHiddenFiles(t *testing.T) {
+	for _, name := range []string{".upload-test", resizeCacheDir + "/test-1-100.jpg", "photography/.write-check-test"} {
+		file := filepath.Join(photoDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("private"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { os.Remove(file) })
+		expectStatus(t, doRequest(t, "GET", "/photos/"+name, "", "", nil), http.StatusNotFound)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Respond 200 with payload as respondWithJSON does, tagged with a weak ETag
+// of the encoded body. A client whose If-None-Match has the tag gets 304 Not
+// Modified without the body, so polling an unchanged listing costs only the
+// headers.
+func respondWithCacheableJSON(w http.ResponseWriter, r *http.Request, payload interface{}) {
+	contentType, response, err := encodeJSON(w, payload)
+	if err != nil {
+		// respondWithJSON reports the encoding failure
+		respondWithJSON(w, http.StatusOK, payload)
+		return
+	}
+
+	sum := sha256.Sum256(response)
+	etag := `W/"` + hex.EncodeToString(sum[:16]) + `"`
+	// The body's field naming depends on Accept, and signed-in owners also
+	// see their drafts
+	w.Header().Add("Vary", "Accept")
+	w.Header().Add("Vary", "Authorization")
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(response)
+}
+
+// Whether an If-None-Match header lists etag or is "*". Tags are compared
+// weakly, ignoring the W/ prefix, as RFC 9110 requires for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestETagMatches(t *testing.T) {
+	const etag = `W/"abc"`
+	tests := []struct {
+		ifNoneMatch string
+		match       bool
+	}{
+		{"", false},
+		{`W/"abc"`, true},
+		{`"abc"`, true},
+		{`"other", W/"abc"`, true},
+		{"*", true},
+		{`W/"abcd"`, false},
+		{`"other"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, etag); got != tt.match {
+			t.Errorf("etagMatches(%q, %q) = %v, want %v", tt.ifNoneMatch, etag, got, tt.match)
+		}
+	}
+}
+
+// Make an anonymous GET with If-None-Match set to etag, unless it's empty
+func getIfNoneMatch(t *testing.T, path, etag string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", path, nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	rec := httptest.NewRecorder()
+	testHandler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestConditionalRequests(t *testing.T) {
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+
+	for _, path := range []string{"/api/photos/photography", "/api/photos/photography/" + photo.ID} {
+		t.Run(path, func(t *testing.T) {
+			rec := getIfNoneMatch(t, path, "")
+			expectStatus(t, rec, http.StatusOK)
+			etag := rec.Header().Get("ETag")
+			if etag == "" {
+				t.Fatal("response has no ETag")
+			}
+
+			rec = getIfNoneMatch(t, path, etag)
+			expectStatus(t, rec, http.StatusNotModified)
+			if rec.Body.Len() != 0 {
+				t.Errorf("304 response has a body %q", rec.Body.String())
+			}
+			if got := rec.Header().Get("ETag"); got != etag {
+				t.Errorf("304 ETag = %q, want %q", got, etag)
+			}
+
+			title := "Retitled " + randomPhotoID()
+			expectStatus(t, doJSON(t, "PATCH", "/api/photos/"+photo.ID, user.token, PhotoUpdate{Title: &title}), http.StatusOK)
+			rec = getIfNoneMatch(t, path, etag)
+			expectStatus(t, rec, http.StatusOK)
+			if got := rec.Header().Get("ETag"); got == etag {
+				t.Errorf("ETag %q unchanged after an edit", got)
+			}
+		})
+	}
+}
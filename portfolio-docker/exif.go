@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// EXIF tag IDs used by the server
+const (
+	exifTagMake              = 0x010F
+	exifTagModel             = 0x0110
+	exifTagOrientation       = 0x0112
+	exifTagSoftware          = 0x0131
+	exifTagDateTime          = 0x0132
+	exifTagArtist            = 0x013B
+	exifTagCopyright         = 0x8298
+	exifTagExposureTime      = 0x829A
+	exifTagFNumber           = 0x829D
+	exifTagExifIFDPointer    = 0x8769
+	exifTagGPSIFDPointer     = 0x8825
+	exifTagISOSpeed          = 0x8827
+	exifTagDateTimeOriginal  = 0x9003
+	exifTagDateTimeDigitized = 0x9004
+	exifTagOffsetTime        = 0x9010
+	exifTagOffsetOriginal    = 0x9011
+	exifTagOffsetDigitized   = 0x9012
+	exifTagFocalLength       = 0x920A
+	exifTagLensModel         = 0xA434
+)
+
+// GPS tag IDs, which are numbered separately from the other tags
+const (
+	gpsTagLatitudeRef  = 0x0001
+	gpsTagLatitude     = 0x0002
+	gpsTagLongitudeRef = 0x0003
+	gpsTagLongitude    = 0x0004
+	gpsTagAltitudeRef  = 0x0005
+	gpsTagAltitude     = 0x0006
+)
+
+// EXIF timestamps are local time; the matching OffsetTime tag is applied
+// when present, otherwise the value is treated as UTC
+const exifTimeLayout = "2006:01:02 15:04:05"
+
+// Capture time tags in order of preference, with their offset tags
+var captureTimeTags = [][2]uint16{
+	{exifTagDateTimeOriginal, exifTagOffsetOriginal},
+	{exifTagDateTimeDigitized, exifTagOffsetDigitized},
+	{exifTagDateTime, exifTagOffsetTime},
+}
+
+var errNoEXIF = errors.New("no EXIF data")
+
+// ifdEntry is a raw TIFF directory entry
+type ifdEntry struct {
+	Type  uint16
+	Count uint32
+	Value []byte
+}
+
+// exifData holds the tags of IFD0 and the Exif sub-IFD, and those of the GPS
+// sub-IFD apart
+type exifData struct {
+	order binary.ByteOrder
+	tags  map[uint16]ifdEntry
+	gps   map[uint16]ifdEntry
+}
+
+// Read the capture time of an image file, preferring DateTimeOriginal
+func readCaptureTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	exif, err := decodeEXIF(bufio.NewReader(f))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return exif.CaptureTime()
+}
+
+// CaptureTime returns when the image was taken, preferring DateTimeOriginal
+func (e *exifData) CaptureTime() (time.Time, bool) {
+	for _, tags := range captureTimeTags {
+		value, ok := e.String(tags[0])
+		if !ok {
+			continue
+		}
+		if offset, ok := e.String(tags[1]); ok {
+			if t, err := time.Parse(exifTimeLayout+"-07:00", value+offset); err == nil {
+				return t.UTC(), true
+			}
+		}
+		if t, err := time.Parse(exifTimeLayout, value); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Extract the EXIF block from a JPEG (APP1) or PNG (eXIf chunk) stream. A
+// TIFF file is itself laid out like an EXIF block.
+func decodeEXIF(r io.Reader) (*exifData, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header[:2]); err != nil {
+		return nil, err
+	}
+
+	var payload []byte
+	var err error
+	switch {
+	case header[0] == 0xFF && header[1] == 0xD8:
+		payload, err = findJPEGEXIF(r)
+	case header[0] == 0x89 && header[1] == 'P':
+		if _, err := io.ReadFull(r, header[2:]); err != nil {
+			return nil, err
+		}
+		payload, err = findPNGEXIF(r)
+	case string(header[:2]) == "II" || string(header[:2]) == "MM":
+		payload, err = io.ReadAll(r)
+		payload = append(header[:2:2], payload...)
+	default:
+		return nil, errNoEXIF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTIFF(payload)
+}
+
+func findJPEGEXIF(r io.Reader) ([]byte, error) {
+	marker := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, marker); err != nil {
+			return nil, err
+		}
+		if marker[0] != 0xFF {
+			return nil, errNoEXIF
+		}
+		// Start of scan: image data follows, no more metadata segments
+		if marker[1] == 0xDA {
+			return nil, errNoEXIF
+		}
+
+		length := int64(binary.BigEndian.Uint16(marker[2:])) - 2
+		if length < 0 {
+			return nil, errNoEXIF
+		}
+		if marker[1] != 0xE1 {
+			if _, err := io.CopyN(io.Discard, r, length); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(r, segment); err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+func findPNGEXIF(r io.Reader) ([]byte, error) {
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return nil, err
+		}
+		length := int64(binary.BigEndian.Uint32(chunk[:4]))
+		switch string(chunk[4:]) {
+		case "eXIf":
+			data := make([]byte, length)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, err
+			}
+			return data, nil
+		case "IDAT", "IEND":
+			return nil, errNoEXIF
+		}
+		// Skip the chunk data and its CRC
+		if _, err := io.CopyN(io.Discard, r, length+4); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func parseTIFF(data []byte) (*exifData, error) {
+	if len(data) < 8 {
+		return nil, errNoEXIF
+	}
+
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, errNoEXIF
+	}
+
+	exif := &exifData{order: order, tags: map[uint16]ifdEntry{}, gps: map[uint16]ifdEntry{}}
+	if err := exif.readIFD(data, order.Uint32(data[4:]), exif.tags); err != nil {
+		return nil, err
+	}
+	if entry, ok := exif.tags[exifTagExifIFDPointer]; ok && len(entry.Value) >= 4 {
+		if err := exif.readIFD(data, order.Uint32(entry.Value), exif.tags); err != nil {
+			return nil, err
+		}
+	}
+	// A broken GPS block costs only the position
+	if entry, ok := exif.tags[exifTagGPSIFDPointer]; ok && len(entry.Value) >= 4 {
+		if err := exif.readIFD(data, order.Uint32(entry.Value), exif.gps); err != nil {
+			exif.gps = map[uint16]ifdEntry{}
+		}
+	}
+	return exif, nil
+}
+
+// Size in bytes of one value of each TIFF field type
+var tiffTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8}
+
+func (e *exifData) readIFD(data []byte, offset uint32, tags map[uint16]ifdEntry) error {
+	if uint64(offset)+2 > uint64(len(data)) {
+		return errNoEXIF
+	}
+	count := uint32(e.order.Uint16(data[offset:]))
+	pos := offset + 2
+
+	for i := uint32(0); i < count; i++ {
+		if uint64(pos)+12 > uint64(len(data)) {
+			return errNoEXIF
+		}
+		tag := e.order.Uint16(data[pos:])
+		typ := e.order.Uint16(data[pos+2:])
+		n := e.order.Uint32(data[pos+4:])
+		pos += 12
+
+		size, ok := tiffTypeSizes[typ]
+		if !ok {
+			continue
+		}
+		total := uint64(size) * uint64(n)
+
+		// Values of four bytes or less are stored inline in the entry
+		var value []byte
+		if total <= 4 {
+			value = data[pos-4 : pos-4+uint32(total)]
+		} else {
+			start := uint64(e.order.Uint32(data[pos-4:]))
+			if start+total > uint64(len(data)) {
+				continue
+			}
+			value = data[start : start+total]
+		}
+		tags[tag] = ifdEntry{Type: typ, Count: n, Value: value}
+	}
+	return nil
+}
+
+// Uints returns the values of a BYTE, SHORT or LONG tag
+func (e *exifData) Uints(tag uint16) []uint32 {
+	entry, ok := e.tags[tag]
+	if !ok {
+		return nil
+	}
+	values := make([]uint32, 0, entry.Count)
+	for i := uint32(0); i < entry.Count; i++ {
+		switch entry.Type {
+		case 1:
+			values = append(values, uint32(entry.Value[i]))
+		case 3:
+			values = append(values, uint32(e.order.Uint16(entry.Value[2*i:])))
+		case 4:
+			values = append(values, e.order.Uint32(entry.Value[4*i:]))
+		default:
+			return nil
+		}
+	}
+	return values
+}
+
+// Uint returns the first value of a BYTE, SHORT or LONG tag, or def when
+// the tag is missing
+func (e *exifData) Uint(tag uint16, def int) int {
+	values := e.Uints(tag)
+	if len(values) == 0 {
+		return def
+	}
+	return int(values[0])
+}
+
+// String returns an ASCII tag value without its NUL terminator
+func (e *exifData) String(tag uint16) (string, bool) {
+	entry, ok := e.tags[tag]
+	if !ok || entry.Type != 2 {
+		return "", false
+	}
+	return strings.TrimRight(string(entry.Value), "\x00 "), true
+}
+
+// Rationals returns the values of a RATIONAL or SRATIONAL tag of IFD0 or the
+// Exif sub-IFD
+func (e *exifData) Rationals(tag uint16) []float64 {
+	return e.rationals(e.tags[tag])
+}
+
+// GPSRationals returns the values of a RATIONAL tag of the GPS sub-IFD
+func (e *exifData) GPSRationals(tag uint16) []float64 {
+	return e.rationals(e.gps[tag])
+}
+
+func (e *exifData) rationals(entry ifdEntry) []float64 {
+	if entry.Type != 5 && entry.Type != 10 {
+		return nil
+	}
+	values := make([]float64, 0, entry.Count)
+	for i := uint32(0); i < entry.Count; i++ {
+		num, den := e.order.Uint32(entry.Value[8*i:]), e.order.Uint32(entry.Value[8*i+4:])
+		if den == 0 {
+			return nil
+		}
+		if entry.Type == 10 {
+			values = append(values, float64(int32(num))/float64(int32(den)))
+		} else {
+			values = append(values, float64(num)/float64(den))
+		}
+	}
+	return values
+}
+
+// GPSString returns an ASCII tag value of the GPS sub-IFD
+func (e *exifData) GPSString(tag uint16) (string, bool) {
+	entry, ok := e.gps[tag]
+	if !ok || entry.Type != 2 {
+		return "", false
+	}
+	return strings.TrimRight(string(entry.Value), "\x00 "), true
+}
+
+// Position returns the latitude and longitude in degrees, negative south and
+// west, and the altitude in meters when recorded
+func (e *exifData) Position() (lat, lon float64, alt *float64, ok bool) {
+	toDegrees := func(dms []float64) (float64, bool) {
+		if len(dms) != 3 {
+			return 0, false
+		}
+		return dms[0] + dms[1]/60 + dms[2]/3600, true
+	}
+	lat, latOK := toDegrees(e.GPSRationals(gpsTagLatitude))
+	lon, lonOK := toDegrees(e.GPSRationals(gpsTagLongitude))
+	if !latOK || !lonOK {
+		return 0, 0, nil, false
+	}
+	if ref, _ := e.GPSString(gpsTagLatitudeRef); ref == "S" {
+		lat = -lat
+	}
+	if ref, _ := e.GPSString(gpsTagLongitudeRef); ref == "W" {
+		lon = -lon
+	}
+	if values := e.GPSRationals(gpsTagAltitude); len(values) == 1 {
+		altitude := values[0]
+		// Reference 1 means below sea level
+		if ref, ok := e.gps[gpsTagAltitudeRef]; ok && len(ref.Value) == 1 && ref.Value[0] == 1 {
+			altitude = -altitude
+		}
+		alt = &altitude
+	}
+	return lat, lon, alt, true
+}
+
+// HasGPS reports whether the image records where it was taken
+func (e *exifData) HasGPS() bool {
+	return len(e.gps) > 0
+}
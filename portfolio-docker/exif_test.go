@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Build a little-endian EXIF block with the given ASCII tags in IFD0
+func testEXIF(tags map[uint16]string) []byte {
+	ids := make([]uint16, 0, len(tags))
+	for id := range tags {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	le := binary.LittleEndian
+	ifdSize := 2 + 12*len(ids) + 4
+	data := []byte("II\x2a\x00\x08\x00\x00\x00")
+	data = le.AppendUint16(data, uint16(len(ids)))
+	values := []byte{}
+	for _, id := range ids {
+		value := append([]byte(tags[id]), 0)
+		data = le.AppendUint16(data, id)
+		data = le.AppendUint16(data, 2)
+		data = le.AppendUint32(data, uint32(len(value)))
+		if len(value) <= 4 {
+			data = append(data, append(value, make([]byte, 4-len(value))...)...)
+			continue
+		}
+		data = le.AppendUint32(data, uint32(8+ifdSize+len(values)))
+		values = append(values, value...)
+	}
+	data = le.AppendUint32(data, 0)
+	return append(data, values...)
+}
+
+// Encode a small JPEG carrying an EXIF block in an APP1 segment
+func testJPEGWithEXIF(t *testing.T, exif []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 8, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	segment := append([]byte("Exif\x00\x00"), exif...)
+	app1 := []byte{0xFF, 0xE1}
+	app1 = binary.BigEndian.AppendUint16(app1, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	encoded := buf.Bytes()
+	return slices.Concat(encoded[:2], app1, encoded[2:])
+}
+
+func TestCaptureTime(t *testing.T) {
+	tests := []struct {
+		name   string
+		tags   map[uint16]string
+		want   time.Time
+		wantOK bool
+	}{
+		{
+			"original",
+			map[uint16]string{exifTagDateTimeOriginal: "2024:06:01 12:30:00"},
+			time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC), true,
+		},
+		{
+			"original with offset",
+			map[uint16]string{exifTagDateTimeOriginal: "2024:06:01 12:30:00", exifTagOffsetOriginal: "+02:00"},
+			time.Date(2024, 6, 1, 10, 30, 0, 0, time.UTC), true,
+		},
+		{
+			"original preferred",
+			map[uint16]string{exifTagDateTimeOriginal: "2024:06:01 12:30:00", exifTagDateTime: "2025:01:01 00:00:00"},
+			time.Date(2024, 6, 1, 12, 30, 0, 0, time.UTC), true,
+		},
+		{
+			"modification time fallback",
+			map[uint16]string{exifTagDateTime: "2025:01:01 08:00:00"},
+			time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC), true,
+		},
+		{
+			"unparseable",
+			map[uint16]string{exifTagDateTimeOriginal: "yesterday"},
+			time.Time{}, false,
+		},
+		{
+			"no date",
+			map[uint16]string{exifTagMake: "Camera"},
+			time.Time{}, false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exif, err := decodeEXIF(bytes.NewReader(testJPEGWithEXIF(t, testEXIF(tt.tags))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := exif.CaptureTime()
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("CaptureTime() = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestDecodeEXIFWithoutEXIF(t *testing.T) {
+	if _, err := decodeEXIF(bytes.NewReader(testPNG(t, 8, 8, testColor))); err == nil {
+		t.Error("decoded EXIF from a PNG without any")
+	}
+}
+
+func TestSortByCaptureDate(t *testing.T) {
+	photos := []PhotoResponse{
+		{ID: "uploaded-only", UploadDate: "2024-03-01T00:00:00Z"},
+		{ID: "oldest", CapturedAt: "2020-01-01T00:00:00Z", UploadDate: "2024-05-01T00:00:00Z"},
+		{ID: "newest", CapturedAt: "2024-06-01T00:00:00Z", UploadDate: "2024-01-01T00:00:00Z"},
+		{ID: "tie-b", CapturedAt: "2022-01-01T00:00:00Z"},
+		{ID: "tie-a", CapturedAt: "2022-01-01T00:00:00Z"},
+	}
+	sortByCaptureDate(photos)
+
+	var got []string
+	for _, p := range photos {
+		got = append(got, p.ID)
+	}
+	want := []string{"newest", "uploaded-only", "tie-a", "tie-b", "oldest"}
+	if !slices.Equal(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestUploadRecordsCaptureDate(t *testing.T) {
+	user := newTestUser(t)
+	file := testJPEGWithEXIF(t, testEXIF(map[uint16]string{exifTagDateTimeOriginal: "2021:07:04 18:00:00"}))
+	contentType, body := multipartBody(t, "photo.jpg", "image/jpeg", file, map[string]string{
+		uploadTitleField:    "Captured",
+		uploadCategoryField: "photography",
+		"altText":           "A captured photo",
+	})
+	rec := doRequest(t, "POST", "/api/photos/upload", user.token, contentType, body)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var photo PhotoResponse
+	decodeResponse(t, rec, &photo)
+	if photo.CapturedAt != "2021-07-04T18:00:00Z" {
+		t.Errorf("capturedAt = %q, want 2021-07-04T18:00:00Z", photo.CapturedAt)
+	}
+}
+
+func TestCategoryListingRejectsUnknownSort(t *testing.T) {
+	rec := doJSON(t, "GET", "/api/photos/photography?sort=sideways", "", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = doJSON(t, "GET", "/api/photos/photography?sort=captured", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// Minimum time between two exports by the same user
+var exportInterval = getEnvDuration("EXPORT_INTERVAL", 10*time.Minute)
+
+// Time of each user's last export, for rate limiting
+var (
+	lastExportMu sync.Mutex
+	lastExport   = map[int64]time.Time{}
+)
+
+// ExportProfile is the account data included in an export. The password
+// hash is deliberately left out.
+type ExportProfile struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+	Role        string `json:"role"`
+	CreatedAt   string `json:"createdAt"`
+	QuotaBytes  *int64 `json:"quotaBytes"`
+	QuotaPhotos *int64 `json:"quotaPhotos"`
+}
+
+// ExportCollection is a collection with the IDs of its photos in order
+type ExportCollection struct {
+	CollectionResponse
+	PhotoIDs []string `json:"photoIds"`
+}
+
+// ExportBundle is everything stored about a user
+type ExportBundle struct {
+	ExportedAt  string             `json:"exportedAt"`
+	Profile     ExportProfile      `json:"profile"`
+	Photos      []PhotoResponse    `json:"photos"`
+	Collections []ExportCollection `json:"collections"`
+}
+
+// Reserve an export for the user, returning how long to wait when the last
+// one was too recent
+func reserveExport(userID int64) (time.Duration, bool) {
+	lastExportMu.Lock()
+	defer lastExportMu.Unlock()
+
+	if last, ok := lastExport[userID]; ok {
+		if wait := exportInterval - time.Since(last); wait > 0 {
+			return wait, false
+		}
+	}
+	lastExport[userID] = time.Now()
+	return 0, true
+}
+
+// Collect the export bundle, also returning the photo rows so their files can
+// be archived
+func buildExportBundle(ctx context.Context, r *http.Request, userID int64) (ExportBundle, []db.Photo, error) {
+	bundle := ExportBundle{
+		ExportedAt:  formatTimestamp(time.Now()),
+		Photos:      []PhotoResponse{},
+		Collections: []ExportCollection{},
+	}
+
+	user, err := queries.GetUser(ctx, userID)
+	if err != nil {
+		return bundle, nil, err
+	}
+	bundle.Profile = ExportProfile{
+		ID:    user.ID,
+		Name:  user.Name,
+		Email: user.Email,
+		Role:  user.Role,
+	}
+	if user.CreatedAt.Valid {
+		bundle.Profile.CreatedAt = formatTimestamp(user.CreatedAt.Time)
+	}
+	if user.QuotaBytes.Valid {
+		bundle.Profile.QuotaBytes = &user.QuotaBytes.Int64
+	}
+	if user.QuotaPhotos.Valid {
+		bundle.Profile.QuotaPhotos = &user.QuotaPhotos.Int64
+	}
+
+	photos, err := queries.ListAllPhotosByUser(ctx, userID)
+	if err != nil {
+		return bundle, nil, err
+	}
+	for _, photo := range photos {
+		bundle.Photos = append(bundle.Photos, photoResponseFromRow(r, photo))
+	}
+
+	collections, err := queries.ListCollectionsByUser(ctx, userID)
+	if err != nil {
+		return bundle, nil, err
+	}
+	for _, collection := range collections {
+		photoIDs, err := queries.ListCollectionPhotoIDs(ctx, collection.ID)
+		if err != nil {
+			return bundle, nil, err
+		}
+		if photoIDs == nil {
+			photoIDs = []string{}
+		}
+		bundle.Collections = append(bundle.Collections, ExportCollection{
+			CollectionResponse: collectionResponseFromRow(collection),
+			PhotoIDs:           photoIDs,
+		})
+	}
+	return bundle, photos, nil
+}
+
+// Export everything stored about the authenticated user as JSON, or with
+// format=zip as a ZIP archive holding the JSON and the image files. Limited
+// to one export per user every EXPORT_INTERVAL.
+func exportProfileHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "zip" {
+		respondWithError(w, http.StatusBadRequest, "format must be json or zip")
+		return
+	}
+
+	if wait, ok := reserveExport(userID); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		respondWithError(w, http.StatusTooManyRequests, "An export was requested recently, please try again later")
+		return
+	}
+
+	bundle, photos, err := buildExportBundle(requestContext(r), r, userID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	if format != "zip" {
+		w.Header().Set("Content-Disposition", `attachment; filename="export.json"`)
+		respondWithJSON(w, http.StatusOK, Response{
+			Success: true,
+			Data:    bundle,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="export.zip"`)
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are sent by now, so failures can only be logged; the client
+	// sees a truncated archive
+	archive := zip.NewWriter(w)
+	defer archive.Close()
+
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		slog.Error("Failed to encode export", "user_id", userID, "error", err)
+		return
+	}
+	entry, err := archive.Create("export.json")
+	if err == nil {
+		_, err = entry.Write(data)
+	}
+	if err != nil {
+		slog.Error("Failed to write export", "user_id", userID, "error", err)
+		return
+	}
+
+	for _, photo := range photos {
+		if err := addFileToArchive(archive, filepath.Join(photoDir, photo.Category, photo.Filename),
+			path.Join("photos", photo.Category, photo.Filename)); err != nil {
+			slog.Error("Failed to add photo to export", "user_id", userID, "photo_id", photo.ID, "error", err)
+			return
+		}
+	}
+}
+
+// Copy a file into a ZIP archive. Files that no longer exist are skipped.
+func addFileToArchive(archive *zip.Writer, src, name string) error {
+	f, err := os.Open(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entry, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", name, err)
+	}
+	_, err = io.Copy(entry, f)
+	return err
+}
+
+// Columns of the photo list CSV
+var photoCSVHeader = []string{"id", "title", "category", "tags", "uploadDate", "dimensions", "views"}
+
+// Keep a cell from being read as a formula when the CSV is opened in a
+// spreadsheet, by quoting values that start with a formula character
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// List the authenticated user's photos as CSV, for curating in a
+// spreadsheet. Rows are written as they're encoded rather than built up
+// first. Dimensions are WIDTHxHEIGHT, empty when unknown.
+func exportPhotosCSVHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+
+	photos, err := queries.ListAllPhotosByUser(requestContext(r), userID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="photos.csv"`)
+	w.WriteHeader(http.StatusOK)
+
+	// As with ZIP exports, failures once writing has started can only be
+	// logged
+	writer := csv.NewWriter(w)
+	if err := writer.Write(photoCSVHeader); err != nil {
+		slog.Error("Failed to write photo CSV", "user_id", userID, "error", err)
+		return
+	}
+	for _, photo := range photos {
+		uploadDate, dimensions := "", ""
+		if photo.CreatedAt.Valid {
+			uploadDate = formatTimestamp(photo.CreatedAt.Time)
+		}
+		if photo.Width > 0 && photo.Height > 0 {
+			dimensions = fmt.Sprintf("%dx%d", photo.Width, photo.Height)
+		}
+		err := writer.Write([]string{
+			photo.ID,
+			csvCell(photo.Title),
+			photo.Category,
+			csvCell(strings.Join(splitTags(photo.Tags), ",")),
+			uploadDate,
+			dimensions,
+			strconv.FormatInt(photo.Views+unflushedViews(photo.ID), 10),
+		})
+		if err != nil {
+			slog.Error("Failed to write photo CSV", "user_id", userID, "error", err)
+			return
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		slog.Error("Failed to write photo CSV", "user_id", userID, "error", err)
+	}
+}
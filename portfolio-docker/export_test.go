@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"testing"
+)
+
+func TestExportProfile(t *testing.T) {
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+	collection := createCollection(t, user.token, "Exported")
+	rec := doJSON(t, "POST", fmt.Sprintf("/api/collections/%d/photos", collection.ID), user.token, CollectionPhotoRequest{PhotoID: photo.ID})
+	expectStatus(t, rec, http.StatusCreated)
+
+	rec = doJSON(t, "GET", "/api/profile/export?format=xml", user.token, nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = doJSON(t, "GET", "/api/profile/export", user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var bundle ExportBundle
+	decodeResponse(t, rec, &bundle)
+	if bundle.Profile.ID != user.id || bundle.Profile.Email != user.email {
+		t.Errorf("profile = %+v, want user %d", bundle.Profile, user.id)
+	}
+	if len(bundle.Photos) != 1 || bundle.Photos[0].ID != photo.ID {
+		t.Errorf("photos = %v, want just %s", bundle.Photos, photo.ID)
+	}
+	if len(bundle.Collections) != 1 || !slices.Equal(bundle.Collections[0].PhotoIDs, []string{photo.ID}) {
+		t.Errorf("collections = %+v, want one holding %s", bundle.Collections, photo.ID)
+	}
+	if bytes.Contains(rec.Body.Bytes(), []byte(user.password)) || bytes.Contains(rec.Body.Bytes(), []byte("$2a$")) {
+		t.Error("export contains the password")
+	}
+
+	// Rate limited per user
+	rec = doJSON(t, "GET", "/api/profile/export", user.token, nil)
+	expectStatus(t, rec, http.StatusTooManyRequests)
+	if rec.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+}
+
+func TestExportProfileZip(t *testing.T) {
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+
+	rec := doJSON(t, "GET", "/api/profile/export?format=zip", user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = data
+	}
+
+	var bundle ExportBundle
+	if err := json.Unmarshal(files["export.json"], &bundle); err != nil {
+		t.Fatalf("export.json: %v", err)
+	}
+	if bundle.Profile.ID != user.id {
+		t.Errorf("export.json is for user %d, want %d", bundle.Profile.ID, user.id)
+	}
+	if _, ok := files[path.Join("photos", photo.Category, photo.Filename)]; !ok {
+		t.Errorf("archive holds %d files, without the photo", len(files))
+	}
+}
+
+func TestExportPhotosCSV(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	contentType, body := multipartBody(t, "photo.png", "image/png", testPNG(t, 8, 8, testColor), map[string]string{
+		uploadTitleField:    "=SUM(A1)",
+		uploadCategoryField: "photography",
+	})
+	rec := doRequest(t, "POST", "/api/photos/upload", user.token, contentType, body)
+	expectStatus(t, rec, http.StatusCreated)
+	var formula PhotoResponse
+	decodeResponse(t, rec, &formula)
+	rec = doJSON(t, "POST", "/api/photos/tag-batch", user.token, TagBatchRequest{IDs: []string{formula.ID}, Add: []string{"landscape", "sunset"}})
+	expectStatus(t, rec, http.StatusOK)
+	plain := uploadTestPhoto(t, user.token, "digital-sketches")
+	uploadTestPhoto(t, other.token, "photography")
+
+	rec = doJSON(t, "GET", "/api/profile/photos.csv", user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("Content-Type = %q, want text/csv", ct)
+	}
+	records, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || !slices.Equal(records[0], photoCSVHeader) {
+		t.Fatalf("CSV = %q, want the header and 2 photos", records)
+	}
+
+	rows := map[string][]string{}
+	for _, record := range records[1:] {
+		rows[record[0]] = record
+	}
+	want := map[string][]string{
+		formula.ID: {formula.ID, "'=SUM(A1)", "photography", "landscape,sunset", formula.UploadDate, "8x8", "0"},
+		plain.ID:   {plain.ID, plain.Title, "digital-sketches", "", plain.UploadDate, "8x8", "0"},
+	}
+	for id, row := range want {
+		if !slices.Equal(rows[id], row) {
+			t.Errorf("row %q, want %q", rows[id], row)
+		}
+	}
+
+	expectStatus(t, doJSON(t, "GET", "/api/profile/photos.csv", "", nil), http.StatusUnauthorized)
+}
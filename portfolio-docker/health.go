@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// How often the SQLite writer self-check runs, how long it may take, and how
+// many consecutive failures mark the server degraded
+var (
+	writerCheckInterval  = time.Duration(getEnvInt64("WRITER_CHECK_INTERVAL_SECONDS", 60)) * time.Second
+	writerCheckTimeout   = 5 * time.Second
+	writerCheckThreshold = int64(3)
+)
+
+// Consecutive failed writer checks; reset by the first success
+var writerCheckFailures atomic.Int64
+
+// Periodically take and release SQLite's write lock to detect a wedged
+// writer. Runs until the process exits; an interval of zero disables it.
+func startWriterCheck() {
+	if writerCheckInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(writerCheckInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := checkWriter(); err != nil {
+				failures := writerCheckFailures.Add(1)
+				slog.Warn("SQLite writer check failed", "error", err, "consecutive_failures", failures)
+				continue
+			}
+			if writerCheckFailures.Swap(0) >= writerCheckThreshold {
+				slog.Info("SQLite writer check recovered")
+			}
+		}
+	}()
+}
+
+// BEGIN IMMEDIATE acquires the write lock without changing any data, so it
+// fails exactly when a real write would block
+func checkWriter() error {
+	ctx, cancel := context.WithTimeout(context.Background(), writerCheckTimeout)
+	defer cancel()
+
+	conn, err := dbConn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	_, err = conn.ExecContext(context.Background(), "ROLLBACK")
+	return err
+}
+
+// Liveness: the process is up and serving requests
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    map[string]string{"status": "ok"},
+	})
+}
+
+// Readiness: the database answers and the writer isn't wedged
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), writerCheckTimeout)
+	defer cancel()
+
+	if err := dbConn.PingContext(ctx); err != nil {
+		respondWithJSON(w, http.StatusServiceUnavailable, Response{
+			Success: false,
+			Message: "Database unavailable",
+			Data:    map[string]string{"status": "unavailable"},
+		})
+		return
+	}
+
+	if writerCheckFailures.Load() >= writerCheckThreshold {
+		respondWithJSON(w, http.StatusServiceUnavailable, Response{
+			Success: false,
+			Message: "Database writer is not responding",
+			Data:    map[string]string{"status": "degraded"},
+		})
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    map[string]string{"status": "ok"},
+	})
+}
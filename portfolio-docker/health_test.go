@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCheckWriter(t *testing.T) {
+	if err := checkWriter(); err != nil {
+		t.Fatalf("checkWriter() with the database idle = %v", err)
+	}
+
+	// The check must release the lock it takes
+	tx, err := dbConn.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+}
+
+func TestHealthEndpoints(t *testing.T) {
+	rec := doJSON(t, "GET", "/api/health", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	rec = doJSON(t, "GET", "/api/health/ready", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	writerCheckFailures.Store(writerCheckThreshold)
+	t.Cleanup(func() { writerCheckFailures.Store(0) })
+
+	rec = doJSON(t, "GET", "/api/health/ready", "", nil)
+	expectStatus(t, rec, http.StatusServiceUnavailable)
+	var data map[string]string
+	decodeResponse(t, rec, &data)
+	if data["status"] != "degraded" {
+		t.Errorf("status = %q, want degraded", data["status"])
+	}
+
+	// Liveness doesn't depend on the database
+	rec = doJSON(t, "GET", "/api/health", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+}
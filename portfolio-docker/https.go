@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Networks whose X-Forwarded-Proto is believed, from TRUSTED_PROXIES
+var trustedProxies []*net.IPNet
+
+// Parse TRUSTED_PROXIES, exiting on an entry that's neither an IP address
+// nor a CIDR range
+func loadTrustedProxies() {
+	for _, entry := range trustedProxiesConfig {
+		cidr := entry
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			log.Fatalf("Invalid TRUSTED_PROXIES entry %q", entry)
+		}
+		trustedProxies = append(trustedProxies, network)
+	}
+}
+
+// Whether a request came straight from one of TRUSTED_PROXIES
+func fromTrustedProxy(r *http.Request) bool {
+	ip := net.ParseIP(clientIP(r))
+	for _, network := range trustedProxies {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a request reached the server, or the trusted proxy in front of
+// it, over HTTPS. Of a list of forwarded protocols the first is the
+// client's.
+func requestIsHTTPS(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if !fromTrustedProxy(r) {
+		return false
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+// With FORCE_HTTPS, redirect plain HTTP requests to the same URL over HTTPS
+// with 308, so the method and body are kept. Health checks are answered over
+// either, as probes usually talk to the server directly. The port is
+// dropped, so the redirect goes to the standard HTTPS port.
+func requireHTTPS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimRight(r.URL.Path, "/")
+		if !forceHTTPS || requestIsHTTPS(r) || path == "/api/health" || path == "/api/health/ready" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
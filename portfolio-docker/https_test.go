@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Trust the given proxies, and require HTTPS, until the test ends
+func useForceHTTPS(t *testing.T, proxies ...string) {
+	t.Helper()
+	oldForce, oldConfig, oldProxies := forceHTTPS, trustedProxiesConfig, trustedProxies
+	t.Cleanup(func() { forceHTTPS, trustedProxiesConfig, trustedProxies = oldForce, oldConfig, oldProxies })
+	forceHTTPS, trustedProxiesConfig, trustedProxies = true, proxies, nil
+	loadTrustedProxies()
+}
+
+func TestRequireHTTPS(t *testing.T) {
+	useForceHTTPS(t, "10.0.0.0/8", "2001:db8::1")
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		host       string
+		remoteAddr string
+		proto      string // X-Forwarded-Proto
+		tls        bool
+		location   string // Of the 308, or empty when the request is served
+	}{
+		{"plain HTTP", "GET", "/api/photos/photography?page=1", "example.com", "192.0.2.1:1234", "", false, "https://example.com/api/photos/photography?page=1"},
+		{"port dropped", "GET", "/api/photos/photography", "example.com:8080", "192.0.2.1:1234", "", false, "https://example.com/api/photos/photography"},
+		{"IPv6 host", "GET", "/api/photos/photography", "[::1]:8080", "192.0.2.1:1234", "", false, "https://[::1]/api/photos/photography"},
+		{"POST kept", "POST", "/api/login", "example.com", "192.0.2.1:1234", "", false, "https://example.com/api/login"},
+		{"TLS", "GET", "/api/photos/photography", "example.com", "192.0.2.1:1234", "", true, ""},
+		{"health check", "GET", "/api/health", "example.com", "192.0.2.1:1234", "", false, ""},
+		{"readiness check", "GET", "/api/health/ready/", "example.com", "192.0.2.1:1234", "", false, ""},
+		{"trusted proxy over HTTPS", "GET", "/api/photos/photography", "example.com", "10.1.2.3:1234", "https", false, ""},
+		{"trusted IPv6 proxy over HTTPS", "GET", "/api/photos/photography", "example.com", "[2001:db8::1]:1234", "HTTPS", false, ""},
+		{"trusted proxy chain", "GET", "/api/photos/photography", "example.com", "10.1.2.3:1234", "https, http", false, ""},
+		{"trusted proxy over HTTP", "GET", "/api/photos/photography", "example.com", "10.1.2.3:1234", "http", false, "https://example.com/api/photos/photography"},
+		{"untrusted forwarded proto", "GET", "/api/photos/photography", "example.com", "192.0.2.1:1234", "https", false, "https://example.com/api/photos/photography"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Host = tt.host
+			req.RemoteAddr = tt.remoteAddr
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			rec := httptest.NewRecorder()
+			testHandler.ServeHTTP(rec, req)
+
+			if tt.location == "" {
+				if rec.Code == http.StatusPermanentRedirect {
+					t.Errorf("redirected to %q, want the request served", rec.Header().Get("Location"))
+				}
+				return
+			}
+			expectStatus(t, rec, http.StatusPermanentRedirect)
+			if location := rec.Header().Get("Location"); location != tt.location {
+				t.Errorf("Location = %q, want %q", location, tt.location)
+			}
+		})
+	}
+
+	forceHTTPS = false
+	expectStatus(t, doJSON(t, "GET", "/api/photos/photography", "", nil), http.StatusOK)
+}
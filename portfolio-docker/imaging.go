@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Number of colors kept in a photo's palette
+const paletteSize = 5
+
+// Longest edge, in pixels, of the sample grid used for color extraction
+const paletteSampleSize = 64
+
+// Longest edge, in pixels, of generated thumbnails
+const thumbnailSize = 400
+
+// Background transparent images are flattened onto for JPEG output, set by
+// loadJPEGBackground
+var jpegBackground = color.RGBA{255, 255, 255, 255}
+
+// Encoder for PNG output, set from PNG_COMPRESSION by loadImageQuality
+var pngEncoder = png.Encoder{CompressionLevel: png.DefaultCompression}
+
+// Check JPEG_QUALITY and apply PNG_COMPRESSION
+func loadImageQuality() {
+	if jpegQuality < 1 || jpegQuality > 100 {
+		log.Fatalf("JPEG_QUALITY must be between 1 and 100: %d", jpegQuality)
+	}
+	pngEncoder.CompressionLevel = map[string]png.CompressionLevel{
+		"default": png.DefaultCompression,
+		"fast":    png.BestSpeed,
+		"best":    png.BestCompression,
+		"none":    png.NoCompression,
+	}[pngCompression]
+}
+
+// Options for every JPEG encode, from JPEG_QUALITY
+func jpegOptions() *jpeg.Options {
+	return &jpeg.Options{Quality: int(jpegQuality)}
+}
+
+// Parse JPEG_BACKGROUND
+func loadJPEGBackground() {
+	value := strings.TrimPrefix(jpegBackgroundConfig, "#")
+	rgb, err := hex.DecodeString(value)
+	if err != nil || len(rgb) != 3 {
+		log.Fatalf("JPEG_BACKGROUND must be a #rrggbb color: %q", jpegBackgroundConfig)
+	}
+	jpegBackground = color.RGBA{rgb[0], rgb[1], rgb[2], 255}
+}
+
+// Lay an image with transparency over JPEG_BACKGROUND, so the transparent
+// areas don't come out black when encoded as JPEG. Opaque images are
+// returned as they are.
+func flattenForJPEG(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+	flat := image.NewRGBA(img.Bounds())
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(jpegBackground), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+	return flat
+}
+
+// Thumbnails and archived originals live in subdirectories of their photo's
+// category directory
+const (
+	thumbnailDir = "thumbs"
+	originalsDir = "originals"
+)
+
+// Resized variants served by the image endpoint are cached in this
+// directory under the photo directory, named after the photo ID, version and
+// requested size
+const resizeCacheDir = ".resized"
+
+// Largest width or height the image endpoint will produce
+const maxResizeDimension = 2000
+
+// Slots for concurrent image processing, and the number of requests holding
+// or waiting for one
+var (
+	imageSlots   = make(chan struct{}, max(1, imageWorkers))
+	imagePending atomic.Int64
+)
+
+var errImageBusy = errors.New("image processing queue is full")
+
+// Wait for an image processing slot. Fails with errImageBusy straight away
+// when the queue is already full, or with the context's error if it ends
+// first. The returned function releases the slot. In a traced request the
+// time the slot is held is recorded as a span.
+func acquireImageSlot(ctx context.Context) (func(), error) {
+	if imagePending.Add(1) > int64(cap(imageSlots))+imageQueueLimit {
+		imagePending.Add(-1)
+		return nil, errImageBusy
+	}
+
+	waitStart := time.Now()
+	select {
+	case imageSlots <- struct{}{}:
+		_, span := startSpan(ctx, "image processing", trace.SpanKindInternal)
+		span.SetAttributes(attribute.Int64("image.queue_wait_ms", time.Since(waitStart).Milliseconds()))
+		return func() {
+			span.End()
+			<-imageSlots
+			imagePending.Add(-1)
+		}, nil
+	case <-ctx.Done():
+		imagePending.Add(-1)
+		return nil, ctx.Err()
+	}
+}
+
+// Tell the client to retry once the image processing queue has drained
+func respondImageBusy(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", "2")
+	respondWithError(w, http.StatusServiceUnavailable, "Server is busy processing images, please retry")
+}
+
+// Extension a photo is stored under for each format decodeImageFile
+// reports. It's never taken from the name the client sent, which could make
+// the file server serve an image's bytes as HTML.
+var formatExtensions = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+	"gif":  ".gif",
+	"tiff": ".tif",
+}
+
+// errCorruptImage wraps the failure to decode a file that is truncated,
+// damaged or in a format the server can't read
+var errCorruptImage = errors.New("image appears corrupt or unsupported")
+
+// Largest image, in pixels or along either side, decodeImageFile will
+// decode. The decoders allocate the pixel buffer from the header, so a few
+// bytes could otherwise claim an image too big for memory.
+const (
+	maxDecodePixels    = 100_000_000
+	maxDecodeDimension = 65_535
+)
+
+// Check an image's claimed dimensions before it's decoded. The product is
+// taken in uint64 so huge sides can't overflow past the limit.
+func checkImageSize(config image.Config) error {
+	if config.Width <= 0 || config.Height <= 0 {
+		return fmt.Errorf("missing dimensions")
+	}
+	if config.Width > maxDecodeDimension || config.Height > maxDecodeDimension ||
+		uint64(config.Width)*uint64(config.Height) > maxDecodePixels {
+		return fmt.Errorf("%dx%d is too large", config.Width, config.Height)
+	}
+	return nil
+}
+
+// Decode the image stored at path. Animated GIFs decode to their first
+// frame, composited onto the full canvas. Files that don't decode fail with
+// an error wrapping errCorruptImage.
+func decodeImageFile(path string) (image.Image, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	config, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", errCorruptImage, err)
+	}
+	if err := checkImageSize(config); err != nil {
+		return nil, "", fmt.Errorf("%w: %s: %v", errCorruptImage, format, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+
+	var img image.Image
+	if format == "gif" {
+		img, err = decodeFirstGIFFrame(f)
+	} else {
+		img, _, err = image.Decode(f)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", errCorruptImage, err)
+	}
+	return img, format, nil
+}
+
+// Decode the first frame of a possibly animated GIF. Frames may cover only
+// part of the canvas, so the frame is drawn onto a canvas of the full size.
+func decodeFirstGIFFrame(r io.Reader) (image.Image, error) {
+	anim, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(anim.Image) == 0 {
+		return nil, fmt.Errorf("gif has no frames")
+	}
+
+	frame := anim.Image[0]
+	bounds := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	if bounds.Empty() {
+		bounds = frame.Bounds()
+	}
+	canvas := image.NewRGBA(bounds)
+	draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+	return canvas, nil
+}
+
+// Scale an image so its longest edge is at most size pixels, preserving the
+// aspect ratio. Smaller images are returned unchanged.
+func resizeToFit(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+
+	if width >= height {
+		height = max(1, height*size/width)
+		width = size
+	} else {
+		width = max(1, width*size/height)
+		height = size
+	}
+	return resizeImage(img, width, height)
+}
+
+// Resize an image to exactly width x height by averaging the source pixels
+// covered by each destination pixel
+func resizeImage(img image.Image, width, height int) *image.RGBA {
+	src := image.NewRGBA(img.Bounds())
+	draw.Draw(src, src.Bounds(), img, img.Bounds().Min, draw.Src)
+
+	srcBounds := src.Bounds()
+	srcW, srcH := srcBounds.Dx(), srcBounds.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := y * srcH / height
+		y1 := max(y0+1, (y+1)*srcH/height)
+		for x := 0; x < width; x++ {
+			x0 := x * srcW / width
+			x1 := max(x0+1, (x+1)*srcW/width)
+
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				offset := src.PixOffset(srcBounds.Min.X+x0, srcBounds.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					r += uint32(src.Pix[offset])
+					g += uint32(src.Pix[offset+1])
+					b += uint32(src.Pix[offset+2])
+					a += uint32(src.Pix[offset+3])
+					offset += 4
+					n++
+				}
+			}
+
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// Scale an image to fit within width x height, preserving the aspect ratio.
+// A zero width or height leaves that edge unconstrained.
+func resizeContain(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	switch {
+	case width == 0:
+		width = max(1, srcW*height/srcH)
+	case height == 0:
+		height = max(1, srcH*width/srcW)
+	case srcW*height > srcH*width:
+		height = max(1, srcH*width/srcW)
+	default:
+		width = max(1, srcW*height/srcH)
+	}
+	return resizeImage(img, width, height)
+}
+
+// Scale and center-crop an image to exactly width x height
+func resizeCover(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	// Largest centered source rectangle with the target aspect ratio
+	cropW, cropH := srcW, srcH
+	if srcW*height > srcH*width {
+		cropW = max(1, srcH*width/height)
+	} else {
+		cropH = max(1, srcW*height/width)
+	}
+	x0 := bounds.Min.X + (srcW-cropW)/2
+	y0 := bounds.Min.Y + (srcH-cropH)/2
+
+	cropped := image.NewRGBA(image.Rect(0, 0, cropW, cropH))
+	draw.Draw(cropped, cropped.Bounds(), img, image.Pt(x0, y0), draw.Src)
+	return resizeImage(cropped, width, height)
+}
+
+// Downscale the image stored at path in place when its longest edge exceeds
+// maxImageDimension. If keepOriginals is set the untouched file is first
+// moved to the category's originals directory, and its path relative to the
+// category directory returned. Animated GIFs and formats the server can't
+// encode are left as they are.
+func downscaleImageFile(path string, img image.Image, format string) (image.Image, string, error) {
+	bounds := img.Bounds()
+	if maxImageDimension <= 0 || max(bounds.Dx(), bounds.Dy()) <= maxImageDimension {
+		return img, "", nil
+	}
+	if format != "jpeg" && format != "png" {
+		return img, "", nil
+	}
+
+	original := ""
+	if keepOriginals {
+		categoryDir := filepath.Dir(path)
+		if err := os.MkdirAll(filepath.Join(categoryDir, originalsDir), 0755); err != nil {
+			return img, "", err
+		}
+		original = filepath.Join(originalsDir, filepath.Base(path))
+		if err := os.Rename(path, filepath.Join(categoryDir, original)); err != nil {
+			return img, "", err
+		}
+	}
+
+	resized := resizeToFit(img, maxImageDimension)
+	if err := encodeImageFile(path, resized, format); err != nil {
+		return img, "", err
+	}
+
+	slog.Info("Downscaled image", "file", filepath.Base(path),
+		"from", fmt.Sprintf("%dx%d", bounds.Dx(), bounds.Dy()),
+		"to", fmt.Sprintf("%dx%d", resized.Bounds().Dx(), resized.Bounds().Dy()))
+	return resized, original, nil
+}
+
+// HEIF brands, found in the ftyp box that opens the file, used for HEIC
+// photos as phones write them
+var heicBrands = []string{"heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1"}
+
+// Check that an uploaded file is in a format browsers can display, or one
+// the server can convert to one. Returns why it can't be stored, or "".
+func checkUploadFormat(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	header := make([]byte, 12)
+	n, _ := io.ReadFull(f, header)
+	header = header[:n]
+
+	switch {
+	case n == 12 && string(header[4:8]) == "ftyp" && slices.Contains(heicBrands, string(header[8:])):
+		return "HEIC images can't be converted on this server; upload a JPEG or PNG"
+	case bytes.HasPrefix(header, []byte("II*\x00")) || bytes.HasPrefix(header, []byte("MM\x00*")):
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return ""
+		}
+		if _, _, err := image.DecodeConfig(f); err != nil {
+			return "This TIFF can't be converted on this server; upload a JPEG or PNG"
+		}
+	}
+	return ""
+}
+
+// Replace an uploaded image in a format browsers can't display with one they
+// can, named after the same photo: PNG if it has transparency to keep and
+// JPEG otherwise. The image is downscaled to maxImageDimension on the way. If
+// keepOriginals is set the source file is moved to the category's originals
+// directory, and its path relative to the category directory returned;
+// otherwise it's removed. On failure the source is left at path.
+func convertImageFile(path string, img image.Image) (string, image.Image, string, error) {
+	format, ext := "jpeg", ".jpg"
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && !opaque.Opaque() {
+		format, ext = "png", ".png"
+	}
+
+	converted := img
+	if maxImageDimension > 0 {
+		converted = resizeToFit(img, maxImageDimension)
+	}
+	categoryDir := filepath.Dir(path)
+	convertedPath := filepath.Join(categoryDir, strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))+ext)
+
+	// The source is moved aside first, as a client may have given a TIFF the
+	// extension of the converted file
+	original := ""
+	if keepOriginals {
+		if err := os.MkdirAll(filepath.Join(categoryDir, originalsDir), 0755); err != nil {
+			return path, img, "", err
+		}
+		original = filepath.Join(originalsDir, filepath.Base(path))
+		if err := os.Rename(path, filepath.Join(categoryDir, original)); err != nil {
+			return path, img, "", err
+		}
+	}
+	if err := encodeImageFile(convertedPath, converted, format); err != nil {
+		os.Remove(convertedPath)
+		if original != "" {
+			os.Rename(filepath.Join(categoryDir, original), path)
+		}
+		return path, img, "", err
+	}
+	if original == "" && convertedPath != path {
+		os.Remove(path)
+	}
+
+	slog.Info("Converted image", "file", filepath.Base(path), "to", filepath.Base(convertedPath))
+	return convertedPath, converted, original, nil
+}
+
+// Encode an image to path in the given format
+func encodeImageFile(path string, img image.Image, format string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(f, flattenForJPEG(img), jpegOptions())
+	case "png":
+		err = pngEncoder.Encode(f, img)
+	default:
+		err = fmt.Errorf("unsupported output format %q", format)
+	}
+	return err
+}
+
+// Write a JPEG thumbnail for a photo into its category's thumbnail
+// directory, returning its path relative to the category directory
+func writeThumbnail(img image.Image, categoryDir, photoID string) (string, error) {
+	dir := filepath.Join(categoryDir, thumbnailDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	name := filepath.Join(thumbnailDir, photoID+".jpg")
+	f, err := os.Create(filepath.Join(categoryDir, name))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if err := jpeg.Encode(f, flattenForJPEG(resizeToFit(img, thumbnailSize)), jpegOptions()); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return name, nil
+}
+
+// Extract the most common colors of an image as hex strings, most dominant
+// first. The image is sampled on a small grid and each channel quantized to
+// 4 bits, so the cost is independent of the image size. Mostly transparent
+// pixels are ignored; a fully transparent image has no palette.
+func extractPalette(img image.Image, n int) []string {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return []string{}
+	}
+
+	stepX := max(1, width/paletteSampleSize)
+	stepY := max(1, height/paletteSampleSize)
+
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := map[uint16]*bucket{}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+		for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+			r, g, b, a := img.At(x, y).RGBA()
+			if a < 0x8000 {
+				continue
+			}
+			// Undo alpha premultiplication before quantizing
+			r, g, b = r*0xffff/a>>8, g*0xffff/a>>8, b*0xffff/a>>8
+
+			key := uint16(r>>4)<<8 | uint16(g>>4)<<4 | uint16(b>>4)
+			bk, ok := buckets[key]
+			if !ok {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.count++
+			bk.r += int(r)
+			bk.g += int(g)
+			bk.b += int(b)
+		}
+	}
+
+	keys := make([]uint16, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	// Break ties by key so the palette is deterministic
+	sort.Slice(keys, func(i, j int) bool {
+		ci, cj := buckets[keys[i]].count, buckets[keys[j]].count
+		if ci != cj {
+			return ci > cj
+		}
+		return keys[i] < keys[j]
+	})
+
+	colors := []string{}
+	for _, key := range keys {
+		if len(colors) == n {
+			break
+		}
+		bk := buckets[key]
+		colors = append(colors, fmt.Sprintf("#%02x%02x%02x", bk.r/bk.count, bk.g/bk.count, bk.b/bk.count))
+	}
+	return colors
+}
+
+// Split a stored comma-separated palette, always returning a non-nil slice
+func splitColors(stored string) []string {
+	if stored == "" {
+		return []string{}
+	}
+	return strings.Split(stored, ",")
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// An image filled with c, with the left part of the given width in left
+func twoToneImage(width, height, leftWidth int, left, c color.Color) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, leftWidth, height), image.NewUniform(left), image.Point{}, draw.Src)
+	return img
+}
+
+func TestExtractPalette(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	tests := []struct {
+		name string
+		img  image.Image
+		n    int
+		want []string
+	}{
+		{"single color", twoToneImage(10, 10, 0, red, red), 5, []string{"#ff0000"}},
+		{"dominant first", twoToneImage(40, 40, 30, blue, red), 5, []string{"#0000ff", "#ff0000"}},
+		{"limited to n", twoToneImage(40, 40, 30, blue, red), 1, []string{"#0000ff"}},
+		{"transparent", image.NewRGBA(image.Rect(0, 0, 10, 10)), 5, []string{}},
+		{"empty", image.NewRGBA(image.Rectangle{}), 5, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extractPalette(tt.img, tt.n); !slices.Equal(got, tt.want) {
+				t.Errorf("extractPalette() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadExtractsPalette(t *testing.T) {
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+	if photo.DominantColor != "#c82828" {
+		t.Errorf("dominantColor = %q, want #c82828", photo.DominantColor)
+	}
+	if len(photo.Colors) == 0 || photo.Colors[0] != photo.DominantColor {
+		t.Errorf("colors = %v, want the dominant color first", photo.Colors)
+	}
+}
+
+// Encode an animated GIF of the given size whose first frame is red and
+// covers only rect, followed by a blue frame covering the whole canvas
+func testAnimatedGIF(t *testing.T, width, height int, rect image.Rectangle) []byte {
+	t.Helper()
+	palette := color.Palette{color.Transparent, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}}
+	first := image.NewPaletted(rect, palette)
+	draw.Draw(first, rect, image.NewUniform(palette[1]), image.Point{}, draw.Src)
+	second := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+	draw.Draw(second, second.Bounds(), image.NewUniform(palette[2]), image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image:  []*image.Paletted{first, second},
+		Delay:  []int{10, 10},
+		Config: image.Config{ColorModel: palette, Width: width, Height: height},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeFirstGIFFrame(t *testing.T) {
+	data := testAnimatedGIF(t, 20, 10, image.Rect(5, 2, 10, 8))
+	img, err := decodeFirstGIFFrame(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.Bounds(); got != image.Rect(0, 0, 20, 10) {
+		t.Errorf("bounds = %v, want the full canvas", got)
+	}
+	if _, _, _, a := img.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("outside the first frame: alpha %d, want transparent", a)
+	}
+	if r, _, b, _ := img.At(6, 4).RGBA(); r != 0xffff || b != 0 {
+		t.Errorf("inside the first frame: %v, want red", img.At(6, 4))
+	}
+}
+
+func TestUploadAnimatedGIF(t *testing.T) {
+	user := newTestUser(t)
+	file := testAnimatedGIF(t, 20, 10, image.Rect(0, 0, 20, 10))
+	contentType, body := multipartBody(t, "anim.gif", "image/gif", file, map[string]string{
+		uploadTitleField:    "Animated",
+		uploadCategoryField: "photography",
+		"altText":           "An animation",
+	})
+	rec := doRequest(t, "POST", "/api/photos/upload", user.token, contentType, body)
+	expectStatus(t, rec, http.StatusCreated)
+
+	var photo PhotoResponse
+	decodeResponse(t, rec, &photo)
+	if photo.ThumbnailURL == "" {
+		t.Error("no thumbnail for an animated GIF")
+	}
+	if photo.DominantColor != "#ff0000" {
+		t.Errorf("dominantColor = %q, want the first frame's #ff0000", photo.DominantColor)
+	}
+}
+
+func TestResizeToFit(t *testing.T) {
+	tests := []struct {
+		name                string
+		width, height, size int
+		wantW, wantH        int
+	}{
+		{"smaller", 40, 30, 100, 40, 30},
+		{"landscape", 400, 300, 100, 100, 75},
+		{"portrait", 300, 400, 100, 75, 100},
+		{"thin", 1000, 2, 100, 100, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewRGBA(image.Rect(0, 0, tt.width, tt.height))
+			got := resizeToFit(img, tt.size).Bounds()
+			if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+				t.Errorf("resizeToFit(%dx%d, %d) = %dx%d, want %dx%d", tt.width, tt.height, tt.size, got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestDownscaleImageFile(t *testing.T) {
+	oldMax, oldKeep := maxImageDimension, keepOriginals
+	t.Cleanup(func() { maxImageDimension, keepOriginals = oldMax, oldKeep })
+	maxImageDimension = 16
+
+	for _, keep := range []bool{false, true} {
+		t.Run(fmt.Sprintf("keepOriginals=%v", keep), func(t *testing.T) {
+			keepOriginals = keep
+			dir := t.TempDir()
+			path := filepath.Join(dir, "photo.png")
+			data := testPNG(t, 64, 32, testColor)
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+			img, _, err := image.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resized, original, err := downscaleImageFile(path, img, "png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := resized.Bounds(); got.Dx() != 16 || got.Dy() != 8 {
+				t.Errorf("resized to %dx%d, want 16x8", got.Dx(), got.Dy())
+			}
+			stored, _, err := decodeImageFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := stored.Bounds(); got.Dx() != 16 || got.Dy() != 8 {
+				t.Errorf("stored file is %dx%d, want 16x8", got.Dx(), got.Dy())
+			}
+
+			if !keep {
+				if original != "" {
+					t.Errorf("original kept as %q without keepOriginals", original)
+				}
+				return
+			}
+			kept, err := os.ReadFile(filepath.Join(dir, original))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(kept, data) {
+				t.Error("kept original differs from the upload")
+			}
+		})
+	}
+}
+
+func TestDownscaleImageFileLeavesSmallImages(t *testing.T) {
+	old := maxImageDimension
+	t.Cleanup(func() { maxImageDimension = old })
+	maxImageDimension = 100
+
+	img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	got, original, err := downscaleImageFile(filepath.Join(t.TempDir(), "missing.png"), img, "png")
+	if err != nil || got != image.Image(img) || original != "" {
+		t.Errorf("downscaleImageFile() = %v, %q, %v; want the image untouched", got.Bounds(), original, err)
+	}
+}
+
+func TestAcquireImageSlot(t *testing.T) {
+	oldLimit := imageQueueLimit
+	t.Cleanup(func() { imageQueueLimit = oldLimit })
+	imageQueueLimit = 1
+
+	// Take every slot
+	var releases []func()
+	for range cap(imageSlots) {
+		release, err := acquireImageSlot(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+
+	// One request may wait; it gives up when its context ends
+	ctx, cancel := context.WithCancel(context.Background())
+	waited := make(chan error)
+	go func() {
+		_, err := acquireImageSlot(ctx)
+		waited <- err
+	}()
+	for imagePending.Load() <= int64(cap(imageSlots)) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The queue is full, so the next is turned away at once
+	if _, err := acquireImageSlot(context.Background()); !errors.Is(err, errImageBusy) {
+		t.Errorf("acquireImageSlot() with the queue full = %v, want errImageBusy", err)
+	}
+	cancel()
+	if err := <-waited; !errors.Is(err, context.Canceled) {
+		t.Errorf("waiting acquireImageSlot() = %v, want context.Canceled", err)
+	}
+
+	for _, release := range releases {
+		release()
+	}
+	if n := imagePending.Load(); n != 0 {
+		t.Errorf("%d requests still pending", n)
+	}
+	release, err := acquireImageSlot(context.Background())
+	if err != nil {
+		t.Fatalf("acquireImageSlot() after release = %v", err)
+	}
+	release()
+}
+
+// Whether two colors are within tol of each other in every channel, as
+// JPEG's lossy encoding shifts them slightly
+func colorsClose(a, b color.Color, tol int) bool {
+	ar, ag, ab, _ := a.RGBA()
+	br, bg, bb, _ := b.RGBA()
+	for _, d := range []int{int(ar>>8) - int(br>>8), int(ag>>8) - int(bg>>8), int(ab>>8) - int(bb>>8)} {
+		if d < -tol || d > tol {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFlattenForJPEG(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	img := twoToneImage(10, 10, 5, color.RGBA{}, red)
+	tests := []struct {
+		background string
+		want       color.RGBA
+	}{
+		{"#ffffff", color.RGBA{255, 255, 255, 255}},
+		{"#102030", color.RGBA{0x10, 0x20, 0x30, 255}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.background, func(t *testing.T) {
+			old := jpegBackgroundConfig
+			jpegBackgroundConfig = tt.background
+			t.Cleanup(func() {
+				jpegBackgroundConfig = old
+				loadJPEGBackground()
+			})
+			loadJPEGBackground()
+
+			flat := flattenForJPEG(img)
+			if got := flat.At(0, 0); got != tt.want {
+				t.Errorf("transparent pixel = %v, want %v", got, tt.want)
+			}
+			if got := flat.At(9, 9); got != red {
+				t.Errorf("opaque pixel = %v, want %v", got, red)
+			}
+		})
+	}
+
+	opaque := twoToneImage(10, 10, 5, red, red)
+	if flat := flattenForJPEG(opaque); flat != image.Image(opaque) {
+		t.Error("opaque image was copied")
+	}
+}
+
+func TestUploadTransparentThumbnail(t *testing.T) {
+	user := newTestUser(t)
+	red := color.RGBA{255, 0, 0, 255}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, twoToneImage(64, 64, 32, color.RGBA{}, red)); err != nil {
+		t.Fatal(err)
+	}
+	rec := uploadFile(t, user.token, "photography", "transparent.png", buf.Bytes())
+	expectStatus(t, rec, http.StatusCreated)
+	var photo PhotoResponse
+	decodeResponse(t, rec, &photo)
+
+	rec = doRequest(t, "GET", "/photos/photography/"+thumbnailDir+"/"+photo.ID+".jpg", "", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	thumb, err := jpeg.Decode(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := thumb.Bounds()
+	if got := thumb.At(b.Min.X+2, b.Min.Y+2); !colorsClose(got, jpegBackground, 8) {
+		t.Errorf("transparent area = %v, want the %v background", got, jpegBackground)
+	}
+	if got := thumb.At(b.Max.X-3, b.Max.Y-3); !colorsClose(got, red, 8) {
+		t.Errorf("opaque area = %v, want %v", got, red)
+	}
+}
+
+// Switch the encode settings until the test ends
+func useImageQuality(t *testing.T, quality int64, compression string) {
+	t.Helper()
+	oldQuality, oldCompression := jpegQuality, pngCompression
+	t.Cleanup(func() {
+		jpegQuality, pngCompression = oldQuality, oldCompression
+		loadImageQuality()
+	})
+	jpegQuality, pngCompression = quality, compression
+	loadImageQuality()
+}
+
+// An image of random pixels, which compresses poorly enough for the
+// settings to show in the size
+func noiseImage(width, height int) *image.RGBA {
+	rng := rand.New(rand.NewPCG(1, 2))
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rng.Uint32())
+		if i%4 == 3 {
+			img.Pix[i] = 255
+		}
+	}
+	return img
+}
+
+// Size of img encoded as format with the current settings
+func encodedSize(t *testing.T, img image.Image, format string) int64 {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "image."+format)
+	if err := encodeImageFile(path, img, format); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestImageQuality(t *testing.T) {
+	img := noiseImage(128, 128)
+
+	var lastSize, lastThumbnail int64
+	for _, quality := range []int64{10, 50, 95} {
+		useImageQuality(t, quality, "default")
+		size := encodedSize(t, img, "jpeg")
+		if size <= lastSize {
+			t.Errorf("JPEG at quality %d is %d bytes, want more than %d at the lower quality", quality, size, lastSize)
+		}
+		lastSize = size
+
+		// Thumbnails follow the setting too
+		dir := t.TempDir()
+		name, err := writeThumbnail(img, dir, "photo")
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() <= lastThumbnail {
+			t.Errorf("thumbnail at quality %d is %d bytes, want more than %d at the lower quality", quality, info.Size(), lastThumbnail)
+		}
+		lastThumbnail = info.Size()
+	}
+
+	sizes := map[string]int64{}
+	for _, compression := range []string{"none", "best"} {
+		useImageQuality(t, 90, compression)
+		sizes[compression] = encodedSize(t, twoToneImage(128, 128, 64, color.White, color.Black), "png")
+	}
+	if sizes["best"] >= sizes["none"] {
+		t.Errorf("PNG sizes %v, want best compression smaller than none", sizes)
+	}
+}
+
+func TestCheckImageSize(t *testing.T) {
+	tests := []struct {
+		width, height int
+		ok            bool
+	}{
+		{4000, 3000, true},
+		{10000, 10000, true},
+		{10001, 10000, false},
+		{maxDecodeDimension + 1, 1, false},
+		{0, 10, false},
+		{1 << 40, 1 << 40, false},
+	}
+	for _, tt := range tests {
+		err := checkImageSize(image.Config{Width: tt.width, Height: tt.height})
+		if (err == nil) != tt.ok {
+			t.Errorf("checkImageSize(%dx%d) = %v, want ok %v", tt.width, tt.height, err, tt.ok)
+		}
+	}
+}
+
+// A PNG signature and IHDR chunk claiming the given dimensions, with no
+// pixel data behind them
+func hostilePNG(width, height uint32) []byte {
+	ihdr := []byte("IHDR")
+	ihdr = binary.BigEndian.AppendUint32(ihdr, width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 6, 0, 0, 0) // 8-bit RGBA, no interlacing
+
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(ihdr)-4))
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestUploadRejectsHugePNG(t *testing.T) {
+	user := newTestUser(t)
+	file := hostilePNG(60000, 60000)
+	if config, _, err := image.DecodeConfig(bytes.NewReader(file)); err != nil || config.Width != 60000 {
+		t.Fatalf("DecodeConfig = %+v, %v, want a 60000x60000 header", config, err)
+	}
+
+	rec := uploadFile(t, user.token, "photography", "huge.png", file)
+	expectStatus(t, rec, http.StatusBadRequest)
+	if resp := decodeResponse(t, rec, nil); resp.Message != errCorruptImage.Error() {
+		t.Errorf("message = %q, want %q", resp.Message, errCorruptImage.Error())
+	}
+}
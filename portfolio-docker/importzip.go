@@ -0,0 +1,275 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// Extensions of archive entries imported as photos. HEIC is included so it's
+// reported as unsupported rather than silently skipped.
+var importExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".tif":  true,
+	".tiff": true,
+	".heic": true,
+	".heif": true,
+}
+
+// ImportResult is what became of one entry of an imported archive. Status is
+// "imported", "skipped" for entries that aren't images, or "failed".
+type ImportResult struct {
+	Name   string         `json:"name"`
+	Status string         `json:"status"`
+	Error  string         `json:"error,omitempty"`
+	Detail string         `json:"detail,omitempty"` // Underlying error, with DEBUG_ERRORS
+	Photo  *PhotoResponse `json:"photo,omitempty"`
+}
+
+// importEntryError is an entry that failed on the server's side, worded for
+// the client, with the underlying error's text when DEBUG_ERRORS is set
+type importEntryError struct {
+	message string
+	detail  string
+}
+
+func (e *importEntryError) Error() string {
+	return e.message
+}
+
+// Log a server-side failure importing an entry and wrap it for the results
+func internalImportError(message string, err error) error {
+	return &importEntryError{message: message, detail: logInternalError(message, err)}
+}
+
+// Whether an entry name stays inside the archive's root once extracted.
+// Entries are spooled to temporary files rather than extracted by name, but
+// one trying to escape marks a malicious archive and is refused all the same.
+func isSafeEntryName(name string) bool {
+	return !strings.Contains(name, `\`) && filepath.IsLocal(filepath.FromSlash(name))
+}
+
+// Whether an entry is metadata an archiver added, such as macOS resource
+// forks under __MACOSX or dotfiles
+func isHiddenEntry(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") || segment == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+// Derive a photo title from an entry name: "trips/Big_sur-01.jpg" becomes
+// "Big sur 01"
+func titleFromEntryName(name string) string {
+	base := sanitizeFilename(path.Base(name))
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	title := strings.Join(strings.Fields(strings.NewReplacer("_", " ", "-", " ").Replace(stem)), " ")
+	if title == "" {
+		return base
+	}
+	return title
+}
+
+// Import every image in an uploaded ZIP archive into one category, titled
+// after its entry name. Entries are processed one at a time; ones that
+// aren't images are skipped, and ones that can't be imported are reported
+// without stopping the rest.
+func importZipHandler(w http.ResponseWriter, r *http.Request) {
+	form, ok := readSpooledForm(w, r, "archive", false, importMaxArchiveBytes)
+	if !ok {
+		return
+	}
+	defer form.cleanup()
+
+	category := form.value("category")
+	if !isValidCategory(category) {
+		respondInvalidCategory(w)
+		return
+	}
+
+	archive, err := zip.OpenReader(form.tempPath)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "File must be a ZIP archive")
+		return
+	}
+	defer archive.Close()
+
+	// Refuse archives too big to import before extracting anything. The
+	// sizes are only what the archive claims; reads are limited as well.
+	if importMaxEntries > 0 && int64(len(archive.File)) > importMaxEntries {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Archives can have at most %d entries", importMaxEntries))
+		return
+	}
+	var declared uint64
+	for _, file := range archive.File {
+		declared += file.UncompressedSize64
+	}
+	if importMaxExtractedBytes > 0 && declared > uint64(importMaxExtractedBytes) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Archive extracts to more than the %d byte limit", importMaxExtractedBytes))
+		return
+	}
+
+	userID := r.Context().Value("userID").(int64)
+	ctx := requestContext(r)
+
+	results := []ImportResult{}
+	counts := map[string]int{}
+	var extracted int64
+	for _, file := range archive.File {
+		if strings.HasSuffix(file.Name, "/") {
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		result := ImportResult{Name: file.Name, Status: "failed"}
+		switch {
+		case !isSafeEntryName(file.Name):
+			result.Error = "Entry path leaves the archive"
+		case isHiddenEntry(file.Name) || !importExtensions[strings.ToLower(path.Ext(file.Name))]:
+			result.Status = "skipped"
+		default:
+			photo, err := importZipEntry(ctx, userID, category, file, &extracted)
+			if err != nil {
+				var entryErr *importEntryError
+				if errors.As(err, &entryErr) {
+					result.Detail = entryErr.detail
+				}
+				result.Error = err.Error()
+				break
+			}
+			auditPhotoAction(ctx, userID, "import", photo.ID, photo.Title)
+			response := photoResponseFromRow(r, photo)
+			result.Status, result.Photo = "imported", &response
+		}
+		counts[result.Status]++
+		results = append(results, result)
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Imported %d photos", counts["imported"]),
+		Data: map[string]interface{}{
+			"imported": counts["imported"],
+			"skipped":  counts["skipped"],
+			"failed":   counts["failed"],
+			"results":  results,
+		},
+	})
+}
+
+// Extract one archive entry to a temporary file and store it as a photo,
+// adding what it extracted to *extracted. Errors are worded for the client.
+func importZipEntry(ctx context.Context, userID int64, category string, file *zip.File, extracted *int64) (db.Photo, error) {
+	limit := maxUploadBytes
+	if importMaxExtractedBytes > 0 && (limit == 0 || importMaxExtractedBytes-*extracted < limit) {
+		limit = importMaxExtractedBytes - *extracted
+	}
+	if limit > 0 && file.UncompressedSize64 > uint64(limit) {
+		return db.Photo{}, fmt.Errorf("Image exceeds the %d byte limit", limit)
+	}
+
+	capacityMessage, err := categoryCapacityProblem(ctx, queries, userID, category, 1)
+	if err != nil {
+		return db.Photo{}, internalImportError("Database error", err)
+	}
+	if capacityMessage != "" {
+		return db.Photo{}, errors.New(capacityMessage)
+	}
+
+	quotaMessage, err := checkUploadQuota(ctx, queries, userID, 1, int64(file.UncompressedSize64))
+	if err != nil {
+		return db.Photo{}, internalImportError("Database error", err)
+	}
+	if quotaMessage != "" {
+		return db.Photo{}, errors.New(quotaMessage)
+	}
+
+	release, err := acquireImageSlot(ctx)
+	if err != nil {
+		return db.Photo{}, errors.New("Server is busy, please retry")
+	}
+	defer release()
+
+	form, err := spoolZipEntry(file, limit)
+	if form != nil {
+		defer form.cleanup()
+	}
+	if err != nil {
+		return db.Photo{}, err
+	}
+	*extracted += form.size
+
+	title := titleFromEntryName(file.Name)
+	photo, err := storePhoto(ctx, userID, form, photoFields{
+		title:    title,
+		category: category,
+		altText:  title,
+		status:   defaultPhotoStatus,
+	})
+	var formatErr *unsupportedFormatError
+	var quotaErr *quotaExceededError
+	var fullErr *categoryFullError
+	switch {
+	case err == nil:
+		return photo, nil
+	case errors.As(err, &formatErr), errors.As(err, &quotaErr), errors.As(err, &fullErr):
+		return db.Photo{}, err
+	case errors.Is(err, errCorruptImage):
+		return db.Photo{}, errCorruptImage
+	case errors.Is(err, errStoreFailed):
+		return db.Photo{}, internalImportError("Failed to save file", err)
+	default:
+		return db.Photo{}, internalImportError("Database error", err)
+	}
+}
+
+// Copy an entry to a temporary file in photoDir, as an upload is spooled,
+// reading at most limit bytes whatever the archive claims. Zero limit means
+// unlimited. The returned form must be cleaned up even on error.
+func spoolZipEntry(file *zip.File, limit int64) (*uploadForm, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, errors.New("Entry can't be read from the archive")
+	}
+	defer src.Close()
+
+	temp, err := os.CreateTemp(photoDir, ".upload-*")
+	if err != nil {
+		return nil, internalImportError("Failed to save file", err)
+	}
+	form := &uploadForm{tempPath: temp.Name(), filename: path.Base(file.Name)}
+
+	reader := io.Reader(src)
+	if limit > 0 {
+		reader = io.LimitReader(src, limit+1)
+	}
+	form.size, err = io.Copy(temp, reader)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	switch {
+	case errors.Is(err, zip.ErrFormat), errors.Is(err, zip.ErrChecksum), errors.Is(err, zip.ErrAlgorithm):
+		return form, errors.New("Entry can't be read from the archive")
+	case err != nil:
+		return form, internalImportError("Failed to save file", err)
+	case limit > 0 && form.size > limit:
+		return form, fmt.Errorf("Image exceeds the %d byte limit", limit)
+	}
+	return form, nil
+}
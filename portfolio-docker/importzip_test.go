@@ -0,0 +1,139 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// zipEntry is one file of a test archive
+type zipEntry struct {
+	name string
+	data []byte
+}
+
+// Build a ZIP archive of entries, in order
+func testZip(t *testing.T, entries ...zipEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(entry.data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Post an archive to the import endpoint
+func importZip(t *testing.T, token, category string, archive []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("category", category)
+	part, err := mw.CreateFormFile("archive", "portfolio.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(archive)
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return doRequest(t, "POST", "/api/photos/import-zip", token, mw.FormDataContentType(), &buf)
+}
+
+// importSummary is the data of an import response
+type importSummary struct {
+	Imported int            `json:"imported"`
+	Skipped  int            `json:"skipped"`
+	Failed   int            `json:"failed"`
+	Results  []ImportResult `json:"results"`
+}
+
+func TestTitleFromEntryName(t *testing.T) {
+	tests := map[string]string{
+		"trips/Big_sur-01.jpg": "Big sur 01",
+		"sunset.png":           "sunset",
+		"a__b--c.jpeg":         "a b c",
+	}
+	for name, want := range tests {
+		if got := titleFromEntryName(name); got != want {
+			t.Errorf("titleFromEntryName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestImportZip(t *testing.T) {
+	user := newTestUser(t)
+	png := testPNG(t, 8, 8, testColor)
+	archive := testZip(t,
+		zipEntry{"trips/Big_sur-01.png", png},
+		zipEntry{"../../escape.png", png},
+		zipEntry{"/etc/absolute.png", png},
+		zipEntry{"notes.txt", []byte("not a photo")},
+		zipEntry{"__MACOSX/trips/._Big_sur-01.png", []byte("resource fork")},
+		zipEntry{"broken.png", []byte("not really a png")},
+	)
+
+	rec := importZip(t, user.token, "photography", archive)
+	expectStatus(t, rec, http.StatusOK)
+	var summary importSummary
+	decodeResponse(t, rec, &summary)
+	if summary.Imported != 1 || summary.Skipped != 2 || summary.Failed != 3 {
+		t.Errorf("imported %d, skipped %d, failed %d; want 1, 2, 3", summary.Imported, summary.Skipped, summary.Failed)
+	}
+
+	want := map[string]string{
+		"trips/Big_sur-01.png":            "imported",
+		"../../escape.png":                "failed",
+		"/etc/absolute.png":               "failed",
+		"notes.txt":                       "skipped",
+		"__MACOSX/trips/._Big_sur-01.png": "skipped",
+		"broken.png":                      "failed",
+	}
+	for _, result := range summary.Results {
+		if result.Status != want[result.Name] {
+			t.Errorf("%s: %s (%s), want %s", result.Name, result.Status, result.Error, want[result.Name])
+		}
+		if result.Name == "trips/Big_sur-01.png" && (result.Photo == nil || result.Photo.Title != "Big sur 01") {
+			t.Errorf("imported photo = %+v, want titled Big sur 01", result.Photo)
+		}
+	}
+
+	// Only the good entry became a photo
+	var rows int
+	if err := dbConn.QueryRow(`SELECT COUNT(*) FROM photos WHERE user_id = ?`, user.id).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 1 {
+		t.Errorf("user has %d photos, want 1", rows)
+	}
+}
+
+func TestImportZipLimits(t *testing.T) {
+	user := newTestUser(t)
+	png := testPNG(t, 8, 8, testColor)
+
+	oldEntries := importMaxEntries
+	importMaxEntries = 2
+	t.Cleanup(func() { importMaxEntries = oldEntries })
+	rec := importZip(t, user.token, "photography", testZip(t, zipEntry{"a.png", png}, zipEntry{"b.png", png}, zipEntry{"c.png", png}))
+	expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+
+	oldExtracted := importMaxExtractedBytes
+	importMaxExtractedBytes = int64(len(png))
+	t.Cleanup(func() { importMaxExtractedBytes = oldExtracted })
+	rec = importZip(t, user.token, "photography", testZip(t, zipEntry{"a.png", png}, zipEntry{"b.png", png}))
+	expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+
+	expectStatus(t, importZip(t, user.token, "paintings", testZip(t, zipEntry{"a.png", png})), http.StatusBadRequest)
+	expectStatus(t, importZip(t, user.token, "photography", []byte("not a zip")), http.StatusBadRequest)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// InspectResponse describes an image without it being stored
+type InspectResponse struct {
+	ContentType string       `json:"contentType"`
+	Width       int          `json:"width"`
+	Height      int          `json:"height"`
+	SizeBytes   int64        `json:"sizeBytes"`
+	EXIF        *EXIFSummary `json:"exif"` // Null when the file has no EXIF
+}
+
+// EXIFSummary is the EXIF metadata of an image most useful to photographers
+type EXIFSummary struct {
+	Make         string   `json:"make,omitempty"`
+	Model        string   `json:"model,omitempty"`
+	LensModel    string   `json:"lensModel,omitempty"`
+	Software     string   `json:"software,omitempty"`
+	Artist       string   `json:"artist,omitempty"`
+	Copyright    string   `json:"copyright,omitempty"`
+	CapturedAt   string   `json:"capturedAt,omitempty"`
+	ExposureTime string   `json:"exposureTime,omitempty"` // Seconds, such as "1/250"
+	FNumber      float64  `json:"fNumber,omitempty"`
+	ISO          int      `json:"iso,omitempty"`
+	FocalLength  float64  `json:"focalLength,omitempty"` // Millimeters
+	Orientation  int      `json:"orientation,omitempty"`
+	HasGPS       bool     `json:"hasGps"`
+	GPS          *GPSInfo `json:"gps,omitempty"` // Only when asked for with gps=true
+}
+
+// GPSInfo is where an image was taken
+type GPSInfo struct {
+	Latitude  float64  `json:"latitude"`  // Degrees, negative south
+	Longitude float64  `json:"longitude"` // Degrees, negative west
+	Altitude  *float64 `json:"altitude,omitempty"`
+}
+
+// Summarize the EXIF of an image, including its position only when
+// includeGPS is set
+func summarizeEXIF(exif *exifData, includeGPS bool) *EXIFSummary {
+	summary := &EXIFSummary{
+		Orientation: exif.Uint(exifTagOrientation, 0),
+		ISO:         exif.Uint(exifTagISOSpeed, 0),
+		HasGPS:      exif.HasGPS(),
+	}
+	summary.Make, _ = exif.String(exifTagMake)
+	summary.Model, _ = exif.String(exifTagModel)
+	summary.LensModel, _ = exif.String(exifTagLensModel)
+	summary.Software, _ = exif.String(exifTagSoftware)
+	summary.Artist, _ = exif.String(exifTagArtist)
+	summary.Copyright, _ = exif.String(exifTagCopyright)
+	if t, ok := exif.CaptureTime(); ok {
+		summary.CapturedAt = formatTimestamp(t)
+	}
+	if values := exif.Rationals(exifTagExposureTime); len(values) == 1 && values[0] > 0 {
+		if values[0] < 1 {
+			summary.ExposureTime = fmt.Sprintf("1/%d", int(math.Round(1/values[0])))
+		} else {
+			summary.ExposureTime = strconv.FormatFloat(values[0], 'f', -1, 64)
+		}
+	}
+	if values := exif.Rationals(exifTagFNumber); len(values) == 1 {
+		summary.FNumber = values[0]
+	}
+	if values := exif.Rationals(exifTagFocalLength); len(values) == 1 {
+		summary.FocalLength = values[0]
+	}
+	if includeGPS {
+		if lat, lon, alt, ok := exif.Position(); ok {
+			summary.GPS = &GPSInfo{Latitude: lat, Longitude: lon, Altitude: alt}
+		}
+	}
+	return summary
+}
+
+// Report an image's type, dimensions and EXIF without storing anything, so
+// users can check a file before uploading it. The position is left out
+// unless gps=true, as the response may end up anywhere the client puts it.
+func inspectPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	includeGPS := false
+	if value := r.URL.Query().Get("gps"); value != "" {
+		var err error
+		if includeGPS, err = strconv.ParseBool(value); err != nil {
+			respondWithError(w, http.StatusBadRequest, "gps must be true or false")
+			return
+		}
+	}
+
+	form, ok := readUploadForm(w, r)
+	if !ok {
+		return
+	}
+	defer form.cleanup()
+
+	f, err := os.Open(form.tempPath)
+	if err != nil {
+		respondWithInternalError(w, "Failed to read file", err)
+		return
+	}
+	defer f.Close()
+
+	config, format, err := image.DecodeConfig(bufio.NewReader(f))
+	if err != nil {
+		respondWithError(w, http.StatusUnsupportedMediaType, fmt.Sprintf("File must be an image of type %s", strings.Join(supportedContentTypes, ", ")))
+		return
+	}
+	response := InspectResponse{
+		ContentType: "image/" + format,
+		Width:       config.Width,
+		Height:      config.Height,
+		SizeBytes:   form.size,
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		respondWithInternalError(w, "Failed to read file", err)
+		return
+	}
+	if exif, err := decodeEXIF(bufio.NewReader(f)); err == nil {
+		response.EXIF = summarizeEXIF(exif, includeGPS)
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    response,
+	})
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// exifField is a TIFF directory entry of a test EXIF block
+type exifField struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	value []byte // Little-endian
+}
+
+func asciiField(tag uint16, s string) exifField {
+	return exifField{tag, 2, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+func shortField(tag uint16, v uint16) exifField {
+	return exifField{tag, 3, 1, binary.LittleEndian.AppendUint16(nil, v)}
+}
+
+func longField(tag uint16, v uint32) exifField {
+	return exifField{tag, 4, 1, binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+// A RATIONAL field of numerator, denominator pairs
+func rationalField(tag uint16, pairs ...uint32) exifField {
+	value := []byte{}
+	for _, v := range pairs {
+		value = binary.LittleEndian.AppendUint32(value, v)
+	}
+	return exifField{tag, 5, uint32(len(pairs) / 2), value}
+}
+
+// Bytes a directory of fields takes, values included
+func ifdSize(fields []exifField) int {
+	size := 2 + 12*len(fields) + 4
+	for _, f := range fields {
+		if len(f.value) > 4 {
+			size += len(f.value)
+		}
+	}
+	return size
+}
+
+// Append a directory of fields, with its values following it
+func appendIFD(data []byte, fields []exifField) []byte {
+	fields = slices.Clone(fields)
+	slices.SortFunc(fields, func(a, b exifField) int { return int(a.tag) - int(b.tag) })
+
+	le := binary.LittleEndian
+	valuesAt := len(data) + 2 + 12*len(fields) + 4
+	values := []byte{}
+	data = le.AppendUint16(data, uint16(len(fields)))
+	for _, f := range fields {
+		data = le.AppendUint16(data, f.tag)
+		data = le.AppendUint16(data, f.typ)
+		data = le.AppendUint32(data, f.count)
+		if len(f.value) <= 4 {
+			data = append(data, append(slices.Clone(f.value), make([]byte, 4-len(f.value))...)...)
+			continue
+		}
+		data = le.AppendUint32(data, uint32(valuesAt+len(values)))
+		values = append(values, f.value...)
+	}
+	data = le.AppendUint32(data, 0)
+	return append(data, values...)
+}
+
+// Build a little-endian EXIF block with the given IFD0 fields and, when
+// there are any, a GPS sub-IFD
+func testEXIFFields(ifd0, gps []exifField) []byte {
+	data := []byte("II\x2a\x00\x08\x00\x00\x00")
+	if len(gps) > 0 {
+		ifd0 = append(slices.Clone(ifd0), longField(exifTagGPSIFDPointer, 0))
+		ifd0[len(ifd0)-1].value = binary.LittleEndian.AppendUint32(nil, uint32(len(data)+ifdSize(ifd0)))
+	}
+	data = appendIFD(data, ifd0)
+	if len(gps) > 0 {
+		data = appendIFD(data, gps)
+	}
+	return data
+}
+
+// Inspect a file, with query appended to the URL
+func inspectFile(t *testing.T, token, query, filename, contentType string, file []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	formType, body := multipartBody(t, filename, contentType, file, nil)
+	return doRequest(t, "POST", "/api/photos/inspect"+query, token, formType, body)
+}
+
+// Inspect a file, failing the test unless it succeeds
+func mustInspect(t *testing.T, token, query, filename, contentType string, file []byte) InspectResponse {
+	t.Helper()
+	rec := inspectFile(t, token, query, filename, contentType, file)
+	expectStatus(t, rec, http.StatusOK)
+	var inspected InspectResponse
+	decodeResponse(t, rec, &inspected)
+	return inspected
+}
+
+func TestInspectPhoto(t *testing.T) {
+	user := newTestUser(t)
+	file := testJPEGWithEXIF(t, testEXIFFields([]exifField{
+		asciiField(exifTagMake, "Canon"),
+		asciiField(exifTagModel, "EOS R5"),
+		asciiField(exifTagLensModel, "RF50mm F1.8 STM"),
+		asciiField(exifTagDateTimeOriginal, "2021:07:04 18:00:00"),
+		rationalField(exifTagExposureTime, 1, 250),
+		rationalField(exifTagFNumber, 28, 10),
+		shortField(exifTagISOSpeed, 400),
+		rationalField(exifTagFocalLength, 50, 1),
+		shortField(exifTagOrientation, 6),
+	}, []exifField{
+		asciiField(gpsTagLatitudeRef, "N"),
+		rationalField(gpsTagLatitude, 51, 1, 30, 1, 0, 1),
+		asciiField(gpsTagLongitudeRef, "W"),
+		rationalField(gpsTagLongitude, 0, 1, 7, 1, 30, 1),
+		rationalField(gpsTagAltitude, 12, 1),
+	}))
+	want := EXIFSummary{
+		Make:         "Canon",
+		Model:        "EOS R5",
+		LensModel:    "RF50mm F1.8 STM",
+		CapturedAt:   "2021-07-04T18:00:00Z",
+		ExposureTime: "1/250",
+		FNumber:      2.8,
+		ISO:          400,
+		FocalLength:  50,
+		Orientation:  6,
+		HasGPS:       true,
+	}
+
+	entries, err := os.ReadDir(photoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inspected := mustInspect(t, user.token, "", "photo.jpg", "image/jpeg", file)
+	if inspected.ContentType != "image/jpeg" || inspected.Width != 8 || inspected.Height != 8 || inspected.SizeBytes != int64(len(file)) {
+		t.Errorf("inspected %+v, want an 8x8 image/jpeg of %d bytes", inspected, len(file))
+	}
+	if inspected.EXIF == nil || !reflect.DeepEqual(*inspected.EXIF, want) {
+		t.Fatalf("EXIF = %+v, want %+v", inspected.EXIF, want)
+	}
+
+	// The position only when asked for
+	inspected = mustInspect(t, user.token, "?gps=true", "photo.jpg", "image/jpeg", file)
+	gps := inspected.EXIF.GPS
+	if gps == nil || math.Abs(gps.Latitude-51.5) > 1e-9 || math.Abs(gps.Longitude+0.125) > 1e-9 || gps.Altitude == nil || *gps.Altitude != 12 {
+		t.Errorf("GPS = %+v, want 51.5, -0.125 at 12m", gps)
+	}
+
+	// Nothing is stored
+	after, err := os.ReadDir(photoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(entries) {
+		t.Errorf("photo directory holds %d entries after inspecting, want %d", len(after), len(entries))
+	}
+	if page := listPhotos(t, "/api/profile/photos", user.token); page.Total != 0 {
+		t.Errorf("user has %d photos after inspecting, want 0", page.Total)
+	}
+
+	inspected = mustInspect(t, user.token, "", "plain.png", "image/png", testPNG(t, 4, 3, testColor))
+	if inspected.ContentType != "image/png" || inspected.Width != 4 || inspected.Height != 3 || inspected.EXIF != nil {
+		t.Errorf("inspected %+v, want a 4x3 image/png without EXIF", inspected)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		query  string
+		file   []byte
+		status int
+	}{
+		{"bad gps flag", user.token, "?gps=maybe", file, http.StatusBadRequest},
+		{"not an image", user.token, "", []byte(strings.Repeat("text ", 20)), http.StatusUnsupportedMediaType},
+		{"signed out", "", "", file, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, inspectFile(t, tt.token, tt.query, "photo.jpg", "image/jpeg", tt.file), tt.status)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// How long an invite stays valid when the admin doesn't say
+const defaultInviteTTL = 7 * 24 * time.Hour
+
+// InviteRequest optionally sets how many hours a new invite is valid for
+type InviteRequest struct {
+	ExpiresInHours int64 `json:"expiresInHours"`
+}
+
+// InviteResponse represents an invite in the response
+type InviteResponse struct {
+	Token     string `json:"token"`
+	CreatedAt string `json:"createdAt"`
+	ExpiresAt string `json:"expiresAt"`
+	UsedBy    *int64 `json:"usedBy"`
+	UsedAt    string `json:"usedAt,omitempty"`
+}
+
+func inviteResponseFromRow(invite db.Invite) InviteResponse {
+	response := InviteResponse{
+		Token:     invite.Token,
+		ExpiresAt: formatTimestamp(invite.ExpiresAt),
+	}
+	if invite.CreatedAt.Valid {
+		response.CreatedAt = formatTimestamp(invite.CreatedAt.Time)
+	}
+	if invite.UsedBy.Valid {
+		response.UsedBy = &invite.UsedBy.Int64
+	}
+	if invite.UsedAt.Valid {
+		response.UsedAt = formatTimestamp(invite.UsedAt.Time)
+	}
+	return response
+}
+
+// Check that an invite token exists, is unused and hasn't expired, writing
+// the error response if not
+func checkInvite(w http.ResponseWriter, ctx context.Context, token string) bool {
+	if token == "" {
+		respondForbidden(w, "An invite is required to register")
+		return false
+	}
+
+	invite, err := queries.GetInvite(ctx, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondForbidden(w, "Invalid or expired invite")
+		return false
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return false
+	}
+	if invite.UsedBy.Valid || time.Now().After(invite.ExpiresAt) {
+		respondForbidden(w, "Invalid or expired invite")
+		return false
+	}
+	return true
+}
+
+// Create a user and mark the invite used in one transaction, so an invite
+// can't be redeemed twice by concurrent registrations
+func createUserWithInvite(w http.ResponseWriter, ctx context.Context, params db.CreateUserParams, token string) bool {
+	tx, err := dbConn.Begin()
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return false
+	}
+	defer tx.Rollback()
+
+	qtx := queries.WithTx(tx)
+	user, err := qtx.CreateUser(ctx, params)
+	if err != nil {
+		respondWithInternalError(w, "Error creating user", err)
+		return false
+	}
+
+	used, err := qtx.UseInvite(ctx, db.UseInviteParams{
+		UsedBy: sql.NullInt64{Int64: user.ID, Valid: true},
+		Token:  token,
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return false
+	}
+	if used == 0 {
+		respondForbidden(w, "Invalid or expired invite")
+		return false
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithDatabaseError(w, err)
+		return false
+	}
+	return true
+}
+
+// Generate an invite token (admin only)
+func createInviteHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.Context().Value("userID").(int64)
+
+	var req InviteRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+	if req.ExpiresInHours < 0 {
+		respondWithError(w, http.StatusBadRequest, "expiresInHours must not be negative")
+		return
+	}
+
+	ttl := defaultInviteTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	invite, err := withRetry(requestContext(r), func() (db.Invite, error) {
+		return queries.CreateInvite(requestContext(r), db.CreateInviteParams{
+			Token:     generateID(),
+			CreatedBy: adminID,
+			ExpiresAt: time.Now().Add(ttl).UTC(),
+		})
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, Response{
+		Success: true,
+		Message: "Invite created successfully",
+		Data:    inviteResponseFromRow(invite),
+	})
+}
+
+// List all invites, newest first (admin only)
+func listInvitesHandler(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rows, err := queries.ListInvites(requestContext(r))
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	start, end := pageBounds(len(rows), page, pageSize)
+	invites := []InviteResponse{}
+	for _, row := range rows[start:end] {
+		invites = append(invites, inviteResponseFromRow(row))
+	}
+
+	setPaginationHeaders(w, r, page, pageSize, int64(len(rows)))
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    newPaginatedResponse(invites, page, pageSize, int64(len(rows))),
+	})
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Switch REGISTRATION_MODE until the test ends
+func setRegistrationMode(t *testing.T, mode string) {
+	t.Helper()
+	old := registrationMode
+	registrationMode = mode
+	t.Cleanup(func() { registrationMode = old })
+}
+
+// Register a new account, returning the response
+func register(t *testing.T, inviteToken string) *httptest.ResponseRecorder {
+	t.Helper()
+	n := testUserCount.Add(1)
+	return doJSON(t, "POST", "/api/register", "", Credentials{
+		Name:        fmt.Sprintf("User %d", n),
+		Email:       fmt.Sprintf("user%d@example.com", n),
+		Password:    "correct horse battery staple",
+		InviteToken: inviteToken,
+	})
+}
+
+// Create an invite as an admin
+func createInvite(t *testing.T, admin testUser) InviteResponse {
+	t.Helper()
+	rec := doJSON(t, "POST", "/api/admin/invites", admin.token, nil)
+	expectStatus(t, rec, http.StatusCreated)
+	var invite InviteResponse
+	decodeResponse(t, rec, &invite)
+	return invite
+}
+
+func TestClosedRegistration(t *testing.T) {
+	setRegistrationMode(t, "closed")
+	expectStatus(t, register(t, ""), http.StatusForbidden)
+}
+
+func TestInviteOnlyRegistration(t *testing.T) {
+	admin := newTestAdmin(t)
+	setRegistrationMode(t, "invite")
+
+	expectStatus(t, register(t, ""), http.StatusForbidden)
+	expectStatus(t, register(t, "no-such-invite"), http.StatusForbidden)
+
+	invite := createInvite(t, admin)
+	expectStatus(t, register(t, invite.Token), http.StatusCreated)
+	expectStatus(t, register(t, invite.Token), http.StatusForbidden)
+
+	expired := createInvite(t, admin)
+	if _, err := dbConn.Exec(`UPDATE invites SET expires_at = datetime('now', '-1 hour') WHERE token = ?`, expired.Token); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, register(t, expired.Token), http.StatusForbidden)
+
+	rec := doJSON(t, "GET", "/api/admin/invites?pageSize=100", admin.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var page struct {
+		Items []InviteResponse `json:"items"`
+	}
+	decodeResponse(t, rec, &page)
+	for _, listed := range page.Items {
+		if listed.Token == invite.Token && listed.UsedBy == nil {
+			t.Error("redeemed invite not marked used")
+		}
+	}
+}
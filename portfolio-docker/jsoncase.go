@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"unicode"
+)
+
+// Naming of JSON response fields: "camel" as declared on the structs, or
+// "snake". Clients can also ask for snake_case on a single request by
+// accepting snakeCaseMediaType.
+var jsonFieldCase = getEnvChoice("JSON_FIELD_CASE", "camel", "camel", "snake")
+
+// Media type that selects snake_case field names for one request
+const snakeCaseMediaType = "application/vnd.api+json"
+
+// snakeCaseWriter marks a response whose JSON field names respondWithJSON
+// rewrites in snake_case, and the content type to send it with
+type snakeCaseWriter struct {
+	http.ResponseWriter
+	contentType string
+}
+
+// Select the JSON field naming for the request, from its Accept header or
+// JSON_FIELD_CASE
+func jsonFieldCaseMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept"), snakeCaseMediaType) {
+			w = &snakeCaseWriter{ResponseWriter: w, contentType: snakeCaseMediaType}
+		} else if jsonFieldCase == "snake" {
+			w = &snakeCaseWriter{ResponseWriter: w, contentType: "application/json"}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// The snakeCaseWriter beneath any middleware wrapping w, or nil when the
+// request uses camelCase
+func snakeCaseFor(w http.ResponseWriter) *snakeCaseWriter {
+	for {
+		switch v := w.(type) {
+		case *snakeCaseWriter:
+			return v
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
+
+// Rewrite every object key of an encoded JSON document in snake_case
+func snakeCaseJSON(data []byte) ([]byte, error) {
+	// Decode numbers as json.Number so large IDs survive the round trip
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(snakeCaseKeys(value))
+}
+
+func snakeCaseKeys(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[toSnakeCase(key)] = snakeCaseKeys(item)
+		}
+		return converted
+	case []interface{}:
+		for i, item := range v {
+			v[i] = snakeCaseKeys(item)
+		}
+		return v
+	}
+	return value
+}
+
+// Convert a camelCase name to snake_case, so "thumbnailUrl" becomes
+// "thumbnail_url". Names without capitals are returned unchanged.
+func toSnakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
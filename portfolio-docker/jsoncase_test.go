@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestToSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"id":           "id",
+		"thumbnailUrl": "thumbnail_url",
+		"altText":      "alt_text",
+		"hasMore":      "has_more",
+	}
+	for name, want := range tests {
+		if got := toSnakeCase(name); got != want {
+			t.Errorf("toSnakeCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSnakeCaseJSON(t *testing.T) {
+	got, err := snakeCaseJSON([]byte(`{"userId":9007199254740993,"items":[{"altText":"a"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"items":[{"alt_text":"a"}],"user_id":9007199254740993}`; string(got) != want {
+		t.Errorf("snakeCaseJSON() = %s, want %s", got, want)
+	}
+}
+
+// Fetch a photo with the given Accept header, returning the response and
+// its data decoded into a map
+func getPhotoFields(t *testing.T, photo PhotoResponse, accept string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/api/photos/"+photo.Category+"/"+photo.ID, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	testHandler.ServeHTTP(rec, req)
+	expectStatus(t, rec, http.StatusOK)
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(body["data"], &fields); err != nil {
+		t.Fatalf("decoding data %s: %v", body["data"], err)
+	}
+	return rec, fields
+}
+
+func TestJSONFieldCase(t *testing.T) {
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+
+	rec, fields := getPhotoFields(t, photo, "")
+	if _, ok := fields["thumbnailUrl"]; !ok {
+		t.Errorf("camelCase fields = %v, want thumbnailUrl", fields)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+
+	rec, snake := getPhotoFields(t, photo, snakeCaseMediaType)
+	if _, ok := snake["thumbnail_url"]; !ok {
+		t.Errorf("snake_case fields = %v, want thumbnail_url", snake)
+	}
+	if _, ok := snake["thumbnailUrl"]; ok {
+		t.Error("snake_case response holds thumbnailUrl")
+	}
+	if len(snake) != len(fields) {
+		t.Errorf("snake_case response has %d fields, want %d", len(snake), len(fields))
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != snakeCaseMediaType {
+		t.Errorf("Content-Type = %q, want %s", ct, snakeCaseMediaType)
+	}
+
+	old := jsonFieldCase
+	jsonFieldCase = "snake"
+	t.Cleanup(func() { jsonFieldCase = old })
+	rec, snake = getPhotoFields(t, photo, "")
+	if _, ok := snake["thumbnail_url"]; !ok {
+		t.Errorf("fields with JSON_FIELD_CASE=snake = %v, want thumbnail_url", snake)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+}
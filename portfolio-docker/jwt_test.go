@@ -0,0 +1,219 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// Switch the JWT signing settings until the test ends
+func useJWTKeys(t *testing.T, alg string, keys map[string][]byte, currentKID string) {
+	t.Helper()
+	oldAlg, oldKeys, oldKID := jwtSigningAlg, jwtKeys, jwtCurrentKID
+	t.Cleanup(func() { jwtSigningAlg, jwtKeys, jwtCurrentKID = oldAlg, oldKeys, oldKID })
+	jwtSigningAlg, jwtKeys, jwtCurrentKID = alg, keys, currentKID
+}
+
+// Claims for a token of user 1 valid for an hour
+func testClaims() *Claims {
+	userID := int64(1)
+	return &Claims{
+		UserID: &userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+}
+
+// Sign claims, failing the test on error
+func mustSignJWT(t *testing.T, claims jwt.Claims) string {
+	t.Helper()
+	token, err := signJWT(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestParseJWTKeys(t *testing.T) {
+	keys := parseJWTKeys(" old:first-secret, new:second:secret ")
+	if len(keys) != 2 || string(keys["old"]) != "first-secret" || string(keys["new"]) != "second:secret" {
+		t.Errorf("parseJWTKeys() = %q", keys)
+	}
+	if keys := parseJWTKeys(""); len(keys) != 0 {
+		t.Errorf("parseJWTKeys(\"\") = %q, want no keys", keys)
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	useJWTKeys(t, "HS256", map[string][]byte{"old": []byte("old-secret")}, "old")
+	oldToken := mustSignJWT(t, testClaims())
+
+	// Both keys are accepted while the new one is current
+	useJWTKeys(t, "HS256", map[string][]byte{"old": []byte("old-secret"), "new": []byte("new-secret")}, "new")
+	newToken := mustSignJWT(t, testClaims())
+	for name, token := range map[string]string{"old key": oldToken, "new key": newToken} {
+		if _, err := parseJWT(token); err != nil {
+			t.Errorf("%s: parseJWT() = %v", name, err)
+		}
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Header["kid"] != "new" {
+		t.Errorf("kid = %v, want new", parsed.Header["kid"])
+	}
+
+	// Once the old key is removed its tokens are rejected
+	useJWTKeys(t, "HS256", map[string][]byte{"new": []byte("new-secret")}, "new")
+	if _, err := parseJWT(oldToken); err == nil {
+		t.Error("token signed by a removed key accepted")
+	}
+	if _, err := parseJWT(newToken); err != nil {
+		t.Errorf("current key: parseJWT() = %v", err)
+	}
+}
+
+func TestJWTWithoutKIDUsesSecretKey(t *testing.T) {
+	useJWTKeys(t, "HS256", map[string][]byte{}, "")
+	legacy := mustSignJWT(t, testClaims())
+
+	useJWTKeys(t, "HS256", map[string][]byte{"new": []byte("new-secret")}, "new")
+	if _, err := parseJWT(legacy); err != nil {
+		t.Errorf("token without kid: parseJWT() = %v", err)
+	}
+}
+
+func TestJWTSigningAlgorithm(t *testing.T) {
+	useJWTKeys(t, "HS512", map[string][]byte{}, "")
+	token := mustSignJWT(t, testClaims())
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Method.Alg() != "HS512" {
+		t.Errorf("signed with %s, want HS512", parsed.Method.Alg())
+	}
+	if _, err := parseJWT(token); err != nil {
+		t.Errorf("parseJWT() = %v", err)
+	}
+
+	// Tokens signed with another algorithm than the configured one are
+	// rejected, even with the right key
+	useJWTKeys(t, "HS256", map[string][]byte{}, "")
+	if _, err := parseJWT(token); err == nil {
+		t.Error("HS512 token accepted with JWT_SIGNING_ALG=HS256")
+	}
+}
+
+func TestJWTLeeway(t *testing.T) {
+	old := jwtLeeway
+	t.Cleanup(func() { jwtLeeway = old })
+
+	tests := []struct {
+		name   string
+		exp    time.Duration // From now
+		nbf    time.Duration // From now, or none when zero
+		leeway time.Duration
+		valid  bool
+	}{
+		{"expired within the leeway", -30 * time.Second, 0, time.Minute, true},
+		{"expired beyond the leeway", -2 * time.Minute, 0, time.Minute, false},
+		{"expired without leeway", -30 * time.Second, 0, 0, false},
+		{"not yet valid within the leeway", time.Hour, 30 * time.Second, time.Minute, true},
+		{"not yet valid beyond the leeway", time.Hour, 2 * time.Minute, time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwtLeeway = tt.leeway
+			claims := testClaims()
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(tt.exp))
+			if tt.nbf != 0 {
+				claims.NotBefore = jwt.NewNumericDate(time.Now().Add(tt.nbf))
+			}
+			_, err := parseJWT(mustSignJWT(t, claims))
+			if (err == nil) != tt.valid {
+				t.Errorf("parseJWT() = %v, want valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestJWTValidation(t *testing.T) {
+	now := time.Now()
+	exp := now.Add(time.Hour).Unix()
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		message string // Of the 401 for the token
+	}{
+		{"no exp", jwt.MapClaims{"user_id": 1}, "Invalid token"},
+		{"exp not a number", jwt.MapClaims{"user_id": 1, "exp": "tomorrow"}, "Invalid token"},
+		{"expired", jwt.MapClaims{"user_id": 1, "exp": now.Add(-time.Hour).Unix()}, "Token expired"},
+		{"issued in the future", jwt.MapClaims{"user_id": 1, "exp": exp, "iat": now.Add(time.Hour).Unix()}, "Invalid token"},
+		{"no user_id", jwt.MapClaims{"exp": exp}, "Invalid token"},
+		{"user_id not a number", jwt.MapClaims{"user_id": "1", "exp": exp}, "Invalid token"},
+		{"user_id zero", jwt.MapClaims{"user_id": 0, "exp": exp}, "Invalid token"},
+		{"user_id negative", jwt.MapClaims{"user_id": -1, "exp": exp}, "Invalid token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := mustSignJWT(t, tt.claims)
+			if _, err := parseJWT(token); err == nil {
+				t.Error("parseJWT() accepted the token")
+			}
+			rec := doJSON(t, "GET", "/api/profile", token, nil)
+			expectStatus(t, rec, http.StatusUnauthorized)
+			if resp := decodeResponse(t, rec, nil); resp.Message != tt.message {
+				t.Errorf("message %q, want %q", resp.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestGenerateJWTClaims(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	user := db.User{ID: 7, Email: "claims@example.com", Role: "admin", TokenVersion: 3}
+	token, err := generateJWT(user, "session-1", expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := parseJWT(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *claims.UserID != user.ID || claims.Email != user.Email || claims.Role != user.Role ||
+		claims.TokenVersion != user.TokenVersion || claims.ID != "session-1" || !claims.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("parsed claims %+v, want those of %+v", claims, user)
+	}
+}
+
+func TestJWTMissingClaims(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+
+	// Optional claims are left at their zero values
+	claims, err := parseJWT(mustSignJWT(t, jwt.MapClaims{"user_id": 1, "exp": exp}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *claims.UserID != 1 || claims.Email != "" || claims.Role != "" || claims.TokenVersion != 0 || claims.Act != nil {
+		t.Errorf("parsed claims %+v, want only user 1", claims)
+	}
+
+	// Claims of the wrong type are errors rather than panics
+	for name, claim := range map[string]jwt.MapClaims{
+		"email": {"user_id": 1, "exp": exp, "email": 5},
+		"role":  {"user_id": 1, "exp": exp, "role": true},
+		"act":   {"user_id": 1, "exp": exp, "act": "admin"},
+	} {
+		if _, err := parseJWT(mustSignJWT(t, claim)); err == nil {
+			t.Errorf("token with a mistyped %s accepted", name)
+		}
+	}
+}
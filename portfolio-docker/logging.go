@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Log output format ("text" or "json") and minimum level
+var (
+	logFormat = getEnv("LOG_FORMAT", "text")
+	logLevel  = getEnv("LOG_LEVEL", "info")
+)
+
+// Comma-separated path prefixes, such as health checks and static photos,
+// whose requests are logged at LOG_EXCLUDED_LEVEL rather than info. Requests
+// that fail are logged at info regardless.
+var (
+	logExcludePaths  = getEnvList("LOG_EXCLUDE_PATHS")
+	logExcludedLevel = getEnv("LOG_EXCLUDED_LEVEL", "debug")
+)
+
+// LOG_EXCLUDED_LEVEL, parsed by setupLogger
+var excludedLevel slog.Level
+
+// Install the slog handler selected by LOG_FORMAT and LOG_LEVEL as the
+// default logger. Output from the standard log package goes through it too.
+func setupLogger() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(logLevel)); err != nil {
+		log.Fatalf("Invalid value for LOG_LEVEL: %q", logLevel)
+	}
+	if err := excludedLevel.UnmarshalText([]byte(logExcludedLevel)); err != nil {
+		log.Fatalf("Invalid value for LOG_EXCLUDED_LEVEL: %q", logExcludedLevel)
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(logFormat) {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	case "text":
+		handler = slog.NewTextHandler(os.Stdout, options)
+	default:
+		log.Fatalf("Invalid value for LOG_FORMAT: %q", logFormat)
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
+
+// statusRecorder captures the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController and
+// snakeCaseFor
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// requestLoggingMiddleware assigns each request an ID, echoed in the
+// X-Request-ID header, and logs it once the response has been written
+func requestLoggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		// Keep an ID assigned by a proxy in front of us so logs can be joined
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" {
+			requestID = generateID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		ctx := context.WithValue(r.Context(), "requestID", requestID)
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		level := slog.LevelInfo
+		if rec.status < 400 && isExcludedFromLog(r.URL.Path) {
+			level = excludedLevel
+		}
+		slog.Log(r.Context(), level, "Request handled",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+			"request_id", requestID,
+		)
+	})
+}
+
+// Whether a request path falls under LOG_EXCLUDE_PATHS
+func isExcludedFromLog(path string) bool {
+	for _, prefix := range logExcludePaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Send the default logger's records to a JSON handler writing to the
+// returned buffer until the test ends
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level})))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	return &buf
+}
+
+// Serve one request through requestLoggingMiddleware, returning the
+// response and the decoded log lines it wrote
+func serveLogged(t *testing.T, logs *bytes.Buffer, path string, status int, requestID string) (*httptest.ResponseRecorder, []map[string]any) {
+	t.Helper()
+	logs.Reset()
+	handler := requestLoggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	req := httptest.NewRequest("GET", path, nil)
+	if requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var lines []map[string]any
+	dec := json.NewDecoder(logs)
+	for dec.More() {
+		var line map[string]any
+		if err := dec.Decode(&line); err != nil {
+			t.Fatalf("log output isn't JSON: %v", err)
+		}
+		lines = append(lines, line)
+	}
+	return rec, lines
+}
+
+func TestRequestLoggingJSON(t *testing.T) {
+	logs := captureLogs(t, slog.LevelInfo)
+
+	rec, lines := serveLogged(t, logs, "/api/photos/photography", http.StatusTeapot, "req-123")
+	if got := rec.Header().Get("X-Request-ID"); got != "req-123" {
+		t.Errorf("X-Request-ID = %q, want the caller's req-123", got)
+	}
+	if len(lines) != 1 {
+		t.Fatalf("logged %d lines, want 1", len(lines))
+	}
+	line := lines[0]
+	if line["msg"] != "Request handled" || line["method"] != "GET" || line["path"] != "/api/photos/photography" ||
+		line["status"] != float64(http.StatusTeapot) || line["request_id"] != "req-123" {
+		t.Errorf("log line = %v", line)
+	}
+	if _, ok := line["latency_ms"].(float64); !ok {
+		t.Errorf("latency_ms = %v, want a number", line["latency_ms"])
+	}
+
+	rec, _ = serveLogged(t, logs, "/api/health", http.StatusOK, "")
+	if rec.Header().Get("X-Request-ID") == "" {
+		t.Error("no request ID generated")
+	}
+}
+
+func TestRequestLoggingExcludedPaths(t *testing.T) {
+	oldPaths, oldLevel := logExcludePaths, excludedLevel
+	logExcludePaths = []string{"/api/health", "/photos/"}
+	excludedLevel = slog.LevelDebug
+	t.Cleanup(func() { logExcludePaths, excludedLevel = oldPaths, oldLevel })
+	logs := captureLogs(t, slog.LevelInfo)
+
+	tests := []struct {
+		path   string
+		status int
+		logged bool
+	}{
+		{"/api/health", http.StatusOK, false},
+		{"/api/health/ready", http.StatusOK, false},
+		{"/photos/photography/a.png", http.StatusNotModified, false},
+		{"/api/health", http.StatusServiceUnavailable, true},
+		{"/photos/photography/a.png", http.StatusNotFound, true},
+		{"/api/photos/photography", http.StatusOK, true},
+	}
+	for _, tt := range tests {
+		_, lines := serveLogged(t, logs, tt.path, tt.status, "")
+		if logged := len(lines) == 1; logged != tt.logged {
+			t.Errorf("%s with %d: logged %d lines at info, want logged %v", tt.path, tt.status, len(lines), tt.logged)
+		}
+	}
+
+	// Still logged at the lower level
+	logs = captureLogs(t, slog.LevelDebug)
+	if _, lines := serveLogged(t, logs, "/api/health", http.StatusOK, ""); len(lines) != 1 || lines[0]["level"] != "DEBUG" {
+		t.Errorf("excluded path at debug: %v", lines)
+	}
+}
@@ -6,12 +6,15 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
+	"log/slog"
+	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -26,11 +29,13 @@ import (
 
 // Response structure for API responses
 type Response struct {
-	Success bool          `json:"success"`
-	Message string        `json:"message,omitempty"`
-	Token   string        `json:"token,omitempty"`
-	User    *UserResponse `json:"user,omitempty"`
-	Data    interface{}   `json:"data,omitempty"`
+	Success bool              `json:"success"`
+	Message string            `json:"message,omitempty"`
+	Token   string            `json:"token,omitempty"`
+	User    *UserResponse     `json:"user,omitempty"`
+	Data    interface{}       `json:"data,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"` // Field-level validation errors
+	Detail  string            `json:"detail,omitempty"` // Underlying error, with DEBUG_ERRORS
 }
 
 // UserResponse is the user data sent in responses
@@ -42,52 +47,191 @@ type UserResponse struct {
 
 // PhotoResponse represents a photo in the response
 type PhotoResponse struct {
-	ID         string `json:"id"`
-	Filename   string `json:"filename"`
-	Title      string `json:"title"`
-	Category   string `json:"category"`
-	URL        string `json:"url"`
-	UploadDate string `json:"uploadDate"`
+	ID               string   `json:"id"`
+	Filename         string   `json:"filename"`
+	Title            string   `json:"title"`
+	Category         string   `json:"category"`
+	URL              string   `json:"url"`
+	UploadDate       string   `json:"uploadDate"`
+	CapturedAt       string   `json:"capturedAt,omitempty"`
+	AltText          string   `json:"altText"`
+	Caption          string   `json:"caption,omitempty"`
+	Colors           []string `json:"colors"`
+	DominantColor    string   `json:"dominantColor,omitempty"`
+	Blurhash         string   `json:"blurhash,omitempty"`
+	ThumbnailURL     string   `json:"thumbnailUrl,omitempty"`
+	Version          int64    `json:"version,omitempty"` // Bumped whenever the file is replaced
+	Slug             string   `json:"slug,omitempty"`
+	Permalink        string   `json:"permalink"` // Public API URL, by slug when set
+	UpdatedAt        string   `json:"updatedAt,omitempty"`
+	Tags             []string `json:"tags"`
+	Cover            bool     `json:"cover"`                      // Whether this is its category's cover photo
+	OriginalFilename string   `json:"originalFilename,omitempty"` // As uploaded, with PRESERVE_FILENAMES
+	UserID           int64    `json:"userId,omitempty"`           // Uploader
+	Views            *int64   `json:"views,omitempty"`
+	// Preset thumbnails by name, from THUMBNAIL_PRESETS, for building a srcset
+	Presets map[string]PresetImage `json:"presets,omitempty"`
+	// The presets and the photo itself as an HTML srcset attribute
+	Srcset string `json:"srcset,omitempty"`
+	// "draft" or "published"; drafts are only listed to their owner
+	Status string `json:"status"`
+	// The uploader, capture date, views and original filename are only
+	// included for the photo's owner and admins; see photoViewer
 }
 
 // Credentials for login/register
 type Credentials struct {
-	Name     string `json:"name,omitempty"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Name        string `json:"name,omitempty"`
+	Email       string `json:"email"`
+	Password    string `json:"password"`
+	RememberMe  bool   `json:"rememberMe,omitempty"`  // Login only: selects the long session TTL
+	TOTPCode    string `json:"totpCode,omitempty"`    // Login only: required once two-factor login is enabled
+	InviteToken string `json:"inviteToken,omitempty"` // Register only: required in invite mode
 }
 
+// Photo categories, each stored in its own directory under photos/
+var photoCategories = []string{"featured", "digital-sketches", "notebook-sketches", "photography"}
+
 var dbConn *sql.DB
 var queries *db.Queries
 var jwtKey = []byte(os.Getenv("JWT_SECRET_KEY")) // In production, use environment variables
 
 func main() {
-	// Initialize database connection
+	setupLogger()
+	validateJWTConfig()
+	validatePaginationConfig()
+	validateUploadFieldNames()
+	loadProtectedCategories()
+	loadCategoryContentTypes()
+	loadCategoryMaxPhotos()
+	loadPhotoIDAlphabet()
+	loadThumbnailPresets()
+	loadJPEGBackground()
+	loadImageQuality()
+	loadTrustedProxies()
+	initTracing()
+
+	// Initialize database connection. This creates the schema and runs all
+	// migrations before the router exists, so no request can reach a
+	// missing table.
 	initDB()
+	startWriterCheck()
+	startViewFlusher()
+	startTempSweeper()
+	startPresetRegeneration()
+
+	// Start server
+	port := "8080"
+	handler := newRouter()
+
+	// ListenAndServeTLS negotiates HTTP/2 via ALPN and sets r.TLS, which the
+	// URL scheme detection relies on
+	if tlsCertFile != "" || tlsKeyFile != "" {
+		if tlsCertFile == "" || tlsKeyFile == "" {
+			log.Fatal("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+		}
+		slog.Info("Server running", "port", port, "mode", "https")
+		log.Fatal(http.ListenAndServeTLS(":"+port, tlsCertFile, tlsKeyFile, handler))
+	}
+
+	slog.Info("Server running", "port", port, "mode", "http")
+	log.Fatal(http.ListenAndServe(":"+port, handler))
+}
 
+// Build the router with every route and the middleware wrapped around it
+func newRouter() http.Handler {
 	// Create router
 	r := mux.NewRouter()
 
+	// Health checks
+	r.HandleFunc("/api/health", healthHandler).Methods("GET")
+	r.HandleFunc("/api/health/ready", readyHandler).Methods("GET")
+	r.HandleFunc("/api/config", clientConfigHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/categories", optionalAuthMiddleware(listCategoriesHandler)).Methods("GET", "OPTIONS")
+
 	// Define API routes
-	r.HandleFunc("/api/register", registerHandler).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/login", loginHandler).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/register", requireContentType("application/json", registerHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/login", requireContentType("application/json", loginHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/auth/validate", authMiddleware(validateTokenHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/auth/me", authMiddleware(tokenInfoHandler)).Methods("GET", "OPTIONS")
 	r.HandleFunc("/api/profile", authMiddleware(profileHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/profile/logout-all", authMiddleware(logoutAllHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/profile/verify-password", authMiddleware(verifyPasswordHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/profile/export", authMiddleware(exportProfileHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/profile/activity", authMiddleware(activityHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/profile/photos", authMiddleware(listMyPhotosHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/profile/photos.csv", authMiddleware(exportPhotosCSVHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/profile/dashboard", authMiddleware(dashboardHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/profile/sessions", authMiddleware(listSessionsHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/profile/sessions/{id}", authMiddleware(revokeSessionHandler)).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/api/profile/2fa/enroll", authMiddleware(enrollTOTPHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/profile/2fa/verify", authMiddleware(verifyTOTPHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/profile/2fa/backup-codes", authMiddleware(regenerateBackupCodesHandler)).Methods("POST", "OPTIONS")
 
 	// Photo management routes
-	r.HandleFunc("/api/photos/upload", authMiddleware(uploadPhotoHandler)).Methods("POST", "OPTIONS")
-	r.HandleFunc("/api/photos/{category}", getPhotosByCategoryHandler).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/photos", optionalAuthMiddleware(photoChangesHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/photos/upload", authMiddleware(requireContentType("multipart/form-data", uploadPhotoHandler))).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/photos/upload-url", authMiddleware(requireContentType("application/json", uploadURLHandler))).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/photos/import-zip", authMiddleware(requireContentType("multipart/form-data", importZipHandler))).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/photos/batch-get", optionalAuthMiddleware(batchGetPhotosHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/photos/tag-batch", authMiddleware(tagBatchHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/photos/move-batch", authMiddleware(movePhotosBatchHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/photos/inspect", authMiddleware(requireContentType("multipart/form-data", inspectPhotoHandler))).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/photos/overview", optionalAuthMiddleware(photosOverviewHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/photos/random", optionalAuthMiddleware(randomPhotoHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/photos/file/{category}/{filename}", optionalAuthMiddleware(getPhotoByFilenameHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/photos/{category}", optionalAuthMiddleware(getPhotosByCategoryHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/photos/{id}", authMiddleware(updatePhotoHandler)).Methods("PATCH", "OPTIONS")
+	r.HandleFunc("/api/photos/{id}/neighbors", optionalAuthMiddleware(photoNeighborsHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/photos/{id}/image", optionalAuthMiddleware(photoImageHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/photos/{id}/file", authMiddleware(requireContentType("multipart/form-data", replacePhotoFileHandler))).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/photos/{id}/download", optionalAuthMiddleware(downloadPhotoHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/photos/{id}/original", authMiddleware(downloadOriginalHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/photos/{id}/stats", authMiddleware(photoStatsHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/photos/{id}/variants", optionalAuthMiddleware(photoVariantsHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/photos/{category}/{slug}", optionalAuthMiddleware(getPhotoBySlugHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/photos/{id}/move", authMiddleware(movePhotoHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/photos/{id}/copy", authMiddleware(copyPhotoHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/photos/{id}/reprocess", authMiddleware(reprocessPhotoHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/photos/{id}/publish", authMiddleware(publishPhotoHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/photos/{id}/unpublish", authMiddleware(unpublishPhotoHandler)).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/photos/{id}", authMiddleware(deletePhotoHandler)).Methods("DELETE", "OPTIONS")
 
+	// Collection routes
+	r.HandleFunc("/api/collections", authMiddleware(listCollectionsHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/collections", authMiddleware(createCollectionHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/collections/{id}", optionalAuthMiddleware(getCollectionHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/collections/{id}", authMiddleware(updateCollectionHandler)).Methods("PATCH", "OPTIONS")
+	r.HandleFunc("/api/collections/{id}", authMiddleware(deleteCollectionHandler)).Methods("DELETE", "OPTIONS")
+	r.HandleFunc("/api/collections/{id}/photos", authMiddleware(addCollectionPhotoHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/collections/{id}/photos/order", authMiddleware(reorderCollectionHandler)).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/collections/{id}/photos/{photoId}", authMiddleware(removeCollectionPhotoHandler)).Methods("DELETE", "OPTIONS")
+
+	// Admin routes
+	r.HandleFunc("/api/admin/invites", adminMiddleware(listInvitesHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/admin/invites", adminMiddleware(createInviteHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/admin/users/search", adminMiddleware(searchUsersHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/admin/users/{id}/token", adminMiddleware(impersonateUserHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/admin/users/{id}/quota", adminMiddleware(updateUserQuotaHandler)).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/admin/categories/{category}/label", adminMiddleware(setCategoryLabelHandler)).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/admin/categories/{category}/max-photos", adminMiddleware(setCategoryLimitHandler)).Methods("PUT", "OPTIONS")
+	r.HandleFunc("/api/admin/storage/reconcile", adminMiddleware(reconcileStorageHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/admin/backup", adminMiddleware(createBackupHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/admin/backup/download", adminMiddleware(downloadBackupHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/admin/orphans", adminMiddleware(listOrphansHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/admin/orphans/clean", adminMiddleware(cleanOrphansHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/admin/consistency", adminMiddleware(consistencyReportHandler)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/admin/photos/blurhash", adminMiddleware(regenerateBlurhashHandler)).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/admin/photos/missing-derivatives", adminMiddleware(listMissingDerivativesHandler)).Methods("GET", "OPTIONS")
+
 	// Serve static files
-	r.PathPrefix("/photos/").Handler(http.StripPrefix("/photos/", http.FileServer(http.Dir("photos"))))
+	r.PathPrefix("/photos/").Handler(http.StripPrefix("/photos/", hidePrivateFiles(optionalAuthMiddleware(hideDraftFiles(redirectLegacyPaths(countViews(http.FileServer(http.Dir(photoDir)))))))))
 
 	// CORS middleware
 	r.Use(corsMiddleware)
+	r.Use(tracingMiddleware)
 
-	// Start server
-	port := "8080"
-	fmt.Printf("Server running on port %s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	return requestLoggingMiddleware(requireHTTPS(trimTrailingSlash(jsonFieldCaseMiddleware(r))))
 }
 
 func initDB() {
@@ -95,6 +239,10 @@ func initDB() {
 	// Use environment variables for these credentials in production
       
 	connStr := "database.db" // Path to your SQLite database file
+	// Transactions take the write lock when they begin, so ones that check
+	// a limit before writing run one after another rather than both
+	// passing the check
+	connStr += "?_txlock=immediate"
 	dbConn, err = sql.Open("sqlite3", connStr)
 	if err != nil {
 		log.Fatal(err)
@@ -106,8 +254,9 @@ func initDB() {
 		log.Fatal(err)
 	}
 
-	// Initialize the queries with our database connection
-	queries = db.New(dbConn)
+	// Initialize the queries with our database connection, wrapped so
+	// queries made while handling a traced request are recorded as spans
+	queries = db.New(tracedDB{dbConn})
 
 	// Execute schema migration
 	
@@ -117,6 +266,84 @@ func initDB() {
 			name TEXT NOT NULL,
 			email TEXT UNIQUE NOT NULL,
 			password TEXT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			token_version INTEGER NOT NULL DEFAULT 0
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = dbConn.Exec(`
+		CREATE TABLE IF NOT EXISTS photos (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			filename TEXT NOT NULL,
+			title TEXT NOT NULL,
+			category TEXT NOT NULL,
+			size_bytes INTEGER NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			captured_at TIMESTAMP,
+			alt_text TEXT NOT NULL DEFAULT '',
+			caption TEXT NOT NULL DEFAULT '',
+			colors TEXT NOT NULL DEFAULT '',
+			blurhash TEXT NOT NULL DEFAULT '',
+			thumbnail TEXT NOT NULL DEFAULT '',
+			original TEXT NOT NULL DEFAULT '',
+			version INTEGER NOT NULL DEFAULT 1,
+			slug TEXT NOT NULL DEFAULT '',
+			updated_at TIMESTAMP,
+			tags TEXT NOT NULL DEFAULT '',
+			cover BOOLEAN NOT NULL DEFAULT 0,
+			original_filename TEXT NOT NULL DEFAULT '',
+			views INTEGER NOT NULL DEFAULT 0,
+			presets TEXT NOT NULL DEFAULT '',
+			width INTEGER NOT NULL DEFAULT 0,
+			height INTEGER NOT NULL DEFAULT 0,
+			status TEXT NOT NULL DEFAULT 'published'
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = dbConn.Exec(`
+		CREATE TABLE IF NOT EXISTS collections (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = dbConn.Exec(`
+		CREATE TABLE IF NOT EXISTS collection_photos (
+			collection_id INTEGER NOT NULL REFERENCES collections(id),
+			photo_id TEXT NOT NULL REFERENCES photos(id),
+			position INTEGER NOT NULL,
+			PRIMARY KEY (collection_id, photo_id)
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = dbConn.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor_id INTEGER NOT NULL REFERENCES users(id),
+			action TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			details TEXT NOT NULL DEFAULT '',
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 		)
 	`)
@@ -125,39 +352,256 @@ func initDB() {
 		log.Fatal(err)
 	}
 
-	fmt.Println("Database initialized successfully")
+	_, err = dbConn.Exec(`
+		CREATE TABLE IF NOT EXISTS invites (
+			token TEXT PRIMARY KEY,
+			created_by INTEGER NOT NULL REFERENCES users(id),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			used_by INTEGER REFERENCES users(id),
+			used_at TIMESTAMP
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Deleted photos, kept so syncing clients learn to drop their copies
+	_, err = dbConn.Exec(`
+		CREATE TABLE IF NOT EXISTS photo_tombstones (
+			photo_id TEXT PRIMARY KEY,
+			category TEXT NOT NULL,
+			deleted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Display names of categories, whose directory names stay fixed
+	_, err = dbConn.Exec(`
+		CREATE TABLE IF NOT EXISTS category_labels (
+			category TEXT PRIMARY KEY,
+			label TEXT NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Issued login tokens, by their jti, so they can be listed and revoked
+	// one at a time
+	_, err = dbConn.Exec(`
+		CREATE TABLE IF NOT EXISTS sessions (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			last_used_at TIMESTAMP,
+			ip TEXT NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			impersonated_by INTEGER REFERENCES users(id),
+			revoked_at TIMESTAMP
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = dbConn.Exec(`
+		CREATE INDEX IF NOT EXISTS sessions_user
+		ON sessions (user_id)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Photo caps admins set per category, overriding CATEGORY_MAX_PHOTOS
+	_, err = dbConn.Exec(`
+		CREATE TABLE IF NOT EXISTS category_limits (
+			category TEXT PRIMARY KEY,
+			max_photos INTEGER NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Authenticator app secrets for two-factor login. A secret only applies
+	// to login once the user has confirmed it with a code.
+	_, err = dbConn.Exec(`
+		CREATE TABLE IF NOT EXISTS totp_secrets (
+			user_id INTEGER PRIMARY KEY REFERENCES users(id),
+			secret TEXT NOT NULL,
+			enabled_at TIMESTAMP,
+			last_used_step INTEGER NOT NULL DEFAULT 0,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// One-time recovery codes for two-factor login, stored as hashes
+	_, err = dbConn.Exec(`
+		CREATE TABLE IF NOT EXISTS totp_backup_codes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			code_hash TEXT NOT NULL,
+			used_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	_, err = dbConn.Exec(`
+		CREATE INDEX IF NOT EXISTS totp_backup_codes_user
+		ON totp_backup_codes (user_id)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = migrateColumns()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// A category has at most one cover photo. Created after the column
+	// migrations, which add the cover column to existing databases.
+	_, err = dbConn.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS photos_category_cover
+		ON photos (category) WHERE cover
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Activity feeds list a user's audit log entries newest first
+	_, err = dbConn.Exec(`
+		CREATE INDEX IF NOT EXISTS audit_log_actor
+		ON audit_log (actor_id, id)
+	`)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	slog.Info("Database initialized successfully")
 	
 	// Initialize photo directories
 	initPhotoDirectories()
+	checkStorage()
+}
+
+// Columns added to existing tables after their initial release. SQLite has
+// no ADD COLUMN IF NOT EXISTS, so "duplicate column name" errors are expected
+// on every start after the first.
+var columnMigrations = []string{
+	`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user'`,
+	`ALTER TABLE users ADD COLUMN quota_bytes INTEGER`,
+	`ALTER TABLE users ADD COLUMN quota_photos INTEGER`,
+	`ALTER TABLE photos ADD COLUMN captured_at TIMESTAMP`,
+	`ALTER TABLE photos ADD COLUMN alt_text TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE photos ADD COLUMN caption TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE photos ADD COLUMN colors TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE photos ADD COLUMN blurhash TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE photos ADD COLUMN thumbnail TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE photos ADD COLUMN original TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE photos ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+	`ALTER TABLE photos ADD COLUMN slug TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE photos ADD COLUMN updated_at TIMESTAMP`,
+	`ALTER TABLE photos ADD COLUMN tags TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE photos ADD COLUMN cover BOOLEAN NOT NULL DEFAULT 0`,
+	`ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE photos ADD COLUMN original_filename TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE photos ADD COLUMN views INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE photos ADD COLUMN presets TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE photos ADD COLUMN width INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE photos ADD COLUMN height INTEGER NOT NULL DEFAULT 0`,
+	`ALTER TABLE photos ADD COLUMN status TEXT NOT NULL DEFAULT 'published'`,
+	`ALTER TABLE photos ADD COLUMN was_published BOOLEAN NOT NULL DEFAULT 0`,
+}
+
+func migrateColumns() error {
+	for _, stmt := range columnMigrations {
+		_, err := dbConn.Exec(stmt)
+		if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+			return err
+		}
+	}
+	return nil
 }
 
 // Initialize the photos directory structure
 func initPhotoDirectories() {
-	baseDir := "photos"
+	baseDir := photoDir
 	
 	// Create base directory if it doesn't exist
-	if _, err := os.Stat(baseDir); os.IsNotExist(err) {
-		os.Mkdir(baseDir, 0755)
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		log.Fatalf("Failed to create photo directory %s: %v", baseDir, err)
+	}
+
+	// Fail now rather than on the first upload if the directory, often a
+	// mounted volume, isn't writable
+	probe, err := os.CreateTemp(baseDir, ".write-check-*")
+	if err != nil {
+		log.Fatalf("Photo directory %s is not writable: %v", baseDir, err)
 	}
+	probe.Close()
+	os.Remove(probe.Name())
 	
-	// Create category directories
-	categories := []string{"featured", "digital-sketches", "notebook-sketches", "photography"}
-	for _, category := range categories {
+	// Create category directories. MkdirAll succeeds when one already
+	// exists, so only real failures such as missing permissions stop startup.
+	for _, category := range photoCategories {
 		categoryPath := filepath.Join(baseDir, category)
-		if _, err := os.Stat(categoryPath); os.IsNotExist(err) {
-			os.Mkdir(categoryPath, 0755)
+		if err := os.MkdirAll(categoryPath, 0755); err != nil {
+			log.Fatalf("Failed to create category directory %s (check that it is a directory the server can write to): %v", categoryPath, err)
 		}
 	}
 	
-	fmt.Println("Photo directories initialized successfully")
+	slog.Info("Photo directories initialized successfully", "dir", baseDir)
+}
+
+// API paths are matched without a trailing slash: /api/photos/featured/ is
+// served exactly like /api/photos/featured rather than redirected, so
+// non-GET requests keep their method and body. Static file paths under
+// /photos/ are left alone since the file server relies on directory slashes.
+// This runs before routing, so it wraps the router instead of using r.Use.
+func trimTrailingSlash(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") && len(r.URL.Path) > len("/api/") {
+			r.URL.Path = strings.TrimRight(r.URL.Path, "/")
+			if r.URL.RawPath != "" {
+				r.URL.RawPath = strings.TrimRight(r.URL.RawPath, "/")
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		// Let browser clients read the pagination headers
+		w.Header().Set("Access-Control-Expose-Headers", "Link, X-Total-Count")
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
@@ -170,6 +614,20 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// Reject requests whose body isn't of the media type the handler reads, such
+// as "application/json", with 415 rather than failing to parse them.
+// Parameters like charset and boundary are allowed.
+func requireContentType(mediaType string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		got, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || got != mediaType {
+			respondWithError(w, http.StatusUnsupportedMediaType, "Content-Type must be "+mediaType)
+			return
+		}
+		next(w, r)
+	}
+}
+
 func registerHandler(w http.ResponseWriter, r *http.Request) {
 	var creds Credentials
 	err := json.NewDecoder(r.Body).Decode(&creds)
@@ -178,18 +636,27 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if registrationMode == "closed" {
+		respondForbidden(w, "Registration is closed")
+		return
+	}
+
 	// Validate input
 	if creds.Name == "" || creds.Email == "" || creds.Password == "" {
 		respondWithError(w, http.StatusBadRequest, "Name, email, and password are required")
 		return
 	}
 
-	ctx := context.Background()
+	ctx := requestContext(r)
+
+	if registrationMode == "invite" && !checkInvite(w, ctx, creds.InviteToken) {
+		return
+	}
 
 	// Check if email already exists using sqlc
 	emailExists, err := queries.CheckEmailExists(ctx, creds.Email)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Database error")
+		respondWithDatabaseError(w, err)
 		return
 	}
 
@@ -200,7 +667,7 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(creds.Password), bcrypt.DefaultCost)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error hashing password")
+		respondWithInternalError(w, "Error hashing password", err)
 		return
 	}
 
@@ -211,10 +678,18 @@ func registerHandler(w http.ResponseWriter, r *http.Request) {
 		Password: string(hashedPassword),
 	}
 
-	_, err = queries.CreateUser(ctx, params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error creating user")
-		return
+	if registrationMode == "invite" {
+		if !createUserWithInvite(w, ctx, params, creds.InviteToken) {
+			return
+		}
+	} else {
+		_, err = withRetry(ctx, func() (db.CreateUserRow, error) {
+			return queries.CreateUser(ctx, params)
+		})
+		if err != nil {
+			respondWithInternalError(w, "Error creating user", err)
+			return
+		}
 	}
 
 	// Return success response
@@ -232,13 +707,21 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate input
-	if creds.Email == "" || creds.Password == "" {
-		respondWithError(w, http.StatusBadRequest, "Email and password are required")
+	// Validate input before touching the database so missing fields are
+	// reported as a client error rather than an authentication failure
+	fieldErrors := map[string]string{}
+	if strings.TrimSpace(creds.Email) == "" {
+		fieldErrors["email"] = "Email is required"
+	}
+	if creds.Password == "" {
+		fieldErrors["password"] = "Password is required"
+	}
+	if len(fieldErrors) > 0 {
+		respondWithValidationErrors(w, fieldErrors)
 		return
 	}
 
-	ctx := context.Background()
+	ctx := requestContext(r)
 
 	// Get the user from the database using sqlc
 	user, err := queries.GetUserByEmail(ctx, creds.Email)
@@ -247,26 +730,39 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fmt.Println("Stored password hash:", user.Password)
-	fmt.Println("Provided password:", creds.Password)
 	// Compare the stored hashed password with the provided password
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password))
 	if err != nil {
 		respondWithError(w, http.StatusUnauthorized, "Invalid email or password")
 		return
 	}
+	if !checkLoginTOTP(w, ctx, user.ID, creds.TOTPCode) {
+		return
+	}
 
 	// Convert GetUserByEmailRow to User for JWT generation
 	userForJWT := db.User{
-		ID:    int64(user.ID),
-		Name:  user.Name,
-		Email: user.Email,
+		ID:           int64(user.ID),
+		Name:         user.Name,
+		Email:        user.Email,
+		TokenVersion: user.TokenVersion,
+		Role:         user.Role,
 	}
 
-	// Create a JWT token
-	token, err := generateJWT(userForJWT)
+	// Create a JWT token, long-lived only when asked to remember the device
+	ttl := sessionTTL
+	if creds.RememberMe {
+		ttl = rememberMeTTL
+	}
+	expiresAt := time.Now().Add(ttl)
+	sessionID, err := createSession(ctx, r, user.ID, expiresAt, sql.NullInt64{})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Error generating token")
+		respondWithDatabaseError(w, err)
+		return
+	}
+	token, err := generateJWT(userForJWT, sessionID, expiresAt)
+	if err != nil {
+		respondWithInternalError(w, "Error generating token", err)
 		return
 	}
 
@@ -279,13 +775,16 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 			Name:  user.Name,
 			Email: user.Email,
 		},
+		Data: map[string]interface{}{
+			"expiresIn": int64(ttl.Seconds()),
+		},
 	})
 }
 
 func profileHandler(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by authMiddleware)
 	userID := r.Context().Value("userID").(int64)
-	ctx := context.Background()
+	ctx := requestContext(r)
 
 	// Get user from database using sqlc, cast userID to int64
 	user, err := queries.GetUserByID(ctx, userID)
@@ -305,6 +804,15 @@ func profileHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func isValidCategory(category string) bool {
+	for _, c := range photoCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
 // Generate a random ID for photos
 func generateID() string {
 	bytes := make([]byte, 16)
@@ -312,91 +820,77 @@ func generateID() string {
 	return hex.EncodeToString(bytes)
 }
 
+// Format a timestamp for a response: RFC 3339 in UTC, whatever the server's
+// time zone or the zone the time was stored with
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
 // Upload a photo
 func uploadPhotoHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse multipart form
-	err := r.ParseMultipartForm(10 << 20) // 10 MB max
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Failed to parse form")
+	// Stream the multipart form, spooling the file to disk
+	form, ok := readUploadForm(w, r)
+	if !ok {
 		return
 	}
+	defer form.cleanup()
 	
-	// Get form values
-	title := r.FormValue("title")
-	category := r.FormValue("category")
-	
-	// Validate category
-	validCategories := map[string]bool{
-		"featured": true,
-		"digital-sketches": true,
-		"notebook-sketches": true,
-		"photography": true,
+	// Get form values, the title and category under their configured names
+	if form.value(uploadCategoryField) == "" {
+		respondWithValidationErrors(w, map[string]string{uploadCategoryField: "Category is required"})
+		return
 	}
-	
-	if !validCategories[category] {
-		respondWithError(w, http.StatusBadRequest, "Invalid category")
+	fields := photoFields{
+		title:    form.value(uploadTitleField),
+		category: form.value(uploadCategoryField),
+		altText:  form.value("altText"),
+		caption:  form.value("caption"),
+		slug:     form.value("slug"),
+		status:   form.value("status"),
+	}
+	ctx := requestContext(r)
+	if !checkPhotoFields(w, ctx, &fields) {
 		return
 	}
 	
-	// Get file from form
-	file, handler, err := r.FormFile("photo")
+	// Check the category has room and the upload fits within the user's
+	// quota
+	userID := r.Context().Value("userID").(int64)
+	if !checkCategoryCapacity(w, ctx, userID, fields.category, 1) {
+		return
+	}
+
+	quotaMessage, err := checkUploadQuota(ctx, queries, userID, 1, form.size)
 	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Failed to get file from form")
+		respondWithDatabaseError(w, err)
 		return
 	}
-	defer file.Close()
-	
-	// Check file type
-	contentType := handler.Header.Get("Content-Type")
-	if !strings.HasPrefix(contentType, "image/") {
-		respondWithError(w, http.StatusBadRequest, "File must be an image")
+	if quotaMessage != "" {
+		respondWithError(w, http.StatusRequestEntityTooLarge, quotaMessage)
 		return
 	}
 	
-	// Generate unique filename
-	fileExt := filepath.Ext(handler.Filename)
-	photoID := generateID()
-	filename := photoID + fileExt
-	
-	// Create destination file
-	categoryDir := filepath.Join("photos", category)
-	destPath := filepath.Join(categoryDir, filename)
-	
-	dest, err := os.Create(destPath)
+	// Queue for an image processing slot before processing anything
+	release, err := acquireImageSlot(r.Context())
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to create destination file")
+		respondImageBusy(w)
 		return
 	}
-	defer dest.Close()
+	defer release()
 	
-	// Copy file
-	_, err = io.Copy(dest, file)
+	// Check and decode the file, then store it with its derivatives
+	row, err := storePhoto(ctx, userID, form, fields)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to save file")
+		respondStoreError(w, err)
 		return
 	}
-	
-	// Get the server's hostname and port for the URL
-	host := r.Host
-	scheme := "http"
-	if r.TLS != nil {
-		scheme = "https"
-	}
-	
-	photoURL := fmt.Sprintf("%s://%s/photos/%s/%s", scheme, host, category, filename)
+	auditPhotoAction(ctx, userID, "upload", row.ID, row.Title)
 	
 	// Return success response
 	respondWithJSON(w, http.StatusCreated, Response{
 		Success: true,
 		Message: "Photo uploaded successfully",
-		Data: PhotoResponse{
-			ID:         photoID,
-			Filename:   filename,
-			Title:      title,
-			Category:   category,
-			URL:        photoURL,
-			UploadDate: time.Now().Format(time.RFC3339),
-		},
+		Data:    photoResponseFromRow(r, row),
 	})
 }
 
@@ -406,24 +900,69 @@ func getPhotosByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	category := vars["category"]
 	
 	// Validate category
-	validCategories := map[string]bool{
-		"featured": true,
-		"digital-sketches": true,
-		"notebook-sketches": true,
-		"photography": true,
+	if !isValidCategory(category) {
+		respondInvalidCategory(w)
+		return
+	}
+	
+	sortOrder := r.URL.Query().Get("sort")
+	if sortOrder != "" && sortOrder != "captured" {
+		respondWithError(w, http.StatusBadRequest, "Invalid sort option")
+		return
 	}
 	
-	if !validCategories[category] {
-		respondWithError(w, http.StatusBadRequest, "Invalid category")
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 	
+	photos, ok := listCategoryPhotos(w, r, category, sortOrder)
+	if !ok {
+		return
+	}
+	
+	// Return the requested page of the listing
+	start, end := pageBounds(len(photos), page, pageSize)
+	setPaginationHeaders(w, r, page, pageSize, int64(len(photos)))
+	respondWithCacheableJSON(w, r, Response{
+		Success: true,
+		Data:    newPaginatedResponse(photos[start:end], page, pageSize, int64(len(photos))),
+	})
+}
+
+// List a category's photos in display order: by filename, or newest first
+// by capture date with sortOrder "captured". Files in the directory are the
+// source of truth; stored rows add their metadata. Writes the error response
+// on failure.
+func listCategoryPhotos(w http.ResponseWriter, r *http.Request, category, sortOrder string) ([]PhotoResponse, bool) {
 	// Get files from directory
-	categoryDir := filepath.Join("photos", category)
+	categoryDir := filepath.Join(photoDir, category)
 	files, err := os.ReadDir(categoryDir)
+	if os.IsNotExist(err) {
+		// Removed from under the server; reconciliation recreates it
+		slog.Warn("Category directory is missing", "category", category)
+		files, err = nil, nil
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to read directory")
-		return
+		respondWithInternalError(w, "Failed to read directory", err)
+		return nil, false
+	}
+	
+	// Load stored metadata; files uploaded before it was recorded have no row
+	rows, err := queries.ListPhotosByCategory(requestContext(r), category)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return nil, false
+	}
+	photoRows := make(map[string]db.Photo, len(rows))
+	hidden := make(map[string]bool)
+	for _, row := range rows {
+		if !photoVisible(r, row) {
+			hidden[row.ID] = true
+			continue
+		}
+		photoRows[row.ID] = row
 	}
 	
 	// Get the server's hostname and port for the URL
@@ -436,7 +975,9 @@ func getPhotosByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 	// Create response
 	photos := []PhotoResponse{}
 	for _, file := range files {
-		if file.IsDir() {
+		// Skip derivative directories and hidden files such as a file set
+		// aside while being replaced
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
 			continue
 		}
 		
@@ -450,24 +991,96 @@ func getPhotosByCategoryHandler(w http.ResponseWriter, r *http.Request) {
 		filename := file.Name()
 		fileExt := filepath.Ext(filename)
 		photoID := strings.TrimSuffix(filename, fileExt)
+		if hidden[photoID] {
+			continue
+		}
 		
 		// Create photo response
 		photoURL := fmt.Sprintf("%s://%s/photos/%s/%s", scheme, host, category, filename)
 		
-		photos = append(photos, PhotoResponse{
+		photo := PhotoResponse{
 			ID:         photoID,
 			Filename:   filename,
 			Title:      strings.TrimSuffix(filename, fileExt), // Use filename as title if no title in DB
 			Category:   category,
 			URL:        photoURL,
-			UploadDate: fileInfo.ModTime().Format(time.RFC3339),
-		})
+			UploadDate: formatTimestamp(fileInfo.ModTime()),
+			Colors:     []string{},
+			Tags:       []string{},
+			Permalink:  photoPermalink(scheme, host, category, photoID, ""),
+			Status:     "published",
+		}
+		if row, ok := photoRows[photoID]; ok {
+			if row.Title != "" {
+				photo.Title = row.Title
+			}
+			if row.CapturedAt.Valid {
+				photo.CapturedAt = formatTimestamp(row.CapturedAt.Time)
+			}
+			photo.AltText = row.AltText
+			photo.Caption = row.Caption
+			photo.Colors = splitColors(row.Colors)
+			photo.Blurhash = row.Blurhash
+			photo.Version = row.Version
+			photo.Slug = row.Slug
+			photo.Tags = splitTags(row.Tags)
+			photo.Cover = row.Cover
+			photo.OriginalFilename = row.OriginalFilename
+			photo.UserID = row.UserID
+			views := row.Views + unflushedViews(row.ID)
+			photo.Views = &views
+			photo.Status = row.Status
+			if row.UpdatedAt.Valid {
+				photo.UpdatedAt = formatTimestamp(row.UpdatedAt.Time)
+			}
+			photo.Permalink = photoPermalink(scheme, host, category, photoID, row.Slug)
+			if row.Thumbnail != "" {
+				photo.ThumbnailURL = fmt.Sprintf("%s://%s/photos/%s/%s", scheme, host, category, row.Thumbnail)
+			}
+			photo.Presets = presetImages(fmt.Sprintf("%s://%s/photos/%s", scheme, host, category), row)
+			photo.Srcset = buildSrcset(photo.URL, row.Width, photo.Presets)
+		}
+		if photo.AltText == "" {
+			photo.AltText = photo.Title
+		}
+		if len(photo.Colors) > 0 {
+			photo.DominantColor = photo.Colors[0]
+		}
+		
+		photos = append(photos, photo)
 	}
 	
-	// Return response
-	respondWithJSON(w, http.StatusOK, Response{
-		Success: true,
-		Data:    photos,
+	if sortOrder == "captured" {
+		sortByCaptureDate(photos)
+	}
+	
+	// Sorted first, as the capture date may be hidden from the viewer
+	viewer := viewerFromRequest(r)
+	for i := range photos {
+		photos[i] = viewer.filter(photos[i])
+	}
+	
+	return photos, true
+}
+
+// Sort photos newest first by capture date, falling back to the upload date
+// for photos without EXIF. Ties are broken by ID so the order is stable.
+func sortByCaptureDate(photos []PhotoResponse) {
+	sortKey := func(p PhotoResponse) time.Time {
+		value := p.CapturedAt
+		if value == "" {
+			value = p.UploadDate
+		}
+		t, _ := time.Parse(time.RFC3339, value)
+		return t
+	}
+	
+	sort.SliceStable(photos, func(i, j int) bool {
+		ki, kj := sortKey(photos[i]), sortKey(photos[j])
+		if !ki.Equal(kj) {
+			return ki.After(kj)
+		}
+		return photos[i].ID < photos[j].ID
 	})
 }
 
@@ -477,49 +1090,55 @@ func deletePhotoHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	photoID := vars["id"]
 	
-	// Find the photo in all categories
-	categories := []string{"featured", "digital-sketches", "notebook-sketches", "photography"}
-	var foundPath string
+	// Only the uploader may delete a photo, and only from a category they
+	// may change
+	userID := r.Context().Value("userID").(int64)
+	row, ok := loadOwnedPhoto(w, requestContext(r), photoID, userID)
+	if !ok || !checkCategoryAccess(w, requestContext(r), userID, row.Category) {
+		return
+	}
+	foundPath := filepath.Join(photoDir, row.Category, row.Filename)
 	
-	for _, category := range categories {
-		categoryDir := filepath.Join("photos", category)
-		files, err := os.ReadDir(categoryDir)
-		if err != nil {
-			continue
-		}
-		
-		for _, file := range files {
-			if file.IsDir() {
-				continue
-			}
-			
-			filename := file.Name()
-			fileExt := filepath.Ext(filename)
-			id := strings.TrimSuffix(filename, fileExt)
-			
-			if id == photoID {
-				foundPath = filepath.Join(categoryDir, filename)
-				break
-			}
-		}
-		
-		if foundPath != "" {
-			break
-		}
+	// Delete the file
+	err := os.Remove(foundPath)
+	if err != nil && !os.IsNotExist(err) {
+		respondWithInternalError(w, "Failed to delete photo", err)
+		return
 	}
 	
-	// If photo not found
-	if foundPath == "" {
-		respondWithError(w, http.StatusNotFound, "Photo not found")
+	// Remove the thumbnail, archived original and cached resizes, if any
+	removeDerivatives(filepath.Dir(foundPath), photoDerivatives(row)...)
+	removeResizeCache(photoID)
+	
+	// Release the quota held by the photo
+	err = execWithRetry(requestContext(r), func() error {
+		return queries.DeletePhoto(requestContext(r), photoID)
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	err = execWithRetry(requestContext(r), func() error {
+		return queries.RemovePhotoFromCollections(requestContext(r), photoID)
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
 		return
 	}
 	
-	// Delete the file
-	err := os.Remove(foundPath)
+	// Leave a tombstone so syncing clients drop their copy
+	err = execWithRetry(requestContext(r), func() error {
+		return queries.CreatePhotoTombstone(requestContext(r), db.CreatePhotoTombstoneParams{
+			PhotoID:  photoID,
+			Category: row.Category,
+		})
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Failed to delete photo")
+		respondWithDatabaseError(w, err)
 		return
 	}
+	auditPhotoAction(requestContext(r), userID, "delete", photoID, row.Title)
 	
 	// Return success response
 	respondWithJSON(w, http.StatusOK, Response{
@@ -529,71 +1148,149 @@ func deletePhotoHandler(w http.ResponseWriter, r *http.Request) {
 }
 func authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Get the Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			respondWithError(w, http.StatusUnauthorized, "Authorization header required")
+		ctx, err := authenticate(r)
+		var authErr *authError
+		if errors.As(err, &authErr) {
+			respondUnauthorized(w, r, authErr.message)
 			return
 		}
-
-		// Check if the header has the Bearer prefix
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			respondWithError(w, http.StatusUnauthorized, "Invalid authorization format")
+		if err != nil {
+			respondWithDatabaseError(w, err)
 			return
 		}
 
-		// Extract the token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		// Call the next handler with the new context
+		next(w, r.WithContext(ctx))
+	}
+}
 
-		// Parse and validate the token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Validate the signing method
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return jwtKey, nil
-		})
+// Identify the user on public routes that show signed-in users more, such as
+// their own drafts. Requests without a valid token are served anonymously,
+// so a stale token never locks a visitor out of public pages.
+func optionalAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next(w, r)
+			return
+		}
 
+		ctx, err := authenticate(r)
+		var authErr *authError
+		if errors.As(err, &authErr) {
+			next(w, r)
+			return
+		}
 		if err != nil {
-			respondWithError(w, http.StatusUnauthorized, "Invalid token")
+			respondWithDatabaseError(w, err)
 			return
 		}
+		next(w, r.WithContext(ctx))
+	}
+}
 
-		// Check if the token is valid
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			// Check if the token is expired
-			if exp, ok := claims["exp"].(float64); ok && float64(time.Now().Unix()) > exp {
-				respondWithError(w, http.StatusUnauthorized, "Token expired")
-				return
-			}
+// authError is a missing or unacceptable bearer token, with the message to
+// send back
+type authError struct {
+	message string
+}
 
-			// Get the user ID from the token
-			userID := int64(claims["user_id"].(float64))
+func (e *authError) Error() string {
+	return e.message
+}
 
-			// Create a new request context with the user ID
-			ctx := r.Context()
-			ctx = context.WithValue(ctx, "userID", userID)
+// Validate the request's bearer token, returning the request context with
+// the user ID and token claims added. Fails with an *authError when the
+// token is missing or unacceptable.
+func authenticate(r *http.Request) (context.Context, error) {
+	// Get the Authorization header
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, &authError{"Authorization header required"}
+	}
 
-			// Call the next handler with the new context
-			next(w, r.WithContext(ctx))
-		} else {
-			respondWithError(w, http.StatusUnauthorized, "Invalid token")
-		}
+	// Check if the header has the Bearer prefix
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, &authError{"Invalid authorization format"}
 	}
+
+	// Extract the token
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+	// Parse and validate the token, including its expiry and user
+	claims, err := parseJWT(tokenString)
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		return nil, &authError{"Token expired"}
+	}
+	if err != nil {
+		return nil, &authError{"Invalid token"}
+	}
+	userID := *claims.UserID
+
+	// Tokens issued before the user last logged out everywhere carry an
+	// older version. Tokens without one predate versioning and count as
+	// version 0.
+	state, err := queries.GetUserAuthState(requestContext(r), userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && claims.TokenVersion != state.TokenVersion) {
+		return nil, &authError{"Token revoked"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Sessions can also be revoked one at a time
+	if err := checkSession(r, claims); err != nil {
+		return nil, err
+	}
+
+	// Create a new request context with the user ID
+	ctx := r.Context()
+	ctx = context.WithValue(ctx, "userID", userID)
+	ctx = context.WithValue(ctx, "tokenClaims", claims)
+	ctx = context.WithValue(ctx, "userRole", state.Role)
+	ctx = context.WithValue(ctx, "tokenExpiresAt", claims.ExpiresAt.Time)
+	return ctx, nil
 }
 
-func generateJWT(user db.User) (string, error) {
-	// Create the token
-	token := jwt.New(jwt.SigningMethodHS256)
+// adminMiddleware restricts a route to authenticated users with the admin role
+func adminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		userID := r.Context().Value("userID").(int64)
 
+		role, err := queries.GetUserRole(requestContext(r), userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			respondUnauthorized(w, r, "User not found")
+			return
+		}
+		if err != nil {
+			respondWithDatabaseError(w, err)
+			return
+		}
+
+		if role != "admin" {
+			respondForbidden(w, "Admin access required")
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+func generateJWT(user db.User, sessionID string, expiresAt time.Time) (string, error) {
 	// Set the claims
-	claims := token.Claims.(jwt.MapClaims)
-	claims["user_id"] = user.ID
-	claims["email"] = user.Email
-	claims["exp"] = time.Now().Add(time.Hour * 24).Unix() // Token expires in 24 hours
+	claims := &Claims{
+		UserID:       &user.ID,
+		Email:        user.Email,
+		Role:         user.Role,
+		TokenVersion: user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
 
-	// Sign the token with the secret key
-	tokenString, err := token.SignedString(jwtKey)
+	// Sign the token with the current key
+	tokenString, err := signJWT(claims)
 	if err != nil {
 		return "", err
 	}
@@ -601,6 +1298,24 @@ func generateJWT(user db.User) (string, error) {
 	return tokenString, nil
 }
 
+// Answer a request whose credentials are missing or no longer accepted: 401
+// with a bearer challenge, telling the client to sign in again. Requests that
+// sent a token are told it's invalid, as RFC 6750 describes.
+func respondUnauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	challenge := `Bearer realm="api"`
+	if r.Header.Get("Authorization") != "" {
+		challenge += `, error="invalid_token"`
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	respondWithError(w, http.StatusUnauthorized, message)
+}
+
+// Answer a request the user isn't allowed to make: 403. Unlike a 401 the
+// client stays signed in, since signing in again wouldn't help.
+func respondForbidden(w http.ResponseWriter, message string) {
+	respondWithError(w, http.StatusForbidden, message)
+}
+
 func respondWithError(w http.ResponseWriter, code int, message string) {
 	respondWithJSON(w, code, Response{
 		Success: false,
@@ -608,15 +1323,87 @@ func respondWithError(w http.ResponseWriter, code int, message string) {
 	})
 }
 
+// Report a failed query. A missing table means the schema hasn't been created
+// yet, and a lock error one still held after retrying, so in both cases the
+// client is told to retry rather than given a bare 500.
+func respondWithDatabaseError(w http.ResponseWriter, err error) {
+	if strings.Contains(err.Error(), "no such table") {
+		w.Header().Set("Retry-After", "1")
+		respondWithError(w, http.StatusServiceUnavailable, "Server is starting up, please retry")
+		return
+	}
+	if isTransientDBError(err) {
+		slog.Warn("Database is busy", "error", err)
+		w.Header().Set("Retry-After", "1")
+		respondWithError(w, http.StatusServiceUnavailable, "Database is busy, please retry")
+		return
+	}
+	respondWithInternalError(w, "Database error", err)
+}
+
+// Report a server-side failure with a generic message. The error is logged,
+// and only sent to the client with DEBUG_ERRORS, as it can reveal paths and
+// queries.
+func respondWithInternalError(w http.ResponseWriter, message string, err error) {
+	respondWithJSON(w, http.StatusInternalServerError, Response{
+		Success: false,
+		Message: message,
+		Detail:  logInternalError(message, err),
+	})
+}
+
+// Log a server-side failure, returning the error's text when DEBUG_ERRORS
+// allows showing it to the client and "" otherwise
+func logInternalError(message string, err error) string {
+	slog.Error(message, "error", err)
+	if !debugErrors {
+		return ""
+	}
+	return err.Error()
+}
+
+func respondWithValidationErrors(w http.ResponseWriter, fieldErrors map[string]string) {
+	respondWithJSON(w, http.StatusBadRequest, Response{
+		Success: false,
+		Message: "Validation failed",
+		Errors:  fieldErrors,
+	})
+}
+
+// Reject an unknown category, listing the valid ones so clients can correct
+// the request or offer them as choices
+func respondInvalidCategory(w http.ResponseWriter) {
+	respondWithJSON(w, http.StatusBadRequest, Response{
+		Success: false,
+		Message: "Invalid category",
+		Data:    map[string][]string{"validCategories": photoCategories},
+	})
+}
+
+// Marshal the payload before touching the response, so an encoding failure
+// can still be reported as a clean JSON 500
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
-	response, err := json.Marshal(payload)
+	contentType, response, err := encodeJSON(w, payload)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("Error encoding response"))
-		return
+		slog.Error("Failed to encode response", "error", err)
+		code = http.StatusInternalServerError
+		response = []byte(`{"success":false,"message":"Error encoding response"}`)
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(code)
 	w.Write(response)
 }
+
+// Encode a response payload, returning the content type to send it with.
+// Field names are rewritten in snake_case when jsonFieldCaseMiddleware
+// selected it.
+func encodeJSON(w http.ResponseWriter, payload interface{}) (string, []byte, error) {
+	contentType := "application/json"
+	response, err := json.Marshal(payload)
+	if sw := snakeCaseFor(w); sw != nil && err == nil {
+		contentType = sw.contentType
+		response, err = snakeCaseJSON(response)
+	}
+	return contentType, response, err
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testHandler serves requests against a fresh database and photo directory
+// in a temporary working directory, set up once for the package
+var testHandler http.Handler
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "portfolio-test-*")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.Chdir(dir); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	jwtKey = []byte("test-signing-key-that-is-long-enough")
+	loadProtectedCategories()
+	loadCategoryContentTypes()
+	loadCategoryMaxPhotos()
+	loadPhotoIDAlphabet()
+	loadThumbnailPresets()
+	loadJPEGBackground()
+	loadImageQuality()
+	loadTrustedProxies()
+	initDB()
+	initPhotoDirectories()
+	testHandler = newRouter()
+
+	code := m.Run()
+	dbConn.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testResponse is a Response with its data left to decode
+type testResponse struct {
+	Success bool              `json:"success"`
+	Message string            `json:"message"`
+	Token   string            `json:"token"`
+	User    *UserResponse     `json:"user"`
+	Data    json.RawMessage   `json:"data"`
+	Errors  map[string]string `json:"errors"`
+}
+
+// Make a request to the test server, authenticated when token isn't empty
+func doRequest(t *testing.T, method, path, token, contentType string, body io.Reader) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	testHandler.ServeHTTP(rec, req)
+	return rec
+}
+
+// Make a request with a JSON body, or none when v is nil
+func doJSON(t *testing.T, method, path, token string, v any) *httptest.ResponseRecorder {
+	t.Helper()
+	if v == nil {
+		return doRequest(t, method, path, token, "", nil)
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doRequest(t, method, path, token, "application/json", bytes.NewReader(body))
+}
+
+// Decode a response, and its data into data when that isn't nil
+func decodeResponse(t *testing.T, rec *httptest.ResponseRecorder, data any) testResponse {
+	t.Helper()
+	var resp testResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response %q: %v", rec.Body.String(), err)
+	}
+	if data != nil {
+		if err := json.Unmarshal(resp.Data, data); err != nil {
+			t.Fatalf("decoding data %s: %v", resp.Data, err)
+		}
+	}
+	return resp
+}
+
+// Fail unless a response has the expected status
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, status, rec.Body.String())
+	}
+}
+
+// Fill colour of test images
+var testColor = color.RGBA{200, 40, 40, 255}
+
+var testUserCount atomic.Int64
+
+// testUser is a registered user with a session
+type testUser struct {
+	id       int64
+	email    string
+	password string
+	token    string
+}
+
+// Register a new user and log them in
+func newTestUser(t *testing.T) testUser {
+	t.Helper()
+	n := testUserCount.Add(1)
+	user := testUser{
+		email:    fmt.Sprintf("user%d@example.com", n),
+		password: "correct horse battery staple",
+	}
+	rec := doJSON(t, "POST", "/api/register", "", Credentials{
+		Name:     fmt.Sprintf("User %d", n),
+		Email:    user.email,
+		Password: user.password,
+	})
+	expectStatus(t, rec, http.StatusCreated)
+
+	user.token, user.id = logIn(t, user)
+	return user
+}
+
+// Log a user in again, starting another session
+func logIn(t *testing.T, user testUser) (token string, id int64) {
+	t.Helper()
+	rec := doJSON(t, "POST", "/api/login", "", Credentials{Email: user.email, Password: user.password})
+	expectStatus(t, rec, http.StatusOK)
+	resp := decodeResponse(t, rec, nil)
+	return resp.Token, resp.User.ID
+}
+
+// Register a new user with the admin role
+func newTestAdmin(t *testing.T) testUser {
+	t.Helper()
+	user := newTestUser(t)
+	if _, err := dbConn.Exec(`UPDATE users SET role = 'admin' WHERE id = ?`, user.id); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// Encode a small PNG, filled with c
+func testPNG(t *testing.T, width, height int, c color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// Build a multipart upload with the file under uploadFileField and the
+// given form fields
+func multipartBody(t *testing.T, filename, contentType string, file []byte, fields map[string]string) (string, *bytes.Buffer) {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for name, value := range fields {
+		if err := mw.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, uploadFileField, filename))
+	header.Set("Content-Type", contentType)
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(file)
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return mw.FormDataContentType(), &buf
+}
+
+// Upload a file as a new photo in category
+func uploadFile(t *testing.T, token, category, filename string, file []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	contentType, body := multipartBody(t, filename, "image/png", file, map[string]string{
+		uploadTitleField:    "Test photo",
+		uploadCategoryField: category,
+		"altText":           "A test photo",
+	})
+	return doRequest(t, "POST", "/api/photos/upload", token, contentType, body)
+}
+
+// Upload a small PNG as a new photo in category, failing unless it's
+// created
+func uploadTestPhoto(t *testing.T, token, category string) PhotoResponse {
+	t.Helper()
+	rec := uploadFile(t, token, category, "photo.png", testPNG(t, 8, 8, testColor))
+	expectStatus(t, rec, http.StatusCreated)
+	var photo PhotoResponse
+	decodeResponse(t, rec, &photo)
+	return photo
+}
+
+func TestDeletePhoto(t *testing.T) {
+	owner := newTestUser(t)
+	other := newTestUser(t)
+	admin := newTestAdmin(t)
+
+	// Photos are uploaded before featured is protected, as only admins may
+	// upload to a protected category
+	open := uploadTestPhoto(t, owner.token, "photography")
+	featured := uploadTestPhoto(t, owner.token, "featured")
+	adminFeatured := uploadTestPhoto(t, admin.token, "featured")
+	protectedCategories["featured"] = true
+	t.Cleanup(func() { delete(protectedCategories, "featured") })
+
+	tests := []struct {
+		name   string
+		token  string
+		photo  PhotoResponse
+		status int
+	}{
+		{"another user, open category", other.token, open, http.StatusForbidden},
+		{"admin, another user's photo", admin.token, open, http.StatusForbidden},
+		{"owner, protected category", owner.token, featured, http.StatusForbidden},
+		{"owner, open category", owner.token, open, http.StatusOK},
+		{"admin owner, protected category", admin.token, adminFeatured, http.StatusOK},
+		{"already deleted", owner.token, open, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, "DELETE", "/api/photos/"+tt.photo.ID, tt.token, nil)
+			expectStatus(t, rec, tt.status)
+
+			_, err := os.Stat(filepath.Join(photoDir, tt.photo.Category, tt.photo.Filename))
+			if deleted := os.IsNotExist(err); deleted != (tt.status != http.StatusForbidden) {
+				t.Errorf("file deleted = %v after status %d", deleted, tt.status)
+			}
+		})
+	}
+}
+
+func TestServesOverTLS(t *testing.T) {
+	user := newTestUser(t)
+	uploadTestPhoto(t, user.token, "photography")
+
+	server := httptest.NewUnstartedServer(testHandler)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL + "/api/photos/photography")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("served over %s, want HTTP/2", resp.Proto)
+	}
+
+	var body struct {
+		Data struct {
+			Items []PhotoResponse `json:"items"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Data.Items) == 0 {
+		t.Fatal("no photos listed")
+	}
+	for _, photo := range body.Data.Items {
+		if !strings.HasPrefix(photo.URL, "https://") {
+			t.Errorf("URL %q isn't https", photo.URL)
+		}
+	}
+}
+
+func TestRespondWithDatabaseError(t *testing.T) {
+	_, missingTable := dbConn.Exec(`SELECT * FROM table_not_created_yet`)
+	if missingTable == nil {
+		t.Fatal("query on a missing table succeeded")
+	}
+	tests := []struct {
+		name           string
+		err            error
+		status         int
+		wantRetryAfter bool
+	}{
+		{"missing table", missingTable, http.StatusServiceUnavailable, true},
+		{"other error", errors.New("disk I/O error"), http.StatusInternalServerError, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			respondWithDatabaseError(rec, tt.err)
+			expectStatus(t, rec, tt.status)
+			if got := rec.Header().Get("Retry-After") != ""; got != tt.wantRetryAfter {
+				t.Errorf("Retry-After set = %v, want %v", got, tt.wantRetryAfter)
+			}
+			if resp := decodeResponse(t, rec, nil); resp.Success {
+				t.Error("error response reports success")
+			}
+		})
+	}
+}
+
+func TestRespondWithJSONEncodingError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	respondWithJSON(rec, http.StatusOK, Response{Success: true, Data: make(chan int)})
+	expectStatus(t, rec, http.StatusInternalServerError)
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	if resp := decodeResponse(t, rec, nil); resp.Success || resp.Message == "" {
+		t.Errorf("response = %+v, want a failure with a message", resp)
+	}
+}
+
+func TestDebugErrors(t *testing.T) {
+	cause := errors.New("open /srv/photos/secret: permission denied")
+	for _, debug := range []bool{false, true} {
+		t.Run(fmt.Sprint("DEBUG_ERRORS=", debug), func(t *testing.T) {
+			old := debugErrors
+			debugErrors = debug
+			t.Cleanup(func() { debugErrors = old })
+			logs := captureLogs(t, slog.LevelInfo)
+
+			rec := httptest.NewRecorder()
+			respondWithInternalError(rec, "Failed to save file", cause)
+			expectStatus(t, rec, http.StatusInternalServerError)
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["message"] != "Failed to save file" {
+				t.Errorf("message = %v, want the generic one", body["message"])
+			}
+			detail, shown := body["detail"]
+			if shown != debug || (debug && detail != cause.Error()) {
+				t.Errorf("detail = %v, want it shown: %v", detail, debug)
+			}
+			if !debug && strings.Contains(rec.Body.String(), "/srv/photos") {
+				t.Errorf("response leaks the error: %s", rec.Body)
+			}
+			if !strings.Contains(logs.String(), cause.Error()) {
+				t.Errorf("error not logged: %s", logs)
+			}
+		})
+	}
+}
+
+// Point photoDir at a fresh directory until the test ends
+func useTempPhotoDir(t *testing.T) string {
+	t.Helper()
+	old := photoDir
+	photoDir = filepath.Join(t.TempDir(), "storage", "photos")
+	t.Cleanup(func() { photoDir = old })
+	return photoDir
+}
+
+func TestInitPhotoDirectories(t *testing.T) {
+	dir := useTempPhotoDir(t)
+	initPhotoDirectories()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			t.Errorf("left %s behind in the photo directory", entry.Name())
+		}
+		names = append(names, entry.Name())
+	}
+	for _, category := range photoCategories {
+		if !slices.Contains(names, category) {
+			t.Errorf("no directory for %s in %v", category, names)
+		}
+	}
+}
+
+func TestInitPhotoDirectoriesTwice(t *testing.T) {
+	useTempPhotoDir(t)
+	initPhotoDirectories()
+	initPhotoDirectories()
+}
+
+func TestInitPhotoDirectoriesFailure(t *testing.T) {
+	// Run in a child process, as the failure exits
+	if dir := os.Getenv("TEST_PHOTO_DIR"); dir != "" {
+		log.SetOutput(os.Stderr)
+		photoDir = dir
+		initPhotoDirectories()
+		return
+	}
+
+	// Tests may run as root, which ignores permissions, so a file stands in
+	// the way of the directories instead
+	base := t.TempDir()
+	blocked := filepath.Join(base, "photos")
+	if err := os.MkdirAll(blocked, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(blocked, photoCategories[0]), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	notADir := filepath.Join(base, "file")
+	if err := os.WriteFile(notADir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{blocked, notADir} {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestInitPhotoDirectoriesFailure$")
+		// The child exits before removing its working directory
+		cmd.Env = append(os.Environ(), "TEST_PHOTO_DIR="+dir, "TMPDIR="+t.TempDir())
+		output, err := cmd.CombinedOutput()
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			t.Errorf("initPhotoDirectories() with %s: err = %v, want exit", dir, err)
+			continue
+		}
+		if !strings.Contains(string(output), dir) {
+			t.Errorf("failure doesn't name the directory:\n%s", output)
+		}
+	}
+}
+
+func TestFormatTimestamp(t *testing.T) {
+	east := time.FixedZone("UTC+5", 5*60*60)
+	when := time.Date(2024, 3, 1, 2, 30, 0, 0, east)
+	if got, want := formatTimestamp(when), "2024-02-29T21:30:00Z"; got != want {
+		t.Errorf("formatTimestamp() = %q, want %q", got, want)
+	}
+}
+
+func TestResponseTimestampsAreUTC(t *testing.T) {
+	old := time.Local
+	time.Local = time.FixedZone("UTC-7", -7*60*60)
+	t.Cleanup(func() { time.Local = old })
+
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+	rec := doJSON(t, "GET", "/api/photos/photography/"+photo.ID, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var fetched PhotoResponse
+	decodeResponse(t, rec, &fetched)
+
+	for name, value := range map[string]string{"uploaded": photo.UploadDate, "fetched": fetched.UploadDate} {
+		uploaded, err := time.Parse(time.RFC3339, value)
+		if err != nil || !strings.HasSuffix(value, "Z") {
+			t.Errorf("%s uploadDate = %q, want RFC 3339 in UTC", name, value)
+			continue
+		}
+		if age := time.Since(uploaded); age < -time.Minute || age > time.Minute {
+			t.Errorf("%s uploadDate = %q is %v from now", name, value, age)
+		}
+	}
+}
+
+func TestRequireContentType(t *testing.T) {
+	user := newTestUser(t)
+	login := `{"email":"` + user.email + `","password":"` + user.password + `"}`
+	tests := []struct {
+		name        string
+		path        string
+		token       string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"login without a type", "/api/login", "", "", login, http.StatusUnsupportedMediaType},
+		{"login as a form", "/api/login", "", "application/x-www-form-urlencoded", login, http.StatusUnsupportedMediaType},
+		{"login as text", "/api/login", "", "text/plain", login, http.StatusUnsupportedMediaType},
+		{"login with a charset", "/api/login", "", "application/json; charset=utf-8", login, http.StatusOK},
+		{"register as text", "/api/register", "", "text/plain", "{}", http.StatusUnsupportedMediaType},
+		{"upload as JSON", "/api/photos/upload", user.token, "application/json", "{}", http.StatusUnsupportedMediaType},
+		{"upload without a type", "/api/photos/upload", user.token, "", "", http.StatusUnsupportedMediaType},
+		{"malformed type", "/api/photos/upload", user.token, "multipart/", "", http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, "POST", tt.path, tt.token, tt.contentType, strings.NewReader(tt.body))
+			expectStatus(t, rec, tt.status)
+		})
+	}
+}
+
+func TestTrailingSlash(t *testing.T) {
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+
+	rec := doJSON(t, "GET", "/api/photos/photography/", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	// Not redirected, so the method and body survive
+	rec = doJSON(t, "PATCH", "/api/photos/"+photo.ID+"/", user.token, map[string]string{"title": "Renamed"})
+	expectStatus(t, rec, http.StatusOK)
+	var updated PhotoResponse
+	decodeResponse(t, rec, &updated)
+	if updated.Title != "Renamed" {
+		t.Errorf("title = %q, want Renamed", updated.Title)
+	}
+
+	// Static file paths keep their slashes for the file server
+	rec = doRequest(t, "GET", "/photos/photography/"+photo.Filename+"/", "", "", nil)
+	if rec.Code == http.StatusOK {
+		t.Errorf("file served at a directory path")
+	}
+}
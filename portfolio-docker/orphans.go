@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// OrphanReport lists what the photos table and the photo directory disagree
+// about. File paths are relative to the photo directory.
+type OrphanReport struct {
+	// IDs of rows whose file is gone
+	MissingFiles []string `json:"missingFiles"`
+	// Category files without a row. These are legacy uploads, still listed
+	// and served from disk, so cleaning removes them only when asked to.
+	UntrackedFiles []string `json:"untrackedFiles"`
+	// Thumbnails, archived originals, presets and cached resizes no row
+	// refers to, and temporary files left behind by interrupted requests
+	StaleFiles []string `json:"staleFiles"`
+	// Total size of the orphaned files
+	Bytes int64 `json:"bytes"`
+	// Whether the orphans were removed; false for a dry run or when a file
+	// couldn't be deleted
+	Cleaned bool `json:"cleaned"`
+}
+
+// orphanFile is a file on disk that no photo row refers to
+type orphanFile struct {
+	path string // Relative to photoDir
+	size int64
+}
+
+// Find the files in the photo directory that no photo row refers to,
+// returning the untracked category files and the stale derivatives and
+// temporary files separately
+func findOrphanFiles(ctx context.Context) ([]orphanFile, []orphanFile, error) {
+	photos, err := queries.ListPhotos(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	referenced := map[string]bool{}
+	photoIDs := map[string]bool{}
+	for _, photo := range photos {
+		photoIDs[photo.ID] = true
+		for _, name := range append([]string{photo.Filename}, photoDerivatives(photo)...) {
+			if name != "" {
+				referenced[filepath.Join(photo.Category, name)] = true
+			}
+		}
+	}
+
+	var untracked, stale []orphanFile
+	isTemporary := func(name string) bool {
+		return strings.HasPrefix(name, ".upload-") || strings.HasPrefix(name, ".write-check-") ||
+			strings.HasSuffix(name, ".replaced") || strings.Contains(name, ".tmp")
+	}
+	visit := func(dir string, classify func(name string, info os.FileInfo) *[]orphanFile) error {
+		entries, err := os.ReadDir(filepath.Join(photoDir, dir))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			if list := classify(entry.Name(), info); list != nil {
+				*list = append(*list, orphanFile{path: filepath.Join(dir, entry.Name()), size: info.Size()})
+			}
+		}
+		return nil
+	}
+	// Temporary files younger than TEMP_FILE_MAX_AGE may belong to an
+	// upload, replacement or resize still in progress
+	staleIfOld := func(info os.FileInfo) *[]orphanFile {
+		if time.Since(info.ModTime()) < tempFileMaxAge {
+			return nil
+		}
+		return &stale
+	}
+
+	// Uploads are spooled to the top of the photo directory
+	err = visit(".", func(name string, info os.FileInfo) *[]orphanFile {
+		if isTemporary(name) {
+			return staleIfOld(info)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, category := range photoCategories {
+		err := visit(category, func(name string, info os.FileInfo) *[]orphanFile {
+			switch {
+			case isTemporary(name):
+				return staleIfOld(info)
+			case strings.HasPrefix(name, "."), referenced[filepath.Join(category, name)]:
+				return nil
+			}
+			return &untracked
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, derivatives := range []string{thumbnailDir, originalsDir, presetsDir} {
+			err := visit(filepath.Join(category, derivatives), func(name string, info os.FileInfo) *[]orphanFile {
+				if referenced[filepath.Join(category, derivatives, name)] {
+					return nil
+				}
+				return &stale
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	// Cached resizes are named after their photo's ID
+	err = visit(resizeCacheDir, func(name string, info os.FileInfo) *[]orphanFile {
+		if isTemporary(name) {
+			return staleIfOld(info)
+		}
+		id, _, _ := strings.Cut(name, "-")
+		if photoIDs[id] {
+			return nil
+		}
+		return &stale
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return untracked, stale, nil
+}
+
+// Find orphaned rows and files, removing them unless dryRun is set. Untracked
+// category files are only removed with includeUntracked set.
+func cleanOrphans(ctx context.Context, dryRun, includeUntracked bool) (OrphanReport, error) {
+	report := OrphanReport{
+		MissingFiles:   []string{},
+		UntrackedFiles: []string{},
+		StaleFiles:     []string{},
+		Cleaned:        !dryRun,
+	}
+
+	storage, err := reconcileStorage(ctx, !dryRun)
+	if err != nil {
+		return report, err
+	}
+	report.MissingFiles = storage.MissingFiles
+
+	untracked, stale, err := findOrphanFiles(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	remove := func(file orphanFile) {
+		if err := os.Remove(filepath.Join(photoDir, file.path)); err != nil && !os.IsNotExist(err) {
+			report.Cleaned = false
+		}
+	}
+	for _, file := range untracked {
+		report.UntrackedFiles = append(report.UntrackedFiles, file.path)
+		report.Bytes += file.size
+		if !dryRun && includeUntracked {
+			remove(file)
+		}
+	}
+	for _, file := range stale {
+		report.StaleFiles = append(report.StaleFiles, file.path)
+		report.Bytes += file.size
+		if !dryRun {
+			remove(file)
+		}
+	}
+	return report, nil
+}
+
+// List photo rows without a file and files without a row (admin only)
+func listOrphansHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := cleanOrphans(requestContext(r), true, false)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    report,
+	})
+}
+
+// Remove orphaned rows and files (admin only). dryRun=true only reports
+// them; untracked category files, which are still served as legacy uploads,
+// are removed only with includeUntracked=true.
+func cleanOrphansHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	dryRun := query.Get("dryRun") == "true"
+	includeUntracked := query.Get("includeUntracked") == "true"
+
+	report, err := cleanOrphans(requestContext(r), dryRun, includeUntracked)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	message := "Orphans checked"
+	if !dryRun {
+		message = "Orphans removed"
+		if !report.Cleaned {
+			message = "Some orphaned files could not be removed"
+		}
+	}
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: message,
+		Data:    report,
+	})
+}
+
+// Most entries of each kind listed in a consistency report; the counts
+// cover all of them
+const consistencySampleSize = 20
+
+// ConsistencyIssues counts one kind of disagreement between the photos table
+// and the photo directory, listing the first few
+type ConsistencyIssues struct {
+	Count  int      `json:"count"`
+	Sample []string `json:"sample"`
+}
+
+// SizeMismatch is a photo whose file isn't the size recorded for it
+type SizeMismatch struct {
+	ID            string `json:"id"`
+	Path          string `json:"path"` // Relative to the photo directory
+	RecordedBytes int64  `json:"recordedBytes"`
+	ActualBytes   int64  `json:"actualBytes"`
+}
+
+// ConsistencyReport summarizes where the photos table and the photo
+// directory disagree
+type ConsistencyReport struct {
+	MissingFiles   ConsistencyIssues `json:"missingFiles"`   // Photo IDs
+	UntrackedFiles ConsistencyIssues `json:"untrackedFiles"` // Paths relative to the photo directory
+	SizeMismatches struct {
+		Count  int            `json:"count"`
+		Sample []SizeMismatch `json:"sample"`
+	} `json:"sizeMismatches"`
+}
+
+// Count an entry, keeping it in the sample while there's room
+func (c *ConsistencyIssues) add(entry string) {
+	c.Count++
+	if len(c.Sample) < consistencySampleSize {
+		c.Sample = append(c.Sample, entry)
+	}
+}
+
+// Report photo rows without a file, category files without a row, and files
+// whose size differs from the recorded one (admin only). Unlike the orphan
+// and reconcile endpoints nothing is changed, not even missing directories.
+func consistencyReportHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := requestContext(r)
+	report := ConsistencyReport{
+		MissingFiles:   ConsistencyIssues{Sample: []string{}},
+		UntrackedFiles: ConsistencyIssues{Sample: []string{}},
+	}
+	report.SizeMismatches.Sample = []SizeMismatch{}
+
+	photos, err := queries.ListPhotos(ctx)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	for _, photo := range photos {
+		if !isValidCategory(photo.Category) {
+			continue
+		}
+		path := filepath.Join(photo.Category, photo.Filename)
+		info, err := os.Stat(filepath.Join(photoDir, path))
+		if os.IsNotExist(err) {
+			report.MissingFiles.add(photo.ID)
+			continue
+		}
+		if err != nil || info.Size() == photo.SizeBytes {
+			continue
+		}
+		report.SizeMismatches.Count++
+		if len(report.SizeMismatches.Sample) < consistencySampleSize {
+			report.SizeMismatches.Sample = append(report.SizeMismatches.Sample, SizeMismatch{
+				ID:            photo.ID,
+				Path:          filepath.ToSlash(path),
+				RecordedBytes: photo.SizeBytes,
+				ActualBytes:   info.Size(),
+			})
+		}
+	}
+
+	untracked, _, err := findOrphanFiles(ctx)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	for _, file := range untracked {
+		report.UntrackedFiles.add(filepath.ToSlash(file.path))
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    report,
+	})
+}
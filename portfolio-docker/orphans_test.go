@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Write a file under the photo directory, aged when old is set
+func writeOrphan(t *testing.T, path string, old bool) string {
+	t.Helper()
+	full := filepath.Join(photoDir, path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte("orphan"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if old {
+		aged := time.Now().Add(-2 * tempFileMaxAge)
+		if err := os.Chtimes(full, aged, aged); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { os.Remove(full) })
+	return path
+}
+
+// Call an orphan endpoint as an admin
+func orphanReport(t *testing.T, method, path string) OrphanReport {
+	t.Helper()
+	admin := newTestAdmin(t)
+	rec := doJSON(t, method, path, admin.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var report OrphanReport
+	decodeResponse(t, rec, &report)
+	return report
+}
+
+func TestOrphans(t *testing.T) {
+	user := newTestUser(t)
+	kept := uploadTestPhoto(t, user.token, "photography")
+	lost := uploadTestPhoto(t, user.token, "photography")
+	if err := os.Remove(filepath.Join(photoDir, lost.Category, lost.Filename)); err != nil {
+		t.Fatal(err)
+	}
+	untracked := writeOrphan(t, filepath.Join("photography", "legacy-orphan.png"), false)
+	staleThumb := writeOrphan(t, filepath.Join("photography", thumbnailDir, "no-such-photo.jpg"), false)
+	staleResize := writeOrphan(t, filepath.Join(resizeCacheDir, "no-such-photo-100x100.png"), false)
+	staleUpload := writeOrphan(t, ".upload-orphan", true)
+	activeUpload := writeOrphan(t, ".upload-in-progress", false)
+	stale := []string{staleThumb, staleResize, staleUpload}
+	ctx := context.Background()
+
+	for _, report := range []OrphanReport{
+		orphanReport(t, "GET", "/api/admin/orphans"),
+		orphanReport(t, "POST", "/api/admin/orphans/clean?dryRun=true&includeUntracked=true"),
+	} {
+		if report.Cleaned {
+			t.Error("dry run reported cleaned")
+		}
+		if !slices.Contains(report.MissingFiles, lost.ID) || slices.Contains(report.MissingFiles, kept.ID) {
+			t.Errorf("missing files = %v, want %s and not %s", report.MissingFiles, lost.ID, kept.ID)
+		}
+		if !slices.Contains(report.UntrackedFiles, untracked) {
+			t.Errorf("untracked = %v, want %s", report.UntrackedFiles, untracked)
+		}
+		for _, path := range stale {
+			if !slices.Contains(report.StaleFiles, path) {
+				t.Errorf("stale = %v, want %s", report.StaleFiles, path)
+			}
+		}
+		if slices.Contains(report.StaleFiles, activeUpload) {
+			t.Errorf("upload in progress %s reported stale", activeUpload)
+		}
+		if report.Bytes < int64(len("orphan")*4) {
+			t.Errorf("bytes = %d, want at least the orphaned files", report.Bytes)
+		}
+	}
+	for _, path := range append(stale, untracked) {
+		if _, err := os.Stat(filepath.Join(photoDir, path)); err != nil {
+			t.Errorf("dry run removed %s: %v", path, err)
+		}
+	}
+	if _, err := queries.GetPhoto(ctx, lost.ID); err != nil {
+		t.Fatalf("dry run deleted the row: %v", err)
+	}
+
+	// Untracked files stay unless asked for
+	report := orphanReport(t, "POST", "/api/admin/orphans/clean")
+	if !report.Cleaned {
+		t.Error("clean not reported cleaned")
+	}
+	for _, path := range stale {
+		if _, err := os.Stat(filepath.Join(photoDir, path)); !os.IsNotExist(err) {
+			t.Errorf("stale %s not removed: %v", path, err)
+		}
+	}
+	for _, path := range []string{untracked, activeUpload, filepath.Join(kept.Category, kept.Filename)} {
+		if _, err := os.Stat(filepath.Join(photoDir, path)); err != nil {
+			t.Errorf("%s removed: %v", path, err)
+		}
+	}
+	if _, err := queries.GetPhoto(ctx, lost.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("row of the missing file: GetPhoto() = %v, want sql.ErrNoRows", err)
+	}
+
+	orphanReport(t, "POST", "/api/admin/orphans/clean?includeUntracked=true")
+	if _, err := os.Stat(filepath.Join(photoDir, untracked)); !os.IsNotExist(err) {
+		t.Errorf("untracked %s not removed: %v", untracked, err)
+	}
+}
+
+// Fetch the consistency report as an admin
+func consistencyReport(t *testing.T, token string) ConsistencyReport {
+	t.Helper()
+	rec := doJSON(t, "GET", "/api/admin/consistency", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var report ConsistencyReport
+	decodeResponse(t, rec, &report)
+	return report
+}
+
+func TestConsistencyReport(t *testing.T) {
+	admin := newTestAdmin(t)
+	user := newTestUser(t)
+	before := consistencyReport(t, admin.token)
+
+	missing := uploadTestPhoto(t, user.token, "photography")
+	if err := os.Remove(filepath.Join(photoDir, missing.Category, missing.Filename)); err != nil {
+		t.Fatal(err)
+	}
+	untracked := writeOrphan(t, filepath.Join("photography", "consistency-untracked.png"), false)
+	resized := uploadTestPhoto(t, user.token, "digital-sketches")
+	resizedPath := filepath.Join(photoDir, resized.Category, resized.Filename)
+	f, err := os.OpenFile(resizedPath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = f.Write([]byte("trailing bytes"))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	uploadTestPhoto(t, user.token, "photography")
+
+	report := consistencyReport(t, admin.token)
+	if got := report.MissingFiles.Count - before.MissingFiles.Count; got != 1 {
+		t.Errorf("%d more missing files, want 1", got)
+	}
+	if got := report.UntrackedFiles.Count - before.UntrackedFiles.Count; got != 1 {
+		t.Errorf("%d more untracked files, want 1", got)
+	}
+	if got := report.SizeMismatches.Count - before.SizeMismatches.Count; got != 1 {
+		t.Errorf("%d more size mismatches, want 1", got)
+	}
+
+	// Samples are capped, so entries are only looked for while they fit
+	if report.MissingFiles.Count <= consistencySampleSize && !slices.Contains(report.MissingFiles.Sample, missing.ID) {
+		t.Errorf("missing files %v don't list %s", report.MissingFiles.Sample, missing.ID)
+	}
+	if report.UntrackedFiles.Count <= consistencySampleSize && !slices.Contains(report.UntrackedFiles.Sample, filepath.ToSlash(untracked)) {
+		t.Errorf("untracked files %v don't list %s", report.UntrackedFiles.Sample, untracked)
+	}
+	if report.SizeMismatches.Count <= consistencySampleSize {
+		i := slices.IndexFunc(report.SizeMismatches.Sample, func(m SizeMismatch) bool { return m.ID == resized.ID })
+		if i < 0 {
+			t.Errorf("size mismatches %+v don't list %s", report.SizeMismatches.Sample, resized.ID)
+		} else if m := report.SizeMismatches.Sample[i]; m.ActualBytes != m.RecordedBytes+int64(len("trailing bytes")) {
+			t.Errorf("mismatch %+v, want the actual size 14 bytes over", m)
+		}
+	}
+	for _, issues := range []ConsistencyIssues{report.MissingFiles, report.UntrackedFiles} {
+		if len(issues.Sample) > consistencySampleSize {
+			t.Errorf("sample of %d entries, want at most %d", len(issues.Sample), consistencySampleSize)
+		}
+	}
+
+	// Nothing is changed
+	if _, err := os.Stat(filepath.Join(photoDir, untracked)); err != nil {
+		t.Errorf("untracked file removed: %v", err)
+	}
+	if _, err := queries.GetPhoto(context.Background(), missing.ID); err != nil {
+		t.Errorf("photo without a file removed: %v", err)
+	}
+	if again := consistencyReport(t, admin.token); !reflect.DeepEqual(again, report) {
+		t.Errorf("second report %+v differs from the first %+v", again, report)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Page size used when the client doesn't ask for one, and the largest
+// served. Larger requested sizes are clamped rather than rejected.
+var (
+	defaultPageSize = int(getEnvInt64("DEFAULT_PAGE_SIZE", 20))
+	maxPageSize     = int(getEnvInt64("MAX_PAGE_SIZE", 100))
+)
+
+// Highest page number accepted. Larger ones are rejected, as no list gets
+// that long and they only make for huge offsets.
+var maxPage = int(getEnvInt64("MAX_PAGE", 100000))
+
+// Check the page size settings at startup
+func validatePaginationConfig() {
+	if defaultPageSize < 1 || maxPageSize < 1 || maxPage < 1 {
+		log.Fatal("DEFAULT_PAGE_SIZE, MAX_PAGE_SIZE and MAX_PAGE must be positive")
+	}
+	if defaultPageSize > maxPageSize {
+		log.Fatalf("DEFAULT_PAGE_SIZE (%d) must not exceed MAX_PAGE_SIZE (%d)", defaultPageSize, maxPageSize)
+	}
+}
+
+// PaginatedResponse is the data returned by every list endpoint: one page of
+// items along with where it sits in the full list
+type PaginatedResponse struct {
+	Items    interface{} `json:"items"`
+	Total    int64       `json:"total"`
+	Page     int         `json:"page"`
+	PageSize int         `json:"pageSize"`
+	HasMore  bool        `json:"hasMore"`
+}
+
+func newPaginatedResponse(items interface{}, page, pageSize int, total int64) PaginatedResponse {
+	return PaginatedResponse{
+		Items:    items,
+		Total:    total,
+		Page:     page,
+		PageSize: pageSize,
+		HasMore:  int64(page) < lastPage(pageSize, total),
+	}
+}
+
+// Number of the last page of total items, 1 when there are none
+func lastPage(pageSize int, total int64) int64 {
+	return max(1, (total+int64(pageSize)-1)/int64(pageSize))
+}
+
+// Offset of a page's first item, for a query. Absurd page numbers saturate
+// rather than overflow, so they come back empty; pages before the first are
+// the first.
+func pageOffset(page, pageSize int) int64 {
+	skipped := int64(max(page-1, 0))
+	if skipped > math.MaxInt64/int64(pageSize) {
+		return math.MaxInt64
+	}
+	return skipped * int64(pageSize)
+}
+
+// Bounds of a page within a list of n items held in memory, for slicing.
+// Pages past the end are empty; pages before the first are the first.
+func pageBounds(n, page, pageSize int) (start, end int) {
+	skipped := max(page-1, 0)
+	start = n
+	if skipped <= n/pageSize {
+		start = min(skipped*pageSize, n)
+	}
+	end = min(start+pageSize, n)
+	return start, end
+}
+
+// Read the page and pageSize query parameters. Pages are numbered from 1 up
+// to MAX_PAGE. The returned pageSize is the effective one, after clamping to
+// MAX_PAGE_SIZE.
+func parsePagination(r *http.Request) (page, pageSize int, err error) {
+	page, pageSize = 1, defaultPageSize
+
+	if value := r.URL.Query().Get("page"); value != "" {
+		page, err = strconv.Atoi(value)
+		if err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("page must be a positive integer")
+		}
+		if page > maxPage {
+			return 0, 0, fmt.Errorf("page must not exceed %d", maxPage)
+		}
+	}
+	if value := r.URL.Query().Get("pageSize"); value != "" {
+		pageSize, err = strconv.Atoi(value)
+		if err != nil || pageSize < 1 {
+			return 0, 0, fmt.Errorf("pageSize must be a positive integer")
+		}
+		pageSize = min(pageSize, maxPageSize)
+	}
+	return page, pageSize, nil
+}
+
+// Set X-Total-Count and an RFC 5988 Link header with first, prev, next and
+// last page URLs. Other query parameters of the request are preserved.
+func setPaginationHeaders(w http.ResponseWriter, r *http.Request, page, pageSize int, total int64) {
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	pageURL := func(p int) string {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(p))
+		query.Set("pageSize", strconv.Itoa(pageSize))
+		u := url.URL{Scheme: scheme, Host: r.Host, Path: r.URL.Path, RawQuery: query.Encode()}
+		return u.String()
+	}
+
+	last := int(lastPage(pageSize, total))
+	links := []string{fmt.Sprintf(`<%s>; rel="first"`, pageURL(1))}
+	if page > 1 {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, pageURL(min(page-1, last))))
+	}
+	if page < last {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, pageURL(page+1)))
+	}
+	links = append(links, fmt.Sprintf(`<%s>; rel="last"`, pageURL(last)))
+	w.Header().Set("Link", strings.Join(links, ", "))
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func TestPageBounds(t *testing.T) {
+	tests := []struct {
+		name               string
+		n, page, size      int
+		wantStart, wantEnd int
+	}{
+		{"first page", 45, 1, 20, 0, 20},
+		{"middle page", 45, 2, 20, 20, 40},
+		{"last partial page", 45, 3, 20, 40, 45},
+		{"past the end", 45, 4, 20, 45, 45},
+		{"page 0", 45, 0, 20, 0, 20},
+		{"huge page", 45, 900000000000000000, 20, 45, 45},
+		{"largest page", 45, math.MaxInt, 100, 45, 45},
+		{"empty list", 0, 1, 20, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := pageBounds(tt.n, tt.page, tt.size)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("pageBounds(%d, %d, %d) = %d, %d; want %d, %d", tt.n, tt.page, tt.size, start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestPageOffset(t *testing.T) {
+	tests := []struct {
+		name       string
+		page, size int
+		want       int64
+	}{
+		{"first page", 1, 20, 0},
+		{"third page", 3, 20, 40},
+		{"page 0", 0, 20, 0},
+		{"huge page", 900000000000000000, 20, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pageOffset(tt.page, tt.size); got != tt.want {
+				t.Errorf("pageOffset(%d, %d) = %d, want %d", tt.page, tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginatedResponseHasMore(t *testing.T) {
+	tests := []struct {
+		name       string
+		page, size int
+		total      int64
+		want       bool
+	}{
+		{"first of several", 1, 20, 45, true},
+		{"last partial page", 3, 20, 45, false},
+		{"last full page", 2, 20, 40, false},
+		{"past the end", 4, 20, 45, false},
+		{"page 0", 0, 20, 45, true},
+		{"huge page", 900000000000000000, 20, 45, false},
+		{"largest page", math.MaxInt, 100, 45, false},
+		{"empty list", 1, 20, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := newPaginatedResponse(nil, tt.page, tt.size, tt.total)
+			if resp.HasMore != tt.want {
+				t.Errorf("hasMore for page %d of %d items = %v, want %v", tt.page, tt.total, resp.HasMore, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantPage  int
+		wantSize  int
+		wantError bool
+	}{
+		{"defaults", "", 1, defaultPageSize, false},
+		{"explicit", "page=3&pageSize=5", 3, 5, false},
+		{"size clamped", "pageSize=100000", 1, maxPageSize, false},
+		{"highest page", "page=" + strconv.Itoa(maxPage), maxPage, defaultPageSize, false},
+		{"over max page", "page=" + strconv.Itoa(maxPage+1), 0, 0, true},
+		{"huge page", "page=900000000000000000", 0, 0, true},
+		{"page overflowing int", "page=99999999999999999999", 0, 0, true},
+		{"page 0", "page=0", 0, 0, true},
+		{"negative page", "page=-1", 0, 0, true},
+		{"page not a number", "page=two", 0, 0, true},
+		{"size 0", "pageSize=0", 0, 0, true},
+		{"size not a number", "pageSize=ten", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/photos/photography?"+tt.query, nil)
+			page, size, err := parsePagination(r)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("parsePagination(%q) = %d, %d; want an error", tt.query, page, size)
+				}
+				return
+			}
+			if err != nil || page != tt.wantPage || size != tt.wantSize {
+				t.Errorf("parsePagination(%q) = %d, %d, %v; want %d, %d", tt.query, page, size, err, tt.wantPage, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestCategoryListingRejectsOverMaxPage(t *testing.T) {
+	rec := doJSON(t, "GET", "/api/photos/photography?page=900000000000000000", "", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestCategoryListingPastTheEnd(t *testing.T) {
+	rec := doJSON(t, "GET", "/api/photos/photography?page="+strconv.Itoa(maxPage), "", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	var page struct {
+		Items   []json.RawMessage `json:"items"`
+		HasMore bool              `json:"hasMore"`
+	}
+	decodeResponse(t, rec, &page)
+	if len(page.Items) != 0 || page.HasMore {
+		t.Errorf("got %d items, hasMore %v; want an empty last page", len(page.Items), page.HasMore)
+	}
+}
+
+func TestSetPaginationHeaders(t *testing.T) {
+	const base = "http://example.com/api/photos/photography?"
+	link := func(page int, rel string) string {
+		return "<" + base + "page=" + strconv.Itoa(page) + "&pageSize=20&sort=captured>; rel=\"" + rel + "\""
+	}
+	tests := []struct {
+		name     string
+		page     int
+		total    int64
+		wantLink string
+	}{
+		{"first", 1, 45, link(1, "first") + ", " + link(2, "next") + ", " + link(3, "last")},
+		{"middle", 2, 45, link(1, "first") + ", " + link(1, "prev") + ", " + link(3, "next") + ", " + link(3, "last")},
+		{"last", 3, 45, link(1, "first") + ", " + link(2, "prev") + ", " + link(3, "last")},
+		{"past the end", 9, 45, link(1, "first") + ", " + link(3, "prev") + ", " + link(3, "last")},
+		{"empty", 1, 0, link(1, "first") + ", " + link(1, "last")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/photos/photography?sort=captured&page="+strconv.Itoa(tt.page), nil)
+			r.Host = "example.com"
+			rec := httptest.NewRecorder()
+			setPaginationHeaders(rec, r, tt.page, 20, tt.total)
+
+			if got := rec.Header().Get("X-Total-Count"); got != strconv.FormatInt(tt.total, 10) {
+				t.Errorf("X-Total-Count = %q, want %d", got, tt.total)
+			}
+			if got := rec.Header().Get("Link"); got != tt.wantLink {
+				t.Errorf("Link =\n%s\nwant\n%s", got, tt.wantLink)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"log"
+	"strings"
+)
+
+// Alphabets PHOTO_ID_ALPHABET may name instead of listing characters
+var photoIDAlphabets = map[string]string{
+	"hex":    "0123456789abcdef",
+	"base62": "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+}
+
+// Shortest and longest PHOTO_ID_LENGTH accepted. Short IDs are guessable and
+// collide often; long ones make unwieldy filenames.
+const (
+	minPhotoIDLength = 8
+	maxPhotoIDLength = 64
+)
+
+// Times a new photo ID is drawn again after colliding with an existing one
+const photoIDAttempts = 5
+
+// Characters new photo IDs are drawn from, set by loadPhotoIDAlphabet
+var photoIDChars string
+
+// Resolve and check PHOTO_ID_ALPHABET and PHOTO_ID_LENGTH
+func loadPhotoIDAlphabet() {
+	photoIDChars = photoIDAlphabet
+	if named, ok := photoIDAlphabets[photoIDAlphabet]; ok {
+		photoIDChars = named
+	}
+
+	if len(photoIDChars) < 2 || len(photoIDChars) > 256 {
+		log.Fatalf("PHOTO_ID_ALPHABET must have between 2 and 256 characters: %q", photoIDAlphabet)
+	}
+	for i, c := range photoIDChars {
+		isWordChar := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_'
+		if !isWordChar {
+			log.Fatalf("PHOTO_ID_ALPHABET may only contain letters, digits, '-' and '_': %q", photoIDAlphabet)
+		}
+		if strings.IndexRune(photoIDChars, c) != i {
+			log.Fatalf("PHOTO_ID_ALPHABET repeats %q", c)
+		}
+	}
+	if photoIDLength < minPhotoIDLength || photoIDLength > maxPhotoIDLength {
+		log.Fatalf("PHOTO_ID_LENGTH must be between %d and %d", minPhotoIDLength, maxPhotoIDLength)
+	}
+}
+
+// Draw a random ID of PHOTO_ID_LENGTH characters from the alphabet. Bytes
+// that would favor the first characters of an alphabet not dividing 256 are
+// skipped, so every character is equally likely.
+func randomPhotoID() string {
+	n := len(photoIDChars)
+	limit := 256 - 256%n
+	id := make([]byte, 0, photoIDLength)
+	buf := make([]byte, photoIDLength)
+	for int64(len(id)) < photoIDLength {
+		rand.Read(buf)
+		for _, b := range buf {
+			if int(b) < limit && int64(len(id)) < photoIDLength {
+				id = append(id, photoIDChars[int(b)%n])
+			}
+		}
+	}
+	return string(id)
+}
+
+// Generate an ID for a new photo that no photo, present or deleted, has had.
+// Deleted photos' IDs aren't reused so sync clients holding a tombstone never
+// see the ID come back as a different photo.
+func generatePhotoID(ctx context.Context) (string, error) {
+	for attempt := 0; attempt < photoIDAttempts; attempt++ {
+		id := randomPhotoID()
+		taken, err := withRetry(ctx, func() (int64, error) {
+			return queries.CheckPhotoIDExists(ctx, id)
+		})
+		if err != nil {
+			return "", err
+		}
+		if taken == 0 {
+			return id, nil
+		}
+	}
+	return "", errors.New("no unused photo ID found; PHOTO_ID_LENGTH may be too short")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// Switch the photo ID format until the test ends
+func usePhotoIDFormat(t *testing.T, alphabet string, length int64) {
+	t.Helper()
+	oldAlphabet, oldLength := photoIDAlphabet, photoIDLength
+	t.Cleanup(func() {
+		photoIDAlphabet, photoIDLength = oldAlphabet, oldLength
+		loadPhotoIDAlphabet()
+	})
+	photoIDAlphabet, photoIDLength = alphabet, length
+	loadPhotoIDAlphabet()
+}
+
+func TestRandomPhotoID(t *testing.T) {
+	tests := []struct {
+		alphabet string
+		length   int64
+		chars    string
+	}{
+		{"hex", 32, photoIDAlphabets["hex"]},
+		{"base62", 12, photoIDAlphabets["base62"]},
+		{"ab", 40, "ab"},
+		{"xyz-_", 16, "xyz-_"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alphabet, func(t *testing.T) {
+			usePhotoIDFormat(t, tt.alphabet, tt.length)
+			seen := map[string]bool{}
+			used := map[rune]bool{}
+			for range 10000 {
+				id := randomPhotoID()
+				if int64(len(id)) != tt.length {
+					t.Fatalf("ID %q has %d characters, want %d", id, len(id), tt.length)
+				}
+				for _, c := range id {
+					if !strings.ContainsRune(tt.chars, c) {
+						t.Fatalf("ID %q has %q, outside the alphabet %q", id, c, tt.chars)
+					}
+					used[c] = true
+				}
+				if seen[id] {
+					t.Fatalf("ID %q generated twice", id)
+				}
+				seen[id] = true
+			}
+			if len(used) != len(tt.chars) {
+				t.Errorf("IDs used %d of the %d characters", len(used), len(tt.chars))
+			}
+		})
+	}
+}
+
+func TestConfiguredPhotoIDs(t *testing.T) {
+	user := newTestUser(t)
+	old := uploadTestPhoto(t, user.token, "photography")
+
+	usePhotoIDFormat(t, "base62", 10)
+	photo := uploadTestPhoto(t, user.token, "photography")
+	if len(photo.ID) != 10 || strings.Trim(photo.ID, photoIDAlphabets["base62"]) != "" {
+		t.Errorf("ID %q isn't 10 base62 characters", photo.ID)
+	}
+
+	// Photos keep working under IDs of either format
+	for _, p := range []PhotoResponse{old, photo} {
+		expectStatus(t, doJSON(t, "GET", "/api/photos/photography/"+p.ID, "", nil), http.StatusOK)
+		title := "Renamed"
+		expectStatus(t, doJSON(t, "PATCH", "/api/photos/"+p.ID, user.token, PhotoUpdate{Title: &title}), http.StatusOK)
+	}
+}
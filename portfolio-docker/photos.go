@@ -0,0 +1,1515 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// PhotoUpdate holds the editable metadata of a photo. Omitted fields are
+// left unchanged.
+type PhotoUpdate struct {
+	Title   *string `json:"title"`
+	AltText *string `json:"altText"`
+	Caption *string `json:"caption"`
+	Slug    *string `json:"slug"`  // An empty string removes the slug
+	Cover   *bool   `json:"cover"` // Setting a cover clears the category's previous one
+}
+
+// Build the response for a stored photo
+func photoResponseFromRow(r *http.Request, photo db.Photo) PhotoResponse {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	categoryURL := fmt.Sprintf("%s://%s/photos/%s", scheme, r.Host, photo.Category)
+
+	response := PhotoResponse{
+		ID:               photo.ID,
+		Filename:         photo.Filename,
+		Title:            photo.Title,
+		Category:         photo.Category,
+		URL:              categoryURL + "/" + photo.Filename,
+		AltText:          photo.AltText,
+		Caption:          photo.Caption,
+		Colors:           splitColors(photo.Colors),
+		Blurhash:         photo.Blurhash,
+		Version:          photo.Version,
+		Slug:             photo.Slug,
+		Tags:             splitTags(photo.Tags),
+		Cover:            photo.Cover,
+		OriginalFilename: photo.OriginalFilename,
+		UserID:           photo.UserID,
+		Status:           photo.Status,
+	}
+	views := photo.Views + unflushedViews(photo.ID)
+	response.Views = &views
+	response.Permalink = photoPermalink(scheme, r.Host, photo.Category, photo.ID, photo.Slug)
+	if len(response.Colors) > 0 {
+		response.DominantColor = response.Colors[0]
+	}
+	if photo.Thumbnail != "" {
+		response.ThumbnailURL = categoryURL + "/" + photo.Thumbnail
+	}
+	response.Presets = presetImages(categoryURL, photo)
+	response.Srcset = buildSrcset(response.URL, photo.Width, response.Presets)
+	if photo.CreatedAt.Valid {
+		response.UploadDate = formatTimestamp(photo.CreatedAt.Time)
+	}
+	if photo.CapturedAt.Valid {
+		response.CapturedAt = formatTimestamp(photo.CapturedAt.Time)
+	}
+	if photo.UpdatedAt.Valid {
+		response.UpdatedAt = formatTimestamp(photo.UpdatedAt.Time)
+	}
+	return viewerFromRequest(r).filter(response)
+}
+
+// photoViewer is who a photo response is serialized for, which decides
+// whether it includes the photo's private fields
+type photoViewer struct {
+	userID int64 // Zero when not signed in
+	admin  bool
+}
+
+// The viewer making a request, as identified by authMiddleware or
+// optionalAuthMiddleware
+func viewerFromRequest(r *http.Request) photoViewer {
+	userID, _ := r.Context().Value("userID").(int64)
+	role, _ := r.Context().Value("userRole").(string)
+	return photoViewer{userID: userID, admin: role == "admin"}
+}
+
+// Leave out the fields of a photo response only its owner and admins may
+// see: the uploader, the capture date from EXIF, the view count and the
+// original filename. Files without a row have no owner to see them.
+func (v photoViewer) filter(photo PhotoResponse) PhotoResponse {
+	if v.admin || (v.userID != 0 && v.userID == photo.UserID) {
+		return photo
+	}
+	photo.UserID = 0
+	photo.CapturedAt = ""
+	photo.Views = nil
+	photo.OriginalFilename = ""
+	return photo
+}
+
+func isValidPhotoStatus(status string) bool {
+	return status == "draft" || status == "published"
+}
+
+// Whether the request may see a photo. Published photos are public; drafts
+// are only visible to their owner, signed in through optionalAuthMiddleware
+// on public routes.
+func photoVisible(r *http.Request, photo db.Photo) bool {
+	if photo.Status != "draft" {
+		return true
+	}
+	userID, ok := r.Context().Value("userID").(int64)
+	return ok && userID == photo.UserID
+}
+
+// ID of the photo a static file path, relative to the photo directory,
+// belongs to: a photo file, thumbnail or preset. Other paths, directories
+// included, belong to no photo.
+func staticFilePhotoID(name string) (string, bool) {
+	category, name, ok := strings.Cut(strings.TrimPrefix(path.Clean("/"+name), "/"), "/")
+	if !ok || !isValidCategory(category) {
+		return "", false
+	}
+	dir, filename := path.Split(name)
+	stem := strings.TrimSuffix(filename, path.Ext(filename))
+	switch dir {
+	case "", thumbnailDir + "/":
+	case presetsDir + "/":
+		// Preset names can't contain a dash; photo IDs can
+		i := strings.LastIndex(stem, "-")
+		if i < 0 {
+			return "", false
+		}
+		stem = stem[:i]
+	default:
+		return "", false
+	}
+	return stem, stem != ""
+}
+
+// hideDraftFiles wraps the static photo file server, answering 404 for a
+// draft's files unless its owner is asking, signed in through
+// optionalAuthMiddleware. Files no photo row owns yet, such as one whose
+// upload hasn't finished, and directory listings, which would name them,
+// get 404 too.
+func hideDraftFiles(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, ok := staticFilePhotoID(r.URL.Path)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		photo, err := queries.GetPhoto(requestContext(r), id)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !photoVisible(r, photo)) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			respondWithDatabaseError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// Largest number of IDs accepted by one batch-get request
+const maxBatchGetSize = 50
+
+// BatchGetRequest lists the photos to fetch, in the order they're wanted
+type BatchGetRequest struct {
+	IDs []string `json:"ids"`
+}
+
+// MoveRequest names the category a photo is moved or copied to
+type MoveRequest struct {
+	Category string `json:"category"`
+}
+
+// Largest number of photos one move-batch request can move
+const maxMoveBatchSize = 100
+
+// MoveBatchRequest moves several photos into one category
+type MoveBatchRequest struct {
+	IDs      []string `json:"ids"`
+	Category string   `json:"category"`
+}
+
+// MoveBatchResult reports what happened to one photo of a move-batch request
+type MoveBatchResult struct {
+	ID    string `json:"id"`
+	Moved bool   `json:"moved"` // False when already in the category, or on error
+	Error string `json:"error,omitempty"`
+}
+
+// Load a photo that the user owns, writing the error response if it doesn't
+// exist or belongs to someone else
+func loadOwnedPhoto(w http.ResponseWriter, ctx context.Context, photoID string, userID int64) (db.Photo, bool) {
+	photo, err := queries.GetPhoto(ctx, photoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Photo not found")
+		return photo, false
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return photo, false
+	}
+	if photo.UserID != userID {
+		respondForbidden(w, "You can only edit your own photos")
+		return photo, false
+	}
+	return photo, true
+}
+
+// Derivative files of a photo, relative to its category directory: its
+// thumbnail, archived original and presets, where it has them
+func photoDerivatives(photo db.Photo) []string {
+	return append([]string{photo.Thumbnail, photo.Original}, presetFiles(photo.ID, photo.Presets)...)
+}
+
+// Remove a photo's derivative files, given relative to its category directory
+func removeDerivatives(categoryDir string, derivatives ...string) {
+	for _, name := range derivatives {
+		if name == "" {
+			continue
+		}
+		path := filepath.Join(categoryDir, name)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			slog.Error("Failed to delete derivative", "path", path, "error", err)
+		}
+	}
+}
+
+// Move a photo's derivative files between category directories
+func moveDerivatives(fromDir, toDir string, derivatives ...string) {
+	for _, name := range derivatives {
+		if name == "" {
+			continue
+		}
+		dest := filepath.Join(toDir, name)
+		err := os.MkdirAll(filepath.Dir(dest), 0755)
+		if err == nil {
+			err = os.Rename(filepath.Join(fromDir, name), dest)
+		}
+		if err != nil {
+			slog.Error("Failed to move derivative", "path", name, "error", err)
+		}
+	}
+}
+
+// Remove every cached resize of a photo
+func removeResizeCache(photoID string) {
+	matches, _ := filepath.Glob(filepath.Join(photoDir, resizeCacheDir, photoID+"-*"))
+	for _, match := range matches {
+		os.Remove(match)
+	}
+}
+
+// List the authenticated user's photos across all categories, newest first
+func listMyPhotosHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+	ctx := requestContext(r)
+
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	category := r.URL.Query().Get("category")
+	if category != "" && !isValidCategory(category) {
+		respondInvalidCategory(w)
+		return
+	}
+
+	total, err := queries.CountPhotosByUser(ctx, db.CountPhotosByUserParams{
+		UserID:   userID,
+		Category: category,
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	rows, err := queries.ListPhotosByUser(ctx, db.ListPhotosByUserParams{
+		UserID:   userID,
+		Category: category,
+		Limit:    int64(pageSize),
+		Offset:   pageOffset(page, pageSize),
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	photos := []PhotoResponse{}
+	for _, row := range rows {
+		photos = append(photos, photoResponseFromRow(r, row))
+	}
+
+	setPaginationHeaders(w, r, page, pageSize, total)
+	respondWithCacheableJSON(w, r, Response{
+		Success: true,
+		Data:    newPaginatedResponse(photos, page, pageSize, total),
+	})
+}
+
+// Photos per category the overview returns when perCategory isn't given, and
+// the most it accepts
+const (
+	defaultOverviewPerCategory = 4
+	maxOverviewPerCategory     = 20
+)
+
+// Fetch one published photo at random, from the given category or any, such
+// as for a rotating hero image. ORDER BY RANDOM() reads every matching row,
+// which is cheap at portfolio sizes but would call for picking a random
+// offset or rowid instead on a table of millions. Drafts are never picked.
+func randomPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	category := r.URL.Query().Get("category")
+	if category != "" && !isValidCategory(category) {
+		respondInvalidCategory(w)
+		return
+	}
+
+	photo, err := queries.GetRandomPublishedPhoto(requestContext(r), category)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "No photos found")
+		return
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	// Each request should get a new pick
+	w.Header().Set("Cache-Control", "no-store")
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    photoResponseFromRow(r, photo),
+	})
+}
+
+// Preview every category in one response: the first perCategory photos of
+// each, in the same order as the category listing, keyed by category. Empty
+// categories map to an empty list.
+func photosOverviewHandler(w http.ResponseWriter, r *http.Request) {
+	perCategory := defaultOverviewPerCategory
+	if value := r.URL.Query().Get("perCategory"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxOverviewPerCategory {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("perCategory must be between 1 and %d", maxOverviewPerCategory))
+			return
+		}
+		perCategory = n
+	}
+
+	sortOrder := r.URL.Query().Get("sort")
+	if sortOrder != "" && sortOrder != "captured" {
+		respondWithError(w, http.StatusBadRequest, "Invalid sort option")
+		return
+	}
+
+	overview := make(map[string][]PhotoResponse, len(photoCategories))
+	for _, category := range photoCategories {
+		photos, ok := listCategoryPhotos(w, r, category, sortOrder)
+		if !ok {
+			return
+		}
+		overview[category] = photos[:min(len(photos), perCategory)]
+	}
+
+	respondWithCacheableJSON(w, r, Response{
+		Success: true,
+		Data:    overview,
+	})
+}
+
+// Fetch several photos by ID in one request. Photos are returned in the
+// requested order; IDs without a photo are listed under "missing".
+func batchGetPhotosHandler(w http.ResponseWriter, r *http.Request) {
+	var req BatchGetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if len(req.IDs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "ids is required")
+		return
+	}
+	if len(req.IDs) > maxBatchGetSize {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("At most %d ids can be fetched at once", maxBatchGetSize))
+		return
+	}
+
+	ctx := requestContext(r)
+	photos := []PhotoResponse{}
+	missing := []string{}
+	for _, id := range req.IDs {
+		photo, err := queries.GetPhoto(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !photoVisible(r, photo)) {
+			missing = append(missing, id)
+			continue
+		}
+		if err != nil {
+			respondWithDatabaseError(w, err)
+			return
+		}
+		photos = append(photos, photoResponseFromRow(r, photo))
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"photos":  photos,
+			"missing": missing,
+		},
+	})
+}
+
+// Return the IDs of the photos before and after a photo in its category's
+// listing order, for lightbox navigation. The category defaults to the
+// photo's own; legacy files without a row must name it. Missing sides at the
+// start or end of the list are null.
+func photoNeighborsHandler(w http.ResponseWriter, r *http.Request) {
+	photoID := mux.Vars(r)["id"]
+
+	category := r.URL.Query().Get("category")
+	if category == "" {
+		photo, err := queries.GetPhoto(requestContext(r), photoID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !photoVisible(r, photo)) {
+			respondWithError(w, http.StatusBadRequest, "category is required for this photo")
+			return
+		}
+		if err != nil {
+			respondWithDatabaseError(w, err)
+			return
+		}
+		category = photo.Category
+	}
+	if !isValidCategory(category) {
+		respondInvalidCategory(w)
+		return
+	}
+
+	sortOrder := r.URL.Query().Get("sort")
+	if sortOrder != "" && sortOrder != "captured" {
+		respondWithError(w, http.StatusBadRequest, "Invalid sort option")
+		return
+	}
+
+	photos, ok := listCategoryPhotos(w, r, category, sortOrder)
+	if !ok {
+		return
+	}
+
+	for i, photo := range photos {
+		if photo.ID != photoID {
+			continue
+		}
+
+		var previous, next *string
+		if i > 0 {
+			previous = &photos[i-1].ID
+		}
+		if i < len(photos)-1 {
+			next = &photos[i+1].ID
+		}
+		respondWithJSON(w, http.StatusOK, Response{
+			Success: true,
+			Data: map[string]interface{}{
+				"previous": previous,
+				"next":     next,
+			},
+		})
+		return
+	}
+
+	respondWithError(w, http.StatusNotFound, "Photo not found")
+}
+
+// Update a photo's title, alt text, caption or slug
+func updatePhotoHandler(w http.ResponseWriter, r *http.Request) {
+	photoID := mux.Vars(r)["id"]
+	userID := r.Context().Value("userID").(int64)
+	ctx := requestContext(r)
+
+	var update PhotoUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+
+	photo, ok := loadOwnedPhoto(w, ctx, photoID, userID)
+	if !ok || !checkCategoryAccess(w, ctx, userID, photo.Category) {
+		return
+	}
+
+	params := db.UpdatePhotoMetadataParams{
+		ID:      photo.ID,
+		Title:   photo.Title,
+		AltText: photo.AltText,
+		Caption: photo.Caption,
+		Slug:    photo.Slug,
+	}
+	if update.Title != nil {
+		params.Title = *update.Title
+	}
+	if update.AltText != nil {
+		params.AltText = *update.AltText
+	}
+	if update.Caption != nil {
+		params.Caption = *update.Caption
+	}
+	if params.AltText == "" {
+		params.AltText = params.Title
+	}
+	if update.Slug != nil && *update.Slug != photo.Slug {
+		params.Slug = *update.Slug
+		if params.Slug != "" {
+			if problem := validateSlug(params.Slug); problem != "" {
+				respondWithValidationErrors(w, map[string]string{"slug": problem})
+				return
+			}
+			if !checkSlugAvailable(w, ctx, photo.Category, params.Slug, photo.ID) {
+				return
+			}
+		}
+	}
+
+	// Changing the cover touches other photos in the category, so the whole
+	// update runs in one transaction
+	tx, err := dbConn.Begin()
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := queries.WithTx(tx)
+	photo, err = qtx.UpdatePhotoMetadata(ctx, params)
+	if err == nil && update.Cover != nil && *update.Cover != photo.Cover {
+		photo, err = setPhotoCover(ctx, qtx, photo, *update.Cover)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	auditPhotoAction(ctx, userID, "update", photo.ID, photo.Title)
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Photo updated successfully",
+		Data:    photoResponseFromRow(r, photo),
+	})
+}
+
+// Publish a draft, making it visible to everyone
+func publishPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	setPhotoStatus(w, r, "published")
+}
+
+// Take a photo back to draft, hiding it from everyone but its owner
+func unpublishPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	setPhotoStatus(w, r, "draft")
+}
+
+// Change a photo's publication state. Setting the state it already has
+// succeeds without touching it.
+func setPhotoStatus(w http.ResponseWriter, r *http.Request, status string) {
+	photoID := mux.Vars(r)["id"]
+	userID := r.Context().Value("userID").(int64)
+	ctx := requestContext(r)
+
+	photo, ok := loadOwnedPhoto(w, ctx, photoID, userID)
+	if !ok || !checkCategoryAccess(w, ctx, userID, photo.Category) {
+		return
+	}
+	if photo.Status == status {
+		respondWithJSON(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Photo is already " + status,
+			Data:    photoResponseFromRow(r, photo),
+		})
+		return
+	}
+
+	photo, err := withRetry(ctx, func() (db.Photo, error) {
+		return queries.UpdatePhotoStatus(ctx, db.UpdatePhotoStatusParams{
+			Status: status,
+			ID:     photo.ID,
+		})
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	action := "publish"
+	if status == "draft" {
+		action = "unpublish"
+	}
+	auditPhotoAction(ctx, userID, action, photo.ID, photo.Title)
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Photo " + action + "ed successfully",
+		Data:    photoResponseFromRow(r, photo),
+	})
+}
+
+// Move a photo to another category without re-uploading it
+func movePhotoHandler(w http.ResponseWriter, r *http.Request) {
+	photoID := mux.Vars(r)["id"]
+	userID := r.Context().Value("userID").(int64)
+	ctx := requestContext(r)
+
+	var req MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if !isValidCategory(req.Category) {
+		respondInvalidCategory(w)
+		return
+	}
+
+	photo, ok := loadOwnedPhoto(w, ctx, photoID, userID)
+	if !ok || !checkCategoryAccess(w, ctx, userID, photo.Category) || !checkCategoryAccess(w, ctx, userID, req.Category) {
+		return
+	}
+	if photo.Category == req.Category {
+		respondWithJSON(w, http.StatusOK, Response{
+			Success: true,
+			Message: "Photo is already in that category",
+			Data:    photoResponseFromRow(r, photo),
+		})
+		return
+	}
+	if photo.Slug != "" && !checkSlugAvailable(w, ctx, req.Category, photo.Slug, photo.ID) {
+		return
+	}
+	if !checkCategoryCapacity(w, ctx, userID, req.Category, 1) {
+		return
+	}
+
+	// The destination has to accept the stored file's format, as it would
+	// an upload
+	oldPath := filepath.Join(photoDir, photo.Category, photo.Filename)
+	if format := storedImageFormat(oldPath); format != "" {
+		if problem := checkCategoryFormat(req.Category, format); problem != "" {
+			respondWithError(w, http.StatusUnsupportedMediaType, problem)
+			return
+		}
+	}
+
+	newPath := filepath.Join(photoDir, req.Category, photo.Filename)
+	if err := os.Rename(oldPath, newPath); err != nil {
+		respondWithInternalError(w, "Failed to move photo", err)
+		return
+	}
+
+	// Derivative paths are relative to the category directory, so they move
+	// along with the photo
+	oldDir := filepath.Join(photoDir, photo.Category)
+	newDir := filepath.Join(photoDir, req.Category)
+	moveDerivatives(oldDir, newDir, photoDerivatives(photo)...)
+
+	// Put the file back if the row can't be updated so the two stay in sync
+	moved, err := movePhotoWithinLimits(ctx, userID, db.UpdatePhotoCategoryParams{
+		ID:       photoID,
+		Category: req.Category,
+	})
+	if err != nil {
+		os.Rename(newPath, oldPath)
+		moveDerivatives(newDir, oldDir, photoDerivatives(photo)...)
+		var fullErr *categoryFullError
+		if errors.As(err, &fullErr) {
+			respondWithError(w, http.StatusConflict, fullErr.problem)
+			return
+		}
+		respondWithDatabaseError(w, err)
+		return
+	}
+	photo = moved
+	auditPhotoAction(ctx, userID, "move", photo.ID, photo.Title)
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Photo moved successfully",
+		Data:    photoResponseFromRow(r, photo),
+	})
+}
+
+// A photo whose files a move-batch request has moved, to put back if the
+// batch is rolled back
+type movedPhoto struct {
+	photo  db.Photo
+	oldDir string
+}
+
+// Move many photos into one category. The rows are updated in one
+// transaction; photos that can't be moved, such as ones the user doesn't own,
+// are reported in their result without stopping the rest. A database error
+// rolls back the whole batch and puts the moved files back.
+func movePhotosBatchHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+
+	var req MoveBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if len(req.IDs) == 0 || len(req.IDs) > maxMoveBatchSize {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("ids must list between 1 and %d photos", maxMoveBatchSize))
+		return
+	}
+	if !isValidCategory(req.Category) {
+		respondInvalidCategory(w)
+		return
+	}
+
+	ctx := requestContext(r)
+	if !checkCategoryAccess(w, ctx, userID, req.Category) {
+		return
+	}
+	admin, err := userIsAdmin(ctx, userID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := queries.WithTx(tx)
+
+	// Room left in the target, or -1 when it's uncapped for this user. It's
+	// counted in the transaction so concurrent moves can't overfill it.
+	room := int64(-1)
+	var limit int64
+	if !admin {
+		limit, err = categoryPhotoLimit(ctx, qtx, req.Category)
+		if err != nil {
+			respondWithDatabaseError(w, err)
+			return
+		}
+		if limit > 0 {
+			count, err := qtx.CountPhotosInCategory(ctx, req.Category)
+			if err != nil {
+				respondWithDatabaseError(w, err)
+				return
+			}
+			room = max(limit-count, 0)
+		}
+	}
+
+	// Put back the files of every photo moved so far
+	newDir := filepath.Join(photoDir, req.Category)
+	var moved []movedPhoto
+	undo := func() {
+		for _, m := range moved {
+			os.Rename(filepath.Join(newDir, m.photo.Filename), filepath.Join(m.oldDir, m.photo.Filename))
+			moveDerivatives(newDir, m.oldDir, photoDerivatives(m.photo)...)
+		}
+	}
+
+	results := make([]MoveBatchResult, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		result := MoveBatchResult{ID: id}
+		photo, err := qtx.GetPhoto(ctx, id)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			result.Error = "Photo not found"
+		case err != nil:
+			undo()
+			respondWithDatabaseError(w, err)
+			return
+		case photo.UserID != userID:
+			result.Error = "You can only edit your own photos"
+		case protectedCategories[photo.Category] && !admin:
+			result.Error = fmt.Sprintf("Only admins can change photos in the %s category", photo.Category)
+		}
+		if result.Error != "" || photo.Category == req.Category {
+			results = append(results, result)
+			continue
+		}
+
+		// Earlier photos of the batch already count against the slug and the
+		// cap, since the transaction sees its own updates
+		if photo.Slug != "" {
+			taken, err := qtx.CheckSlugExists(ctx, db.CheckSlugExistsParams{
+				Category: req.Category,
+				Slug:     photo.Slug,
+				ID:       photo.ID,
+			})
+			if err != nil {
+				undo()
+				respondWithDatabaseError(w, err)
+				return
+			}
+			if taken == 1 {
+				result.Error = "Slug already in use in this category"
+			}
+		}
+		oldDir := filepath.Join(photoDir, photo.Category)
+		oldPath := filepath.Join(oldDir, photo.Filename)
+		if result.Error == "" {
+			if format := storedImageFormat(oldPath); format != "" {
+				result.Error = checkCategoryFormat(req.Category, format)
+			}
+		}
+		if result.Error == "" && room == 0 {
+			result.Error = fmt.Sprintf("The %s category is full; it holds at most %d photos", req.Category, limit)
+		}
+		if result.Error != "" {
+			results = append(results, result)
+			continue
+		}
+
+		if err := os.Rename(oldPath, filepath.Join(newDir, photo.Filename)); err != nil {
+			slog.Error("Failed to move photo", "photo_id", photo.ID, "error", err)
+			result.Error = "Failed to move photo"
+			results = append(results, result)
+			continue
+		}
+		moveDerivatives(oldDir, newDir, photoDerivatives(photo)...)
+		moved = append(moved, movedPhoto{photo: photo, oldDir: oldDir})
+
+		_, err = qtx.UpdatePhotoCategory(ctx, db.UpdatePhotoCategoryParams{
+			ID:       photo.ID,
+			Category: req.Category,
+		})
+		if err != nil {
+			undo()
+			respondWithDatabaseError(w, err)
+			return
+		}
+		if room > 0 {
+			room--
+		}
+		result.Moved = true
+		results = append(results, result)
+	}
+
+	if err := tx.Commit(); err != nil {
+		undo()
+		respondWithDatabaseError(w, err)
+		return
+	}
+	for _, m := range moved {
+		auditPhotoAction(ctx, userID, "move", m.photo.ID, m.photo.Title)
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Moved %d photos", len(moved)),
+		Data: map[string]interface{}{
+			"moved":   len(moved),
+			"results": results,
+		},
+	})
+}
+
+// Copy a photo into a category, as a new photo of the same owner with its
+// own ID, files and metadata. The slug is kept when it's free in the target
+// category; views, cover and version start afresh.
+func copyPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	photoID := mux.Vars(r)["id"]
+	userID := r.Context().Value("userID").(int64)
+	ctx := requestContext(r)
+
+	var req MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if !isValidCategory(req.Category) {
+		respondInvalidCategory(w)
+		return
+	}
+
+	photo, ok := loadOwnedPhoto(w, ctx, photoID, userID)
+	if !ok || !checkCategoryAccess(w, ctx, userID, photo.Category) || !checkCategoryAccess(w, ctx, userID, req.Category) {
+		return
+	}
+
+	// The target has to accept the stored file's format, as it would an
+	// upload
+	srcDir := filepath.Join(photoDir, photo.Category)
+	if format := storedImageFormat(filepath.Join(srcDir, photo.Filename)); format != "" {
+		if problem := checkCategoryFormat(req.Category, format); problem != "" {
+			respondWithError(w, http.StatusUnsupportedMediaType, problem)
+			return
+		}
+	}
+
+	if !checkCategoryCapacity(w, ctx, userID, req.Category, 1) {
+		return
+	}
+	quotaMessage, err := checkUploadQuota(ctx, queries, userID, 1, photo.SizeBytes)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if quotaMessage != "" {
+		respondWithError(w, http.StatusRequestEntityTooLarge, quotaMessage)
+		return
+	}
+
+	slug := photo.Slug
+	if slug != "" {
+		taken, err := queries.CheckSlugExists(ctx, db.CheckSlugExistsParams{
+			Category: req.Category,
+			Slug:     slug,
+		})
+		if err != nil {
+			respondWithDatabaseError(w, err)
+			return
+		}
+		if taken == 1 {
+			slug = ""
+		}
+	}
+
+	// Files are named after the photo ID, derivatives included
+	newID, err := generatePhotoID(ctx)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	rename := func(name string) string {
+		if name == "" {
+			return ""
+		}
+		return filepath.Join(filepath.Dir(name), strings.Replace(filepath.Base(name), photo.ID, newID, 1))
+	}
+
+	destDir := filepath.Join(photoDir, req.Category)
+	copied, err := copyPhotoFiles(srcDir, destDir, photo, rename)
+	if err != nil {
+		respondWithInternalError(w, "Failed to copy photo", err)
+		return
+	}
+
+	// Remove the copied files if the row can't be created so none are
+	// orphaned
+	created, err := createPhotoWithinLimits(ctx, db.CreatePhotoParams{
+		ID:               newID,
+		UserID:           userID,
+		Filename:         rename(photo.Filename),
+		Title:            photo.Title,
+		Category:         req.Category,
+		SizeBytes:        photo.SizeBytes,
+		CapturedAt:       photo.CapturedAt,
+		AltText:          photo.AltText,
+		Caption:          photo.Caption,
+		Colors:           photo.Colors,
+		Blurhash:         photo.Blurhash,
+		Thumbnail:        rename(photo.Thumbnail),
+		Original:         rename(photo.Original),
+		Slug:             slug,
+		OriginalFilename: photo.OriginalFilename,
+		Presets:          photo.Presets,
+		Width:            photo.Width,
+		Height:           photo.Height,
+		Status:           photo.Status,
+		Tags:             photo.Tags,
+	})
+	var quotaErr *quotaExceededError
+	if errors.As(err, &quotaErr) {
+		removeDerivatives(destDir, copied...)
+		respondWithError(w, http.StatusRequestEntityTooLarge, quotaErr.problem)
+		return
+	}
+	var fullErr *categoryFullError
+	if errors.As(err, &fullErr) {
+		removeDerivatives(destDir, copied...)
+		respondWithError(w, http.StatusConflict, fullErr.problem)
+		return
+	}
+	if err != nil {
+		removeDerivatives(destDir, copied...)
+		respondWithDatabaseError(w, err)
+		return
+	}
+	auditPhotoAction(ctx, userID, "copy", created.ID, created.Title)
+
+	respondWithJSON(w, http.StatusCreated, Response{
+		Success: true,
+		Message: "Photo copied successfully",
+		Data:    photoResponseFromRow(r, created),
+	})
+}
+
+// Copy a photo's file and derivatives from srcDir to destDir under the names
+// rename gives them, returning the copied paths relative to destDir.
+// Derivatives missing from disk are skipped. On failure nothing copied is
+// left behind.
+func copyPhotoFiles(srcDir, destDir string, photo db.Photo, rename func(string) string) ([]string, error) {
+	copied := []string{}
+	for i, name := range append([]string{photo.Filename}, photoDerivatives(photo)...) {
+		if name == "" {
+			continue
+		}
+		dest := rename(name)
+		err := copyFile(filepath.Join(srcDir, name), filepath.Join(destDir, dest))
+		if i > 0 && os.IsNotExist(err) {
+			slog.Warn("Derivative to copy is missing", "photo_id", photo.ID, "path", name)
+			continue
+		}
+		if err != nil {
+			removeDerivatives(destDir, copied...)
+			return nil, err
+		}
+		copied = append(copied, dest)
+	}
+	return copied, nil
+}
+
+// Copy a file to a new path, creating its directory. The destination must
+// not exist yet.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dest)
+	}
+	return err
+}
+
+// Replace a photo's file, keeping its ID and metadata. Derivatives are
+// regenerated and the version bumped so clients can drop cached copies. The
+// old file is set aside until the new one is recorded, and restored if that
+// fails.
+func replacePhotoFileHandler(w http.ResponseWriter, r *http.Request) {
+	photoID := mux.Vars(r)["id"]
+	userID := r.Context().Value("userID").(int64)
+	ctx := requestContext(r)
+
+	photo, ok := loadOwnedPhoto(w, ctx, photoID, userID)
+	if !ok || !checkCategoryAccess(w, ctx, userID, photo.Category) {
+		return
+	}
+
+	form, ok := readUploadForm(w, r)
+	if !ok {
+		return
+	}
+	defer form.cleanup()
+
+	quotaMessage, err := checkUploadQuota(ctx, queries, userID, 0, form.size-photo.SizeBytes)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if quotaMessage != "" {
+		respondWithError(w, http.StatusRequestEntityTooLarge, quotaMessage)
+		return
+	}
+
+	release, err := acquireImageSlot(r.Context())
+	if err != nil {
+		respondImageBusy(w)
+		return
+	}
+	defer release()
+
+	if problem := checkUploadFormat(form.tempPath); problem != "" {
+		respondWithError(w, http.StatusUnsupportedMediaType, problem)
+		return
+	}
+
+	// A file that doesn't decode is rejected before the current one is
+	// touched
+	img, format, err := decodeImageFile(form.tempPath)
+	if errors.Is(err, errCorruptImage) {
+		respondWithError(w, http.StatusBadRequest, errCorruptImage.Error())
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, "Failed to replace file", err)
+		return
+	}
+	if problem := checkCategoryFormat(photo.Category, format); problem != "" {
+		respondWithError(w, http.StatusUnsupportedMediaType, problem)
+		return
+	}
+
+	categoryDir := filepath.Join(photoDir, photo.Category)
+	oldPath := filepath.Join(categoryDir, photo.Filename)
+	backupPath := filepath.Join(categoryDir, "."+photo.Filename+".replaced")
+	if err := os.Rename(oldPath, backupPath); err != nil && !os.IsNotExist(err) {
+		respondWithInternalError(w, "Failed to replace file", err)
+		return
+	}
+	restore := func() {
+		os.Rename(backupPath, oldPath)
+	}
+
+	originalFilename := ""
+	if preserveFilenames {
+		originalFilename = sanitizeFilename(form.filename)
+	}
+	filename := photo.ID + formatExtensions[format]
+	destPath := filepath.Join(categoryDir, filename)
+	if err := form.moveTo(destPath); err != nil {
+		restore()
+		respondWithInternalError(w, "Failed to replace file", err)
+		return
+	}
+	written := form.size
+
+	var capturedAt sql.NullTime
+	if t, ok := readCaptureTime(destPath); ok {
+		capturedAt = sql.NullTime{Time: t, Valid: true}
+	}
+
+	var original string
+	if format == "tiff" {
+		destPath, img, original, err = convertImageFile(destPath, img)
+		filename = filepath.Base(destPath)
+	} else {
+		img, original, err = downscaleImageFile(destPath, img, format)
+	}
+	if err != nil {
+		os.Remove(destPath)
+		restore()
+		respondWithInternalError(w, "Failed to replace file", err)
+		return
+	}
+	if info, err := os.Stat(destPath); err == nil {
+		written = info.Size()
+	}
+	colors := extractPalette(img, paletteSize)
+	blurhash := encodeBlurhash(img)
+
+	// Thumbnails are named after the photo ID, so the path is known before
+	// the new one is written
+	thumbnail := filepath.Join(thumbnailDir, photo.ID+".jpg")
+
+	updated, err := withRetry(ctx, func() (db.Photo, error) {
+		return queries.ReplacePhotoFile(ctx, db.ReplacePhotoFileParams{
+			Filename:         filename,
+			SizeBytes:        written,
+			CapturedAt:       capturedAt,
+			Colors:           strings.Join(colors, ","),
+			Blurhash:         blurhash,
+			Thumbnail:        thumbnail,
+			Original:         original,
+			ID:               photo.ID,
+			OriginalFilename: originalFilename,
+			Presets:          presetsSpec,
+			Width:            int64(img.Bounds().Dx()),
+			Height:           int64(img.Bounds().Dy()),
+		})
+	})
+	if err != nil {
+		os.Remove(destPath)
+		if original != photo.Original {
+			removeDerivatives(categoryDir, original)
+		}
+		restore()
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	auditPhotoAction(ctx, userID, "replace", updated.ID, updated.Title)
+
+	// The new file is recorded; drop what it replaced
+	os.Remove(backupPath)
+	removeResizeCache(photo.ID)
+	if photo.Original != "" && photo.Original != original {
+		removeDerivatives(categoryDir, photo.Original)
+	}
+	if _, err := writeThumbnail(img, categoryDir, photo.ID); err != nil {
+		slog.Error("Failed to write thumbnail", "photo_id", photo.ID, "error", err)
+	}
+	presetPaths, err := writePresets(img, categoryDir, photo.ID)
+	if err != nil {
+		slog.Error("Failed to write presets", "photo_id", photo.ID, "error", err)
+	}
+	for _, name := range presetFiles(photo.ID, photo.Presets) {
+		if !slices.Contains(presetPaths, name) {
+			removeDerivatives(categoryDir, name)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Photo file replaced successfully",
+		Data:    photoResponseFromRow(r, updated),
+	})
+}
+
+// Regenerate a photo's thumbnail, presets, blurhash, palette and dimensions
+// from its stored file, such as after a fix to how they're made. The file
+// itself is left as it is.
+func reprocessPhotoHandler(w http.ResponseWriter, r *http.Request) {
+	photoID := mux.Vars(r)["id"]
+	userID := r.Context().Value("userID").(int64)
+	ctx := requestContext(r)
+
+	photo, ok := loadOwnedPhoto(w, ctx, photoID, userID)
+	if !ok || !checkCategoryAccess(w, ctx, userID, photo.Category) {
+		return
+	}
+
+	release, err := acquireImageSlot(r.Context())
+	if err != nil {
+		respondImageBusy(w)
+		return
+	}
+	defer release()
+
+	categoryDir := filepath.Join(photoDir, photo.Category)
+	img, _, err := decodeImageFile(filepath.Join(categoryDir, photo.Filename))
+	if os.IsNotExist(err) {
+		respondWithError(w, http.StatusConflict, "Photo file is missing")
+		return
+	}
+	if err != nil {
+		respondWithInternalError(w, "Failed to read photo", err)
+		return
+	}
+
+	thumbnail, err := writeThumbnail(img, categoryDir, photo.ID)
+	if err != nil {
+		respondWithInternalError(w, "Failed to write thumbnail", err)
+		return
+	}
+	presets := presetsSpec
+	presetPaths, err := writePresets(img, categoryDir, photo.ID)
+	if err != nil {
+		slog.Error("Failed to write presets", "photo_id", photo.ID, "error", err)
+		presets = ""
+	}
+
+	updated, err := withRetry(ctx, func() (db.Photo, error) {
+		return queries.UpdatePhotoDerivatives(ctx, db.UpdatePhotoDerivativesParams{
+			Colors:    strings.Join(extractPalette(img, paletteSize), ","),
+			Blurhash:  encodeBlurhash(img),
+			Thumbnail: thumbnail,
+			Presets:   presets,
+			Width:     int64(img.Bounds().Dx()),
+			Height:    int64(img.Bounds().Dy()),
+			ID:        photo.ID,
+		})
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	auditPhotoAction(ctx, userID, "reprocess", updated.ID, updated.Title)
+
+	// Resized copies were made from the old derivatives' version, and presets
+	// no longer configured are left over
+	removeResizeCache(photo.ID)
+	for _, name := range presetFiles(photo.ID, photo.Presets) {
+		if !slices.Contains(presetPaths, name) {
+			removeDerivatives(categoryDir, name)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Photo reprocessed successfully",
+		Data:    photoResponseFromRow(r, updated),
+	})
+}
+
+// Serve a photo resized to the requested width and/or height. fit=contain
+// (the default) scales the image to fit within the box; fit=cover fills the
+// box exactly, cropping the overflow, and needs both dimensions. Results are
+// cached on disk per photo version.
+func photoImageHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	parseDimension := func(name string) (int, bool) {
+		value := query.Get(name)
+		if value == "" {
+			return 0, true
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxResizeDimension {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("%s must be between 1 and %d", name, maxResizeDimension))
+			return 0, false
+		}
+		return n, true
+	}
+	width, ok := parseDimension("w")
+	if !ok {
+		return
+	}
+	height, ok := parseDimension("h")
+	if !ok {
+		return
+	}
+	if width == 0 && height == 0 {
+		respondWithError(w, http.StatusBadRequest, "w or h is required")
+		return
+	}
+
+	fit := query.Get("fit")
+	if fit == "" {
+		fit = "contain"
+	}
+	if fit != "contain" && fit != "cover" {
+		respondWithError(w, http.StatusBadRequest, "fit must be contain or cover")
+		return
+	}
+	if fit == "cover" && (width == 0 || height == 0) {
+		respondWithError(w, http.StatusBadRequest, "fit=cover needs both w and h")
+		return
+	}
+
+	photo, err := queries.GetPhoto(requestContext(r), mux.Vars(r)["id"])
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !photoVisible(r, photo)) {
+		respondWithError(w, http.StatusNotFound, "Photo not found")
+		return
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	// Keep transparency for formats that may have it
+	format, ext := "jpeg", ".jpg"
+	switch strings.ToLower(filepath.Ext(photo.Filename)) {
+	case ".png", ".gif":
+		format, ext = "png", ".png"
+	}
+
+	key := fmt.Sprintf("%s-v%d-%dx%d-%s", photo.ID, photo.Version, width, height, fit)
+	cachePath := filepath.Join(photoDir, resizeCacheDir, key+ext)
+
+	if _, err := os.Stat(cachePath); err != nil {
+		release, err := acquireImageSlot(r.Context())
+		if err != nil {
+			respondImageBusy(w)
+			return
+		}
+		defer release()
+
+		img, _, err := decodeImageFile(filepath.Join(photoDir, photo.Category, photo.Filename))
+		if err != nil {
+			respondWithError(w, http.StatusUnprocessableEntity, "Photo can't be resized")
+			return
+		}
+
+		if fit == "cover" {
+			img = resizeCover(img, width, height)
+		} else {
+			img = resizeContain(img, width, height)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+			respondWithInternalError(w, "Failed to resize photo", err)
+			return
+		}
+		// Write under a temporary name so concurrent requests never serve a
+		// partially written file
+		tmpPath := cachePath + ".tmp" + generateID()[:8] + ext
+		if err := encodeImageFile(tmpPath, img, format); err != nil {
+			os.Remove(tmpPath)
+			respondWithInternalError(w, "Failed to resize photo", err)
+			return
+		}
+		if err := os.Rename(tmpPath, cachePath); err != nil {
+			os.Remove(tmpPath)
+			respondWithInternalError(w, "Failed to resize photo", err)
+			return
+		}
+	}
+
+	recordView(r, photo.ID)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("ETag", `"`+key+`"`)
+	http.ServeFile(w, r, cachePath)
+}
+
+// Compute blurhashes for photos stored before they were generated on upload
+func regenerateBlurhashHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := requestContext(r)
+
+	photos, err := queries.ListPhotosWithoutBlurhash(ctx)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	// The photos are processed one at a time, holding a single slot
+	release, err := acquireImageSlot(r.Context())
+	if err != nil {
+		respondImageBusy(w)
+		return
+	}
+	defer release()
+
+	updated := 0
+	failed := []string{}
+	for _, photo := range photos {
+		img, _, err := decodeImageFile(filepath.Join(photoDir, photo.Category, photo.Filename))
+		if err != nil {
+			failed = append(failed, photo.ID)
+			continue
+		}
+
+		err = execWithRetry(ctx, func() error {
+			return queries.UpdatePhotoBlurhash(ctx, db.UpdatePhotoBlurhashParams{
+				ID:       photo.ID,
+				Blurhash: encodeBlurhash(img),
+			})
+		})
+		if err != nil {
+			respondWithDatabaseError(w, err)
+			return
+		}
+		updated++
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Regenerated %d blurhashes", updated),
+		Data: map[string]interface{}{
+			"updated": updated,
+			"failed":  failed,
+		},
+	})
+}
+
+// PhotoDerivatives names the derivatives a photo is missing
+type PhotoDerivatives struct {
+	ID       string   `json:"id"`
+	Category string   `json:"category"`
+	Filename string   `json:"filename"`
+	Missing  []string `json:"missing"`
+}
+
+// List photos lacking a thumbnail, blurhash, palette or current presets,
+// such as legacy uploads, so backfills can target them (admin only)
+func listMissingDerivativesHandler(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	photos, err := queries.ListPhotosMissingDerivatives(requestContext(r), presetsSpec)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	start, end := pageBounds(len(photos), page, pageSize)
+	results := make([]PhotoDerivatives, 0, end-start)
+	for _, photo := range photos[start:end] {
+		missing := []string{}
+		if photo.Thumbnail == "" {
+			missing = append(missing, "thumbnail")
+		}
+		if photo.Blurhash == "" {
+			missing = append(missing, "blurhash")
+		}
+		if photo.Colors == "" {
+			missing = append(missing, "colors")
+		}
+		if photo.Presets != presetsSpec {
+			missing = append(missing, "presets")
+		}
+		results = append(results, PhotoDerivatives{
+			ID:       photo.ID,
+			Category: photo.Category,
+			Filename: photo.Filename,
+			Missing:  missing,
+		})
+	}
+
+	setPaginationHeaders(w, r, page, pageSize, int64(len(photos)))
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    newPaginatedResponse(results, page, pageSize, int64(len(photos))),
+	})
+}
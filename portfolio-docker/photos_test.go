@@ -0,0 +1,845 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// Replace a photo's file
+func replaceFile(t *testing.T, token, photoID, filename, contentType string, file []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	formType, body := multipartBody(t, filename, contentType, file, nil)
+	return doRequest(t, "PUT", "/api/photos/"+photoID+"/file", token, formType, body)
+}
+
+func TestReplacePhotoFileKeepsIdentity(t *testing.T) {
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+
+	tests := []struct {
+		name        string
+		filename    string
+		contentType string
+		file        []byte
+		wantExt     string
+	}{
+		{"png named as html", "x.html", "image/png", testPNG(t, 10, 10, color.RGBA{0, 0, 255, 255}), ".png"},
+		{"tiff converted", "scan.tiff", "image/tiff", testTIFF(t, 12, 12), ".jpg"},
+	}
+	version := photo.Version
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := replaceFile(t, user.token, photo.ID, tt.filename, tt.contentType, tt.file)
+			expectStatus(t, rec, http.StatusOK)
+
+			var replaced PhotoResponse
+			decodeResponse(t, rec, &replaced)
+			if replaced.ID != photo.ID || replaced.Title != photo.Title {
+				t.Errorf("replaced photo is %q %q, want %q %q", replaced.ID, replaced.Title, photo.ID, photo.Title)
+			}
+			if want := photo.ID + tt.wantExt; replaced.Filename != want {
+				t.Errorf("stored as %q, want %q", replaced.Filename, want)
+			}
+			if replaced.Version <= version {
+				t.Errorf("version = %d, want more than %d", replaced.Version, version)
+			}
+			version = replaced.Version
+
+			if format := storedImageFormat(filepath.Join(photoDir, "photography", replaced.Filename)); formatExtensions[format] != tt.wantExt {
+				t.Errorf("stored file is %q, want %s", format, tt.wantExt)
+			}
+		})
+	}
+}
+
+func TestReplacePhotoFileRequiresOwner(t *testing.T) {
+	owner := newTestUser(t)
+	other := newTestUser(t)
+	photo := uploadTestPhoto(t, owner.token, "photography")
+
+	rec := replaceFile(t, other.token, photo.ID, "x.png", "image/png", testPNG(t, 8, 8, testColor))
+	if rec.Code == http.StatusOK {
+		t.Fatalf("another user replaced the file: %s", rec.Body.String())
+	}
+}
+
+func TestCORSPreflightAllowsPatch(t *testing.T) {
+	rec := doRequest(t, "OPTIONS", "/api/photos/some-id", "", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	if methods := rec.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(methods, "PATCH") {
+		t.Errorf("Access-Control-Allow-Methods = %q, want PATCH included", methods)
+	}
+}
+
+func TestUploadAltTextDefaultsToTitle(t *testing.T) {
+	user := newTestUser(t)
+	tests := []struct {
+		name    string
+		altText string
+		want    string
+	}{
+		{"omitted", "", "Sunset"},
+		{"given", "Red sky over the bay", "Red sky over the bay"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := map[string]string{
+				uploadTitleField:    "Sunset",
+				uploadCategoryField: "photography",
+			}
+			if tt.altText != "" {
+				fields["altText"] = tt.altText
+			}
+			contentType, body := multipartBody(t, "sunset.png", "image/png", testPNG(t, 8, 8, testColor), fields)
+			rec := doRequest(t, "POST", "/api/photos/upload", user.token, contentType, body)
+			expectStatus(t, rec, http.StatusCreated)
+
+			var photo PhotoResponse
+			decodeResponse(t, rec, &photo)
+			if photo.AltText != tt.want {
+				t.Errorf("altText = %q, want %q", photo.AltText, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdatePhotoAltText(t *testing.T) {
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+	strptr := func(s string) *string { return &s }
+
+	tests := []struct {
+		name   string
+		update PhotoUpdate
+		want   string
+	}{
+		{"set", PhotoUpdate{AltText: strptr("A red square")}, "A red square"},
+		{"other field left alone", PhotoUpdate{Caption: strptr("Caption")}, "A red square"},
+		{"cleared falls back to title", PhotoUpdate{AltText: strptr("")}, photo.Title},
+		{"cleared with new title", PhotoUpdate{Title: strptr("Renamed"), AltText: strptr("")}, "Renamed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, "PATCH", "/api/photos/"+photo.ID, user.token, tt.update)
+			expectStatus(t, rec, http.StatusOK)
+
+			var updated PhotoResponse
+			decodeResponse(t, rec, &updated)
+			if updated.AltText != tt.want {
+				t.Errorf("altText = %q, want %q", updated.AltText, tt.want)
+			}
+		})
+	}
+}
+
+func TestListMissingDerivatives(t *testing.T) {
+	admin := newTestAdmin(t)
+	complete := uploadTestPhoto(t, admin.token, "photography")
+
+	// Rows created straight in the database have no derivatives, as legacy
+	// uploads don't
+	legacy := []string{}
+	for i := range 2 {
+		id := fmt.Sprintf("legacy-%d-%d", admin.id, i)
+		_, err := queries.CreatePhoto(context.Background(), db.CreatePhotoParams{
+			ID:       id,
+			UserID:   admin.id,
+			Filename: id + ".jpg",
+			Title:    "Legacy",
+			Category: "photography",
+			Presets:  presetsSpec,
+			Status:   defaultPhotoStatus,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		legacy = append(legacy, id)
+	}
+
+	type page struct {
+		Items    []PhotoDerivatives `json:"items"`
+		Total    int64              `json:"total"`
+		PageSize int                `json:"pageSize"`
+		HasMore  bool               `json:"hasMore"`
+	}
+
+	// Every page, collected
+	listed := map[string]PhotoDerivatives{}
+	for n := 1; ; n++ {
+		rec := doJSON(t, "GET", fmt.Sprintf("/api/admin/photos/missing-derivatives?page=%d&pageSize=%d", n, maxPageSize), admin.token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var p page
+		decodeResponse(t, rec, &p)
+		for _, item := range p.Items {
+			listed[item.ID] = item
+		}
+		if !p.HasMore {
+			if int64(len(listed)) != p.Total {
+				t.Errorf("listed %d photos across pages, total is %d", len(listed), p.Total)
+			}
+			break
+		}
+	}
+	if _, ok := listed[complete.ID]; ok {
+		t.Errorf("photo with derivatives %s listed", complete.ID)
+	}
+	for _, id := range legacy {
+		item, ok := listed[id]
+		if !ok {
+			t.Errorf("legacy photo %s not listed", id)
+			continue
+		}
+		if want := []string{"thumbnail", "blurhash", "colors"}; !slices.Equal(item.Missing, want) {
+			t.Errorf("%s missing %v, want %v", id, item.Missing, want)
+		}
+	}
+
+	// A page of one
+	rec := doJSON(t, "GET", "/api/admin/photos/missing-derivatives?pageSize=1", admin.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var p page
+	decodeResponse(t, rec, &p)
+	if len(p.Items) != 1 || p.PageSize != 1 || !p.HasMore || p.Total < 2 {
+		t.Errorf("got %d items of %d, hasMore %v; want 1 with more", len(p.Items), p.Total, p.HasMore)
+	}
+	if rec.Header().Get("Link") == "" || rec.Header().Get("X-Total-Count") == "" {
+		t.Error("pagination headers missing")
+	}
+
+	rec = doJSON(t, "GET", "/api/admin/photos/missing-derivatives?page=0", admin.token, nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestMovePhoto(t *testing.T) {
+	owner := newTestUser(t)
+	other := newTestUser(t)
+	photo := uploadTestPhoto(t, owner.token, "photography")
+
+	rec := doJSON(t, "POST", "/api/photos/"+photo.ID+"/move", other.token, MoveRequest{Category: "digital-sketches"})
+	expectStatus(t, rec, http.StatusForbidden)
+	rec = doJSON(t, "POST", "/api/photos/"+photo.ID+"/move", owner.token, MoveRequest{Category: "paintings"})
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	rec = doJSON(t, "POST", "/api/photos/"+photo.ID+"/move", owner.token, MoveRequest{Category: "digital-sketches"})
+	expectStatus(t, rec, http.StatusOK)
+	var moved PhotoResponse
+	decodeResponse(t, rec, &moved)
+	if moved.ID != photo.ID || moved.Category != "digital-sketches" {
+		t.Errorf("moved photo is %s in %s, want %s in digital-sketches", moved.ID, moved.Category, photo.ID)
+	}
+
+	row, err := queries.GetPhoto(context.Background(), photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range append([]string{row.Filename}, photoDerivatives(row)...) {
+		if name == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(photoDir, "digital-sketches", name)); err != nil {
+			t.Errorf("%s not moved: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(photoDir, "photography", name)); !os.IsNotExist(err) {
+			t.Errorf("%s left in the old category", name)
+		}
+	}
+}
+
+// photoPage is a page of a paginated photo listing
+type photoPage struct {
+	Items   []PhotoResponse `json:"items"`
+	Total   int64           `json:"total"`
+	HasMore bool            `json:"hasMore"`
+}
+
+// Fetch a page of a photo listing
+func listPhotos(t *testing.T, path, token string) photoPage {
+	t.Helper()
+	rec := doJSON(t, "GET", path, token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var page photoPage
+	decodeResponse(t, rec, &page)
+	return page
+}
+
+func TestListMyPhotos(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	uploadTestPhoto(t, user.token, "photography")
+	uploadTestPhoto(t, user.token, "photography")
+	uploadTestPhoto(t, user.token, "digital-sketches")
+	uploadTestPhoto(t, other.token, "photography")
+
+	tests := []struct {
+		name        string
+		query       string
+		wantItems   int
+		wantTotal   int64
+		wantHasMore bool
+	}{
+		{"all categories", "", 3, 3, false},
+		{"one category", "?category=photography", 2, 2, false},
+		{"first page", "?pageSize=2", 2, 3, true},
+		{"second page", "?pageSize=2&page=2", 1, 3, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := listPhotos(t, "/api/profile/photos"+tt.query, user.token)
+			if len(page.Items) != tt.wantItems || page.Total != tt.wantTotal || page.HasMore != tt.wantHasMore {
+				t.Errorf("got %d items of %d, hasMore %v; want %d of %d, hasMore %v",
+					len(page.Items), page.Total, page.HasMore, tt.wantItems, tt.wantTotal, tt.wantHasMore)
+			}
+			for _, photo := range page.Items {
+				if photo.UserID != user.id {
+					t.Errorf("listed photo %s of user %d", photo.ID, photo.UserID)
+				}
+			}
+		})
+	}
+
+	rec := doJSON(t, "GET", "/api/profile/photos?category=paintings", user.token, nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = doJSON(t, "GET", "/api/profile/photos", "", nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+}
+
+func TestBatchGetPhotos(t *testing.T) {
+	user := newTestUser(t)
+	first := uploadTestPhoto(t, user.token, "photography")
+	second := uploadTestPhoto(t, user.token, "digital-sketches")
+
+	rec := doJSON(t, "POST", "/api/photos/batch-get", "", BatchGetRequest{IDs: []string{second.ID, "no-such-photo", first.ID}})
+	expectStatus(t, rec, http.StatusOK)
+	var batch struct {
+		Photos  []PhotoResponse `json:"photos"`
+		Missing []string        `json:"missing"`
+	}
+	decodeResponse(t, rec, &batch)
+	if len(batch.Photos) != 2 || batch.Photos[0].ID != second.ID || batch.Photos[1].ID != first.ID {
+		t.Errorf("photos = %v, want %s then %s", batch.Photos, second.ID, first.ID)
+	}
+	if !slices.Equal(batch.Missing, []string{"no-such-photo"}) {
+		t.Errorf("missing = %v, want [no-such-photo]", batch.Missing)
+	}
+
+	rec = doJSON(t, "POST", "/api/photos/batch-get", "", BatchGetRequest{})
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = doJSON(t, "POST", "/api/photos/batch-get", "", BatchGetRequest{IDs: make([]string, maxBatchGetSize+1)})
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestPhotoImageResize(t *testing.T) {
+	user := newTestUser(t)
+	rec := uploadFile(t, user.token, "photography", "wide.png", testPNG(t, 40, 20, testColor))
+	expectStatus(t, rec, http.StatusCreated)
+	var photo PhotoResponse
+	decodeResponse(t, rec, &photo)
+	path := "/api/photos/" + photo.ID + "/image"
+
+	tests := []struct {
+		query        string
+		wantW, wantH int
+	}{
+		{"?w=20", 20, 10},
+		{"?h=5", 10, 5},
+		{"?w=10&h=10", 10, 5},
+		{"?w=10&h=10&fit=cover", 10, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := doRequest(t, "GET", path+tt.query, "", "", nil)
+			expectStatus(t, rec, http.StatusOK)
+			config, format, err := image.DecodeConfig(rec.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if format != "png" || config.Width != tt.wantW || config.Height != tt.wantH {
+				t.Errorf("got a %dx%d %s, want a %dx%d png", config.Width, config.Height, format, tt.wantW, tt.wantH)
+			}
+
+			// Served from the cache the second time
+			again := doRequest(t, "GET", path+tt.query, "", "", nil)
+			expectStatus(t, again, http.StatusOK)
+			if again.Header().Get("ETag") != rec.Header().Get("ETag") {
+				t.Errorf("ETag changed from %q to %q", rec.Header().Get("ETag"), again.Header().Get("ETag"))
+			}
+		})
+	}
+
+	for _, query := range []string{"", "?w=0", "?w=abc", fmt.Sprintf("?w=%d", maxResizeDimension+1), "?w=10&fit=fill", "?w=10&fit=cover"} {
+		t.Run("invalid "+query, func(t *testing.T) {
+			rec := doRequest(t, "GET", path+query, "", "", nil)
+			expectStatus(t, rec, http.StatusBadRequest)
+		})
+	}
+	rec = doRequest(t, "GET", "/api/photos/no-such-photo/image?w=10", "", "", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestPhotoNeighbors(t *testing.T) {
+	user := newTestUser(t)
+	for range 3 {
+		uploadTestPhoto(t, user.token, "digital-sketches")
+	}
+	listing := listPhotos(t, fmt.Sprintf("/api/photos/digital-sketches?pageSize=%d", maxPageSize), "").Items
+	if len(listing) < 3 || len(listing) == maxPageSize {
+		t.Fatalf("listed %d photos, want 3 or more on one page", len(listing))
+	}
+
+	neighbors := func(id, query string) (previous, next *string) {
+		t.Helper()
+		rec := doJSON(t, "GET", "/api/photos/"+id+"/neighbors"+query, "", nil)
+		expectStatus(t, rec, http.StatusOK)
+		var data struct {
+			Previous *string `json:"previous"`
+			Next     *string `json:"next"`
+		}
+		decodeResponse(t, rec, &data)
+		return data.Previous, data.Next
+	}
+
+	last := len(listing) - 1
+	if previous, next := neighbors(listing[0].ID, ""); previous != nil || next == nil || *next != listing[1].ID {
+		t.Errorf("first photo: previous %v, next %v; want none and %s", previous, next, listing[1].ID)
+	}
+	if previous, next := neighbors(listing[1].ID, ""); previous == nil || *previous != listing[0].ID || next == nil || *next != listing[2].ID {
+		t.Errorf("second photo: previous %v, next %v; want %s and %s", previous, next, listing[0].ID, listing[2].ID)
+	}
+	if previous, next := neighbors(listing[last].ID, "?category=digital-sketches"); previous == nil || *previous != listing[last-1].ID || next != nil {
+		t.Errorf("last photo: previous %v, next %v; want %s and none", previous, next, listing[last-1].ID)
+	}
+
+	rec := doJSON(t, "GET", "/api/photos/no-such-photo/neighbors", "", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+	rec = doJSON(t, "GET", "/api/photos/no-such-photo/neighbors?category=digital-sketches", "", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+	rec = doJSON(t, "GET", "/api/photos/"+listing[0].ID+"/neighbors?sort=sideways", "", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestDraftPhotos(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	old := defaultPhotoStatus
+	defaultPhotoStatus = "draft"
+	t.Cleanup(func() { defaultPhotoStatus = old })
+
+	const listing = "/api/photos/photography?pageSize=1"
+	publicTotal := listPhotos(t, listing, "").Total
+	ownerTotal := listPhotos(t, listing, user.token).Total
+	photo := uploadTestPhoto(t, user.token, "photography")
+	if photo.Status != "draft" {
+		t.Fatalf("uploaded with status %q, want draft", photo.Status)
+	}
+
+	// Hidden from everyone but the owner
+	expectVisible := func(visible bool) {
+		t.Helper()
+		wantPublic, wantOwner := publicTotal, ownerTotal+1
+		if visible {
+			wantPublic++
+		}
+		if got := listPhotos(t, listing, "").Total; got != wantPublic {
+			t.Errorf("anonymous listing has %d photos, want %d", got, wantPublic)
+		}
+		if got := listPhotos(t, listing, user.token).Total; got != wantOwner {
+			t.Errorf("owner's listing has %d photos, want %d", got, wantOwner)
+		}
+		status := http.StatusNotFound
+		if visible {
+			status = http.StatusOK
+		}
+		expectStatus(t, doJSON(t, "GET", "/api/photos/photography/"+photo.ID, "", nil), status)
+		expectStatus(t, doJSON(t, "GET", "/api/photos/photography/"+photo.ID, other.token, nil), status)
+		expectStatus(t, doJSON(t, "GET", "/api/photos/photography/"+photo.ID, user.token, nil), http.StatusOK)
+
+		// Its files too, and the anonymous change feed doesn't list it
+		for _, file := range []string{photo.Filename, thumbnailDir + "/" + photo.ID + ".jpg"} {
+			expectStatus(t, doRequest(t, "GET", "/photos/photography/"+file, "", "", nil), status)
+			expectStatus(t, doRequest(t, "GET", "/photos/photography/"+file, other.token, "", nil), status)
+			expectStatus(t, doRequest(t, "GET", "/photos/photography/"+file, user.token, "", nil), http.StatusOK)
+		}
+		rec := doJSON(t, "GET", "/api/photos?since="+time.Now().Add(-time.Hour).UTC().Format(time.RFC3339), "", nil)
+		expectStatus(t, rec, http.StatusOK)
+		var changes PhotoChangesResponse
+		decodeResponse(t, rec, &changes)
+		listed := slices.ContainsFunc(changes.Photos, func(p PhotoResponse) bool { return p.ID == photo.ID })
+		if listed != visible {
+			t.Errorf("anonymous change feed lists the photo: %v, want %v", listed, visible)
+		}
+	}
+	expectVisible(false)
+
+	expectStatus(t, doJSON(t, "POST", "/api/photos/"+photo.ID+"/publish", other.token, nil), http.StatusForbidden)
+	rec := doJSON(t, "POST", "/api/photos/"+photo.ID+"/publish", user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var published PhotoResponse
+	decodeResponse(t, rec, &published)
+	if published.Status != "published" {
+		t.Errorf("published photo has status %q", published.Status)
+	}
+	expectVisible(true)
+	expectStatus(t, doJSON(t, "POST", "/api/photos/"+photo.ID+"/publish", user.token, nil), http.StatusOK)
+
+	expectStatus(t, doJSON(t, "POST", "/api/photos/"+photo.ID+"/unpublish", user.token, nil), http.StatusOK)
+	expectVisible(false)
+}
+
+func TestCopyPhoto(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+	rec := doJSON(t, "POST", "/api/photos/tag-batch", user.token, TagBatchRequest{IDs: []string{photo.ID}, Add: []string{"copied"}})
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = doJSON(t, "POST", "/api/photos/"+photo.ID+"/copy", user.token, MoveRequest{Category: "digital-sketches"})
+	expectStatus(t, rec, http.StatusCreated)
+	var copied PhotoResponse
+	decodeResponse(t, rec, &copied)
+	if copied.ID == photo.ID || copied.Category != "digital-sketches" || copied.Title != photo.Title || copied.AltText != photo.AltText {
+		t.Errorf("copy = %+v, want a new photo in digital-sketches with the metadata of %+v", copied, photo)
+	}
+	if !slices.Equal(photoTags(t, copied), []string{"copied"}) {
+		t.Errorf("copy's tags = %v, want [copied]", photoTags(t, copied))
+	}
+
+	// The copy is independent of the original, files included
+	newTitle := "Only the original"
+	expectStatus(t, doJSON(t, "PATCH", "/api/photos/"+photo.ID, user.token, PhotoUpdate{Title: &newTitle}), http.StatusOK)
+	expectStatus(t, doJSON(t, "DELETE", "/api/photos/"+photo.ID, user.token, nil), http.StatusOK)
+	expectStatus(t, doJSON(t, "GET", "/api/photos/photography/"+photo.ID, "", nil), http.StatusNotFound)
+	rec = doJSON(t, "GET", "/api/photos/digital-sketches/"+copied.ID, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var fetched PhotoResponse
+	decodeResponse(t, rec, &fetched)
+	if fetched.Title != photo.Title {
+		t.Errorf("copy's title = %q after editing the original, want %q", fetched.Title, photo.Title)
+	}
+	for _, file := range []string{copied.Filename, thumbnailDir + "/" + copied.ID + ".jpg"} {
+		expectStatus(t, doRequest(t, "GET", "/photos/digital-sketches/"+file, "", "", nil), http.StatusOK)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		category string
+		status   int
+	}{
+		{"another user's photo", other.token, "photography", http.StatusForbidden},
+		{"invalid category", user.token, "paintings", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, "POST", "/api/photos/"+copied.ID+"/copy", tt.token, MoveRequest{Category: tt.category})
+			expectStatus(t, rec, tt.status)
+		})
+	}
+
+	// Copies count against the quota
+	setPhotoQuota(t, user.id, 1)
+	rec = doJSON(t, "POST", "/api/photos/"+copied.ID+"/copy", user.token, MoveRequest{Category: "photography"})
+	expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+}
+
+func TestMovePhotosBatch(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	a := uploadTestPhoto(t, user.token, "photography")
+	b := uploadTestPhoto(t, user.token, "photography")
+	already := uploadTestPhoto(t, user.token, "digital-sketches")
+	theirs := uploadTestPhoto(t, other.token, "photography")
+	slug := "batch-" + strings.ToLower(randomPhotoID())
+	rec := uploadWithSlug(t, user.token, "photography", slug)
+	expectStatus(t, rec, http.StatusCreated)
+	var slugged PhotoResponse
+	decodeResponse(t, rec, &slugged)
+	expectStatus(t, uploadWithSlug(t, user.token, "digital-sketches", slug), http.StatusCreated)
+
+	rec = doJSON(t, "POST", "/api/photos/move-batch", user.token, MoveBatchRequest{
+		IDs:      []string{a.ID, theirs.ID, "no-such-photo", already.ID, slugged.ID, b.ID},
+		Category: "digital-sketches",
+	})
+	expectStatus(t, rec, http.StatusOK)
+	var result struct {
+		Moved   int               `json:"moved"`
+		Results []MoveBatchResult `json:"results"`
+	}
+	decodeResponse(t, rec, &result)
+	want := []MoveBatchResult{
+		{ID: a.ID, Moved: true},
+		{ID: theirs.ID, Error: "You can only edit your own photos"},
+		{ID: "no-such-photo", Error: "Photo not found"},
+		{ID: already.ID},
+		{ID: slugged.ID, Error: "Slug already in use in this category"},
+		{ID: b.ID, Moved: true},
+	}
+	if result.Moved != 2 || !slices.Equal(result.Results, want) {
+		t.Errorf("moved %d, results %+v; want 2, %+v", result.Moved, result.Results, want)
+	}
+
+	// Moved photos' files went with them; the rest stayed put
+	for _, tt := range []struct {
+		photo    PhotoResponse
+		category string
+	}{{a, "digital-sketches"}, {b, "digital-sketches"}, {theirs, "photography"}, {slugged, "photography"}} {
+		expectStatus(t, doJSON(t, "GET", "/api/photos/"+tt.category+"/"+tt.photo.ID, "", nil), http.StatusOK)
+		expectStatus(t, doRequest(t, "GET", "/photos/"+tt.category+"/"+tt.photo.Filename, "", "", nil), http.StatusOK)
+	}
+	rec = doRequest(t, "GET", "/photos/photography/"+a.Filename, "", "", nil)
+	expectStatus(t, rec, http.StatusMovedPermanently)
+	if location := rec.Header().Get("Location"); location != "/photos/digital-sketches/"+a.Filename {
+		t.Errorf("old path redirects to %q, want the new one", location)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		req    MoveBatchRequest
+		status int
+	}{
+		{"no IDs", user.token, MoveBatchRequest{Category: "photography"}, http.StatusBadRequest},
+		{"invalid category", user.token, MoveBatchRequest{IDs: []string{a.ID}, Category: "paintings"}, http.StatusBadRequest},
+		{"signed out", "", MoveBatchRequest{IDs: []string{a.ID}, Category: "photography"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, doJSON(t, "POST", "/api/photos/move-batch", tt.token, tt.req), tt.status)
+		})
+	}
+}
+
+// Fetch the overview of every category
+func photosOverview(t *testing.T, query string) map[string][]PhotoResponse {
+	t.Helper()
+	rec := doJSON(t, "GET", "/api/photos/overview"+query, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var overview map[string][]PhotoResponse
+	decodeResponse(t, rec, &overview)
+	return overview
+}
+
+func TestPhotosOverview(t *testing.T) {
+	user := newTestUser(t)
+	for range defaultOverviewPerCategory + 1 {
+		uploadTestPhoto(t, user.token, "photography")
+	}
+
+	tests := []struct {
+		query string
+		n     int
+	}{
+		{"", defaultOverviewPerCategory},
+		{"?perCategory=2", 2},
+		{"?perCategory=1", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			overview := photosOverview(t, tt.query)
+			if len(overview) != len(photoCategories) {
+				t.Errorf("overview has %d categories, want %d", len(overview), len(photoCategories))
+			}
+			for _, category := range photoCategories {
+				photos, ok := overview[category]
+				if !ok || len(photos) > tt.n {
+					t.Errorf("%s has %d photos (listed %v), want at most %d", category, len(photos), ok, tt.n)
+				}
+				for _, photo := range photos {
+					if photo.Category != category {
+						t.Errorf("%s lists photo %s of %s", category, photo.ID, photo.Category)
+					}
+				}
+			}
+
+			// The first photos of the category listing, in its order
+			listed := listPhotos(t, fmt.Sprintf("/api/photos/photography?pageSize=%d", tt.n), "").Items
+			var got, want []string
+			for _, photo := range overview["photography"] {
+				got = append(got, photo.ID)
+			}
+			for _, photo := range listed {
+				want = append(want, photo.ID)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("photography preview = %v, want %v", got, want)
+			}
+		})
+	}
+
+	for _, query := range []string{"?perCategory=0", fmt.Sprintf("?perCategory=%d", maxOverviewPerCategory+1), "?perCategory=four", "?sort=random"} {
+		expectStatus(t, doJSON(t, "GET", "/api/photos/overview"+query, "", nil), http.StatusBadRequest)
+	}
+}
+
+func TestPhotoResponseMasking(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	admin := newTestAdmin(t)
+	old := preserveFilenames
+	preserveFilenames = true
+	t.Cleanup(func() { preserveFilenames = old })
+
+	file := testJPEGWithEXIF(t, testEXIF(map[uint16]string{exifTagDateTimeOriginal: "2021:07:04 18:00:00"}))
+	contentType, body := multipartBody(t, "private-name.jpg", "image/jpeg", file, map[string]string{
+		uploadTitleField:    "Masked",
+		uploadCategoryField: "photography",
+	})
+	rec := doRequest(t, "POST", "/api/photos/upload", user.token, contentType, body)
+	expectStatus(t, rec, http.StatusCreated)
+	var uploaded PhotoResponse
+	decodeResponse(t, rec, &uploaded)
+
+	fetch := func(token string) PhotoResponse {
+		t.Helper()
+		rec := doJSON(t, "GET", "/api/photos/photography/"+uploaded.ID, token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var photo PhotoResponse
+		decodeResponse(t, rec, &photo)
+		return photo
+	}
+	owner := fetch(user.token)
+	if owner.UserID != user.id || owner.CapturedAt == "" || owner.Views == nil || owner.OriginalFilename != "private-name.jpg" {
+		t.Fatalf("owner sees %+v, want the uploader, capture date, views and original filename", owner)
+	}
+	if got := fetch(admin.token); !reflect.DeepEqual(got, owner) {
+		t.Errorf("admin sees %+v, want what the owner sees, %+v", got, owner)
+	}
+
+	// Others see the same photo without the sensitive fields
+	masked := owner
+	masked.UserID, masked.CapturedAt, masked.Views, masked.OriginalFilename = 0, "", nil, ""
+	for name, token := range map[string]string{"anonymous": "", "another user": other.token} {
+		if got := fetch(token); !reflect.DeepEqual(got, masked) {
+			t.Errorf("%s sees %+v, want %+v", name, got, masked)
+		}
+	}
+	rec = doJSON(t, "GET", "/api/photos/photography/"+uploaded.ID, "", nil)
+	for _, field := range []string{`"userId"`, `"capturedAt"`, `"views"`, `"originalFilename"`} {
+		if strings.Contains(rec.Body.String(), field) {
+			t.Errorf("anonymous response has %s: %s", field, rec.Body)
+		}
+	}
+}
+
+func TestReprocessPhoto(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+	ctx := context.Background()
+
+	// Lose the derivatives, as a processing bug might have
+	thumbnailPath := filepath.Join(photoDir, "photography", thumbnailDir, photo.ID+".jpg")
+	if err := os.Remove(thumbnailPath); err != nil {
+		t.Fatal(err)
+	}
+	_, err := dbConn.Exec(`UPDATE photos SET colors = '', blurhash = '', thumbnail = '', width = 0, height = 0 WHERE id = ?`, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectStatus(t, doJSON(t, "POST", "/api/photos/"+photo.ID+"/reprocess", other.token, nil), http.StatusForbidden)
+	rec := doJSON(t, "POST", "/api/photos/"+photo.ID+"/reprocess", user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var reprocessed PhotoResponse
+	decodeResponse(t, rec, &reprocessed)
+	if !slices.Equal(reprocessed.Colors, photo.Colors) || reprocessed.Blurhash != photo.Blurhash || reprocessed.ThumbnailURL != photo.ThumbnailURL {
+		t.Errorf("reprocessed %+v, want the derivatives of %+v", reprocessed, photo)
+	}
+	if _, err := os.Stat(thumbnailPath); err != nil {
+		t.Errorf("thumbnail not regenerated: %v", err)
+	}
+	row, err := queries.GetPhoto(ctx, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Width != 8 || row.Height != 8 {
+		t.Errorf("stored dimensions %dx%d, want 8x8", row.Width, row.Height)
+	}
+
+	// Without its file there's nothing to regenerate from
+	if err := os.Remove(filepath.Join(photoDir, "photography", photo.Filename)); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, doJSON(t, "POST", "/api/photos/"+photo.ID+"/reprocess", user.token, nil), http.StatusConflict)
+}
+
+func TestRandomPhoto(t *testing.T) {
+	user := newTestUser(t)
+	uploadTestPhoto(t, user.token, "photography")
+	old := defaultPhotoStatus
+	defaultPhotoStatus = "draft"
+	draft := uploadTestPhoto(t, user.token, "photography")
+	defaultPhotoStatus = old
+
+	for _, category := range []string{"photography", ""} {
+		t.Run("category="+category, func(t *testing.T) {
+			for range 20 {
+				rec := doJSON(t, "GET", "/api/photos/random?category="+category, "", nil)
+				expectStatus(t, rec, http.StatusOK)
+				if cc := rec.Header().Get("Cache-Control"); cc != "no-store" {
+					t.Errorf("Cache-Control = %q, want no-store", cc)
+				}
+				var photo PhotoResponse
+				decodeResponse(t, rec, &photo)
+				if photo.ID == draft.ID || photo.Status != "published" {
+					t.Fatalf("picked %s with status %q, want a published photo", photo.ID, photo.Status)
+				}
+				if (category != "" && photo.Category != category) || !isValidCategory(photo.Category) {
+					t.Fatalf("picked a photo of %q, want one of %q", photo.Category, category)
+				}
+				expectStatus(t, doJSON(t, "GET", "/api/photos/"+photo.Category+"/"+photo.ID, "", nil), http.StatusOK)
+			}
+		})
+	}
+
+	// A category whose photos are all drafts has nothing to pick
+	rows, err := dbConn.Query(`SELECT id FROM photos WHERE category = 'featured' AND status = 'published'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var published []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		published = append(published, id)
+	}
+	rows.Close()
+	setStatus := func(status string) {
+		t.Helper()
+		for _, id := range published {
+			if _, err := dbConn.Exec(`UPDATE photos SET status = ? WHERE id = ?`, status, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	setStatus("draft")
+	t.Cleanup(func() { setStatus("published") })
+	expectStatus(t, doJSON(t, "GET", "/api/photos/random?category=featured", "", nil), http.StatusNotFound)
+}
+
+func TestStaticFilesNeedAPhoto(t *testing.T) {
+	// A file whose upload hasn't finished has no row yet
+	writeOrphan(t, filepath.Join("photography", "unfinished.png"), false)
+	for _, path := range []string{
+		"/photos/photography/unfinished.png",
+		"/photos/photography/",
+		"/photos/photography/" + thumbnailDir + "/",
+		"/photos/",
+	} {
+		expectStatus(t, doRequest(t, "GET", path, "", "", nil), http.StatusNotFound)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// Preset images live in this subdirectory of their photo's category
+// directory, named after the photo ID and preset name
+const presetsDir = "presets"
+
+// thumbnailPreset is a named width, in pixels, generated for each photo
+type thumbnailPreset struct {
+	name  string
+	width int
+}
+
+// Presets from THUMBNAIL_PRESETS, loaded at startup, and their normalized
+// spec. Each photo records the spec its presets were made with, so a photo
+// whose spec differs has stale presets.
+var (
+	thumbnailPresets []thumbnailPreset
+	presetsSpec      string
+)
+
+// PresetImage is one preset rendition of a photo, with its actual width for
+// use in a srcset
+type PresetImage struct {
+	URL   string `json:"url"`
+	Width int    `json:"width"`
+}
+
+var presetNamePattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// Parse a preset spec such as "sm=200,md=600,lg=1200", ordering the presets
+// by name. Entries that don't parse are returned as an error.
+func parsePresets(spec string) ([]thumbnailPreset, error) {
+	presets := []thumbnailPreset{}
+	for _, entry := range strings.Split(spec, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(entry, "=")
+		width, err := strconv.Atoi(value)
+		if !presetNamePattern.MatchString(name) || err != nil || width < 1 || width > maxResizeDimension {
+			return nil, fmt.Errorf("invalid preset %q", entry)
+		}
+		if slices.ContainsFunc(presets, func(p thumbnailPreset) bool { return p.name == name }) {
+			return nil, fmt.Errorf("duplicate preset %q", name)
+		}
+		presets = append(presets, thumbnailPreset{name: name, width: width})
+	}
+	slices.SortFunc(presets, func(a, b thumbnailPreset) int { return strings.Compare(a.name, b.name) })
+	return presets, nil
+}
+
+// Format presets as a spec, the inverse of parsePresets
+func formatPresets(presets []thumbnailPreset) string {
+	entries := make([]string, len(presets))
+	for i, preset := range presets {
+		entries[i] = preset.name + "=" + strconv.Itoa(preset.width)
+	}
+	return strings.Join(entries, ",")
+}
+
+// Read THUMBNAIL_PRESETS, exiting on an invalid spec
+func loadThumbnailPresets() {
+	presets, err := parsePresets(thumbnailPresetsConfig)
+	if err != nil {
+		log.Fatalf("Invalid value for THUMBNAIL_PRESETS: %v", err)
+	}
+	thumbnailPresets = presets
+	presetsSpec = formatPresets(presets)
+}
+
+// Path of a photo's preset file, relative to its category directory
+func presetFile(photoID, name string) string {
+	return filepath.Join(presetsDir, photoID+"-"+name+".jpg")
+}
+
+// Paths of a photo's preset files for the presets in spec
+func presetFiles(photoID, spec string) []string {
+	presets, _ := parsePresets(spec)
+	files := make([]string, len(presets))
+	for i, preset := range presets {
+		files[i] = presetFile(photoID, preset.name)
+	}
+	return files
+}
+
+// Describe a photo's presets for a response. Images narrower than a preset
+// aren't upscaled, so the width is the smaller of the two.
+func presetImages(categoryURL string, photo db.Photo) map[string]PresetImage {
+	presets, _ := parsePresets(photo.Presets)
+	if len(presets) == 0 {
+		return nil
+	}
+
+	images := make(map[string]PresetImage, len(presets))
+	for _, preset := range presets {
+		width := preset.width
+		if photo.Width > 0 && int(photo.Width) < width {
+			width = int(photo.Width)
+		}
+		images[preset.name] = PresetImage{
+			URL:   categoryURL + "/" + filepath.ToSlash(presetFile(photo.ID, preset.name)),
+			Width: width,
+		}
+	}
+	return images
+}
+
+// Write every configured preset of an image as a JPEG, returning the paths
+// written relative to the category directory. Presets no wider than the
+// image are scaled down to their width; the rest keep the image's size.
+func writePresets(img image.Image, categoryDir, photoID string) ([]string, error) {
+	if len(thumbnailPresets) == 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Join(categoryDir, presetsDir), 0755); err != nil {
+		return nil, err
+	}
+
+	written := []string{}
+	for _, preset := range thumbnailPresets {
+		scaled := img
+		if img.Bounds().Dx() > preset.width {
+			scaled = resizeContain(img, preset.width, 0)
+		}
+
+		name := presetFile(photoID, preset.name)
+		f, err := os.Create(filepath.Join(categoryDir, name))
+		if err != nil {
+			return written, err
+		}
+		err = jpeg.Encode(f, flattenForJPEG(scaled), jpegOptions())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		written = append(written, name)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// Regenerate the presets of photos made with a different THUMBNAIL_PRESETS,
+// in the background so startup isn't held up. Files of presets no longer
+// configured are removed.
+func startPresetRegeneration() {
+	go func() {
+		ctx := context.Background()
+		photos, err := queries.ListPhotosWithStalePresets(ctx, presetsSpec)
+		if err != nil {
+			slog.Error("Failed to list photos with stale presets", "error", err)
+			return
+		}
+		if len(photos) == 0 {
+			return
+		}
+
+		slog.Info("Regenerating thumbnail presets", "photos", len(photos), "presets", presetsSpec)
+		regenerated := 0
+		for _, photo := range photos {
+			if err := regeneratePresets(ctx, photo); err != nil {
+				slog.Error("Failed to regenerate presets", "photo_id", photo.ID, "error", err)
+				continue
+			}
+			regenerated++
+		}
+		slog.Info("Regenerated thumbnail presets", "photos", regenerated, "failed", len(photos)-regenerated)
+	}()
+}
+
+func regeneratePresets(ctx context.Context, photo db.Photo) error {
+	release, err := acquireImageSlot(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	categoryDir := filepath.Join(photoDir, photo.Category)
+	img, _, err := decodeImageFile(filepath.Join(categoryDir, photo.Filename))
+	if err != nil {
+		return err
+	}
+
+	// On failure the photo keeps its old spec and is retried next startup
+	written, err := writePresets(img, categoryDir, photo.ID)
+	if err != nil {
+		return err
+	}
+	for _, name := range presetFiles(photo.ID, photo.Presets) {
+		if !slices.Contains(written, name) {
+			removeDerivatives(categoryDir, name)
+		}
+	}
+
+	return queries.UpdatePhotoPresets(ctx, db.UpdatePhotoPresetsParams{
+		Presets: presetsSpec,
+		Width:   int64(img.Bounds().Dx()),
+		Height:  int64(img.Bounds().Dy()),
+		ID:      photo.ID,
+	})
+}
+
+// Format a photo's presets and the photo itself as an HTML srcset attribute,
+// narrowest first. The photo is included only when its width is known, and
+// presets as wide as the photo are left out in its favor.
+func buildSrcset(photoURL string, photoWidth int64, presets map[string]PresetImage) string {
+	images := make([]PresetImage, 0, len(presets)+1)
+	for _, preset := range presets {
+		if photoWidth == 0 || int64(preset.Width) < photoWidth {
+			images = append(images, preset)
+		}
+	}
+	if photoWidth > 0 && len(images) > 0 {
+		images = append(images, PresetImage{URL: photoURL, Width: int(photoWidth)})
+	}
+	slices.SortFunc(images, func(a, b PresetImage) int {
+		if a.Width != b.Width {
+			return a.Width - b.Width
+		}
+		return strings.Compare(a.URL, b.URL)
+	})
+
+	// Widths must be unique, so of presets the same width only the first
+	// is kept
+	entries := make([]string, 0, len(images))
+	lastWidth := 0
+	for _, candidate := range images {
+		if candidate.Width == lastWidth {
+			continue
+		}
+		entries = append(entries, candidate.URL+" "+strconv.Itoa(candidate.Width)+"w")
+		lastWidth = candidate.Width
+	}
+	return strings.Join(entries, ", ")
+}
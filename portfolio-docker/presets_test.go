@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"image"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePresets(t *testing.T) {
+	tests := []struct {
+		spec  string
+		valid bool
+		want  string // Normalized
+	}{
+		{"", true, ""},
+		{"sm=200,md=600,lg=1200", true, "lg=1200,md=600,sm=200"},
+		{" sm=200 , ,md=600", true, "md=600,sm=200"},
+		{"sm=200,sm=300", false, ""},
+		{"sm", false, ""},
+		{"sm=0", false, ""},
+		{"Small=200", false, ""},
+		{"sm=wide", false, ""},
+	}
+	for _, tt := range tests {
+		presets, err := parsePresets(tt.spec)
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("parsePresets(%q) = %v, want an error", tt.spec, presets)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePresets(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := formatPresets(presets); got != tt.want {
+			t.Errorf("parsePresets(%q) = %q, want %q", tt.spec, got, tt.want)
+		}
+	}
+}
+
+// Width and height of an image file, failing when it can't be read
+func imageFileSize(t *testing.T, path string) (int, int) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config.Width, config.Height
+}
+
+func TestUploadGeneratesPresets(t *testing.T) {
+	user := newTestUser(t)
+	usePresets(t, "sm=8,md=24,lg=100")
+
+	rec := uploadFile(t, user.token, "photography", "wide.png", testPNG(t, 48, 24, testColor))
+	expectStatus(t, rec, http.StatusCreated)
+	var photo PhotoResponse
+	decodeResponse(t, rec, &photo)
+
+	// Presets wider than the image keep its size
+	want := map[string]int{"sm": 8, "md": 24, "lg": 48}
+	if len(photo.Presets) != len(want) {
+		t.Errorf("presets = %v, want %v", photo.Presets, want)
+	}
+	categoryDir := filepath.Join(photoDir, photo.Category)
+	for name, width := range want {
+		preset, ok := photo.Presets[name]
+		if !ok {
+			t.Errorf("no %s preset in %v", name, photo.Presets)
+			continue
+		}
+		if preset.Width != width {
+			t.Errorf("%s preset width = %d, want %d", name, preset.Width, width)
+		}
+		file := presetFile(photo.ID, name)
+		if got, _ := imageFileSize(t, filepath.Join(categoryDir, file)); got != width {
+			t.Errorf("%s preset file is %d wide, want %d", name, got, width)
+		}
+		expectStatus(t, doRequest(t, "GET", "/photos/"+photo.Category+"/"+filepath.ToSlash(file), "", "", nil), http.StatusOK)
+	}
+}
+
+func TestRegeneratePresets(t *testing.T) {
+	user := newTestUser(t)
+	usePresets(t, "sm=8,md=24")
+	photo := uploadTestPhoto(t, user.token, "photography")
+	categoryDir := filepath.Join(photoDir, photo.Category)
+
+	usePresets(t, "sm=4,xl=6")
+	ctx := context.Background()
+	row, err := queries.GetPhoto(ctx, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := regeneratePresets(ctx, row); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, width := range map[string]int{"sm": 4, "xl": 6} {
+		if got, _ := imageFileSize(t, filepath.Join(categoryDir, presetFile(photo.ID, name))); got != width {
+			t.Errorf("%s preset is %d wide, want %d", name, got, width)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(categoryDir, presetFile(photo.ID, "md"))); !os.IsNotExist(err) {
+		t.Errorf("preset no longer configured wasn't removed: %v", err)
+	}
+	row, err = queries.GetPhoto(ctx, photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Presets != presetsSpec {
+		t.Errorf("photo's preset spec = %q, want %q", row.Presets, presetsSpec)
+	}
+	stale, err := queries.ListPhotosWithStalePresets(ctx, presetsSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range stale {
+		if p.ID == photo.ID {
+			t.Error("regenerated photo still listed as stale")
+		}
+	}
+}
+
+func TestBuildSrcset(t *testing.T) {
+	presets := map[string]PresetImage{
+		"sm": {URL: "/sm.jpg", Width: 200},
+		"md": {URL: "/md.jpg", Width: 600},
+		"lg": {URL: "/lg.jpg", Width: 1200},
+	}
+	tests := []struct {
+		name    string
+		width   int64
+		presets map[string]PresetImage
+		want    string
+	}{
+		{"all sizes", 2000, presets, "/sm.jpg 200w, /md.jpg 600w, /lg.jpg 1200w, /photo.png 2000w"},
+		{"presets as wide as the photo", 600, map[string]PresetImage{
+			"sm": {URL: "/sm.jpg", Width: 200},
+			"md": {URL: "/md.jpg", Width: 600},
+			"lg": {URL: "/lg.jpg", Width: 600},
+		}, "/sm.jpg 200w, /photo.png 600w"},
+		{"presets of one width", 1000, map[string]PresetImage{
+			"a": {URL: "/a.jpg", Width: 200},
+			"b": {URL: "/b.jpg", Width: 200},
+		}, "/a.jpg 200w, /photo.png 1000w"},
+		{"photo width unknown", 0, presets, "/sm.jpg 200w, /md.jpg 600w, /lg.jpg 1200w"},
+		{"no presets", 2000, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildSrcset("/photo.png", tt.width, tt.presets); got != tt.want {
+				t.Errorf("buildSrcset() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadSrcset(t *testing.T) {
+	user := newTestUser(t)
+	usePresets(t, "sm=8,md=24")
+
+	rec := uploadFile(t, user.token, "photography", "wide.png", testPNG(t, 48, 24, testColor))
+	expectStatus(t, rec, http.StatusCreated)
+	var photo PhotoResponse
+	decodeResponse(t, rec, &photo)
+
+	want := photo.Presets["sm"].URL + " 8w, " + photo.Presets["md"].URL + " 24w, " + photo.URL + " 48w"
+	if photo.Srcset != want {
+		t.Errorf("srcset = %q, want %q", photo.Srcset, want)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// QuotaRequest sets or clears a user's quota override. A null field falls
+// back to the server-wide default. Unlike the default, an override of zero
+// isn't unlimited: it stops the user uploading.
+type QuotaRequest struct {
+	QuotaBytes  *int64 `json:"quotaBytes"`
+	QuotaPhotos *int64 `json:"quotaPhotos"`
+}
+
+// quotaExceededError is a photo that would take its owner over their upload
+// quota
+type quotaExceededError struct {
+	problem string
+}
+
+func (e *quotaExceededError) Error() string {
+	return e.problem
+}
+
+// Check whether adding the given number of photos and bytes would exceed the
+// user's quota. Returns a user-facing message when it would.
+func checkUploadQuota(ctx context.Context, q *db.Queries, userID int64, addPhotos, addBytes int64) (string, error) {
+	quota, err := q.GetUserQuota(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	// Zero means unlimited only for the server-wide defaults
+	maxBytes, limitBytes := uploadQuotaBytes, uploadQuotaBytes > 0
+	if quota.QuotaBytes.Valid {
+		maxBytes, limitBytes = quota.QuotaBytes.Int64, true
+	}
+	maxPhotos, limitPhotos := uploadQuotaPhotos, uploadQuotaPhotos > 0
+	if quota.QuotaPhotos.Valid {
+		maxPhotos, limitPhotos = quota.QuotaPhotos.Int64, true
+	}
+
+	usage, err := q.GetPhotoUsageByUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	if limitPhotos && addPhotos > 0 && usage.PhotoCount+addPhotos > maxPhotos {
+		return fmt.Sprintf("Upload quota exceeded: %d of %d photos used", usage.PhotoCount, maxPhotos), nil
+	}
+	if limitBytes && addBytes > 0 && usage.TotalBytes+addBytes > maxBytes {
+		return fmt.Sprintf("Upload quota exceeded: %d of %d bytes used, file adds %d bytes", usage.TotalBytes, maxBytes, addBytes), nil
+	}
+	return "", nil
+}
+
+// Record a new photo, checking its owner's quota and its category's cap
+// again in the same transaction. The checks handlers make up front only fail
+// early: without this, concurrent uploads could each pass them and together
+// exceed a limit. The whole transaction is retried if the database is busy.
+func createPhotoWithinLimits(ctx context.Context, params db.CreatePhotoParams) (db.Photo, error) {
+	return withRetry(ctx, func() (db.Photo, error) {
+		tx, err := dbConn.BeginTx(ctx, nil)
+		if err != nil {
+			return db.Photo{}, err
+		}
+		defer tx.Rollback()
+
+		qtx := queries.WithTx(tx)
+		problem, err := checkUploadQuota(ctx, qtx, params.UserID, 1, params.SizeBytes)
+		if err != nil {
+			return db.Photo{}, err
+		}
+		if problem != "" {
+			return db.Photo{}, &quotaExceededError{problem: problem}
+		}
+		problem, err = categoryCapacityProblem(ctx, qtx, params.UserID, params.Category, 1)
+		if err != nil {
+			return db.Photo{}, err
+		}
+		if problem != "" {
+			return db.Photo{}, &categoryFullError{problem: problem}
+		}
+
+		row, err := qtx.CreatePhoto(ctx, params)
+		if err != nil {
+			return db.Photo{}, err
+		}
+		return row, tx.Commit()
+	})
+}
+
+// Set or clear a user's quota override (admin only)
+func updateUserQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req QuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if (req.QuotaBytes != nil && *req.QuotaBytes < 0) || (req.QuotaPhotos != nil && *req.QuotaPhotos < 0) {
+		respondWithError(w, http.StatusBadRequest, "Quota values must not be negative")
+		return
+	}
+
+	params := db.UpdateUserQuotaParams{ID: userID}
+	if req.QuotaBytes != nil {
+		params.QuotaBytes = sql.NullInt64{Int64: *req.QuotaBytes, Valid: true}
+	}
+	if req.QuotaPhotos != nil {
+		params.QuotaPhotos = sql.NullInt64{Int64: *req.QuotaPhotos, Valid: true}
+	}
+
+	rows, err := withRetry(requestContext(r), func() (int64, error) {
+		return queries.UpdateUserQuota(requestContext(r), params)
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if rows == 0 {
+		respondWithError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Quota updated successfully",
+	})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// Give a user a photo count quota through the admin endpoint
+func setPhotoQuota(t *testing.T, userID, photos int64) {
+	t.Helper()
+	admin := newTestAdmin(t)
+	rec := doJSON(t, "PUT", fmt.Sprintf("/api/admin/users/%d/quota", userID), admin.token, QuotaRequest{QuotaPhotos: &photos})
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestUploadQuotaRejectsUploadOverQuota(t *testing.T) {
+	user := newTestUser(t)
+	setPhotoQuota(t, user.id, 1)
+
+	uploadTestPhoto(t, user.token, "photography")
+
+	rec := uploadFile(t, user.token, "photography", "second.png", testPNG(t, 8, 8, testColor))
+	expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+}
+
+func TestCreatePhotoWithinLimitsIsAtomic(t *testing.T) {
+	user := newTestUser(t)
+	const quota, attempts = 3, 40
+	setPhotoQuota(t, user.id, quota)
+
+	// Release every attempt at once so their checks overlap
+	ctx := context.Background()
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	errs := make([]error, attempts)
+	for i := range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			id := fmt.Sprintf("quota-race-%d-%d", user.id, i)
+			_, errs[i] = createPhotoWithinLimits(ctx, db.CreatePhotoParams{
+				ID:       id,
+				UserID:   user.id,
+				Filename: id + ".png",
+				Title:    "Race",
+				Category: "photography",
+				Status:   defaultPhotoStatus,
+			})
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	created := 0
+	for _, err := range errs {
+		var quotaErr *quotaExceededError
+		switch {
+		case err == nil:
+			created++
+		case errors.As(err, &quotaErr):
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if created != quota {
+		t.Errorf("created %d photos, want %d", created, quota)
+	}
+
+	usage, err := queries.GetPhotoUsageByUser(ctx, user.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.PhotoCount != quota {
+		t.Errorf("user has %d photos, want %d", usage.PhotoCount, quota)
+	}
+}
+
+func TestUploadQuotaOverrideOfZero(t *testing.T) {
+	admin := newTestAdmin(t)
+	tests := []struct {
+		name  string
+		quota QuotaRequest
+	}{
+		{"no photos", QuotaRequest{QuotaPhotos: new(int64)}},
+		{"no bytes", QuotaRequest{QuotaBytes: new(int64)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := newTestUser(t)
+			rec := doJSON(t, "PUT", fmt.Sprintf("/api/admin/users/%d/quota", user.id), admin.token, tt.quota)
+			expectStatus(t, rec, http.StatusOK)
+
+			rec = uploadFile(t, user.token, "photography", "photo.png", testPNG(t, 8, 8, testColor))
+			expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+		})
+	}
+
+	// The server-wide default of zero is still unlimited
+	old := uploadQuotaPhotos
+	uploadQuotaPhotos = 0
+	t.Cleanup(func() { uploadQuotaPhotos = old })
+	uploadTestPhoto(t, newTestUser(t).token, "photography")
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// StorageReport lists the disagreements between the photos table and the
+// photo directory
+type StorageReport struct {
+	// Rows whose file is gone, including rows in a removed category directory
+	MissingFiles []string `json:"missingFiles"`
+	// Rows in a category the server no longer serves
+	UnknownCategories []string `json:"unknownCategories"`
+	// Category directories that had to be recreated
+	RecreatedDirs []string `json:"recreatedDirs"`
+}
+
+// Compare the photos table with the files on disk. Missing category
+// directories are recreated. With fix set, rows without a file are deleted
+// along with their derivatives and collection memberships; otherwise they
+// are only reported. Files without a row are not orphans: they are legacy
+// uploads and still listed.
+func reconcileStorage(ctx context.Context, fix bool) (StorageReport, error) {
+	report := StorageReport{
+		MissingFiles:      []string{},
+		UnknownCategories: []string{},
+		RecreatedDirs:     []string{},
+	}
+
+	for _, category := range photoCategories {
+		dir := filepath.Join(photoDir, category)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return report, err
+			}
+			report.RecreatedDirs = append(report.RecreatedDirs, category)
+		}
+	}
+
+	photos, err := queries.ListPhotos(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	for _, photo := range photos {
+		if !isValidCategory(photo.Category) {
+			report.UnknownCategories = append(report.UnknownCategories, photo.ID)
+			continue
+		}
+
+		categoryDir := filepath.Join(photoDir, photo.Category)
+		if _, err := os.Stat(filepath.Join(categoryDir, photo.Filename)); !os.IsNotExist(err) {
+			continue
+		}
+		report.MissingFiles = append(report.MissingFiles, photo.ID)
+		if !fix {
+			continue
+		}
+
+		if err := queries.RemovePhotoFromCollections(ctx, photo.ID); err != nil {
+			return report, err
+		}
+		if err := queries.DeletePhoto(ctx, photo.ID); err != nil {
+			return report, err
+		}
+		err := queries.CreatePhotoTombstone(ctx, db.CreatePhotoTombstoneParams{
+			PhotoID:  photo.ID,
+			Category: photo.Category,
+		})
+		if err != nil {
+			return report, err
+		}
+		removeDerivatives(categoryDir, photoDerivatives(photo)...)
+		removeResizeCache(photo.ID)
+	}
+	return report, nil
+}
+
+// Report storage inconsistencies at startup. Nothing is deleted here: an
+// unmounted volume would otherwise wipe every row.
+func checkStorage() {
+	report, err := reconcileStorage(context.Background(), false)
+	if err != nil {
+		slog.Error("Storage check failed", "error", err)
+		return
+	}
+	if len(report.MissingFiles) > 0 || len(report.UnknownCategories) > 0 || len(report.RecreatedDirs) > 0 {
+		slog.Warn("Photo storage is out of sync with the database",
+			"missing_files", len(report.MissingFiles),
+			"unknown_categories", len(report.UnknownCategories),
+			"recreated_dirs", report.RecreatedDirs)
+	}
+}
+
+// Reconcile the photos table with the files on disk (admin only). Orphaned
+// rows are deleted unless dryRun=true is given.
+func reconcileStorageHandler(w http.ResponseWriter, r *http.Request) {
+	fix := r.URL.Query().Get("dryRun") != "true"
+
+	report, err := reconcileStorage(requestContext(r), fix)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	message := "Storage checked"
+	if fix {
+		message = "Storage reconciled"
+	}
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: message,
+		Data:    report,
+	})
+}
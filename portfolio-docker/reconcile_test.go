@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Run the reconcile endpoint as an admin
+func reconcile(t *testing.T, query string) StorageReport {
+	t.Helper()
+	admin := newTestAdmin(t)
+	rec := doJSON(t, "POST", "/api/admin/storage/reconcile"+query, admin.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var report StorageReport
+	decodeResponse(t, rec, &report)
+	return report
+}
+
+func TestReconcileStorage(t *testing.T) {
+	user := newTestUser(t)
+	kept := uploadTestPhoto(t, user.token, "photography")
+	lost := uploadTestPhoto(t, user.token, "photography")
+	if err := os.Remove(filepath.Join(photoDir, lost.Category, lost.Filename)); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	report := reconcile(t, "?dryRun=true")
+	if !slices.Contains(report.MissingFiles, lost.ID) || slices.Contains(report.MissingFiles, kept.ID) {
+		t.Errorf("missing files = %v, want %s and not %s", report.MissingFiles, lost.ID, kept.ID)
+	}
+	if _, err := queries.GetPhoto(ctx, lost.ID); err != nil {
+		t.Fatalf("dry run deleted the row: %v", err)
+	}
+
+	report = reconcile(t, "")
+	if !slices.Contains(report.MissingFiles, lost.ID) {
+		t.Errorf("missing files = %v, want %s", report.MissingFiles, lost.ID)
+	}
+	if _, err := queries.GetPhoto(ctx, lost.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("row of the missing file: GetPhoto() = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := queries.GetPhoto(ctx, kept.ID); err != nil {
+		t.Errorf("row with its file: GetPhoto() = %v", err)
+	}
+}
+
+func TestReconcileStorageRecreatesDirectories(t *testing.T) {
+	dir := useTempPhotoDir(t)
+
+	// A dry run, as none of the rows have their files in the new directory
+	report := reconcile(t, "?dryRun=true")
+	if !slices.Equal(report.RecreatedDirs, photoCategories) {
+		t.Errorf("recreated = %v, want %v", report.RecreatedDirs, photoCategories)
+	}
+	for _, category := range photoCategories {
+		if _, err := os.Stat(filepath.Join(dir, category)); err != nil {
+			t.Errorf("%s not recreated: %v", category, err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// How long clients may cache a redirect from a legacy photo URL. Kept finite
+// so that a photo moved back to where it was isn't stuck behind a cached
+// redirect.
+const legacyRedirectMaxAge = "86400"
+
+// redirectLegacyPaths wraps the static photo file server, redirecting
+// requests for a photo file or thumbnail that's no longer there to its
+// current URL with 301. Files are named after the photo ID, so an old path
+// still identifies the photo after it was moved to another category or its
+// file was replaced by one of another format. Paths that exist, or don't
+// name a stored photo, are served as usual.
+func redirectLegacyPaths(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		category, name, ok := strings.Cut(strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/"), "/")
+		if !ok || !isValidCategory(category) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		dir, filename := path.Split(name)
+		if (dir != "" && dir != thumbnailDir+"/") || filename == "" || strings.HasPrefix(filename, ".") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if _, err := os.Stat(filepath.Join(photoDir, category, filepath.FromSlash(name))); !errors.Is(err, fs.ErrNotExist) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Drafts aren't public, so where they went isn't given away
+		photo, err := queries.GetPhoto(requestContext(r), strings.TrimSuffix(filename, path.Ext(filename)))
+		if err != nil || photo.Status == "draft" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		current := photo.Filename
+		if dir != "" {
+			current = photo.Thumbnail
+		}
+		if current == "" || (photo.Category == category && current == name) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age="+legacyRedirectMaxAge)
+		http.Redirect(w, r, "/photos/"+photo.Category+"/"+current, http.StatusMovedPermanently)
+	})
+}
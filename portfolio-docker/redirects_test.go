@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRedirectLegacyPaths(t *testing.T) {
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+	oldFile := "/photos/photography/" + photo.Filename
+	oldThumbnail := "/photos/photography/" + thumbnailDir + "/" + photo.ID + ".jpg"
+
+	// Moved to another category, then replaced by a file of another format
+	rec := doJSON(t, "POST", "/api/photos/"+photo.ID+"/move", user.token, MoveRequest{Category: "digital-sketches"})
+	expectStatus(t, rec, http.StatusOK)
+	rec = replaceFile(t, user.token, photo.ID, "scan.tiff", "image/tiff", testTIFF(t, 12, 12))
+	expectStatus(t, rec, http.StatusOK)
+	var current PhotoResponse
+	decodeResponse(t, rec, &current)
+	if current.Filename == photo.Filename {
+		t.Fatalf("replacing with a TIFF kept the filename %q", current.Filename)
+	}
+	newFile := "/photos/digital-sketches/" + current.Filename
+	newThumbnail := "/photos/digital-sketches/" + thumbnailDir + "/" + photo.ID + ".jpg"
+
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		location string
+	}{
+		{"old file", oldFile, http.StatusMovedPermanently, newFile},
+		{"old file in the new category", "/photos/digital-sketches/" + photo.Filename, http.StatusMovedPermanently, newFile},
+		{"old thumbnail", oldThumbnail, http.StatusMovedPermanently, newThumbnail},
+		{"current file", newFile, http.StatusOK, ""},
+		{"current thumbnail", newThumbnail, http.StatusOK, ""},
+		{"unknown photo", "/photos/photography/no-such-photo.png", http.StatusNotFound, ""},
+		{"invalid category", "/photos/paintings/" + photo.Filename, http.StatusNotFound, ""},
+		{"nested path", "/photos/photography/a/b/" + photo.Filename, http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doRequest(t, "GET", tt.path, "", "", nil)
+			expectStatus(t, rec, tt.status)
+			if location := rec.Header().Get("Location"); location != tt.location {
+				t.Errorf("Location = %q, want %q", location, tt.location)
+			}
+			if tt.location != "" && rec.Header().Get("Cache-Control") != "public, max-age="+legacyRedirectMaxAge {
+				t.Errorf("Cache-Control = %q, want a finite public max-age", rec.Header().Get("Cache-Control"))
+			}
+		})
+	}
+
+	// Drafts' new locations aren't given away
+	expectStatus(t, doJSON(t, "POST", "/api/photos/"+photo.ID+"/unpublish", user.token, nil), http.StatusOK)
+	expectStatus(t, doRequest(t, "GET", oldFile, "", "", nil), http.StatusNotFound)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// UploadURLRequest names an image to fetch and store as a new photo, with
+// the same metadata as an upload form
+type UploadURLRequest struct {
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	Category string `json:"category"`
+	AltText  string `json:"altText"`
+	Caption  string `json:"caption"`
+	Slug     string `json:"slug"`
+	Status   string `json:"status"`
+}
+
+// Content types a fetched image may be served with, and the extension it's
+// stored under
+var remoteImageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/tiff": ".tif",
+}
+
+// Ranges outside the public internet that netip doesn't already class as
+// private, loopback, link-local or multicast
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // This network
+	netip.MustParsePrefix("100.64.0.0/10"),   // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // Documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // Benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // Documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // Documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // Reserved, and broadcast
+	netip.MustParsePrefix("64:ff9b::/96"),    // NAT64, which can reach private IPv4
+	netip.MustParsePrefix("2001:db8::/32"),   // Documentation
+}
+
+// Problems fetching an image by URL that the client caused
+var (
+	errInvalidFetchURL  = errors.New("URL must be an absolute http or https URL")
+	errBlockedAddress   = errors.New("address is not public")
+	errTooManyRedirects = errors.New("too many redirects")
+	errRemoteTooLarge   = errors.New("remote image too large")
+)
+
+// remoteStatusError is a response other than 200 OK to an image fetch
+type remoteStatusError struct {
+	status int
+}
+
+func (e *remoteStatusError) Error() string {
+	return fmt.Sprintf("remote server responded with status %d", e.status)
+}
+
+// HTTP client for fetching images by URL. Addresses are checked as each
+// connection is made, after DNS resolution, so no hostname or redirect can
+// lead it to an internal address. Proxies from the environment aren't used,
+// as they'd connect on the server's behalf past the check.
+var remoteFetchClient = &http.Client{
+	Timeout: remoteFetchTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: checkDialAddress,
+		}).DialContext,
+		TLSHandshakeTimeout:    10 * time.Second,
+		MaxResponseHeaderBytes: 64 << 10,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if int64(len(via)) > remoteFetchMaxRedirects {
+			return errTooManyRedirects
+		}
+		return checkFetchURL(req.URL)
+	},
+}
+
+// Whether an address is on the public internet
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Refuse to connect to addresses that aren't public. address is the
+// resolved IP and port.
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !isPublicAddr(addr) {
+		return errBlockedAddress
+	}
+	return nil
+}
+
+// Check a URL to fetch, or to be redirected to, is http or https
+func checkFetchURL(u *url.URL) error {
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errInvalidFetchURL
+	}
+	return nil
+}
+
+// Name a fetched image after the last segment of its URL, with the
+// extension of its content type
+func remoteFilename(u *url.URL, ext string) string {
+	base := path.Base(u.Path)
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	if stem == "" || stem == "." || stem == "/" {
+		stem = "image"
+	}
+	return stem + ext
+}
+
+// Download an image to a temporary file in photoDir, as a form for
+// storePhoto. The caller must call cleanup on success; nothing is left
+// behind on failure.
+func fetchRemoteImage(ctx context.Context, rawURL string) (*uploadForm, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errInvalidFetchURL
+	}
+	if err := checkFetchURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, errInvalidFetchURL
+	}
+	req.Header.Set("Accept", strings.Join(supportedContentTypes, ", "))
+
+	resp, err := remoteFetchClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &remoteStatusError{status: resp.StatusCode}
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	ext, ok := remoteImageExtensions[mediaType]
+	if !ok {
+		return nil, &unsupportedFormatError{problem: fmt.Sprintf("URL must point to an image of type %s", strings.Join(supportedContentTypes, ", "))}
+	}
+	if maxUploadBytes > 0 && resp.ContentLength > maxUploadBytes {
+		return nil, errRemoteTooLarge
+	}
+
+	temp, err := os.CreateTemp(photoDir, ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errStoreFailed, err)
+	}
+	form := &uploadForm{
+		tempPath:    temp.Name(),
+		filename:    remoteFilename(resp.Request.URL, ext),
+		contentType: mediaType,
+	}
+
+	// The declared length can be absent or wrong, so the read is limited too
+	reader := io.Reader(resp.Body)
+	if maxUploadBytes > 0 {
+		reader = io.LimitReader(resp.Body, maxUploadBytes+1)
+	}
+	form.size, err = io.Copy(temp, reader)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && maxUploadBytes > 0 && form.size > maxUploadBytes {
+		err = errRemoteTooLarge
+	}
+	if err != nil {
+		form.cleanup()
+		return nil, err
+	}
+	return form, nil
+}
+
+// Write the response for a failed fetch
+func respondFetchError(w http.ResponseWriter, err error) {
+	var formatErr *unsupportedFormatError
+	var statusErr *remoteStatusError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errInvalidFetchURL):
+		respondWithValidationErrors(w, map[string]string{"url": errInvalidFetchURL.Error()})
+	case errors.Is(err, errBlockedAddress):
+		respondWithValidationErrors(w, map[string]string{"url": "URL must point to a public address"})
+	case errors.Is(err, errTooManyRedirects):
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("URL redirected more than %d times", remoteFetchMaxRedirects))
+	case errors.As(err, &formatErr):
+		respondWithError(w, http.StatusUnsupportedMediaType, formatErr.problem)
+	case errors.Is(err, errRemoteTooLarge):
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Image exceeds the %d byte limit", maxUploadBytes))
+	case errors.Is(err, errStoreFailed):
+		respondWithInternalError(w, "Failed to save file", err)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		respondWithError(w, http.StatusGatewayTimeout, "Timed out fetching the image")
+	case errors.As(err, &statusErr):
+		respondWithError(w, http.StatusBadGateway, fmt.Sprintf("Remote server responded with status %d", statusErr.status))
+	default:
+		respondWithError(w, http.StatusBadGateway, "Failed to fetch the image")
+	}
+}
+
+// Fetch an image by URL and store it as a new photo, as an upload would
+func uploadURLHandler(w http.ResponseWriter, r *http.Request) {
+	var req UploadURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if strings.TrimSpace(req.URL) == "" {
+		respondWithValidationErrors(w, map[string]string{"url": "URL is required"})
+		return
+	}
+
+	fields := photoFields{
+		title:    req.Title,
+		category: req.Category,
+		altText:  req.AltText,
+		caption:  req.Caption,
+		slug:     req.Slug,
+		status:   req.Status,
+	}
+	ctx := requestContext(r)
+	if !checkPhotoFields(w, ctx, &fields) {
+		return
+	}
+
+	// Refuse full categories and users already at their photo limit before
+	// downloading anything
+	userID := r.Context().Value("userID").(int64)
+	if !checkCategoryCapacity(w, ctx, userID, fields.category, 1) {
+		return
+	}
+	quotaMessage, err := checkUploadQuota(ctx, queries, userID, 1, 0)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if quotaMessage != "" {
+		respondWithError(w, http.StatusRequestEntityTooLarge, quotaMessage)
+		return
+	}
+
+	// Abandon the fetch if the client goes away
+	form, err := fetchRemoteImage(r.Context(), strings.TrimSpace(req.URL))
+	if err != nil {
+		respondFetchError(w, err)
+		return
+	}
+	defer form.cleanup()
+
+	quotaMessage, err = checkUploadQuota(ctx, queries, userID, 1, form.size)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if quotaMessage != "" {
+		respondWithError(w, http.StatusRequestEntityTooLarge, quotaMessage)
+		return
+	}
+
+	release, err := acquireImageSlot(r.Context())
+	if err != nil {
+		respondImageBusy(w)
+		return
+	}
+	defer release()
+
+	row, err := storePhoto(ctx, userID, form, fields)
+	if err != nil {
+		respondStoreError(w, err)
+		return
+	}
+	auditPhotoAction(ctx, userID, "upload", row.ID, row.Title)
+
+	respondWithJSON(w, http.StatusCreated, Response{
+		Success: true,
+		Message: "Photo uploaded successfully",
+		Data:    photoResponseFromRow(r, row),
+	})
+}
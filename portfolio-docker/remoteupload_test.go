@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"255.255.255.255", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"64:ff9b::a00:1", false},
+	}
+	for _, tt := range tests {
+		if got := isPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("isPublicAddr(%s) = %v, want %v", tt.addr, got, tt.public)
+		}
+	}
+}
+
+// Let the fetch client connect to srv, a local test server, as though it
+// were public. Every other address is still checked.
+func allowFetchFrom(t *testing.T, srv *httptest.Server) {
+	t.Helper()
+	allowed := srv.Listener.Addr().String()
+	old := remoteFetchClient
+	client := *old
+	client.Transport = &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, c syscall.RawConn) error {
+				if address == allowed {
+					return nil
+				}
+				return checkDialAddress(network, address, c)
+			},
+		}).DialContext,
+	}
+	remoteFetchClient = &client
+	t.Cleanup(func() { remoteFetchClient = old })
+}
+
+// Ask the server to fetch url as a new photography photo
+func uploadURL(t *testing.T, token, url string) *httptest.ResponseRecorder {
+	t.Helper()
+	return doJSON(t, "POST", "/api/photos/upload-url", token, UploadURLRequest{
+		URL:      url,
+		Title:    "Fetched",
+		Category: "photography",
+	})
+}
+
+func TestUploadURLBlocksPrivateAddresses(t *testing.T) {
+	user := newTestUser(t)
+	var hits atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testPNG(t, 8, 8, testColor))
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	tests := []struct {
+		name  string
+		url   string
+		error string
+	}{
+		{"loopback", srv.URL + "/photo.png", "URL must point to a public address"},
+		{"localhost", "http://localhost:" + port + "/photo.png", "URL must point to a public address"},
+		{"IPv6 loopback", "http://[::1]:" + port + "/photo.png", "URL must point to a public address"},
+		{"cloud metadata", "http://169.254.169.254/latest/meta-data/", "URL must point to a public address"},
+		{"private network", "http://10.0.0.1/photo.png", "URL must point to a public address"},
+		{"unspecified", "http://0.0.0.0:" + port + "/photo.png", "URL must point to a public address"},
+		{"file scheme", "file:///etc/passwd", errInvalidFetchURL.Error()},
+		{"relative", "/photo.png", errInvalidFetchURL.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := uploadURL(t, user.token, tt.url)
+			expectStatus(t, rec, http.StatusBadRequest)
+			if resp := decodeResponse(t, rec, nil); resp.Errors["url"] != tt.error {
+				t.Errorf("url error %q, want %q", resp.Errors["url"], tt.error)
+			}
+		})
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("test server was fetched %d times", n)
+	}
+}
+
+func TestUploadURLRedirects(t *testing.T) {
+	user := newTestUser(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/photo.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(testPNG(t, 8, 8, testColor))
+		case "/to-photo":
+			http.Redirect(w, r, "/photo.png", http.StatusFound)
+		case "/to-private":
+			http.Redirect(w, r, "http://10.0.0.1/photo.png", http.StatusFound)
+		case "/to-file":
+			http.Redirect(w, r, "file:///etc/passwd", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	allowFetchFrom(t, srv)
+
+	rec := uploadURL(t, user.token, srv.URL+"/to-photo")
+	expectStatus(t, rec, http.StatusCreated)
+	var photo PhotoResponse
+	decodeResponse(t, rec, &photo)
+	if photo.Title != "Fetched" || photo.Category != "photography" {
+		t.Errorf("stored %q in %s, want Fetched in photography", photo.Title, photo.Category)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/to-private", http.StatusBadRequest},
+		{"/to-file", http.StatusBadRequest},
+		{"/loop", http.StatusBadRequest},
+		{"/page", http.StatusUnsupportedMediaType},
+		{"/missing", http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			expectStatus(t, uploadURL(t, user.token, srv.URL+tt.path), tt.status)
+		})
+	}
+}
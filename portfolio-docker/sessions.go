@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// Longest user agent kept with a session
+const maxSessionUserAgent = 255
+
+// How often a session's last use is written while its token is in use. A
+// short SESSION_IDLE_TIMEOUT shortens it, so sessions in use aren't mistaken
+// for idle ones.
+const sessionTouchInterval = time.Minute
+
+// SessionResponse describes a token issued to the user
+type SessionResponse struct {
+	ID         string `json:"id"`
+	CreatedAt  string `json:"createdAt,omitempty"`
+	LastUsedAt string `json:"lastUsedAt,omitempty"`
+	ExpiresAt  string `json:"expiresAt"`
+	IP         string `json:"ip"` // Address the token was last used from
+	UserAgent  string `json:"userAgent"`
+	// Admin who issued the token when it's for impersonation
+	ImpersonatedBy *int64 `json:"impersonatedBy,omitempty"`
+	Current        bool   `json:"current"` // Whether this is the token making the request
+}
+
+// Whether a session has gone unused for longer than SESSION_IDLE_TIMEOUT
+func sessionIdle(session db.Session) bool {
+	if sessionIdleTimeout == 0 {
+		return false
+	}
+	lastActive := session.LastUsedAt
+	if !lastActive.Valid {
+		lastActive = session.CreatedAt
+	}
+	return lastActive.Valid && time.Since(lastActive.Time) > sessionIdleTimeout
+}
+
+// Record a token about to be issued, returning the session ID to use as its
+// jti. Expired sessions of the user are dropped at the same time.
+func createSession(ctx context.Context, r *http.Request, userID int64, expiresAt time.Time, impersonatedBy sql.NullInt64) (string, error) {
+	if err := queries.DeleteExpiredSessionsByUser(ctx, userID); err != nil {
+		slog.Error("Failed to delete expired sessions", "user_id", userID, "error", err)
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxSessionUserAgent {
+		userAgent = userAgent[:maxSessionUserAgent]
+	}
+	id := generateID()
+	err := execWithRetry(ctx, func() error {
+		return queries.CreateSession(ctx, db.CreateSessionParams{
+			ID:             id,
+			UserID:         userID,
+			ExpiresAt:      expiresAt.UTC(),
+			Ip:             clientIP(r),
+			UserAgent:      userAgent,
+			ImpersonatedBy: impersonatedBy,
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// Check the session behind a token hasn't been revoked or gone idle, and
+// note that it was used. Tokens without a jti were issued before sessions
+// were recorded and are only subject to the token version check.
+func checkSession(r *http.Request, claims *Claims) error {
+	if claims.ID == "" {
+		return nil
+	}
+
+	ctx := requestContext(r)
+	session, err := queries.GetSession(ctx, claims.ID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (session.UserID != *claims.UserID || session.RevokedAt.Valid)) {
+		return &authError{"Session revoked"}
+	}
+	if err != nil {
+		return err
+	}
+	if sessionIdle(session) {
+		return &authError{"Session expired due to inactivity"}
+	}
+
+	// Failing to record the use shouldn't fail the request
+	touchInterval := sessionTouchInterval
+	if sessionIdleTimeout > 0 {
+		touchInterval = min(touchInterval, sessionIdleTimeout/10)
+	}
+	if !session.LastUsedAt.Valid || time.Since(session.LastUsedAt.Time) >= touchInterval {
+		err := queries.TouchSession(ctx, db.TouchSessionParams{Ip: clientIP(r), ID: session.ID})
+		if err != nil {
+			slog.Error("Failed to record session use", "session_id", session.ID, "error", err)
+		}
+	}
+	return nil
+}
+
+// List the signed-in user's unexpired, unrevoked sessions, most recently used
+// first. Sessions past SESSION_IDLE_TIMEOUT are left out, as they can no
+// longer be used.
+func listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+	claims := r.Context().Value("tokenClaims").(*Claims)
+
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sessions, err := queries.ListActiveSessionsByUser(requestContext(r), userID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		if sessionIdle(session) {
+			continue
+		}
+		item := SessionResponse{
+			ID:        session.ID,
+			ExpiresAt: formatTimestamp(session.ExpiresAt),
+			IP:        session.Ip,
+			UserAgent: session.UserAgent,
+			Current:   session.ID == claims.ID,
+		}
+		if session.CreatedAt.Valid {
+			item.CreatedAt = formatTimestamp(session.CreatedAt.Time)
+		}
+		if session.LastUsedAt.Valid {
+			item.LastUsedAt = formatTimestamp(session.LastUsedAt.Time)
+		}
+		if session.ImpersonatedBy.Valid {
+			adminID := session.ImpersonatedBy.Int64
+			item.ImpersonatedBy = &adminID
+		}
+		response = append(response, item)
+	}
+
+	// Idle sessions are only known once read, so pages are taken from what's
+	// left
+	total := int64(len(response))
+	start, end := pageBounds(len(response), page, pageSize)
+	setPaginationHeaders(w, r, page, pageSize, total)
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    newPaginatedResponse(response[start:end], page, pageSize, total),
+	})
+}
+
+// Revoke one of the signed-in user's sessions, so its token stops working.
+// Revoking the current session logs this client out.
+func revokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+	sessionID := mux.Vars(r)["id"]
+	ctx := requestContext(r)
+
+	revoked, err := withRetry(ctx, func() (int64, error) {
+		return queries.RevokeSession(ctx, db.RevokeSessionParams{ID: sessionID, UserID: userID})
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	err = execWithRetry(ctx, func() error {
+		return queries.CreateAuditLogEntry(ctx, db.CreateAuditLogEntryParams{
+			ActorID:    userID,
+			Action:     "revoke",
+			TargetType: "session",
+			TargetID:   sessionID,
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to write audit log entry", "action", "revoke", "session_id", sessionID, "error", err)
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Session revoked",
+	})
+}
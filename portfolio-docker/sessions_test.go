@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type sessionPage struct {
+	Items   []SessionResponse `json:"items"`
+	Total   int64             `json:"total"`
+	HasMore bool              `json:"hasMore"`
+}
+
+func listSessions(t *testing.T, token, query string) sessionPage {
+	t.Helper()
+	rec := doJSON(t, "GET", "/api/profile/sessions"+query, token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var page sessionPage
+	decodeResponse(t, rec, &page)
+	return page
+}
+
+func TestListSessions(t *testing.T) {
+	user := newTestUser(t)
+	logIn(t, user)
+	logIn(t, user)
+
+	page := listSessions(t, user.token, "")
+	if page.Total != 3 || len(page.Items) != 3 || page.HasMore {
+		t.Fatalf("got %d of %d sessions, hasMore %v; want all 3", len(page.Items), page.Total, page.HasMore)
+	}
+	current := 0
+	for _, session := range page.Items {
+		if session.Current {
+			current++
+		}
+	}
+	if current != 1 {
+		t.Errorf("%d sessions marked current, want 1", current)
+	}
+
+	page = listSessions(t, user.token, "?pageSize=2")
+	if page.Total != 3 || len(page.Items) != 2 || !page.HasMore {
+		t.Errorf("got %d of %d sessions, hasMore %v; want 2 with more", len(page.Items), page.Total, page.HasMore)
+	}
+	page = listSessions(t, user.token, "?page=2&pageSize=2")
+	if len(page.Items) != 1 || page.HasMore {
+		t.Errorf("got %d sessions on the last page, hasMore %v; want 1", len(page.Items), page.HasMore)
+	}
+
+	rec := doJSON(t, "GET", "/api/profile/sessions?pageSize=0", user.token, nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+}
+
+func TestRevokeSession(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	secondToken, _ := logIn(t, user)
+
+	var second SessionResponse
+	for _, session := range listSessions(t, secondToken, "").Items {
+		if session.Current {
+			second = session
+		}
+	}
+	otherSession := listSessions(t, other.token, "").Items[0]
+
+	tests := []struct {
+		name   string
+		id     string
+		status int
+	}{
+		{"another user's session", otherSession.ID, http.StatusNotFound},
+		{"unknown session", "no-such-session", http.StatusNotFound},
+		{"own session", second.ID, http.StatusOK},
+		{"already revoked", second.ID, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, "DELETE", "/api/profile/sessions/"+tt.id, user.token, nil)
+			expectStatus(t, rec, tt.status)
+		})
+	}
+
+	expectStatus(t, doJSON(t, "GET", "/api/profile", secondToken, nil), http.StatusUnauthorized)
+	expectStatus(t, doJSON(t, "GET", "/api/profile", other.token, nil), http.StatusOK)
+	if page := listSessions(t, user.token, ""); page.Total != 1 {
+		t.Errorf("%d sessions left, want 1", page.Total)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	secondToken, _ := logIn(t, user)
+
+	rec := doJSON(t, "POST", "/api/profile/logout-all", user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	for _, token := range []string{user.token, secondToken} {
+		expectStatus(t, doJSON(t, "GET", "/api/profile", token, nil), http.StatusUnauthorized)
+	}
+	expectStatus(t, doJSON(t, "GET", "/api/profile", other.token, nil), http.StatusOK)
+
+	// Logging in again issues a token for the new version
+	token, _ := logIn(t, user)
+	expectStatus(t, doJSON(t, "GET", "/api/profile", token, nil), http.StatusOK)
+}
+
+func TestTokenVersionChecked(t *testing.T) {
+	user := newTestUser(t)
+
+	// Bumped directly, so the token's session is still active and only its
+	// version is out of date
+	if _, err := queries.IncrementUserTokenVersion(context.Background(), user.id); err != nil {
+		t.Fatal(err)
+	}
+	expectStatus(t, doJSON(t, "GET", "/api/profile", user.token, nil), http.StatusUnauthorized)
+}
+
+// Set when the session behind a token was last used
+func setSessionLastUsed(t *testing.T, token string, ago time.Duration) {
+	t.Helper()
+	claims, err := parseJWT(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = dbConn.Exec(`UPDATE sessions SET last_used_at = ? WHERE id = ?`,
+		time.Now().UTC().Add(-ago).Format(time.DateTime), claims.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionIdleTimeout(t *testing.T) {
+	old := sessionIdleTimeout
+	sessionIdleTimeout = time.Hour
+	t.Cleanup(func() { sessionIdleTimeout = old })
+
+	user := newTestUser(t)
+	active, _ := logIn(t, user)
+	setSessionLastUsed(t, user.token, 2*time.Hour)
+	setSessionLastUsed(t, active, 30*time.Minute)
+
+	rec := doJSON(t, "GET", "/api/profile", user.token, nil)
+	expectStatus(t, rec, http.StatusUnauthorized)
+	if resp := decodeResponse(t, rec, nil); resp.Message != "Session expired due to inactivity" {
+		t.Errorf("message %q, want the inactivity one", resp.Message)
+	}
+
+	// Using a session keeps it alive
+	expectStatus(t, doJSON(t, "GET", "/api/profile", active, nil), http.StatusOK)
+	page := listSessions(t, active, "")
+	if page.Total != 1 || !page.Items[0].Current {
+		t.Fatalf("sessions = %+v, want only the active one", page)
+	}
+	if lastUsed, err := time.Parse(time.RFC3339, page.Items[0].LastUsedAt); err != nil || time.Since(lastUsed) > time.Minute {
+		t.Errorf("active session last used %q, want just now", page.Items[0].LastUsedAt)
+	}
+
+	// Without a timeout idle sessions stay valid
+	sessionIdleTimeout = 0
+	expectStatus(t, doJSON(t, "GET", "/api/profile", user.token, nil), http.StatusOK)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// Longest slug accepted for a photo
+const maxSlugLength = 64
+
+// Slugs are lowercase letters and digits in words joined by single hyphens,
+// so they're safe in a URL without escaping
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Path segments that follow a photo ID in API routes. A slug with one of
+// these names would be shadowed by that route.
+var reservedSlugs = map[string]bool{
+	"copy":      true,
+	"download":  true,
+	"file":      true,
+	"image":     true,
+	"move":      true,
+	"neighbors": true,
+	"original":  true,
+	"publish":   true,
+	"stats":     true,
+	"unpublish": true,
+	"variants":  true,
+}
+
+// Validate a photo slug, returning what's wrong with it or "" if it's fine
+func validateSlug(slug string) string {
+	if len(slug) > maxSlugLength {
+		return fmt.Sprintf("Slug must be at most %d characters", maxSlugLength)
+	}
+	if !slugPattern.MatchString(slug) {
+		return "Slug may only contain lowercase letters, digits and single hyphens between words"
+	}
+	if reservedSlugs[slug] {
+		return "Slug is reserved"
+	}
+	return ""
+}
+
+// Check that no other photo in the category uses the slug, writing the error
+// response if one does. photoID is the photo being given the slug, if it
+// already exists.
+func checkSlugAvailable(w http.ResponseWriter, ctx context.Context, category, slug, photoID string) bool {
+	taken, err := queries.CheckSlugExists(ctx, db.CheckSlugExistsParams{
+		Category: category,
+		Slug:     slug,
+		ID:       photoID,
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return false
+	}
+	if taken == 1 {
+		respondWithError(w, http.StatusConflict, "Slug already in use in this category")
+		return false
+	}
+	return true
+}
+
+// Public API URL of a photo, by slug when it has one and by ID otherwise
+func photoPermalink(scheme, host, category, photoID, slug string) string {
+	if slug == "" {
+		slug = photoID
+	}
+	return fmt.Sprintf("%s://%s/api/photos/%s/%s", scheme, host, category, slug)
+}
+
+// Fetch a single photo by its slug within a category. The raw ID is accepted
+// too, for photos without a slug.
+func getPhotoBySlugHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	category := vars["category"]
+	if !isValidCategory(category) {
+		respondInvalidCategory(w)
+		return
+	}
+
+	ctx := requestContext(r)
+	photo, err := queries.GetPhotoBySlug(ctx, db.GetPhotoBySlugParams{
+		Category: category,
+		Slug:     vars["slug"],
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		photo, err = queries.GetPhoto(ctx, vars["slug"])
+		if err == nil && photo.Category != category {
+			err = sql.ErrNoRows
+		}
+	}
+	if err == nil && !photoVisible(r, photo) {
+		err = sql.ErrNoRows
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Photo not found")
+		return
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	respondWithCacheableJSON(w, r, Response{
+		Success: true,
+		Data:    photoResponseFromRow(r, photo),
+	})
+}
+
+// Fetch a single photo by the name of its file within a category, for old
+// links that point at the file rather than the photo. Only bare stored names
+// are accepted, never paths.
+func getPhotoByFilenameHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	category := vars["category"]
+	if !isValidCategory(category) {
+		respondInvalidCategory(w)
+		return
+	}
+	filename := vars["filename"]
+	if filename == "" || strings.ContainsAny(filename, `/\`) || strings.HasPrefix(filename, ".") {
+		respondWithError(w, http.StatusBadRequest, "Invalid filename")
+		return
+	}
+
+	photo, err := queries.GetPhotoByFilename(requestContext(r), db.GetPhotoByFilenameParams{
+		Category: category,
+		Filename: filename,
+	})
+	if err == nil && !photoVisible(r, photo) {
+		err = sql.ErrNoRows
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Photo not found")
+		return
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	respondWithCacheableJSON(w, r, Response{
+		Success: true,
+		Data:    photoResponseFromRow(r, photo),
+	})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestValidateSlug(t *testing.T) {
+	tests := []struct {
+		slug  string
+		valid bool
+	}{
+		{"sunset", true},
+		{"sunset-over-the-bay-2024", true},
+		{strings.Repeat("a", maxSlugLength), true},
+		{strings.Repeat("a", maxSlugLength+1), false},
+		{"Sunset", false},
+		{"sunset--bay", false},
+		{"-sunset", false},
+		{"sunset-", false},
+		{"sun set", false},
+		{"sunset/bay", false},
+		{"", false},
+		{"move", false},
+		{"variants", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.slug, func(t *testing.T) {
+			if problem := validateSlug(tt.slug); (problem == "") != tt.valid {
+				t.Errorf("validateSlug(%q) = %q, want valid %v", tt.slug, problem, tt.valid)
+			}
+		})
+	}
+}
+
+// Upload a photo with a slug
+func uploadWithSlug(t *testing.T, token, category, slug string) *httptest.ResponseRecorder {
+	t.Helper()
+	contentType, body := multipartBody(t, "photo.png", "image/png", testPNG(t, 8, 8, testColor), map[string]string{
+		uploadTitleField:    "Slugged",
+		uploadCategoryField: category,
+		"altText":           "A slugged photo",
+		"slug":              slug,
+	})
+	return doRequest(t, "POST", "/api/photos/upload", token, contentType, body)
+}
+
+func TestPhotoSlugs(t *testing.T) {
+	user := newTestUser(t)
+	slug := "slug-test-" + strings.ToLower(randomPhotoID())
+
+	rec := uploadWithSlug(t, user.token, "photography", slug)
+	expectStatus(t, rec, http.StatusCreated)
+	var photo PhotoResponse
+	decodeResponse(t, rec, &photo)
+	if photo.Slug != slug || !strings.HasSuffix(photo.Permalink, "/api/photos/photography/"+slug) {
+		t.Errorf("slug %q, permalink %q; want %q in both", photo.Slug, photo.Permalink, slug)
+	}
+
+	// Fetched by slug, or by ID
+	for _, key := range []string{slug, photo.ID} {
+		rec = doJSON(t, "GET", "/api/photos/photography/"+key, "", nil)
+		expectStatus(t, rec, http.StatusOK)
+		var fetched PhotoResponse
+		decodeResponse(t, rec, &fetched)
+		if fetched.ID != photo.ID {
+			t.Errorf("GET by %q found %s, want %s", key, fetched.ID, photo.ID)
+		}
+	}
+	rec = doJSON(t, "GET", "/api/photos/digital-sketches/"+slug, "", nil)
+	expectStatus(t, rec, http.StatusNotFound)
+
+	// Unique within a category only
+	expectStatus(t, uploadWithSlug(t, user.token, "photography", slug), http.StatusConflict)
+	expectStatus(t, uploadWithSlug(t, user.token, "digital-sketches", slug), http.StatusCreated)
+	expectStatus(t, uploadWithSlug(t, user.token, "photography", "Not A Slug"), http.StatusBadRequest)
+
+	// Cleared with an empty string, which frees it
+	other := uploadTestPhoto(t, user.token, "photography")
+	rec = doJSON(t, "PATCH", "/api/photos/"+other.ID, user.token, PhotoUpdate{Slug: &slug})
+	expectStatus(t, rec, http.StatusConflict)
+	empty := ""
+	rec = doJSON(t, "PATCH", "/api/photos/"+photo.ID, user.token, PhotoUpdate{Slug: &empty})
+	expectStatus(t, rec, http.StatusOK)
+	rec = doJSON(t, "PATCH", "/api/photos/"+other.ID, user.token, PhotoUpdate{Slug: &slug})
+	expectStatus(t, rec, http.StatusOK)
+}
+
+func TestGetPhotoByFilename(t *testing.T) {
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+
+	rec := doJSON(t, "GET", "/api/photos/file/photography/"+photo.Filename, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var found PhotoResponse
+	decodeResponse(t, rec, &found)
+	if found.ID != photo.ID || found.Title != photo.Title {
+		t.Errorf("found %s %q, want %s %q", found.ID, found.Title, photo.ID, photo.Title)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"other category", "digital-sketches/" + photo.Filename, http.StatusNotFound},
+		{"unknown file", "photography/no-such-file.png", http.StatusNotFound},
+		{"invalid category", "paintings/" + photo.Filename, http.StatusBadRequest},
+		{"hidden file", "photography/.upload-123", http.StatusBadRequest},
+		{"backslash", "photography/..%5C" + photo.Filename, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectStatus(t, doJSON(t, "GET", "/api/photos/file/"+tt.path, "", nil), tt.status)
+		})
+	}
+
+	// Drafts are only found by their owner
+	expectStatus(t, doJSON(t, "POST", "/api/photos/"+photo.ID+"/unpublish", user.token, nil), http.StatusOK)
+	expectStatus(t, doJSON(t, "GET", "/api/photos/file/photography/"+photo.Filename, "", nil), http.StatusNotFound)
+	expectStatus(t, doJSON(t, "GET", "/api/photos/file/photography/"+photo.Filename, user.token, nil), http.StatusOK)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// PhotoTombstoneResponse marks a photo deleted since the client last synced
+type PhotoTombstoneResponse struct {
+	ID        string `json:"id"`
+	Category  string `json:"category"`
+	DeletedAt string `json:"deletedAt"`
+}
+
+// PhotoChangesResponse lists what changed since the client's last sync
+type PhotoChangesResponse struct {
+	Photos   []PhotoResponse          `json:"photos"`
+	Deleted  []PhotoTombstoneResponse `json:"deleted"`
+	SyncedAt string                   `json:"syncedAt"` // Pass as since on the next sync
+}
+
+// List photos created or updated at or after the since timestamp, along with
+// tombstones of photos deleted since then, for incremental client sync.
+// Without since every photo is returned. Timestamps have one-second
+// resolution, so changes in the second of syncedAt may be sent twice.
+func photoChangesHandler(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "since must be an RFC 3339 timestamp")
+			return
+		}
+		since = t.UTC()
+	}
+
+	// Taken before querying so changes made during the sync are picked up
+	// next time
+	syncedAt := time.Now().UTC().Truncate(time.Second)
+
+	ctx := requestContext(r)
+	rows, err := queries.ListPhotosChangedSince(ctx, since)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	tombstones, err := queries.ListPhotoTombstonesSince(ctx, since)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	response := PhotoChangesResponse{
+		Photos:   []PhotoResponse{},
+		Deleted:  []PhotoTombstoneResponse{},
+		SyncedAt: formatTimestamp(syncedAt),
+	}
+	for _, row := range rows {
+		// A photo unpublished since the last sync is gone as far as the
+		// client is concerned. Drafts that were never published are left
+		// out, so their IDs aren't given away.
+		if !photoVisible(r, row) {
+			if !row.WasPublished {
+				continue
+			}
+			hidden := PhotoTombstoneResponse{ID: row.ID, Category: row.Category}
+			if row.UpdatedAt.Valid {
+				hidden.DeletedAt = formatTimestamp(row.UpdatedAt.Time)
+			} else if row.CreatedAt.Valid {
+				hidden.DeletedAt = formatTimestamp(row.CreatedAt.Time)
+			}
+			response.Deleted = append(response.Deleted, hidden)
+			continue
+		}
+		response.Photos = append(response.Photos, photoResponseFromRow(r, row))
+	}
+	for _, tombstone := range tombstones {
+		deleted := PhotoTombstoneResponse{
+			ID:       tombstone.PhotoID,
+			Category: tombstone.Category,
+		}
+		if tombstone.DeletedAt.Valid {
+			deleted.DeletedAt = formatTimestamp(tombstone.DeletedAt.Time)
+		}
+		response.Deleted = append(response.Deleted, deleted)
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    response,
+	})
+}
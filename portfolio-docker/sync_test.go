@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+// Backdate a photo's creation, clearing any update
+func backdatePhoto(t *testing.T, id string) {
+	t.Helper()
+	if _, err := dbConn.Exec(`UPDATE photos SET created_at = datetime('now', '-2 hours'), updated_at = NULL WHERE id = ?`, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPhotoChanges(t *testing.T) {
+	user := newTestUser(t)
+	old := uploadTestPhoto(t, user.token, "photography")
+	updated := uploadTestPhoto(t, user.token, "photography")
+	deleted := uploadTestPhoto(t, user.token, "photography")
+	for _, photo := range []PhotoResponse{old, updated, deleted} {
+		backdatePhoto(t, photo.ID)
+	}
+	created := uploadTestPhoto(t, user.token, "photography")
+	title := "Updated"
+	rec := doJSON(t, "PATCH", "/api/photos/"+updated.ID, user.token, PhotoUpdate{Title: &title})
+	expectStatus(t, rec, http.StatusOK)
+	rec = doJSON(t, "DELETE", "/api/photos/"+deleted.ID, user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	rec = doJSON(t, "GET", "/api/photos?since=yesterday", "", nil)
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	since := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	rec = doJSON(t, "GET", "/api/photos?since="+since, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var changes PhotoChangesResponse
+	decodeResponse(t, rec, &changes)
+
+	var changed, removed []string
+	for _, photo := range changes.Photos {
+		changed = append(changed, photo.ID)
+	}
+	for _, tombstone := range changes.Deleted {
+		removed = append(removed, tombstone.ID)
+	}
+	if !slices.Contains(changed, created.ID) || !slices.Contains(changed, updated.ID) {
+		t.Errorf("changed = %v, want %s and %s", changed, created.ID, updated.ID)
+	}
+	if slices.Contains(changed, old.ID) || slices.Contains(removed, old.ID) {
+		t.Errorf("unchanged photo %s returned", old.ID)
+	}
+	if slices.Contains(changed, deleted.ID) || !slices.Contains(removed, deleted.ID) {
+		t.Errorf("deleted = %v, want a tombstone for %s", removed, deleted.ID)
+	}
+	if _, err := time.Parse(time.RFC3339, changes.SyncedAt); err != nil {
+		t.Errorf("syncedAt %q: %v", changes.SyncedAt, err)
+	}
+
+	// Nothing changed since the last sync
+	rec = doJSON(t, "GET", "/api/photos?since="+time.Now().Add(time.Hour).UTC().Format(time.RFC3339), "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	decodeResponse(t, rec, &changes)
+	if len(changes.Photos) != 0 || len(changes.Deleted) != 0 {
+		t.Errorf("changes after a future since = %d photos, %d deleted", len(changes.Photos), len(changes.Deleted))
+	}
+}
+
+func TestPhotoChangesDrafts(t *testing.T) {
+	user := newTestUser(t)
+	old := defaultPhotoStatus
+	defaultPhotoStatus = "draft"
+	t.Cleanup(func() { defaultPhotoStatus = old })
+	draft := uploadTestPhoto(t, user.token, "photography")
+	unpublished := uploadTestPhoto(t, user.token, "photography")
+	expectStatus(t, doJSON(t, "POST", "/api/photos/"+unpublished.ID+"/publish", user.token, nil), http.StatusOK)
+	expectStatus(t, doJSON(t, "POST", "/api/photos/"+unpublished.ID+"/unpublish", user.token, nil), http.StatusOK)
+
+	since := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	changes := func(token string) (changed, removed []string) {
+		t.Helper()
+		rec := doJSON(t, "GET", "/api/photos?since="+since, token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		var changes PhotoChangesResponse
+		decodeResponse(t, rec, &changes)
+		for _, photo := range changes.Photos {
+			changed = append(changed, photo.ID)
+		}
+		for _, tombstone := range changes.Deleted {
+			removed = append(removed, tombstone.ID)
+		}
+		return changed, removed
+	}
+
+	// A draft that was never published isn't mentioned; one that was
+	// published is gone as far as anonymous clients are concerned
+	changed, removed := changes("")
+	if slices.Contains(changed, draft.ID) || slices.Contains(removed, draft.ID) {
+		t.Errorf("anonymous sync mentions the fresh draft %s", draft.ID)
+	}
+	if slices.Contains(changed, unpublished.ID) || !slices.Contains(removed, unpublished.ID) {
+		t.Errorf("deleted = %v, want a tombstone for the unpublished %s", removed, unpublished.ID)
+	}
+
+	changed, removed = changes(user.token)
+	if !slices.Contains(changed, draft.ID) || !slices.Contains(changed, unpublished.ID) ||
+		slices.Contains(removed, draft.ID) || slices.Contains(removed, unpublished.ID) {
+		t.Errorf("owner's sync = %v changed, %v deleted, want both drafts changed", changed, removed)
+	}
+}
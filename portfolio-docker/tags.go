@@ -0,0 +1,164 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// Limits on tags: the length of one tag, how many a photo can carry, and how
+// many photos one batch request can change
+const (
+	maxTagLength    = 32
+	maxTagsPerPhoto = 20
+	maxTagBatchSize = 100
+)
+
+// TagBatchRequest adds and removes tags on several photos at once
+type TagBatchRequest struct {
+	IDs    []string `json:"ids"`
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// TagBatchFailure names a photo the batch couldn't change, and why
+type TagBatchFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// Split stored comma-separated tags, always returning a non-nil slice
+func splitTags(stored string) []string {
+	if stored == "" {
+		return []string{}
+	}
+	return strings.Split(stored, ",")
+}
+
+// Lowercase and trim tags, which must then look like slugs: letters, digits
+// and single hyphens. Returns what's wrong with the first invalid tag.
+func normalizeTags(tags []string) ([]string, string) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if len(tag) > maxTagLength {
+			return nil, fmt.Sprintf("Tags must be at most %d characters", maxTagLength)
+		}
+		if !slugPattern.MatchString(tag) {
+			return nil, fmt.Sprintf("Invalid tag %q: use letters, digits and single hyphens", tag)
+		}
+		normalized = append(normalized, tag)
+	}
+	return normalized, ""
+}
+
+// Add and remove tags on many photos in one transaction. Photos that don't
+// exist or belong to someone else are reported as failures without stopping
+// the rest; a database error rolls back the whole batch.
+func tagBatchHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+
+	var req TagBatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	if len(req.IDs) == 0 || len(req.IDs) > maxTagBatchSize {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("ids must list between 1 and %d photos", maxTagBatchSize))
+		return
+	}
+	if len(req.Add) == 0 && len(req.Remove) == 0 {
+		respondWithError(w, http.StatusBadRequest, "add or remove must list at least one tag")
+		return
+	}
+
+	add, problem := normalizeTags(req.Add)
+	if problem == "" {
+		req.Remove, problem = normalizeTags(req.Remove)
+	}
+	if problem != "" {
+		respondWithValidationErrors(w, map[string]string{"tags": problem})
+		return
+	}
+
+	ctx := requestContext(r)
+	admin, err := userIsAdmin(ctx, userID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := queries.WithTx(tx)
+	updated := 0
+	failures := []TagBatchFailure{}
+	for _, id := range req.IDs {
+		photo, err := qtx.GetPhoto(ctx, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			failures = append(failures, TagBatchFailure{ID: id, Error: "Photo not found"})
+			continue
+		}
+		if err != nil {
+			respondWithDatabaseError(w, err)
+			return
+		}
+		if photo.UserID != userID {
+			failures = append(failures, TagBatchFailure{ID: id, Error: "You can only edit your own photos"})
+			continue
+		}
+		if protectedCategories[photo.Category] && !admin {
+			failures = append(failures, TagBatchFailure{ID: id, Error: fmt.Sprintf("Only admins can change photos in the %s category", photo.Category)})
+			continue
+		}
+
+		current := splitTags(photo.Tags)
+		tags := slices.DeleteFunc(slices.Concat(current, add), func(tag string) bool {
+			return slices.Contains(req.Remove, tag)
+		})
+		slices.Sort(tags)
+		tags = slices.Compact(tags)
+		if len(tags) > maxTagsPerPhoto {
+			failures = append(failures, TagBatchFailure{ID: id, Error: fmt.Sprintf("A photo can have at most %d tags", maxTagsPerPhoto)})
+			continue
+		}
+		if strings.Join(tags, ",") == photo.Tags {
+			continue
+		}
+
+		err = qtx.UpdatePhotoTags(ctx, db.UpdatePhotoTagsParams{
+			Tags: strings.Join(tags, ","),
+			ID:   id,
+		})
+		if err != nil {
+			respondWithDatabaseError(w, err)
+			return
+		}
+		updated++
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: fmt.Sprintf("Updated tags on %d photos", updated),
+		Data: map[string]interface{}{
+			"updated":  updated,
+			"failures": failures,
+		},
+	})
+}
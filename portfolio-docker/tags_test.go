@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// tagBatchResult is the data of a tag batch response
+type tagBatchResult struct {
+	Updated  int               `json:"updated"`
+	Failures []TagBatchFailure `json:"failures"`
+}
+
+// Tags of a photo as served
+func photoTags(t *testing.T, photo PhotoResponse) []string {
+	t.Helper()
+	rec := doJSON(t, "GET", "/api/photos/"+photo.Category+"/"+photo.ID, "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var fetched PhotoResponse
+	decodeResponse(t, rec, &fetched)
+	return fetched.Tags
+}
+
+func TestTagBatch(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	a := uploadTestPhoto(t, user.token, "photography")
+	b := uploadTestPhoto(t, user.token, "photography")
+	theirs := uploadTestPhoto(t, other.token, "photography")
+
+	rec := doJSON(t, "POST", "/api/photos/tag-batch", user.token, TagBatchRequest{
+		IDs: []string{a.ID, b.ID},
+		Add: []string{" Landscape ", "sunset", "sunset"},
+	})
+	expectStatus(t, rec, http.StatusOK)
+	var result tagBatchResult
+	decodeResponse(t, rec, &result)
+	if result.Updated != 2 || len(result.Failures) != 0 {
+		t.Errorf("result = %+v, want 2 updated", result)
+	}
+
+	// Adding and removing at once, with failures reported per photo
+	rec = doJSON(t, "POST", "/api/photos/tag-batch", user.token, TagBatchRequest{
+		IDs:    []string{a.ID, theirs.ID, "no-such-photo"},
+		Add:    []string{"coast"},
+		Remove: []string{"sunset"},
+	})
+	expectStatus(t, rec, http.StatusOK)
+	decodeResponse(t, rec, &result)
+	var failed []string
+	for _, failure := range result.Failures {
+		failed = append(failed, failure.ID)
+	}
+	if result.Updated != 1 || !slices.Equal(failed, []string{theirs.ID, "no-such-photo"}) {
+		t.Errorf("result = %+v, want 1 updated and 2 failures", result)
+	}
+
+	if tags, want := photoTags(t, a), []string{"coast", "landscape"}; !slices.Equal(tags, want) {
+		t.Errorf("tags of a = %v, want %v", tags, want)
+	}
+	if tags, want := photoTags(t, b), []string{"landscape", "sunset"}; !slices.Equal(tags, want) {
+		t.Errorf("tags of b = %v, want %v", tags, want)
+	}
+	if tags := photoTags(t, theirs); len(tags) != 0 {
+		t.Errorf("another user's photo was tagged %v", tags)
+	}
+
+	// Unchanged photos aren't counted
+	rec = doJSON(t, "POST", "/api/photos/tag-batch", user.token, TagBatchRequest{IDs: []string{b.ID}, Add: []string{"sunset"}})
+	expectStatus(t, rec, http.StatusOK)
+	decodeResponse(t, rec, &result)
+	if result.Updated != 0 {
+		t.Errorf("updated = %d for a tag the photo had", result.Updated)
+	}
+}
+
+func TestTagBatchValidation(t *testing.T) {
+	user := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+	tests := []struct {
+		name string
+		req  TagBatchRequest
+	}{
+		{"no photos", TagBatchRequest{Add: []string{"a"}}},
+		{"no tags", TagBatchRequest{IDs: []string{photo.ID}}},
+		{"invalid tag", TagBatchRequest{IDs: []string{photo.ID}, Add: []string{"two words"}}},
+		{"too many photos", TagBatchRequest{IDs: make([]string, maxTagBatchSize+1), Add: []string{"a"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, "POST", "/api/photos/tag-batch", user.token, tt.req)
+			expectStatus(t, rec, http.StatusBadRequest)
+		})
+	}
+	if tags := photoTags(t, photo); len(tags) != 0 {
+		t.Errorf("rejected batches tagged the photo %v", tags)
+	}
+}
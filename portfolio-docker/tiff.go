@@ -0,0 +1,5 @@
+package main
+
+// Registers TIFF with image.Decode. TIFF uploads are converted on upload, as
+// browsers can't display them.
+import _ "golang.org/x/image/tiff"
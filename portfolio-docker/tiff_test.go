@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/tiff"
+)
+
+// Encode an opaque RGB TIFF, which the server converts to JPEG
+func testTIFF(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := tiff.Encode(&buf, img, &tiff.Options{Compression: tiff.Deflate}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// A little-endian TIFF header and IFD claiming the given dimensions, with a
+// single byte of pixel data
+func hostileTIFF(width, height uint32) []byte {
+	type entry struct {
+		tag, typ uint16
+		value    uint32
+	}
+	entries := []entry{
+		{256, 4, width},  // ImageWidth
+		{257, 4, height}, // ImageLength
+		{258, 3, 8},      // BitsPerSample
+		{259, 3, 1},      // Compression: none
+		{262, 3, 1},      // Photometric: black is zero
+		{273, 4, 0},      // StripOffsets, patched below
+		{278, 4, height}, // RowsPerStrip
+		{279, 4, 1},      // StripByteCounts
+	}
+	var buf bytes.Buffer
+	buf.WriteString("II*\x00")
+	binary.Write(&buf, binary.LittleEndian, uint32(8))
+	binary.Write(&buf, binary.LittleEndian, uint16(len(entries)))
+	dataOffset := uint32(8 + 2 + 12*len(entries) + 4)
+	for _, e := range entries {
+		if e.tag == 273 {
+			e.value = dataOffset
+		}
+		binary.Write(&buf, binary.LittleEndian, e.tag)
+		binary.Write(&buf, binary.LittleEndian, e.typ)
+		binary.Write(&buf, binary.LittleEndian, uint32(1))
+		binary.Write(&buf, binary.LittleEndian, e.value)
+	}
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+	buf.WriteByte(0)
+	return buf.Bytes()
+}
+
+// Upload a TIFF as a new photo
+func uploadTIFF(t *testing.T, token string, file []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	contentType, body := multipartBody(t, "scan.tiff", "image/tiff", file, map[string]string{
+		uploadTitleField:    "Scan",
+		uploadCategoryField: "photography",
+		"altText":           "A scan",
+	})
+	return doRequest(t, "POST", "/api/photos/upload", token, contentType, body)
+}
+
+func TestUploadConvertsTIFFToJPEG(t *testing.T) {
+	user := newTestUser(t)
+	rec := uploadTIFF(t, user.token, testTIFF(t, 16, 12))
+	expectStatus(t, rec, http.StatusCreated)
+
+	var photo PhotoResponse
+	decodeResponse(t, rec, &photo)
+	if !strings.HasSuffix(photo.Filename, ".jpg") {
+		t.Fatalf("stored as %q, want a .jpg", photo.Filename)
+	}
+	if format := storedImageFormat(filepath.Join(photoDir, "photography", photo.Filename)); format != "jpeg" {
+		t.Errorf("stored file is %q, want jpeg", format)
+	}
+}
+
+func TestUploadRejectsOversizedTIFF(t *testing.T) {
+	user := newTestUser(t)
+	tests := []struct {
+		name          string
+		width, height uint32
+	}{
+		{"both sides huge", 0xFFFFFFFF, 0xFFFFFFFF},
+		{"one side huge", 0xFFFFFFFF, 1},
+		{"too many pixels", 20000, 20000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := uploadTIFF(t, user.token, hostileTIFF(tt.width, tt.height))
+			expectStatus(t, rec, http.StatusBadRequest)
+		})
+	}
+}
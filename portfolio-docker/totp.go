@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+	"github.com/pquerna/otp/totp"
+)
+
+// Two-factor codes follow RFC 6238 with the parameters authenticator apps
+// assume when none are given: HMAC-SHA1, six digits, 30 second steps
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// Steps either side of the current one also accepted, allowing for clock
+	// drift and codes entered just as they change
+	totpSkew = 1
+)
+
+// How codes are computed for each time step, as HOTP values (RFC 4226)
+var totpValidateOpts = hotp.ValidateOpts{Digits: otp.Digits(totpDigits), Algorithm: otp.AlgorithmSHA1}
+
+// Backup codes issued at a time, and the random bytes in each. A code is
+// shown as two groups of four base32 characters.
+const (
+	totpBackupCodeCount = 10
+	totpBackupCodeBytes = 5
+)
+
+// Backup codes are shown in base32, like secrets
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TOTPEnrollment is a new secret for the user to add to their authenticator
+// app, either by scanning the URI as a QR code or typing the secret in, and
+// the backup codes that go with it
+type TOTPEnrollment struct {
+	Secret      string   `json:"secret"`
+	URI         string   `json:"uri"`
+	BackupCodes []string `json:"backupCodes"` // Only ever returned here; just hashes are kept
+}
+
+// TOTPCodeRequest is the body of a request confirming a two-factor code
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// Find the time step a code is valid for around now, if any. Steps are
+// checked one at a time, rather than with totp.Validate, because the step
+// is what stops a code being replayed.
+func matchTOTPCode(secret, code string, now time.Time) (int64, bool) {
+	step := now.Unix() / totpPeriod
+	for s := step - totpSkew; s <= step+totpSkew; s++ {
+		if ok, err := hotp.ValidateCustom(code, uint64(s), secret, totpValidateOpts); err == nil && ok {
+			return s, true
+		}
+	}
+	return 0, false
+}
+
+// Check a code against the user's enabled secret and use it up, so the same
+// code can't be replayed within its window
+func useTOTPCode(ctx context.Context, secret db.TotpSecret, code string) (bool, error) {
+	step, ok := matchTOTPCode(secret.Secret, code, time.Now())
+	if !ok || step <= secret.LastUsedStep {
+		return false, nil
+	}
+	used, err := withRetry(ctx, func() (int64, error) {
+		return queries.UseTOTPStep(ctx, db.UseTOTPStepParams{Step: step, UserID: secret.UserID})
+	})
+	return used == 1, err
+}
+
+// Hash a backup code for storage or lookup. Codes are random enough that a
+// plain hash suffices, and can then be looked up directly. Case, spaces and
+// the hyphen between the groups don't matter.
+func hashBackupCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Replace the user's backup codes with a new set, returning the codes
+func replaceBackupCodes(ctx context.Context, q *db.Queries, userID int64) ([]string, error) {
+	if err := q.DeleteTOTPBackupCodes(ctx, userID); err != nil {
+		return nil, err
+	}
+	codes := make([]string, totpBackupCodeCount)
+	key := make([]byte, totpBackupCodeBytes)
+	for i := range codes {
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(key))
+		codes[i] = code[:4] + "-" + code[4:]
+		err := q.CreateTOTPBackupCode(ctx, db.CreateTOTPBackupCodeParams{
+			UserID:   userID,
+			CodeHash: hashBackupCode(code),
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// Whether a code is shaped like one from an authenticator app rather than a
+// backup code
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Check the second factor of a login whose password was correct, responding
+// and returning false when the login can't go ahead. Users without two-factor
+// login enabled pass without a code. A backup code may be given in place of
+// the app's code, and is used up.
+func checkLoginTOTP(w http.ResponseWriter, ctx context.Context, userID int64, code string) bool {
+	secret, err := queries.GetTOTPSecret(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !secret.EnabledAt.Valid) {
+		return true
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return false
+	}
+
+	// The field error tells clients to prompt for the code and try again
+	code = strings.TrimSpace(code)
+	if code == "" {
+		respondWithJSON(w, http.StatusUnauthorized, Response{
+			Success: false,
+			Message: "Two-factor code required",
+			Errors:  map[string]string{"totpCode": "Two-factor code is required"},
+		})
+		return false
+	}
+
+	if wait, ok := reservePasswordAttempt(userID); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		respondWithError(w, http.StatusTooManyRequests, "Too many attempts, please try again later")
+		return false
+	}
+	var ok bool
+	if isTOTPCode(code) {
+		ok, err = useTOTPCode(ctx, secret, code)
+	} else {
+		var used int64
+		used, err = withRetry(ctx, func() (int64, error) {
+			return queries.UseTOTPBackupCode(ctx, db.UseTOTPBackupCodeParams{
+				UserID:   userID,
+				CodeHash: hashBackupCode(code),
+			})
+		})
+		ok = used == 1
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return false
+	}
+	if !ok {
+		slog.Warn("Two-factor code rejected", "user_id", userID)
+		respondWithJSON(w, http.StatusUnauthorized, Response{
+			Success: false,
+			Message: "Invalid two-factor code",
+			Errors:  map[string]string{"totpCode": "Invalid two-factor code"},
+		})
+		return false
+	}
+	resetPasswordAttempts(userID)
+	return true
+}
+
+// Start setting up two-factor login with a new secret and backup codes. Login
+// doesn't ask for a code until one from the secret is confirmed with the
+// verify endpoint; enrolling again before then replaces both.
+func enrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+	ctx := requestContext(r)
+
+	user, err := queries.GetUserByID(ctx, userID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{
+		Issuer:      totpIssuer,
+		AccountName: user.Email,
+		Period:      totpPeriod,
+		Digits:      totpValidateOpts.Digits,
+		Algorithm:   totpValidateOpts.Algorithm,
+	})
+	if err != nil {
+		respondWithInternalError(w, "Failed to generate secret", err)
+		return
+	}
+	secret := key.Secret()
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	qtx := queries.WithTx(tx)
+	stored, err := qtx.UpsertPendingTOTPSecret(ctx, db.UpsertPendingTOTPSecretParams{
+		UserID: userID,
+		Secret: secret,
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if stored == 0 {
+		respondWithError(w, http.StatusConflict, "Two-factor login is already enabled")
+		return
+	}
+	backupCodes, err := replaceBackupCodes(ctx, qtx, userID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    TOTPEnrollment{Secret: secret, URI: key.URL(), BackupCodes: backupCodes},
+	})
+}
+
+// Confirm the secret from enrollment with a code from the user's app, which
+// turns on two-factor login. Wrong codes count against the same limit as
+// password confirmations.
+func verifyTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+	ctx := requestContext(r)
+
+	var req TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	code := strings.TrimSpace(req.Code)
+	if code == "" {
+		respondWithValidationErrors(w, map[string]string{"code": "Code is required"})
+		return
+	}
+
+	secret, err := queries.GetTOTPSecret(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "Two-factor setup not started")
+		return
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if secret.EnabledAt.Valid {
+		respondWithError(w, http.StatusConflict, "Two-factor login is already enabled")
+		return
+	}
+
+	if wait, ok := reservePasswordAttempt(userID); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		respondWithError(w, http.StatusTooManyRequests, "Too many attempts, please try again later")
+		return
+	}
+	step, ok := matchTOTPCode(secret.Secret, code, time.Now())
+	if !ok {
+		respondWithValidationErrors(w, map[string]string{"code": "Invalid code"})
+		return
+	}
+
+	// The confirming code is used up, so it can't also be used to log in
+	enabled, err := withRetry(ctx, func() (int64, error) {
+		return queries.EnableTOTPSecret(ctx, db.EnableTOTPSecretParams{LastUsedStep: step, UserID: userID})
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if enabled == 0 {
+		respondWithError(w, http.StatusConflict, "Two-factor login is already enabled")
+		return
+	}
+	resetPasswordAttempts(userID)
+
+	err = execWithRetry(ctx, func() error {
+		return queries.CreateAuditLogEntry(ctx, db.CreateAuditLogEntryParams{
+			ActorID:    userID,
+			Action:     "enable",
+			TargetType: "totp",
+			TargetID:   strconv.FormatInt(userID, 10),
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to write audit log entry", "action", "enable", "user_id", userID, "error", err)
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Two-factor login enabled",
+	})
+}
+
+// Replace the signed-in user's backup codes with a new set, such as when the
+// old ones are used up or lost. The new codes are returned only this once.
+func regenerateBackupCodesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+	ctx := requestContext(r)
+
+	secret, err := queries.GetTOTPSecret(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !secret.EnabledAt.Valid) {
+		respondWithError(w, http.StatusConflict, "Two-factor login is not enabled")
+		return
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	tx, err := dbConn.Begin()
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	defer tx.Rollback()
+
+	backupCodes, err := replaceBackupCodes(ctx, queries.WithTx(tx), userID)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	err = execWithRetry(ctx, func() error {
+		return queries.CreateAuditLogEntry(ctx, db.CreateAuditLogEntryParams{
+			ActorID:    userID,
+			Action:     "regenerate_backup_codes",
+			TargetType: "totp",
+			TargetID:   strconv.FormatInt(userID, 10),
+		})
+	})
+	if err != nil {
+		slog.Error("Failed to write audit log entry", "action", "regenerate_backup_codes", "user_id", userID, "error", err)
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Message: "Backup codes regenerated",
+		Data:    map[string][]string{"backupCodes": backupCodes},
+	})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+// Enroll a user in two-factor login and confirm it with the current code,
+// returning the enrollment
+func enrollTOTP(t *testing.T, user testUser) TOTPEnrollment {
+	t.Helper()
+	rec := doJSON(t, "POST", "/api/profile/2fa/enroll", user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var enrollment TOTPEnrollment
+	decodeResponse(t, rec, &enrollment)
+
+	rec = doJSON(t, "POST", "/api/profile/2fa/verify", user.token, TOTPCodeRequest{Code: totpCodeAt(t, enrollment.Secret, time.Now())})
+	expectStatus(t, rec, http.StatusOK)
+	return enrollment
+}
+
+func totpCodeAt(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	code, err := totp.GenerateCode(secret, at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	user := newTestUser(t)
+	enrollment := enrollTOTP(t, user)
+	if len(enrollment.BackupCodes) != totpBackupCodeCount {
+		t.Fatalf("got %d backup codes, want %d", len(enrollment.BackupCodes), totpBackupCodeCount)
+	}
+
+	// The code used to confirm enrollment is spent; the next step's isn't
+	verifyCode := totpCodeAt(t, enrollment.Secret, time.Now())
+	nextCode := totpCodeAt(t, enrollment.Secret, time.Now().Add(totpPeriod*time.Second))
+	wrongCode := "000000"
+	if wrongCode == nextCode {
+		wrongCode = "111111"
+	}
+	tests := []struct {
+		name   string
+		code   string
+		status int
+	}{
+		{"no code", "", http.StatusUnauthorized},
+		{"confirming code replayed", verifyCode, http.StatusUnauthorized},
+		{"wrong code", wrongCode, http.StatusUnauthorized},
+		{"next code", nextCode, http.StatusOK},
+		{"next code replayed", nextCode, http.StatusUnauthorized},
+		{"backup code", enrollment.BackupCodes[0], http.StatusOK},
+		{"backup code reused", enrollment.BackupCodes[0], http.StatusUnauthorized},
+		{"backup code, other case and no hyphen", "  " + strings.ToUpper(strings.ReplaceAll(enrollment.BackupCodes[1], "-", "")), http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, "POST", "/api/login", "", Credentials{Email: user.email, Password: user.password, TOTPCode: tt.code})
+			expectStatus(t, rec, tt.status)
+			resp := decodeResponse(t, rec, nil)
+			if tt.status == http.StatusOK && resp.Token == "" {
+				t.Error("login succeeded without a token")
+			}
+			if tt.status == http.StatusUnauthorized && resp.Errors["totpCode"] == "" {
+				t.Errorf("401 without a totpCode field error: %+v", resp)
+			}
+		})
+	}
+}
+
+// Hashes of a user's unused backup codes, as stored
+func storedBackupCodes(t *testing.T, userID int64) []string {
+	t.Helper()
+	rows, err := dbConn.Query(`SELECT code_hash FROM totp_backup_codes WHERE user_id = ? AND used_at IS NULL`, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	hashes := []string{}
+	for rows.Next() {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(hashes)
+	return hashes
+}
+
+func TestRegenerateBackupCodes(t *testing.T) {
+	user := newTestUser(t)
+	expectStatus(t, doJSON(t, "POST", "/api/profile/2fa/backup-codes", user.token, nil), http.StatusConflict)
+	enrollment := enrollTOTP(t, user)
+	t.Cleanup(func() { resetPasswordAttempts(user.id) })
+
+	rec := doJSON(t, "POST", "/api/profile/2fa/backup-codes", user.token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var regenerated struct {
+		BackupCodes []string `json:"backupCodes"`
+	}
+	decodeResponse(t, rec, &regenerated)
+	codes := regenerated.BackupCodes
+	if len(codes) != totpBackupCodeCount || slices.ContainsFunc(codes, func(code string) bool { return slices.Contains(enrollment.BackupCodes, code) }) {
+		t.Fatalf("regenerated %v, want %d new codes", codes, totpBackupCodeCount)
+	}
+
+	// Only hashes are stored
+	want := []string{}
+	for _, code := range codes {
+		want = append(want, hashBackupCode(code))
+	}
+	slices.Sort(want)
+	if got := storedBackupCodes(t, user.id); !slices.Equal(got, want) {
+		t.Errorf("stored %v, want the hashes %v", got, want)
+	}
+
+	login := func(code string) int {
+		t.Helper()
+		return doJSON(t, "POST", "/api/login", "", Credentials{Email: user.email, Password: user.password, TOTPCode: code}).Code
+	}
+	if status := login(enrollment.BackupCodes[0]); status != http.StatusUnauthorized {
+		t.Errorf("replaced backup code: status = %d, want 401", status)
+	}
+	if status := login(codes[0]); status != http.StatusOK {
+		t.Errorf("new backup code: status = %d, want 200", status)
+	}
+	if status := login(codes[0]); status != http.StatusUnauthorized {
+		t.Errorf("new backup code reused: status = %d, want 401", status)
+	}
+	if got := len(storedBackupCodes(t, user.id)); got != totpBackupCodeCount-1 {
+		t.Errorf("%d unused backup codes left, want %d", got, totpBackupCodeCount-1)
+	}
+}
+
+func TestLoginWithTOTPIsRateLimited(t *testing.T) {
+	user := newTestUser(t)
+	enrollment := enrollTOTP(t, user)
+	t.Cleanup(func() { resetPasswordAttempts(user.id) })
+
+	for range verifyPasswordMaxAttempts {
+		rec := doJSON(t, "POST", "/api/login", "", Credentials{Email: user.email, Password: user.password, TOTPCode: "not-a-backup-code"})
+		expectStatus(t, rec, http.StatusUnauthorized)
+	}
+
+	// Out of attempts, even the right code is refused
+	code := totpCodeAt(t, enrollment.Secret, time.Now().Add(totpPeriod*time.Second))
+	rec := doJSON(t, "POST", "/api/login", "", Credentials{Email: user.email, Password: user.password, TOTPCode: code})
+	expectStatus(t, rec, http.StatusTooManyRequests)
+}
+
+func TestMatchTOTPCode(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXP"
+	now := time.Unix(1_700_000_000, 0)
+	step := now.Unix() / totpPeriod
+	tests := []struct {
+		name     string
+		at       time.Time
+		wantStep int64
+		ok       bool
+	}{
+		{"current step", now, step, true},
+		{"previous step", now.Add(-totpPeriod * time.Second), step - 1, true},
+		{"next step", now.Add(totpPeriod * time.Second), step + 1, true},
+		{"outside the skew", now.Add(-3 * totpPeriod * time.Second), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := matchTOTPCode(secret, totpCodeAt(t, secret, tt.at), now)
+			if ok != tt.ok || got != tt.wantStep {
+				t.Errorf("matchTOTPCode = %d, %v; want %d, %v", got, ok, tt.wantStep, tt.ok)
+			}
+		})
+	}
+	if _, ok := matchTOTPCode(secret, "12345", now); ok {
+		t.Error("short code matched")
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Instrumentation scope spans are recorded under
+const tracerName = "github.com/meduaq/portfolio-backend"
+
+// Export spans if an OTLP endpoint is configured, and otherwise install a
+// no-op provider so spans cost nothing. The traces endpoint is used as is;
+// the general one has the standard path appended. Callers continue traces
+// passed in the W3C traceparent header.
+func initTracing() {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	endpoint := otlpTracesEndpoint
+	if endpoint == "" && otlpEndpoint != "" {
+		endpoint = strings.TrimSuffix(otlpEndpoint, "/") + "/v1/traces"
+	}
+	if endpoint == "" {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		return
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(endpoint),
+		otlptracehttp.WithHeaders(parseOTLPHeaders(otlpHeaders)),
+	)
+	if err != nil {
+		log.Fatalf("Invalid OTLP exporter settings: %v", err)
+	}
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(otelServiceName))),
+	))
+	slog.Info("Tracing enabled", "endpoint", endpoint, "protocol", otlpProtocol, "service", otelServiceName)
+}
+
+// Parse OTEL_EXPORTER_OTLP_HEADERS, a comma-separated list of key=value
+// pairs with URL-encoded values
+func parseOTLPHeaders(value string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(val); err == nil {
+			val = unescaped
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return headers
+}
+
+// Start a span as a child of the one in ctx. Outside a traced request there
+// is no parent and nothing is recorded, so background work doesn't start
+// traces of its own.
+func startSpan(ctx context.Context, name string, kind trace.SpanKind) (context.Context, trace.Span) {
+	parent := trace.SpanFromContext(ctx)
+	if !parent.SpanContext().IsValid() {
+		return ctx, parent
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithSpanKind(kind))
+}
+
+// Mark a span as failed unless err is nil. sql.ErrNoRows is an expected
+// result rather than a failure.
+func recordSpanError(s trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		s.RecordError(err)
+		s.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// tracingMiddleware records a server span for each routed request, named
+// after its route template. A trace started by the caller is continued.
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, s := otel.Tracer(tracerName).Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", r.URL.Path),
+			),
+		)
+		defer s.End()
+		if requestID, ok := r.Context().Value("requestID").(string); ok {
+			s.SetAttributes(attribute.String("request.id", requestID))
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		s.SetAttributes(attribute.Int("http.response.status_code", rec.status))
+		if rec.status >= 500 {
+			s.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// Context for the database and file work of a request. It carries the
+// request's span but, like context.Background(), isn't cancelled when the
+// client goes away, so work that has started still finishes.
+func requestContext(r *http.Request) context.Context {
+	return context.WithoutCancel(r.Context())
+}
+
+// tracedDB records a client span for each query made through it. Spans are
+// named after the sqlc query. Queries returning rows are timed until the
+// first row is ready rather than until the rows are read.
+type tracedDB struct {
+	*sql.DB
+}
+
+func (t tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, s := startQuerySpan(ctx, query)
+	defer s.End()
+	result, err := t.DB.ExecContext(ctx, query, args...)
+	recordSpanError(s, err)
+	return result, err
+}
+
+func (t tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, s := startQuerySpan(ctx, query)
+	defer s.End()
+	rows, err := t.DB.QueryContext(ctx, query, args...)
+	recordSpanError(s, err)
+	return rows, err
+}
+
+func (t tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, s := startQuerySpan(ctx, query)
+	defer s.End()
+	row := t.DB.QueryRowContext(ctx, query, args...)
+	recordSpanError(s, row.Err())
+	return row
+}
+
+// Start a span for a query, named by the "-- name: X :kind" comment sqlc
+// puts at the start of each
+func startQuerySpan(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := "query"
+	if rest, ok := strings.CutPrefix(query, "-- name:"); ok {
+		if fields := strings.Fields(rest); len(fields) > 0 {
+			name = fields[0]
+		}
+	}
+	ctx, s := startSpan(ctx, "db "+name, trace.SpanKindClient)
+	s.SetAttributes(
+		attribute.String("db.system", "sqlite"),
+		attribute.String("db.operation.name", name),
+	)
+	return ctx, s
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Record spans in memory for the rest of the test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+// The ended span with the given name prefix, failing when there's none
+func findSpan(t *testing.T, recorder *tracetest.SpanRecorder, prefix string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	for _, s := range recorder.Ended() {
+		if strings.HasPrefix(s.Name(), prefix) {
+			return s
+		}
+	}
+	t.Fatalf("no span named %q...", prefix)
+	return nil
+}
+
+func spanAttribute(s sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range s.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracingContinuesCallerTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	req := httptest.NewRequest("GET", "/api/photos/photography", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	testHandler.ServeHTTP(rec, req)
+	expectStatus(t, rec, http.StatusOK)
+
+	server := findSpan(t, recorder, "GET /api/photos/{category}")
+	if server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("server span kind = %v", server.SpanKind())
+	}
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("trace ID = %s, want the caller's", got)
+	}
+	if got := server.Parent().SpanID().String(); got != "00f067aa0ba902b7" || !server.Parent().IsRemote() {
+		t.Errorf("parent = %s, want the caller's span", got)
+	}
+	if got := spanAttribute(server, "http.response.status_code").AsInt64(); got != http.StatusOK {
+		t.Errorf("status code attribute = %d", got)
+	}
+
+	query := findSpan(t, recorder, "db ")
+	if query.SpanKind() != trace.SpanKindClient || query.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("query span %q isn't a client child of the request span", query.Name())
+	}
+}
+
+func TestTracingStartsTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	rec := doRequest(t, "GET", "/api/health", "", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+
+	server := findSpan(t, recorder, "GET /api/health")
+	if !server.SpanContext().IsValid() || server.Parent().IsValid() {
+		t.Errorf("want a new root span, got parent %v", server.Parent())
+	}
+}
+
+func TestStartSpanOutsideTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	_, s := startSpan(context.Background(), "background", trace.SpanKindInternal)
+	s.End()
+	if s.IsRecording() || len(recorder.Ended()) != 0 {
+		t.Error("span recorded outside a traced request")
+	}
+}
+
+func TestInitTracingWithoutEndpointIsNoop(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	otlpEndpoint, otlpTracesEndpoint = "", ""
+	initTracing()
+
+	_, s := otel.Tracer(tracerName).Start(context.Background(), "span")
+	defer s.End()
+	if s.IsRecording() || s.SpanContext().IsValid() {
+		t.Error("span recorded with no endpoint configured")
+	}
+}
+
+func TestParseOTLPHeaders(t *testing.T) {
+	got := parseOTLPHeaders("api-key=secret%20value, x-team = photos,malformed")
+	want := map[string]string{"api-key": "secret value", "x-team": "photos"}
+	if len(got) != len(want) {
+		t.Fatalf("parseOTLPHeaders = %v, want %v", got, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("header %s = %q, want %q", key, got[key], value)
+		}
+	}
+}
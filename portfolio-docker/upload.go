@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// Largest accepted text field of an upload form
+const maxUploadFieldBytes = 64 << 10
+
+// uploadForm is a multipart upload read as a stream. The photo part is
+// spooled to a hidden temporary file in photoDir, so memory use doesn't grow
+// with the file size and the file can be renamed into its category directory.
+type uploadForm struct {
+	fileField   string // Name of the file part
+	imagesOnly  bool
+	fields      map[string]string
+	tempPath    string
+	filename    string // As sent by the client
+	contentType string
+	size        int64
+}
+
+// Value of a text field, or "" when the form didn't include it
+func (f *uploadForm) value(name string) string {
+	return f.fields[name]
+}
+
+// Move the spooled photo to its final path. After this cleanup leaves it
+// alone.
+func (f *uploadForm) moveTo(path string) error {
+	// Temporary files are private; stored photos are readable like any
+	// other created file
+	if err := os.Chmod(f.tempPath, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(f.tempPath, path); err != nil {
+		return err
+	}
+	f.tempPath = ""
+	return nil
+}
+
+// Remove the spooled photo unless it has been moved into place
+func (f *uploadForm) cleanup() {
+	if f.tempPath != "" {
+		os.Remove(f.tempPath)
+	}
+}
+
+// Check at startup that the configured upload field names are distinct, as
+// one field can't carry two values
+func validateUploadFieldNames() {
+	names := []string{uploadFileField, uploadTitleField, uploadCategoryField}
+	for i, name := range names {
+		if slices.Contains(names[i+1:], name) {
+			log.Fatalf("UPLOAD_FILE_FIELD, UPLOAD_TITLE_FIELD and UPLOAD_CATEGORY_FIELD must differ: %q is used twice", name)
+		}
+	}
+}
+
+// Read a multipart upload of at most MAX_UPLOAD_BYTES part by part. Text
+// fields may come before or after the photo part, named by
+// UPLOAD_FILE_FIELD, which must be an image. Writes the error response on
+// failure; on success the caller must call cleanup.
+func readUploadForm(w http.ResponseWriter, r *http.Request) (*uploadForm, bool) {
+	return readSpooledForm(w, r, uploadFileField, true, maxUploadBytes)
+}
+
+// Read a multipart form of at most maxBytes, spooling the part named
+// fileField to disk as readUploadForm does for photos. Zero maxBytes means
+// unlimited.
+func readSpooledForm(w http.ResponseWriter, r *http.Request, fileField string, imagesOnly bool, maxBytes int64) (*uploadForm, bool) {
+	if maxBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Failed to parse form")
+		return nil, false
+	}
+
+	form := &uploadForm{fileField: fileField, imagesOnly: imagesOnly, fields: map[string]string{}}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = readUploadPart(form, part)
+			part.Close()
+		}
+		if err != nil {
+			form.cleanup()
+			respondUploadError(w, err, maxBytes)
+			return nil, false
+		}
+	}
+
+	if form.tempPath == "" {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Failed to get file from form field %q", fileField))
+		return nil, false
+	}
+	return form, true
+}
+
+// Problems with an upload that the client caused
+var (
+	errNotAnImage    = errors.New("file must be an image")
+	errSecondFile    = errors.New("more than one file part")
+	errFieldTooLarge = errors.New("form field too large")
+)
+
+func readUploadPart(form *uploadForm, part *multipart.Part) error {
+	if part.FileName() == "" {
+		value, err := io.ReadAll(io.LimitReader(part, maxUploadFieldBytes+1))
+		if err != nil {
+			return err
+		}
+		if len(value) > maxUploadFieldBytes {
+			return errFieldTooLarge
+		}
+		form.fields[part.FormName()] = string(value)
+		return nil
+	}
+
+	// Other file parts are skipped; the multipart reader discards them
+	if part.FormName() != form.fileField {
+		return nil
+	}
+	if form.tempPath != "" {
+		return errSecondFile
+	}
+	form.contentType = part.Header.Get("Content-Type")
+	if form.imagesOnly && !strings.HasPrefix(form.contentType, "image/") {
+		return errNotAnImage
+	}
+
+	temp, err := os.CreateTemp(photoDir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	form.tempPath = temp.Name()
+	form.filename = part.FileName()
+	form.size, err = io.Copy(temp, part)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Report a failed upload read. Failures writing the spooled file are the
+// server's; anything else is a malformed or oversized request.
+func respondUploadError(w http.ResponseWriter, err error, maxBytes int64) {
+	var tooLarge *http.MaxBytesError
+	var pathErr *os.PathError
+	switch {
+	case errors.As(err, &tooLarge):
+		respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Upload exceeds the %d byte limit", maxBytes))
+	case errors.Is(err, errNotAnImage):
+		respondWithError(w, http.StatusBadRequest, "File must be an image")
+	case errors.Is(err, errSecondFile):
+		respondWithError(w, http.StatusBadRequest, "Only one file can be uploaded at a time")
+	case errors.Is(err, errFieldTooLarge):
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Form fields must be at most %d bytes", maxUploadFieldBytes))
+	case errors.As(err, &pathErr):
+		respondWithInternalError(w, "Failed to save file", err)
+	default:
+		respondWithError(w, http.StatusBadRequest, "Failed to parse form")
+	}
+}
+
+// Periodically remove spooled uploads that outlived their request. Requests
+// clean up after themselves, so these are left only when the server stopped
+// mid-upload. Runs until the process exits.
+func startTempSweeper() {
+	go func() {
+		ticker := time.NewTicker(tempSweepInterval)
+		defer ticker.Stop()
+		for {
+			sweepUploadTemps()
+			<-ticker.C
+		}
+	}()
+}
+
+// Remove spooled uploads older than TEMP_FILE_MAX_AGE. Files still being
+// written have a recent modification time, so they're left alone.
+func sweepUploadTemps() {
+	matches, err := filepath.Glob(filepath.Join(photoDir, ".upload-*"))
+	if err != nil {
+		return
+	}
+
+	removed := 0
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || time.Since(info.ModTime()) < tempFileMaxAge {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			slog.Warn("Failed to remove stale upload", "path", path, "error", err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		slog.Info("Removed stale uploads", "count", removed)
+	}
+}
+
+// photoFields is the validated metadata of a new photo
+type photoFields struct {
+	title    string
+	category string
+	altText  string
+	caption  string
+	slug     string
+	status   string
+}
+
+// Validate a new photo's metadata, filling in defaults: the alt text falls
+// back to the title and the status to DEFAULT_PHOTO_STATUS. Writes the error
+// response on failure.
+func checkPhotoFields(w http.ResponseWriter, ctx context.Context, fields *photoFields) bool {
+	// Screen readers need something to announce; fall back to the title
+	if fields.altText == "" {
+		fields.altText = fields.title
+	}
+
+	if !isValidCategory(fields.category) {
+		respondInvalidCategory(w)
+		return false
+	}
+
+	// New photos are published unless the upload asks for a draft
+	if fields.status == "" {
+		fields.status = defaultPhotoStatus
+	} else if !isValidPhotoStatus(fields.status) {
+		respondWithValidationErrors(w, map[string]string{"status": "Status must be draft or published"})
+		return false
+	}
+
+	// Validate the optional slug and make sure it's free in the category
+	if fields.slug != "" {
+		if problem := validateSlug(fields.slug); problem != "" {
+			respondWithValidationErrors(w, map[string]string{"slug": problem})
+			return false
+		}
+		if !checkSlugAvailable(w, ctx, fields.category, fields.slug, "") {
+			return false
+		}
+	}
+	return true
+}
+
+// Failure writing a photo's files, as opposed to a problem with the image or
+// a database error
+var errStoreFailed = errors.New("failed to save file")
+
+// unsupportedFormatError is an image in a format that browsers can't
+// display and the server can't convert, or that its category doesn't accept
+type unsupportedFormatError struct {
+	problem string
+}
+
+func (e *unsupportedFormatError) Error() string {
+	return e.problem
+}
+
+// Store a spooled image as a new photo of userID: decode it, move it into
+// its category directory, write its derivatives and record it. The caller
+// has validated the fields, checked the quota and holds an image slot.
+// Nothing is left behind on failure.
+func storePhoto(ctx context.Context, userID int64, form *uploadForm, fields photoFields) (db.Photo, error) {
+	// Browsers can't display HEIC or TIFF; TIFF is converted once decoded,
+	// but HEIC can't be decoded here at all
+	if problem := checkUploadFormat(form.tempPath); problem != "" {
+		return db.Photo{}, &unsupportedFormatError{problem: problem}
+	}
+
+	// Decode before storing anything, so a truncated or corrupt file never
+	// gets a row or a place in the category directory
+	img, format, err := decodeImageFile(form.tempPath)
+	if errors.Is(err, errCorruptImage) {
+		return db.Photo{}, err
+	}
+	if err != nil {
+		return db.Photo{}, fmt.Errorf("%w: %v", errStoreFailed, err)
+	}
+	if problem := checkCategoryFormat(fields.category, format); problem != "" {
+		return db.Photo{}, &unsupportedFormatError{problem: problem}
+	}
+
+	// Generate unique filename. The name the client sent is only kept as
+	// metadata, and only when PRESERVE_FILENAMES is set.
+	originalFilename := ""
+	if preserveFilenames {
+		originalFilename = sanitizeFilename(form.filename)
+	}
+	photoID, err := generatePhotoID(ctx)
+	if err != nil {
+		return db.Photo{}, err
+	}
+	filename := photoID + formatExtensions[format]
+
+	// Move the spooled file into its category directory
+	categoryDir := filepath.Join(photoDir, fields.category)
+	destPath := filepath.Join(categoryDir, filename)
+	if err := form.moveTo(destPath); err != nil {
+		return db.Photo{}, fmt.Errorf("%w: %v", errStoreFailed, err)
+	}
+	written := form.size
+
+	// Extract the capture date from EXIF when present
+	var capturedAt sql.NullTime
+	if t, ok := readCaptureTime(destPath); ok {
+		capturedAt = sql.NullTime{Time: t, Valid: true}
+	}
+
+	// Convert formats browsers can't display, and downscale oversized images
+	var original string
+	if format == "tiff" {
+		destPath, img, original, err = convertImageFile(destPath, img)
+		filename = filepath.Base(destPath)
+	} else {
+		img, original, err = downscaleImageFile(destPath, img, format)
+	}
+	if err != nil {
+		os.Remove(destPath)
+		return db.Photo{}, fmt.Errorf("%w: %v", errStoreFailed, err)
+	}
+	if info, err := os.Stat(destPath); err == nil {
+		written = info.Size()
+	}
+
+	// Extract a color palette and blurhash for placeholders while the image
+	// loads, and a thumbnail
+	colors := extractPalette(img, paletteSize)
+	blurhash := encodeBlurhash(img)
+	thumbnail, err := writeThumbnail(img, categoryDir, photoID)
+	if err != nil {
+		slog.Error("Failed to write thumbnail", "photo_id", photoID, "error", err)
+	}
+
+	// Photos whose presets couldn't be written are retried at the next
+	// startup, as their spec won't match
+	presets := presetsSpec
+	presetPaths, err := writePresets(img, categoryDir, photoID)
+	if err != nil {
+		slog.Error("Failed to write presets", "photo_id", photoID, "error", err)
+		removeDerivatives(categoryDir, presetPaths...)
+		presets = ""
+	}
+
+	// Record the photo so it counts towards the uploader's quota
+	row, err := createPhotoWithinLimits(ctx, db.CreatePhotoParams{
+		ID:               photoID,
+		UserID:           userID,
+		Filename:         filename,
+		Title:            fields.title,
+		Category:         fields.category,
+		SizeBytes:        written,
+		CapturedAt:       capturedAt,
+		AltText:          fields.altText,
+		Caption:          fields.caption,
+		Colors:           strings.Join(colors, ","),
+		Blurhash:         blurhash,
+		Thumbnail:        thumbnail,
+		Original:         original,
+		Slug:             fields.slug,
+		Status:           fields.status,
+		OriginalFilename: originalFilename,
+		Presets:          presets,
+		Width:            int64(img.Bounds().Dx()),
+		Height:           int64(img.Bounds().Dy()),
+	})
+	if err != nil {
+		os.Remove(destPath)
+		removeDerivatives(categoryDir, thumbnail, original)
+		removeDerivatives(categoryDir, presetPaths...)
+		return db.Photo{}, err
+	}
+	return row, nil
+}
+
+// Report a photo storePhoto couldn't store
+func respondStoreError(w http.ResponseWriter, err error) {
+	var formatErr *unsupportedFormatError
+	var quotaErr *quotaExceededError
+	var fullErr *categoryFullError
+	switch {
+	case errors.As(err, &formatErr):
+		respondWithError(w, http.StatusUnsupportedMediaType, formatErr.problem)
+	case errors.As(err, &quotaErr):
+		respondWithError(w, http.StatusRequestEntityTooLarge, quotaErr.problem)
+	case errors.As(err, &fullErr):
+		respondWithError(w, http.StatusConflict, fullErr.problem)
+	case errors.Is(err, errCorruptImage):
+		respondWithError(w, http.StatusBadRequest, errCorruptImage.Error())
+	case errors.Is(err, errStoreFailed):
+		respondWithInternalError(w, "Failed to save file", err)
+	default:
+		respondWithDatabaseError(w, err)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"image/jpeg"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestUploadIgnoresClientExtension(t *testing.T) {
+	user := newTestUser(t)
+	png := testPNG(t, 8, 8, testColor)
+	for _, name := range []string{
+		"x.html",
+		"x.svg",
+		"photo.png.html",
+		"../../x.html",
+		"no-extension",
+		"photo.JPG",
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := uploadFile(t, user.token, "photography", name, png)
+			expectStatus(t, rec, http.StatusCreated)
+
+			var photo PhotoResponse
+			decodeResponse(t, rec, &photo)
+			if !strings.HasSuffix(photo.Filename, ".png") || strings.ContainsAny(photo.Filename, `/\`) {
+				t.Fatalf("stored as %q, want <id>.png", photo.Filename)
+			}
+
+			served := doRequest(t, "GET", "/photos/photography/"+photo.Filename, "", "", nil)
+			expectStatus(t, served, http.StatusOK)
+			if got := served.Header().Get("Content-Type"); got != "image/png" {
+				t.Errorf("served as %q, want image/png", got)
+			}
+		})
+	}
+}
+
+func TestUploadRejectsHTMLNamedAsImage(t *testing.T) {
+	user := newTestUser(t)
+	rec := uploadFile(t, user.token, "photography", "x.png", []byte("<html><script>alert(1)</script></html>"))
+	if rec.Code == http.StatusCreated {
+		t.Fatalf("HTML upload was stored: %s", rec.Body.String())
+	}
+}
+
+func TestUploadRejectsCorruptImage(t *testing.T) {
+	user := newTestUser(t)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 64, 64)), nil); err != nil {
+		t.Fatal(err)
+	}
+	truncated := buf.Bytes()[:buf.Len()/2]
+	before, err := os.ReadDir(filepath.Join(photoDir, "photography"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	contentType, body := multipartBody(t, "truncated.jpg", "image/jpeg", truncated, map[string]string{
+		uploadTitleField:    "Truncated",
+		uploadCategoryField: "photography",
+		"altText":           "A truncated photo",
+	})
+	rec := doRequest(t, "POST", "/api/photos/upload", user.token, contentType, body)
+	expectStatus(t, rec, http.StatusBadRequest)
+	if resp := decodeResponse(t, rec, nil); resp.Message != errCorruptImage.Error() {
+		t.Errorf("message = %q, want %q", resp.Message, errCorruptImage.Error())
+	}
+
+	var rows int
+	if err := dbConn.QueryRow(`SELECT COUNT(*) FROM photos WHERE user_id = ?`, user.id).Scan(&rows); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 0 {
+		t.Errorf("stored %d rows for the corrupt upload", rows)
+	}
+	after, err := os.ReadDir(filepath.Join(photoDir, "photography"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(before) {
+		t.Errorf("photography holds %d entries after the upload, want %d", len(after), len(before))
+	}
+	temps, err := filepath.Glob(filepath.Join(photoDir, ".upload-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(temps) != 0 {
+		t.Errorf("corrupt upload left %v behind", temps)
+	}
+}
+
+func TestSweepUploadTemps(t *testing.T) {
+	stale := writeOrphan(t, ".upload-abandoned", true)
+	active := writeOrphan(t, ".upload-active", false)
+	other := writeOrphan(t, ".not-an-upload", true)
+
+	sweepUploadTemps()
+	if _, err := os.Stat(filepath.Join(photoDir, stale)); !os.IsNotExist(err) {
+		t.Errorf("stale upload not removed: %v", err)
+	}
+	for _, path := range []string{active, other} {
+		if _, err := os.Stat(filepath.Join(photoDir, path)); err != nil {
+			t.Errorf("%s removed: %v", path, err)
+		}
+	}
+}
+
+func TestUploadRemovesTempFile(t *testing.T) {
+	user := newTestUser(t)
+	for _, file := range [][]byte{testPNG(t, 8, 8, testColor), []byte("not an image")} {
+		uploadFile(t, user.token, "photography", "photo.png", file)
+		temps, err := filepath.Glob(filepath.Join(photoDir, ".upload-*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(temps) != 0 {
+			t.Errorf("upload left %v behind", temps)
+		}
+	}
+}
+
+// repeatReader yields n bytes of a repeating pattern without holding them
+type repeatReader struct {
+	n int64
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	for i := range p {
+		p[i] = byte(r.n - int64(i))
+	}
+	r.n -= int64(len(p))
+	return len(p), nil
+}
+
+// Stream a multipart form through readSpooledForm, with the file part
+// written between the text fields
+func readStreamedForm(t *testing.T, file io.Reader, contentType string, maxBytes int64) (*httptest.ResponseRecorder, *uploadForm, bool) {
+	t.Helper()
+	body, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		mw.WriteField("title", "Before the file")
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", `form-data; name="photo"; filename="large.bin"`)
+		h.Set("Content-Type", contentType)
+		part, err := mw.CreatePart(h)
+		if err == nil {
+			_, err = io.Copy(part, file)
+		}
+		if err == nil {
+			err = mw.WriteField("category", "After the file")
+		}
+		if err == nil {
+			err = mw.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req := httptest.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	form, ok := readSpooledForm(rec, req, "photo", true, maxBytes)
+	body.Close()
+	return rec, form, ok
+}
+
+func TestReadSpooledFormStreamsLargeFile(t *testing.T) {
+	const size = 64 << 20
+	want := sha256.New()
+	io.Copy(want, &repeatReader{n: size})
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	rec, form, ok := readStreamedForm(t, &repeatReader{n: size}, "image/png", 0)
+	runtime.ReadMemStats(&after)
+	if !ok {
+		t.Fatalf("readSpooledForm() failed: %d %s", rec.Code, rec.Body)
+	}
+	defer form.cleanup()
+
+	// The file passes through fixed buffers rather than being held
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/8 {
+		t.Errorf("allocated %d bytes reading a %d byte upload", allocated, size)
+	}
+
+	if form.size != size || form.filename != "large.bin" || form.contentType != "image/png" {
+		t.Errorf("form = %d bytes of %q as %s", form.size, form.filename, form.contentType)
+	}
+	if form.value("title") != "Before the file" || form.value("category") != "After the file" {
+		t.Errorf("fields = %v, want those on both sides of the file", form.fields)
+	}
+	spooled, err := os.Open(form.tempPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := sha256.New()
+	io.Copy(got, spooled)
+	spooled.Close()
+	if !bytes.Equal(got.Sum(nil), want.Sum(nil)) {
+		t.Error("spooled file differs from the upload")
+	}
+
+	path := form.tempPath
+	form.cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("cleanup left %s: %v", path, err)
+	}
+}
+
+func TestReadSpooledFormErrors(t *testing.T) {
+	rec, _, ok := readStreamedForm(t, &repeatReader{n: 1 << 20}, "image/png", 64<<10)
+	if ok {
+		t.Fatal("oversized upload accepted")
+	}
+	expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+
+	rec, _, ok = readStreamedForm(t, strings.NewReader("<html></html>"), "text/html", 0)
+	if ok {
+		t.Fatal("non-image upload accepted")
+	}
+	expectStatus(t, rec, http.StatusBadRequest)
+
+	matches, err := filepath.Glob(filepath.Join(photoDir, ".upload-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("failed uploads left %v behind", matches)
+	}
+}
+
+// Switch the upload form's field names until the test ends
+func useUploadFieldNames(t *testing.T, file, title, category string) {
+	t.Helper()
+	oldFile, oldTitle, oldCategory := uploadFileField, uploadTitleField, uploadCategoryField
+	t.Cleanup(func() { uploadFileField, uploadTitleField, uploadCategoryField = oldFile, oldTitle, oldCategory })
+	uploadFileField, uploadTitleField, uploadCategoryField = file, title, category
+}
+
+func TestUploadFieldNames(t *testing.T) {
+	user := newTestUser(t)
+	file := testPNG(t, 8, 8, testColor)
+	defaultType, defaultBody := multipartBody(t, "photo.png", "image/png", file, map[string]string{
+		"title":    "Default names",
+		"category": "photography",
+	})
+
+	useUploadFieldNames(t, "image", "name", "section")
+	contentType, body := multipartBody(t, "photo.png", "image/png", file, map[string]string{
+		"name":    "Custom names",
+		"section": "photography",
+	})
+	rec := doRequest(t, "POST", "/api/photos/upload", user.token, contentType, body)
+	expectStatus(t, rec, http.StatusCreated)
+	var photo PhotoResponse
+	decodeResponse(t, rec, &photo)
+	if photo.Title != "Custom names" || photo.Category != "photography" {
+		t.Errorf("uploaded %q to %q, want Custom names in photography", photo.Title, photo.Category)
+	}
+
+	// The default names no longer count
+	rec = doRequest(t, "POST", "/api/photos/upload", user.token, defaultType, defaultBody)
+	expectStatus(t, rec, http.StatusBadRequest)
+	if resp := decodeResponse(t, rec, nil); !strings.Contains(resp.Message, `"image"`) {
+		t.Errorf("message %q, want it to name the image field", resp.Message)
+	}
+
+	contentType, body = multipartBody(t, "photo.png", "image/png", file, map[string]string{
+		"name":     "No section",
+		"category": "photography",
+	})
+	rec = doRequest(t, "POST", "/api/photos/upload", user.token, contentType, body)
+	expectStatus(t, rec, http.StatusBadRequest)
+	if resp := decodeResponse(t, rec, nil); resp.Errors["section"] == "" {
+		t.Errorf("errors %v, want one for section", resp.Errors)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// Longest search term accepted by the admin user search
+const maxUserSearchLength = 100
+
+// AdminUserResponse describes a user to admins. Password hashes are never
+// included.
+type AdminUserResponse struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+// Escape LIKE wildcards in a search term and match it anywhere in the value
+func likeContains(term string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(term)
+	return "%" + escaped + "%"
+}
+
+// Find users whose name or email contains q, ignoring case (admin only).
+// Results are ordered by name and paginated like other lists.
+func searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		respondWithError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	if len(q) > maxUserSearchLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("q must be at most %d characters", maxUserSearchLength))
+		return
+	}
+
+	page, pageSize, err := parsePagination(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := requestContext(r)
+	pattern := likeContains(q)
+	total, err := queries.CountUsersMatching(ctx, pattern)
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	rows, err := queries.SearchUsers(ctx, db.SearchUsersParams{
+		Pattern: pattern,
+		Limit:   int64(pageSize),
+		Offset:  pageOffset(page, pageSize),
+	})
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	users := []AdminUserResponse{}
+	for _, row := range rows {
+		user := AdminUserResponse{
+			ID:    row.ID,
+			Name:  row.Name,
+			Email: row.Email,
+			Role:  row.Role,
+		}
+		if row.CreatedAt.Valid {
+			user.CreatedAt = formatTimestamp(row.CreatedAt.Time)
+		}
+		users = append(users, user)
+	}
+
+	setPaginationHeaders(w, r, page, pageSize, total)
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data:    newPaginatedResponse(users, page, pageSize, total),
+	})
+}
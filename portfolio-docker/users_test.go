@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// userPage is a page of the admin user search
+type userPage struct {
+	Items   []AdminUserResponse `json:"items"`
+	Total   int64               `json:"total"`
+	HasMore bool                `json:"hasMore"`
+}
+
+func TestSearchUsers(t *testing.T) {
+	admin := newTestAdmin(t)
+	user := newTestUser(t)
+	marker := strings.ToLower(randomPhotoID()[:10])
+	for _, creds := range []Credentials{
+		{Name: "Ada " + marker, Email: "ada-" + marker + "@example.com"},
+		{Name: "Grace", Email: "grace." + marker + "@example.com"},
+		{Name: "Alan", Email: "alan-" + randomPhotoID()[:10] + "@example.com"},
+	} {
+		creds.Password = "correct horse battery staple"
+		expectStatus(t, doJSON(t, "POST", "/api/register", "", creds), http.StatusCreated)
+	}
+
+	search := func(query string) userPage {
+		t.Helper()
+		rec := doJSON(t, "GET", "/api/admin/users/search?"+query, admin.token, nil)
+		expectStatus(t, rec, http.StatusOK)
+		if strings.Contains(strings.ToLower(rec.Body.String()), "password") {
+			t.Errorf("search response mentions passwords: %s", rec.Body)
+		}
+		var page userPage
+		decodeResponse(t, rec, &page)
+		return page
+	}
+
+	// Matches names and emails, ignoring case, ordered by name
+	page := search("q=" + strings.ToUpper(marker))
+	if page.Total != 2 || len(page.Items) != 2 || page.Items[0].Name != "Ada "+marker || page.Items[1].Name != "Grace" {
+		t.Errorf("search for %s = %+v, want Ada and Grace", marker, page)
+	}
+	page = search("q=" + marker + "&pageSize=1&page=2")
+	if page.Total != 2 || len(page.Items) != 1 || page.Items[0].Name != "Grace" || page.HasMore {
+		t.Errorf("second page = %+v, want Grace alone", page)
+	}
+
+	// LIKE wildcards in the query match only themselves
+	for _, q := range []string{"_" + marker, marker[:3] + "%" + marker[4:]} {
+		if page := search("q=" + url.QueryEscape(q)); page.Total != 0 {
+			t.Errorf("search for %q = %+v, want no users", q, page)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		query  string
+		status int
+	}{
+		{"non-admin", user.token, "q=" + marker, http.StatusForbidden},
+		{"signed out", "", "q=" + marker, http.StatusUnauthorized},
+		{"no query", admin.token, "q=+", http.StatusBadRequest},
+		{"long query", admin.token, "q=" + strings.Repeat("a", maxUserSearchLength+1), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := doJSON(t, "GET", "/api/admin/users/search?"+tt.query, tt.token, nil)
+			expectStatus(t, rec, tt.status)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// PhotoVariant is one stored rendition of a photo. Kind is "full" for the
+// photo itself, "thumbnail", "preset" for a THUMBNAIL_PRESETS size,
+// "original" for an archived upload, or "resized" for a cached resize of the
+// current version.
+type PhotoVariant struct {
+	Kind      string `json:"kind"`
+	URL       string `json:"url"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
+// PhotoVariants lists the renditions of a photo that exist on disk
+type PhotoVariants struct {
+	ID       string         `json:"id"`
+	Variants []PhotoVariant `json:"variants"`
+}
+
+// Describe the image file at path, or report false when it doesn't exist.
+// Dimensions are left zero for files the server can't decode.
+func statVariant(kind, path, link string) (PhotoVariant, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return PhotoVariant{}, false
+	}
+
+	variant := PhotoVariant{Kind: kind, URL: link, SizeBytes: info.Size()}
+	if f, err := os.Open(path); err == nil {
+		if config, _, err := image.DecodeConfig(f); err == nil {
+			variant.Width, variant.Height = config.Width, config.Height
+		}
+		f.Close()
+	}
+	return variant, true
+}
+
+// List the renditions of a photo: the photo itself, its thumbnail, presets
+// and archived original when present, and the resizes cached for its current
+// version, so it can be checked that processing worked
+func photoVariantsHandler(w http.ResponseWriter, r *http.Request) {
+	photo, err := queries.GetPhoto(requestContext(r), mux.Vars(r)["id"])
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !photoVisible(r, photo)) {
+		respondWithError(w, http.StatusNotFound, "Photo not found")
+		return
+	}
+	if err != nil {
+		respondWithDatabaseError(w, err)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	baseURL := fmt.Sprintf("%s://%s", scheme, r.Host)
+	categoryDir := filepath.Join(photoDir, photo.Category)
+	categoryURL := baseURL + "/photos/" + photo.Category
+
+	variants := []PhotoVariant{}
+	add := func(kind, path, link string) {
+		if variant, ok := statVariant(kind, path, link); ok {
+			variants = append(variants, variant)
+		}
+	}
+	add("full", filepath.Join(categoryDir, photo.Filename), categoryURL+"/"+photo.Filename)
+	if photo.Thumbnail != "" {
+		add("thumbnail", filepath.Join(categoryDir, photo.Thumbnail), categoryURL+"/"+filepath.ToSlash(photo.Thumbnail))
+	}
+	for _, name := range presetFiles(photo.ID, photo.Presets) {
+		add("preset", filepath.Join(categoryDir, name), categoryURL+"/"+filepath.ToSlash(name))
+	}
+	if photo.Original != "" {
+		add("original", filepath.Join(categoryDir, photo.Original), categoryURL+"/"+filepath.ToSlash(photo.Original))
+	}
+
+	// Cached resizes are named ID-vVERSION-WIDTHxHEIGHT-FIT, after the
+	// request that produced them; resizes of earlier versions are stale
+	prefix := fmt.Sprintf("%s-v%d-", photo.ID, photo.Version)
+	matches, _ := filepath.Glob(filepath.Join(photoDir, resizeCacheDir, prefix+"*"))
+	sort.Strings(matches)
+	for _, path := range matches {
+		name := filepath.Base(path)
+		if strings.Contains(name, ".tmp") {
+			continue
+		}
+		var width, height int
+		var fit string
+		key := strings.TrimSuffix(strings.TrimPrefix(name, prefix), filepath.Ext(name))
+		if _, err := fmt.Sscanf(strings.Replace(key, "-", " ", 1), "%dx%d %s", &width, &height, &fit); err != nil {
+			continue
+		}
+
+		query := url.Values{"fit": {fit}}
+		if width > 0 {
+			query.Set("w", strconv.Itoa(width))
+		}
+		if height > 0 {
+			query.Set("h", strconv.Itoa(height))
+		}
+		add("resized", path, baseURL+"/api/photos/"+photo.ID+"/image?"+query.Encode())
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data: PhotoVariants{
+			ID:       photo.ID,
+			Variants: variants,
+		},
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+// Generate the presets in spec until the test ends
+func usePresets(t *testing.T, spec string) {
+	t.Helper()
+	presets, err := parsePresets(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPresets, oldSpec := thumbnailPresets, presetsSpec
+	thumbnailPresets, presetsSpec = presets, formatPresets(presets)
+	t.Cleanup(func() { thumbnailPresets, presetsSpec = oldPresets, oldSpec })
+}
+
+func TestPhotoVariants(t *testing.T) {
+	user := newTestUser(t)
+	usePresets(t, "sm=4,md=16")
+	oldDimension, oldKeep := maxImageDimension, keepOriginals
+	maxImageDimension, keepOriginals = 32, true
+	t.Cleanup(func() { maxImageDimension, keepOriginals = oldDimension, oldKeep })
+
+	rec := uploadFile(t, user.token, "photography", "wide.png", testPNG(t, 64, 32, testColor))
+	expectStatus(t, rec, http.StatusCreated)
+	var photo PhotoResponse
+	decodeResponse(t, rec, &photo)
+	expectStatus(t, doRequest(t, "GET", "/api/photos/"+photo.ID+"/image?w=10", "", "", nil), http.StatusOK)
+
+	rec = doJSON(t, "GET", "/api/photos/"+photo.ID+"/variants", "", nil)
+	expectStatus(t, rec, http.StatusOK)
+	var listed PhotoVariants
+	decodeResponse(t, rec, &listed)
+
+	type size struct{ w, h int }
+	want := map[string][]size{
+		"full":      {{32, 16}},
+		"thumbnail": nil,
+		"preset":    {{16, 8}, {4, 2}}, // Ordered by name, md then sm
+		"original":  {{64, 32}},
+		"resized":   {{10, 5}},
+	}
+	got := map[string][]size{}
+	for _, variant := range listed.Variants {
+		if variant.URL == "" || variant.SizeBytes == 0 {
+			t.Errorf("variant %+v lacks a URL or size", variant)
+		}
+		got[variant.Kind] = append(got[variant.Kind], size{variant.Width, variant.Height})
+	}
+	for kind, sizes := range want {
+		if len(got[kind]) == 0 {
+			t.Errorf("no %s variant in %+v", kind, listed.Variants)
+			continue
+		}
+		if sizes == nil {
+			continue
+		}
+		if len(got[kind]) != len(sizes) {
+			t.Errorf("%s variants = %v, want %v", kind, got[kind], sizes)
+			continue
+		}
+		for i := range sizes {
+			if got[kind][i] != sizes[i] {
+				t.Errorf("%s variants = %v, want %v", kind, got[kind], sizes)
+				break
+			}
+		}
+	}
+
+	expectStatus(t, doJSON(t, "GET", "/api/photos/no-such-photo/variants", "", nil), http.StatusNotFound)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	db "github.com/meduaq/portfolio-backend/db/sqlc"
+)
+
+// PhotoStats reports how often a photo has been viewed
+type PhotoStats struct {
+	ID    string `json:"id"`
+	Views int64  `json:"views"`
+}
+
+// Views not yet written to the database, by photo ID, and when each client
+// address last counted as viewing each photo
+var (
+	viewsMu      sync.Mutex
+	pendingViews = map[string]int64{}
+	lastViewedBy = map[string]time.Time{}
+)
+
+// Address of the client making a request, for telling viewers apart
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Count a view of a photo, unless the same client viewed it within
+// VIEW_DEBOUNCE. Views are held in memory and written in batches, so a
+// crash loses at most VIEW_FLUSH_INTERVAL worth of them.
+func recordView(r *http.Request, photoID string) {
+	key := clientIP(r) + " " + photoID
+
+	viewsMu.Lock()
+	defer viewsMu.Unlock()
+
+	if last, ok := lastViewedBy[key]; ok && time.Since(last) < viewDebounce {
+		return
+	}
+	lastViewedBy[key] = time.Now()
+	pendingViews[photoID]++
+}
+
+// Views of a photo counted but not yet written
+func unflushedViews(photoID string) int64 {
+	viewsMu.Lock()
+	defer viewsMu.Unlock()
+	return pendingViews[photoID]
+}
+
+// Write pending view counts every VIEW_FLUSH_INTERVAL
+func startViewFlusher() {
+	go func() {
+		ticker := time.NewTicker(viewFlushInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := flushViews(context.Background()); err != nil {
+				slog.Error("Failed to save view counts", "error", err)
+			}
+		}
+	}()
+}
+
+// Write the pending view counts in one transaction, and forget viewers whose
+// debounce window has passed. Counts that fail to save are kept for the next
+// flush.
+func flushViews(ctx context.Context) error {
+	viewsMu.Lock()
+	batch := pendingViews
+	pendingViews = map[string]int64{}
+	for key, last := range lastViewedBy {
+		if time.Since(last) >= viewDebounce {
+			delete(lastViewedBy, key)
+		}
+	}
+	viewsMu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := saveViews(ctx, batch)
+	if err != nil {
+		viewsMu.Lock()
+		for photoID, views := range batch {
+			pendingViews[photoID] += views
+		}
+		viewsMu.Unlock()
+	}
+	return err
+}
+
+func saveViews(ctx context.Context, batch map[string]int64) error {
+	tx, err := dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	qtx := queries.WithTx(tx)
+	for photoID, views := range batch {
+		err := qtx.AddPhotoViews(ctx, db.AddPhotoViewsParams{
+			Views: views,
+			ID:    photoID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// countViews wraps the static photo file server, counting a view for each
+// full-size photo file served. Thumbnails, archived originals and other
+// files in subdirectories aren't views of the photo.
+func countViews(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		category, filename, ok := strings.Cut(strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/"), "/")
+		if !ok || rec.status >= 400 || !isValidCategory(category) ||
+			strings.Contains(filename, "/") || strings.HasPrefix(filename, ".") {
+			return
+		}
+		recordView(r, strings.TrimSuffix(filename, path.Ext(filename)))
+	})
+}
+
+// Report a photo's view count (owner only)
+func photoStatsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value("userID").(int64)
+	photo, ok := loadOwnedPhoto(w, requestContext(r), mux.Vars(r)["id"], userID)
+	if !ok {
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, Response{
+		Success: true,
+		Data: PhotoStats{
+			ID:    photo.ID,
+			Views: photo.Views + unflushedViews(photo.ID),
+		},
+	})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Fetch a file under /photos/ from the given client address
+func viewFile(t *testing.T, path, remoteAddr string) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/photos/"+path, nil)
+	req.RemoteAddr = remoteAddr
+	rec := httptest.NewRecorder()
+	testHandler.ServeHTTP(rec, req)
+	expectStatus(t, rec, http.StatusOK)
+}
+
+// A photo's view count as its owner sees it
+func photoViews(t *testing.T, token, id string) int64 {
+	t.Helper()
+	rec := doJSON(t, "GET", "/api/photos/"+id+"/stats", token, nil)
+	expectStatus(t, rec, http.StatusOK)
+	var stats PhotoStats
+	decodeResponse(t, rec, &stats)
+	return stats.Views
+}
+
+func TestViewCounter(t *testing.T) {
+	user := newTestUser(t)
+	other := newTestUser(t)
+	photo := uploadTestPhoto(t, user.token, "photography")
+	file := photo.Category + "/" + photo.Filename
+
+	viewFile(t, file, "192.0.2.1:1234")
+	viewFile(t, file, "192.0.2.1:5678")
+	viewFile(t, photo.Category+"/"+thumbnailDir+"/"+photo.ID+".jpg", "192.0.2.2:1234")
+	if views := photoViews(t, user.token, photo.ID); views != 1 {
+		t.Errorf("views = %d after repeat and thumbnail loads, want 1", views)
+	}
+	viewFile(t, file, "192.0.2.3:1234")
+	if views := photoViews(t, user.token, photo.ID); views != 2 {
+		t.Errorf("views = %d after a second viewer, want 2", views)
+	}
+
+	// Counts survive being written to the database
+	if err := flushViews(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if views := photoViews(t, user.token, photo.ID); views != 2 {
+		t.Errorf("views = %d after flushing, want 2", views)
+	}
+	row, err := queries.GetPhoto(context.Background(), photo.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if row.Views != 2 {
+		t.Errorf("stored views = %d, want 2", row.Views)
+	}
+
+	old := viewDebounce
+	viewDebounce = 0
+	t.Cleanup(func() { viewDebounce = old })
+	viewFile(t, file, "192.0.2.1:1234")
+	if views := photoViews(t, user.token, photo.ID); views != 3 {
+		t.Errorf("views = %d once the debounce passed, want 3", views)
+	}
+
+	rec := doJSON(t, "GET", "/api/photos/"+photo.ID+"/stats", other.token, nil)
+	expectStatus(t, rec, http.StatusForbidden)
+}